@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwksRefreshInterval bounds how often the key set is fetched again for an
+// ID token signed with a key not seen yet, as providers rotate keys.
+const jwksRefreshInterval = time.Minute
+
+// jwk is a key of the provider's key set in the fields in use.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// signingKey is a provider key that can check ID token signatures.
+type signingKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// verifySignature checks the JWS signature of an ID token against the
+// provider's published keys. Only RS256 and ES256 are accepted.
+func (p *Provider) verifySignature(ctx context.Context, meta *metadata, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed id token")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errors.New("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return errors.New("malformed id token")
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return fmt.Errorf("id token signed with unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed id token")
+	}
+	key, err := p.signingKey(ctx, meta, header.Kid, header.Alg)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(pub, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return errors.New("invalid id token signature")
+}
+
+// signingKey returns the provider key with kid for alg, fetching the key set
+// again when it is not known yet. Tokens without a kid match the only key
+// for their algorithm.
+func (p *Provider) signingKey(ctx context.Context, meta *metadata, kid, alg string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := findKey(p.keys, kid, alg); ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("id token signed with unknown key %q", kid)
+	}
+	keys, err := p.fetchKeys(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+	if key, ok := findKey(p.keys, kid, alg); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("id token signed with unknown key %q", kid)
+}
+
+func findKey(keys []signingKey, kid, alg string) (crypto.PublicKey, bool) {
+	var found crypto.PublicKey
+	matches := 0
+	for _, key := range keys {
+		if key.alg != alg || (kid != "" && key.kid != kid) {
+			continue
+		}
+		found = key.key
+		matches++
+	}
+	return found, matches == 1
+}
+
+// fetchKeys downloads the provider's key set and keeps the RSA and P-256
+// keys meant for signatures.
+func (p *Provider) fetchKeys(ctx context.Context, meta *metadata) ([]signingKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("key set: %w", err)
+	}
+	keys := make([]signingKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, alg, err := k.publicKey()
+		if err != nil || (k.Alg != "" && k.Alg != alg) {
+			continue
+		}
+		keys = append(keys, signingKey{kid: k.Kid, alg: alg, key: key})
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA or P-256 key and the algorithm it signs with.
+func (k jwk) publicKey() (crypto.PublicKey, string, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, "", errors.New("invalid rsa exponent")
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, "RS256", nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, "", fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, "", errors.New("invalid p-256 point")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, "ES256", nil
+	}
+	return nil, "", fmt.Errorf("unsupported key type %q", k.Kty)
+}
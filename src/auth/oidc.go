@@ -0,0 +1,332 @@
+// Package auth signs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE, and keeps them signed in with signed
+// session cookies.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/sealed"
+)
+
+// loginTTL bounds the time between starting a login and its callback.
+const loginTTL = 10 * time.Minute
+
+// maxResponseBytes bounds the provider responses read.
+const maxResponseBytes = 1 << 20
+
+var (
+	ErrLoginState   = errors.New("login state mismatch")
+	ErrLoginExpired = errors.New("login expired")
+)
+
+// Config identifies the wiki as a client of the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// Secret signs the cookie that carries the login state to the callback.
+	Secret []byte
+}
+
+// metadata is the part of the provider's discovery document in use.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// login is what the login cookie remembers between sending a user to the
+// provider and the callback.
+type login struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ReturnTo  string `json:"returnTo"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Provider talks to an OpenID Connect provider. Its discovery document is
+// fetched on first use, so the wiki starts while the provider is down.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        []signingKey
+	keysFetched time.Time
+}
+
+// NewProvider returns a provider for cfg that makes requests with client.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Host is the host name of the issuer.
+func (p *Provider) Host() string {
+	if parsed, err := url.Parse(p.cfg.Issuer); err == nil {
+		return parsed.Hostname()
+	}
+	return p.cfg.Issuer
+}
+
+// Begin starts a login that returns the user to returnTo. It returns the
+// provider URL to redirect to, and the value of the login cookie the
+// callback needs.
+func (p *Provider) Begin(ctx context.Context, returnTo string, now time.Time) (string, string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state := login{
+		State:     randomString(),
+		Nonce:     randomString(),
+		Verifier:  randomString(),
+		ReturnTo:  returnTo,
+		ExpiresAt: now.Add(loginTTL).Unix(),
+	}
+	cookie, err := sealed.Seal(p.cfg.Secret, loginKind, state)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	target := meta.AuthorizationEndpoint
+	if strings.Contains(target, "?") {
+		target += "&"
+	} else {
+		target += "?"
+	}
+	return target + query.Encode(), cookie, nil
+}
+
+// Finish completes a login from the callback's state and code, and the
+// login cookie set by Begin. It returns the signed-in identity and where
+// the user asked to return to.
+func (p *Provider) Finish(ctx context.Context, cookie, state, code string, now time.Time) (Identity, string, error) {
+	var pending login
+	if err := open(p.cfg.Secret, loginKind, cookie, &pending); err != nil {
+		return Identity{}, "", err
+	}
+	if pending.State == "" || state != pending.State {
+		return Identity{}, "", ErrLoginState
+	}
+	if now.Unix() >= pending.ExpiresAt {
+		return Identity{}, "", ErrLoginExpired
+	}
+	if code == "" {
+		return Identity{}, "", errors.New("authorization code missing")
+	}
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return Identity{}, "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {pending.Verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		return Identity{}, "", fmt.Errorf("token request: %w", err)
+	}
+
+	if err := p.verifySignature(ctx, meta, tokens.IDToken); err != nil {
+		return Identity{}, "", err
+	}
+	identity, err := p.verifyIDToken(meta, tokens.IDToken, pending.Nonce, now)
+	if err != nil {
+		return Identity{}, "", err
+	}
+	if identity.Name == "" && identity.Email == "" && meta.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		if info, err := p.userinfo(ctx, meta, tokens.AccessToken); err == nil && info.Subject == identity.Subject {
+			identity.Name, identity.Email = info.Name, info.Email
+		}
+	}
+	return identity, pending.ReturnTo, nil
+}
+
+// idClaims are the ID token and userinfo claims in use.
+type idClaims struct {
+	Issuer            string   `json:"iss"`
+	Audience          audience `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Subject           string   `json:"sub"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	EmailVerified     *bool    `json:"email_verified"`
+}
+
+func (c idClaims) identity() Identity {
+	identity := Identity{Subject: c.Subject, Name: c.Name}
+	if identity.Name == "" {
+		identity.Name = c.PreferredUsername
+	}
+	// Providers that do not say the address was verified are not taken at
+	// their word, as commits are attributed to it.
+	if c.EmailVerified != nil && *c.EmailVerified {
+		identity.Email = c.Email
+	}
+	return identity
+}
+
+// audience is a JWT "aud" claim, either a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// verifyIDToken checks the claims of an ID token, whose signature
+// verifySignature has checked.
+func (p *Provider) verifyIDToken(meta *metadata, token, nonce string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errors.New("malformed id token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return Identity{}, errors.New("malformed id token")
+	}
+	var claims idClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, errors.New("malformed id token")
+	}
+	switch {
+	case claims.Issuer != meta.Issuer:
+		return Identity{}, fmt.Errorf("id token issued by %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, p.cfg.ClientID):
+		return Identity{}, errors.New("id token not issued for this client")
+	case now.Unix() >= claims.ExpiresAt:
+		return Identity{}, errors.New("id token expired")
+	case claims.Nonce != nonce:
+		return Identity{}, errors.New("id token nonce mismatch")
+	case claims.Subject == "":
+		return Identity{}, errors.New("id token without subject")
+	}
+	return claims.identity(), nil
+}
+
+func (p *Provider) userinfo(ctx context.Context, meta *metadata, accessToken string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.UserinfoEndpoint, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var claims idClaims
+	if err := p.do(req, &claims); err != nil {
+		return Identity{}, fmt.Errorf("userinfo request: %w", err)
+	}
+	return claims.identity(), nil
+}
+
+// metadata returns the provider's discovery document, fetching it once.
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	if err := p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: authorization or token endpoint, or jwks_uri missing")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// do sends req and decodes its JSON response into v.
+func (p *Provider) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s: %s %s", resp.Status, failure.Error, failure.Description)
+		}
+		return errors.New(resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+func randomString() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
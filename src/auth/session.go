@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/sealed"
+)
+
+// Kinds of sealed values, so that session and login cookies cannot stand in
+// for one another, nor for edit tokens signed with the same secret.
+const (
+	sessionKind = "s1"
+	loginKind   = "l1"
+)
+
+var (
+	ErrMalformed = errors.New("malformed session")
+	ErrSignature = errors.New("invalid session signature")
+	ErrExpired   = errors.New("session expired")
+)
+
+// Identity is a user signed in with the provider.
+type Identity struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// DisplayName is the name shown for the user, falling back to the email
+// address and the subject.
+func (i Identity) DisplayName() string {
+	switch {
+	case i.Name != "":
+		return i.Name
+	case i.Email != "":
+		return i.Email
+	}
+	return i.Subject
+}
+
+// Author formats the identity as a git author. Users without an email
+// address get one made up of their subject and host, which is the issuer's
+// host name.
+func (i Identity) Author(host string) string {
+	email := i.Email
+	if email == "" {
+		email = i.Subject + "@" + host
+	}
+	name := strings.NewReplacer("<", "", ">", "", "\n", " ").Replace(i.DisplayName())
+	email = strings.NewReplacer("<", "", ">", "", "\n", "", " ", "").Replace(email)
+	return name + " <" + email + ">"
+}
+
+// session is the content of a session cookie.
+type session struct {
+	Identity
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// Sessions signs and checks session cookies.
+type Sessions struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSessions returns Sessions whose cookies last ttl.
+func NewSessions(secret []byte, ttl time.Duration) *Sessions {
+	return &Sessions{secret: secret, ttl: ttl}
+}
+
+// TTL is how long issued sessions last.
+func (s *Sessions) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue returns a session cookie value for identity.
+func (s *Sessions) Issue(identity Identity, now time.Time) (string, error) {
+	if identity.Subject == "" {
+		return "", errors.New("subject required")
+	}
+	return sealed.Seal(s.secret, sessionKind, session{Identity: identity, IssuedAt: now.Unix(), ExpiresAt: now.Add(s.ttl).Unix()})
+}
+
+// Verify checks the signature and expiry of a session cookie value and
+// returns the identity it was issued for.
+func (s *Sessions) Verify(value string, now time.Time) (Identity, error) {
+	var sess session
+	if err := open(s.secret, sessionKind, value, &sess); err != nil {
+		return Identity{}, err
+	}
+	if sess.Subject == "" {
+		return Identity{}, ErrMalformed
+	}
+	if now.Unix() >= sess.ExpiresAt {
+		return Identity{}, ErrExpired
+	}
+	return sess.Identity, nil
+}
+
+// open checks the signature of a value sealed as kind and decodes it into v.
+func open(secret []byte, kind, value string, v any) error {
+	err := sealed.Open(secret, kind, value, v)
+	switch {
+	case errors.Is(err, sealed.ErrSignature):
+		return ErrSignature
+	case err != nil:
+		return ErrMalformed
+	}
+	return nil
+}
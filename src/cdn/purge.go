@@ -0,0 +1,120 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/metrics"
+	"github.com/iedon/dn42-wiki-go/netutil"
+)
+
+// cloudflareBatch is the number of files Cloudflare accepts per purge call.
+const cloudflareBatch = 30
+
+var (
+	purgedURLs    = metrics.NewCounter("wiki_cdn_purged_urls_total", "URLs purged from the CDN after builds.")
+	purgeFailures = metrics.NewCounter("wiki_cdn_purge_failures_total", "Failed CDN purge requests.")
+)
+
+// Purger sends purge requests for changed public paths.
+type Purger struct {
+	cfg       config.CDNConfig
+	client    *http.Client
+	userAgent string
+}
+
+// New builds a purger from the cdn configuration section.
+func New(cfg *config.Config, userAgent string) (*Purger, error) {
+	client, err := netutil.NewHTTPClient(cfg.Outbound.ClientOptions(30*time.Second, cfg.CDN.SkipRemoteCert))
+	if err != nil {
+		return nil, fmt.Errorf("http client: %w", err)
+	}
+	return &Purger{cfg: cfg.CDN, client: client, userAgent: userAgent}, nil
+}
+
+// Purge invalidates the given site paths, eg. "/Howto/Peering/". Every path
+// is attempted; the returned error joins all failures.
+func (p *Purger) Purge(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = p.cfg.SiteURL + (&url.URL{Path: path}).EscapedPath()
+	}
+	if p.cfg.Provider == config.CDNProviderCloudflare {
+		return p.purgeCloudflare(ctx, urls)
+	}
+	return p.purgeEach(ctx, paths, urls)
+}
+
+func (p *Purger) purgeEach(ctx context.Context, paths, urls []string) error {
+	var errs []error
+	for i, target := range urls {
+		endpoint := strings.NewReplacer(
+			"{url}", url.QueryEscape(target),
+			"{path}", strings.TrimPrefix((&url.URL{Path: paths[i]}).EscapedPath(), "/"),
+		).Replace(p.cfg.PurgeURL)
+		if err := p.send(ctx, p.cfg.Method, endpoint, nil); err != nil {
+			errs = append(errs, fmt.Errorf("purge %s: %w", target, err))
+			continue
+		}
+		purgedURLs.Inc()
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Purger) purgeCloudflare(ctx context.Context, urls []string) error {
+	endpoint := p.cfg.APIBase + "/zones/" + url.PathEscape(p.cfg.ZoneID) + "/purge_cache"
+	var errs []error
+	for start := 0; start < len(urls); start += cloudflareBatch {
+		batch := urls[start:min(start+cloudflareBatch, len(urls))]
+		body, err := json.Marshal(map[string][]string{"files": batch})
+		if err != nil {
+			return err
+		}
+		if err := p.send(ctx, http.MethodPost, endpoint, body); err != nil {
+			errs = append(errs, fmt.Errorf("purge %d urls: %w", len(batch), err))
+			continue
+		}
+		purgedURLs.Add(uint64(len(batch)))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Purger) send(ctx context.Context, method, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		purgeFailures.Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		purgeFailures.Inc()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package challenge verifies the anti-abuse challenges anonymous editors
+// solve before writing: a built-in proof of work, or a CAPTCHA service
+// such as hCaptcha or Cloudflare Turnstile.
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrMissing  = errors.New("challenge response required")
+	ErrRejected = errors.New("challenge not solved")
+)
+
+// Verifier checks the response a client sent for a challenge.
+type Verifier interface {
+	// Provider names the kind of challenge, as the frontend knows it.
+	Provider() string
+	// Verify checks response, sent by the client at remoteIP.
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// SiteVerify checks CAPTCHA responses with the siteverify API shared by
+// hCaptcha and Turnstile.
+type SiteVerify struct {
+	Name   string
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (v *SiteVerify) Provider() string {
+	return v.Name
+}
+
+func (v *SiteVerify) Verify(ctx context.Context, response, remoteIP string) error {
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return ErrMissing
+	}
+	form := url.Values{"secret": {v.Secret}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", v.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: siteverify returned %s", v.Name, resp.Status)
+	}
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return fmt.Errorf("%s: %w", v.Name, err)
+	}
+	if !result.Success {
+		if len(result.ErrorCodes) > 0 {
+			return fmt.Errorf("%w: %s", ErrRejected, strings.Join(result.ErrorCodes, ", "))
+		}
+		return ErrRejected
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoW is a hashcash-style proof of work. Clients fetch a signed challenge
+// and look for a counter that makes the SHA-256 of "challenge:counter"
+// start with Difficulty zero bits. Each challenge is accepted once.
+type PoW struct {
+	Difficulty int
+	TTL        time.Duration
+	secret     []byte
+
+	mu    sync.Mutex
+	spent map[string]time.Time
+}
+
+// NewPoW returns a proof of work verifier signing its challenges with a
+// random key, so challenges do not survive a restart.
+func NewPoW(difficulty int, ttl time.Duration) (*PoW, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &PoW{Difficulty: difficulty, TTL: ttl, secret: secret, spent: make(map[string]time.Time)}, nil
+}
+
+func (p *PoW) Provider() string {
+	return "pow"
+}
+
+// Issue returns a new challenge and when it expires.
+func (p *PoW) Issue(now time.Time) (string, time.Time, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := now.Add(p.TTL)
+	body := fmt.Sprintf("%d.%d.%s", p.Difficulty, expires.Unix(), hex.EncodeToString(nonce))
+	return body + "." + p.sign(body), expires.UTC(), nil
+}
+
+// Verify checks a "challenge:counter" response.
+func (p *PoW) Verify(_ context.Context, response, _ string) error {
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return ErrMissing
+	}
+	challenge, counter, ok := strings.Cut(response, ":")
+	if !ok || counter == "" || len(counter) > 32 {
+		return ErrRejected
+	}
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return ErrRejected
+	}
+	body := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(p.sign(body))) {
+		return ErrRejected
+	}
+	difficulty, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ErrRejected
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrRejected
+	}
+	now := time.Now()
+	expires := time.Unix(expiry, 0)
+	if now.After(expires) {
+		return fmt.Errorf("%w: challenge expired", ErrRejected)
+	}
+	sum := sha256.Sum256([]byte(response))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrRejected
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, at := range p.spent {
+		if now.After(at) {
+			delete(p.spent, key)
+		}
+	}
+	if _, used := p.spent[challenge]; used {
+		return fmt.Errorf("%w: challenge already used", ErrRejected)
+	}
+	p.spent[challenge] = expires
+	return nil
+}
+
+func (p *PoW) sign(body string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/edittoken"
+	"github.com/iedon/dn42-wiki-go/gitutil"
+	"github.com/iedon/dn42-wiki-go/site"
+	"github.com/iedon/dn42-wiki-go/snapshot"
+	"github.com/iedon/dn42-wiki-go/webhook"
+)
+
+// subcommands maps CLI verbs to their entry points. Each receives the
+// remaining arguments and returns the process exit code.
+var subcommands = map[string]func(args []string) int{
+	"snapshot":   runSnapshot,
+	"restore":    runRestore,
+	"trigger":    runTrigger,
+	"edit-token": runEditToken,
+	"fsck":       runFsck,
+}
+
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	cfgPath := fs.String("config", "config.json", "path to configuration file")
+	out := fs.String("out", "", "archive to write (default: wiki-snapshot-<timestamp>.tar.gz)")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	redacted, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "marshal config:", err)
+		return 1
+	}
+
+	target := *out
+	if target == "" {
+		target = fmt.Sprintf("wiki-snapshot-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+	file, err := os.Create(filepath.Clean(target))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	opts := snapshot.Options{
+		RepoDir: cfg.Git.LocalDirectory,
+		Config:  redacted,
+		Stores:  localStores(cfg),
+		Server:  SERVER_SIGNATURE,
+	}
+	if err := snapshot.Create(file, opts); err != nil {
+		_ = file.Close()
+		_ = os.Remove(target)
+		fmt.Fprintln(os.Stderr, "snapshot:", err)
+		return 1
+	}
+	// The archive is only complete once the file is flushed and closed.
+	if err := file.Close(); err != nil {
+		_ = os.Remove(target)
+		fmt.Fprintln(os.Stderr, "snapshot:", err)
+		return 1
+	}
+	fmt.Println(target)
+	return 0
+}
+
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	cfgPath := fs.String("config", "config.json", "path to configuration file describing the destination")
+	in := fs.String("in", "", "archive to restore")
+	configOut := fs.String("config-out", "", "optional path to write the embedded (redacted) configuration")
+	force := fs.Bool("force", false, "restore into non-empty directories")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "restore: -in is required")
+		return 2
+	}
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	file, err := os.Open(filepath.Clean(*in))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	manifest, err := snapshot.Restore(file, snapshot.RestoreOptions{
+		RepoDir:    cfg.Git.LocalDirectory,
+		ConfigPath: *configOut,
+		Stores:     localStores(cfg),
+		Force:      *force,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	fmt.Printf("restored snapshot created %s by %s\n", manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"), manifest.Server)
+	return 0
+}
+
+func runTrigger(args []string) int {
+	fs := flag.NewFlagSet("trigger", flag.ExitOnError)
+	baseURL := fs.String("url", "", "base URL of the target wiki instance")
+	secret := fs.String("secret", "", "webhook secret (default: $DN42_WIKI_SECRET)")
+	adminToken := fs.String("admin-token", "", "call the admin API with this token instead of the webhook (default: $DN42_WIKI_ADMIN_TOKEN)")
+	action := fs.String("action", "pull", "webhook action to invoke, pull or push, or admin report to fetch, pull or build")
+	timeout := fs.Duration("timeout", 5*time.Minute, "request timeout")
+	insecure := fs.Bool("insecure", false, "skip TLS certificate verification")
+	_ = fs.Parse(args)
+
+	target := strings.TrimRight(strings.TrimSpace(*baseURL), "/")
+	if target == "" {
+		fmt.Fprintln(os.Stderr, "trigger: -url is required")
+		return 2
+	}
+	admin := strings.TrimSpace(*adminToken)
+	if admin == "" {
+		admin = strings.TrimSpace(os.Getenv("DN42_WIKI_ADMIN_TOKEN"))
+	}
+	actions := []string{"pull", "push"}
+	if admin != "" {
+		actions = []string{"pull", "build"}
+	}
+	if !slices.Contains(actions, *action) {
+		fmt.Fprintf(os.Stderr, "trigger: unsupported action %q\n", *action)
+		return 2
+	}
+	token := strings.TrimSpace(*secret)
+	if token == "" {
+		token = strings.TrimSpace(os.Getenv("DN42_WIKI_SECRET"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	var req *http.Request
+	var err error
+	if admin != "" {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, target+"/api/admin/"+*action, nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+admin)
+		}
+	} else {
+		req, err = webhookRequest(ctx, target+"/api/webhook/"+*action, token)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "trigger:", err)
+		return 1
+	}
+	req.Header.Set("User-Agent", SERVER_SIGNATURE)
+
+	client := &http.Client{}
+	if *insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "trigger:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	fmt.Println(strings.TrimSpace(string(body)))
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		fmt.Fprintf(os.Stderr, "trigger: %s\n", resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// webhookRequest builds a webhook delivery to target. With a secret, a
+// timestamp and a random nonce are signed instead of sending the secret, so
+// the request cannot be replayed outside the replay window, and triggers
+// sent within the same second do not look like replays of one another.
+func webhookRequest(ctx context.Context, target, secret string) (*http.Request, error) {
+	if secret == "" {
+		return http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{"nonce": hex.EncodeToString(nonce)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Nonce", hex.EncodeToString(nonce))
+	req.Header.Set(webhook.TimestampHeader, timestamp)
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, timestamp, body))
+	return req, nil
+}
+
+func runEditToken(args []string) int {
+	fs := flag.NewFlagSet("edit-token", flag.ExitOnError)
+	cfgPath := fs.String("config", "config.json", "path to configuration file")
+	subject := fs.String("subject", "", "who the token is for, eg. an ASN or nickname")
+	ttl := fs.Duration("ttl", 24*time.Hour, "token lifetime")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !cfg.EditTokens.Enabled {
+		fmt.Fprintln(os.Stderr, "edit-token: editTokens is not enabled in the configuration")
+		return 2
+	}
+	if *ttl > cfg.EditTokens.MaxTTL() {
+		fmt.Fprintf(os.Stderr, "edit-token: -ttl exceeds editTokens.maxTtlSec (%s)\n", cfg.EditTokens.MaxTTL())
+		return 2
+	}
+	token, claims, err := edittoken.Mint([]byte(cfg.EditTokens.Secret), *subject, *ttl, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "edit-token:", err)
+		return 2
+	}
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "valid for %s until %s\n", claims.Subject, claims.Expires().Format(time.RFC3339))
+	return 0
+}
+
+func runFsck(args []string) int {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	cfgPath := fs.String("config", "config.json", "path to configuration file")
+	repoDir := fs.String("repo", "", "repository checkout to check (default: git.localDirectory)")
+	maxBytes := fs.Int64("max-bytes", 0, "report files larger than this (default: pullValidation.maxFileBytes, or 5 MiB)")
+	format := fs.String("format", "json", "report format: json or text")
+	_ = fs.Parse(args)
+
+	if *format != "json" && *format != "text" {
+		fmt.Fprintf(os.Stderr, "fsck: unsupported format %q\n", *format)
+		return 2
+	}
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg.Live = false
+	if *repoDir != "" {
+		cfg.Git.LocalDirectory = *repoDir
+	}
+	limit := *maxBytes
+	if limit == 0 {
+		limit = cfg.PullValidation.MaxFileBytes
+	}
+	if limit == 0 {
+		limit = 5 << 20
+	}
+
+	timeout := time.Duration(cfg.Git.CommandTimeoutSec) * time.Second
+	repo := gitutil.OpenRepository(cfg.Git.BinPath, cfg.Git.Remote, cfg.Git.LocalDirectory, timeout)
+	repo.Hardening = gitHardening(cfg)
+	svc := site.NewService(cfg, repo, nil)
+	report, err := svc.Fsck(context.Background(), site.FsckOptions{MaxFileBytes: limit})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fsck:", err)
+		return 1
+	}
+
+	if *format == "text" {
+		for _, issue := range report.Issues {
+			fmt.Printf("%s\t%s\t%s\n", issue.Check, issue.Path, issue.Detail)
+		}
+		fmt.Fprintf(os.Stderr, "%d pages, %d files, %d issues\n", report.Pages, report.Files, len(report.Issues))
+	} else {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, "fsck:", err)
+			return 1
+		}
+	}
+	if len(report.Issues) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// localStores lists instance-local state that lives outside the repository
+// and should travel with a snapshot, by store name: the page view counts,
+// the access log and file log sinks. Uploads are committed to the
+// repository and travel with it.
+func localStores(cfg *config.Config) map[string]string {
+	stores := make(map[string]string)
+	add := func(name, storePath string) {
+		if strings.TrimSpace(storePath) != "" {
+			stores[name] = filepath.Clean(storePath)
+		}
+	}
+	if cfg.Analytics.Enabled {
+		add("analytics", cfg.Analytics.File)
+	}
+	if cfg.AccessLog.Enabled {
+		add("access-log", cfg.AccessLog.Path)
+	}
+	for i, sink := range cfg.Logging.Sinks {
+		if sink.Type == config.LogSinkFile {
+			add(fmt.Sprintf("log-%d", i), sink.Path)
+		}
+	}
+	return stores
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/netip"
@@ -13,23 +14,70 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/iedon/dn42-wiki-go/gitutil"
+	"github.com/iedon/dn42-wiki-go/netutil"
+	"github.com/iedon/dn42-wiki-go/renderer"
 )
 
 // GitConfig groups Git-related settings.
 type GitConfig struct {
-	BinPath                       string `json:"binPath"`
-	Remote                        string `json:"remote"`
-	LocalDirectory                string `json:"localDirectory"`
-	PullIntervalSec               int    `json:"pullIntervalSec"`
-	Author                        string `json:"author"`
+	BinPath             string   `json:"binPath"`
+	Remote              string   `json:"remote"`
+	PushRemote          string   `json:"pushRemote"`
+	Mirrors             []string `json:"mirrors"`
+	MirrorFailoverAfter int      `json:"mirrorFailoverAfter"`
+	LocalDirectory      string   `json:"localDirectory"`
+	PullIntervalSec     int      `json:"pullIntervalSec"`
+	MinPullIntervalSec  int      `json:"minPullIntervalSec"`
+	MaxPullIntervalSec  int      `json:"maxPullIntervalSec"`
+	Author              string   `json:"author"`
+	Committer           string   `json:"committer"`
+	// Attribution decides whether editors may, must or must not name
+	// themselves as the author of their edits.
+	Attribution                   string `json:"attribution"`
 	CommitMessagePrefix           string `json:"commitMessagePrefix"`
 	CommitMessageAppendRemoteAddr string `json:"commitMessageAppendRemoteAddr"`
 	CommandTimeoutSec             int    `json:"commandTimeoutSec"`
-	repositoryPath                string `json:"-"`
+	// Hardening isolates git from the host's configuration and limits the
+	// transports it may use.
+	Hardening      GitHardening `json:"hardening"`
+	repositoryPath string       `json:"-"`
+}
+
+// GitHardening runs git with a scrubbed environment: the system gitconfig
+// is ignored, inherited GIT_* variables are dropped and only the listed
+// transports are allowed.
+type GitHardening struct {
+	Enabled bool `json:"enabled"`
+	// Protocols are the transports git may use, eg. "https" and "ssh".
+	// Local paths need "file".
+	Protocols []string `json:"protocols"`
+	// IgnoreGlobalConfig also ignores the gitconfig of the user the wiki
+	// runs as.
+	IgnoreGlobalConfig bool `json:"ignoreGlobalConfig"`
+	// PassEnv lists inherited GIT_* variables to keep, eg. GIT_SSH_COMMAND.
+	PassEnv []string `json:"passEnv"`
 }
 
+// GitProtocols are the transports git.hardening.protocols may allow.
+var GitProtocols = []string{"file", "git", "http", "https", "ssh"}
+
+// Editor attribution modes.
+const (
+	// AttributionOptional lets editors name themselves.
+	AttributionOptional = "optional"
+	// AttributionRequired refuses anonymous edits.
+	AttributionRequired = "required"
+	// AttributionForbidden authors every edit as git.author.
+	AttributionForbidden = "forbidden"
+)
+
 // WebhookPollingConfig describes background poll/refresh behaviour for remote notifications.
 type WebhookPollingConfig struct {
 	Enabled            bool          `json:"enabled"`
@@ -37,53 +85,864 @@ type WebhookPollingConfig struct {
 	CallbackURL        string        `json:"callbackUrl"`
 	PollingIntervalSec int           `json:"pollingIntervalSec"`
 	SkipRemoteCert     bool          `json:"skipRemoteCert"`
+	ProtocolVersion    int           `json:"protocolVersion"`
 	interval           time.Duration `json:"-"`
 }
 
 // WebhookConfig controls inbound webhook endpoints and optional remote poll integration.
 type WebhookConfig struct {
-	Enabled bool                 `json:"enabled"`
-	Secret  string               `json:"secret"`
-	Polling WebhookPollingConfig `json:"polling"`
+	Enabled          bool                 `json:"enabled"`
+	Secret           string               `json:"secret"`
+	Polling          WebhookPollingConfig `json:"polling"`
+	HistorySize      int                  `json:"historySize"`
+	ReplayWindowSec  int                  `json:"replayWindowSec"`
+	RequireTimestamp bool                 `json:"requireTimestamp"`
+}
+
+// AdminConfig protects operator-only API endpoints under /api/admin.
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+}
+
+// CDN purge providers.
+const (
+	CDNProviderURL        = "url"
+	CDNProviderCloudflare = "cloudflare"
+)
+
+// CDNConfig purges the public URLs changed by each build from a caching CDN
+// in front of the wiki.
+type CDNConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Provider string `json:"provider"`
+	// SiteURL is the public origin the CDN caches, eg. https://wiki.dn42.
+	SiteURL string `json:"siteUrl"`
+	// PurgeURL is requested once per changed URL by the "url" provider.
+	// {url} and {path} are replaced by the escaped public URL and path.
+	PurgeURL string `json:"purgeUrl"`
+	Method   string `json:"method"`
+	// APIBase, ZoneID and Token address the Cloudflare (or compatible) API.
+	APIBase        string `json:"apiBase"`
+	ZoneID         string `json:"zoneId"`
+	Token          string `json:"token"`
+	SkipRemoteCert bool   `json:"skipRemoteCert"`
+}
+
+// PullValidationConfig checks every pulled upstream commit before it is
+// published. A failing commit is rolled back so the previous content keeps
+// being served until upstream is fixed.
+type PullValidationConfig struct {
+	Enabled      bool  `json:"enabled"`
+	MaxFileBytes int64 `json:"maxFileBytes"`
+	CheckLinks   bool  `json:"checkLinks"`
+	CheckAnchors bool  `json:"checkAnchors"`
+}
+
+// ReplicaConfig turns the instance into a read-only mirror that forwards
+// write API calls to a primary instance.
+type ReplicaConfig struct {
+	Enabled        bool   `json:"enabled"`
+	PrimaryURL     string `json:"primaryUrl"`
+	SkipRemoteCert bool   `json:"skipRemoteCert"`
+}
+
+// MetricsConfig controls the Prometheus-compatible /metrics endpoint.
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+}
+
+// CacheConfig bounds in-memory caches so large wikis fit on small hosts.
+type CacheConfig struct {
+	MaxRenderedPages    int `json:"maxRenderedPages"`
+	MaxSearchIndexBytes int `json:"maxSearchIndexBytes"`
+	// RenderDir persists rendered documents across restarts when set.
+	RenderDir         string `json:"renderDir"`
+	MaxRenderDirBytes int64  `json:"maxRenderDirBytes"`
+}
+
+// RenderConfig selects content transforms applied around Markdown rendering
+// and external commands that render additional formats.
+type RenderConfig struct {
+	Transforms []string                 `json:"transforms"`
+	Formats    []string                 `json:"formats"`
+	Viewers    []string                 `json:"viewers"`
+	External   []ExternalRendererConfig `json:"external"`
+	Math       bool                     `json:"math"`
+	Minify     bool                     `json:"minify"`
+	// Variables are substituted for {{NAME}} placeholders by the
+	// "variables" transform.
+	Variables map[string]string `json:"variables"`
+	// Interwiki maps link prefixes, as in [[reg:AS4242420000]], to the URL
+	// of another site, where $1 stands for the rest of the link target.
+	Interwiki map[string]string `json:"interwiki"`
+	// Concurrency bounds the documents rendered in parallel by a build.
+	Concurrency int `json:"concurrency"`
+	// TitleFromHeading titles pages after their first H1 rather than
+	// their file name.
+	TitleFromHeading bool `json:"titleFromHeading"`
+	// FormatOnSave normalizes the Markdown layout of pages saved from the
+	// editor, as /api/format does.
+	FormatOnSave bool `json:"formatOnSave"`
+	// SlowestPages is how many of the pages that took a build longest are
+	// reported. Negative disables timing.
+	SlowestPages int `json:"slowestPages"`
+}
+
+// ExternalRendererConfig delegates fenced code blocks or whole files to a
+// command reading the source on stdin and writing HTML to stdout.
+type ExternalRendererConfig struct {
+	Name       string   `json:"name"`
+	Command    []string `json:"command"`
+	Fences     []string `json:"fences"`
+	Extensions []string `json:"extensions"`
+	TimeoutSec int      `json:"timeoutSec"`
+}
+
+// RecentChangesConfig sizes the generated recent changes page.
+type RecentChangesConfig struct {
+	// Limit is the number of commits inspected; negative disables the page.
+	Limit int `json:"limit"`
+}
+
+// AnalyticsConfig counts page views on the wiki itself. Only the number of
+// views of each page per day is kept: no cookies, addresses or referrers.
+type AnalyticsConfig struct {
+	Enabled bool `json:"enabled"`
+	// File persists the counts across restarts.
+	File string `json:"file"`
+	// RetentionDays is how many days of counts are kept.
+	RetentionDays int `json:"retentionDays"`
+	// FlushSec is how often the counts are written to File.
+	FlushSec int `json:"flushSec"`
+}
+
+// SearchConfig tunes the client side search index.
+type SearchConfig struct {
+	// SnippetChars is how much of each page's text the index carries for
+	// result excerpts; negative leaves excerpts out.
+	SnippetChars int `json:"snippetChars"`
+}
+
+// SummaryConfig chooses where page summaries, used in listings, search
+// results and meta descriptions, come from.
+type SummaryConfig struct {
+	// Sources are tried in order; the first one a page has wins.
+	Sources []string `json:"sources"`
+	// MaxChars caps summaries, cut at a word boundary where there is one.
+	MaxChars int `json:"maxChars"`
+}
+
+// Summary sources.
+const (
+	// SummaryDescription is the description of the front matter.
+	SummaryDescription = "description"
+	// SummaryMore is the text before a <!--more--> marker.
+	SummaryMore = "more"
+	// SummaryParagraph is the first paragraph.
+	SummaryParagraph = "paragraph"
+	// SummaryText is the start of the page text.
+	SummaryText = "text"
+)
+
+// UIConfig tunes the bundled frontend, which reads it from /api/ui-config.
+type UIConfig struct {
+	// Shortcuts maps frontend actions to single keys; an empty key turns
+	// the shortcut off.
+	Shortcuts map[string]string `json:"shortcuts"`
+}
+
+// ShortcutActions are the actions keyboard shortcuts may be bound to.
+var ShortcutActions = []string{"search", "edit", "new", "history", "rename", "delete", "home"}
+
+// PrecompressConfig writes gzip, and optionally brotli, siblings of text
+// outputs during builds, served to clients accepting those encodings.
+type PrecompressConfig struct {
+	Enabled  bool `json:"enabled"`
+	MinBytes int  `json:"minBytes"`
+	// BrotliCommand reads a file on stdin and writes it brotli-compressed
+	// to stdout, eg. ["brotli", "-c", "-q", "11"].
+	BrotliCommand []string `json:"brotliCommand"`
+}
+
+// Deployment environments. Staging instances are marked as such on every
+// page and kept out of search engines.
+const (
+	EnvironmentProduction = "production"
+	EnvironmentStaging    = "staging"
+
+	stagingRobots = "noindex, nofollow"
+)
+
+// How _Header.md and _Footer.md files in subdirectories combine with the
+// ones above them.
+const (
+	// LayoutCascadeReplace uses the nearest fragment only.
+	LayoutCascadeReplace = "replace"
+	// LayoutCascadeAugment stacks every fragment from the root down.
+	LayoutCascadeAugment = "augment"
+)
+
+// EditTokenConfig requires a signed, expiring token minted by an operator
+// for every write, so edit rights can be handed out without accounts.
+type EditTokenConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Secret    string `json:"secret"`
+	MaxTTLSec int    `json:"maxTtlSec"`
+}
+
+// MaxTTL bounds the lifetime of minted tokens.
+func (e EditTokenConfig) MaxTTL() time.Duration {
+	return time.Duration(e.MaxTTLSec) * time.Second
+}
+
+// AuthConfig signs editors in with an OpenID Connect provider. Writes then
+// need a login, and their commits are authored by the signed-in user rather
+// than git.author.
+type AuthConfig struct {
+	Enabled bool `json:"enabled"`
+	// Issuer is the provider URL its discovery document is served under.
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// RedirectURL is the absolute URL of /auth/callback, as registered with
+	// the provider.
+	RedirectURL string   `json:"redirectUrl"`
+	Scopes      []string `json:"scopes"`
+	// SessionSecret signs the session cookies.
+	SessionSecret  string `json:"sessionSecret"`
+	SessionTTLSec  int    `json:"sessionTtlSec"`
+	CookieName     string `json:"cookieName"`
+	SkipRemoteCert bool   `json:"skipRemoteCert"`
+}
+
+// SessionTTL is how long a login lasts.
+func (a AuthConfig) SessionTTL() time.Duration {
+	return time.Duration(a.SessionTTLSec) * time.Second
+}
+
+// EditQuotaConfig caps how much a single editor may change per UTC day.
+// Editors are told apart by edit token subject, site user or client IP.
+type EditQuotaConfig struct {
+	Enabled    bool  `json:"enabled"`
+	DailyEdits int   `json:"dailyEdits"`
+	DailyBytes int64 `json:"dailyBytes"`
+}
+
+// RateLimitConfig throttles write and preview requests per client IP, so
+// a single client cannot flood a public instance.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled"`
+	// Endpoints overrides the limits of the endpoints in
+	// RateLimitEndpoints.
+	Endpoints map[string]RateLimit `json:"endpoints"`
+}
+
+// RateLimit is a token bucket: Burst requests at once, refilled at
+// PerMinute. A negative PerMinute lifts the limit.
+type RateLimit struct {
+	PerMinute float64 `json:"perMinute"`
+	Burst     int     `json:"burst"`
+}
+
+// RateLimitEndpoints are the endpoints rate limits apply to, with their
+// default limits.
+var RateLimitEndpoints = map[string]RateLimit{
+	"save":    {PerMinute: 10, Burst: 5},
+	"rename":  {PerMinute: 5, Burst: 3},
+	"delete":  {PerMinute: 5, Burst: 3},
+	"restore": {PerMinute: 5, Burst: 3},
+	"preview": {PerMinute: 60, Burst: 20},
+	"format":  {PerMinute: 30, Burst: 10},
+	"upload":  {PerMinute: 10, Burst: 5},
+	"beacon":  {PerMinute: 60, Burst: 30},
+}
+
+// Limit returns the limit of endpoint, filling unset fields from its
+// default, and whether there is one.
+func (c *RateLimitConfig) Limit(endpoint string) (RateLimit, bool) {
+	limit, known := RateLimitEndpoints[endpoint]
+	if !c.Enabled || !known {
+		return RateLimit{}, false
+	}
+	if override, ok := c.Endpoints[endpoint]; ok {
+		if override.PerMinute != 0 {
+			limit.PerMinute = override.PerMinute
+		}
+		if override.Burst > 0 {
+			limit.Burst = override.Burst
+		}
+	}
+	return limit, limit.PerMinute > 0
+}
+
+// ChallengeConfig makes anonymous editors solve an anti-abuse challenge
+// before their writes are accepted. Signed-in users, edit token holders and
+// site users are exempt.
+type ChallengeConfig struct {
+	Enabled bool `json:"enabled"`
+	// Provider is one of the ChallengeProviders.
+	Provider string `json:"provider"`
+	// Endpoints are the writes that need a solved challenge.
+	Endpoints []string `json:"endpoints"`
+	// Difficulty is the number of leading zero bits a proof of work must
+	// reach.
+	Difficulty int `json:"difficulty"`
+	// TTLSec is how long a proof of work challenge stays valid.
+	TTLSec int `json:"ttlSec"`
+	// SiteKey and Secret are issued by the CAPTCHA service.
+	SiteKey string `json:"siteKey"`
+	Secret  string `json:"secret"`
+	// VerifyURL overrides the verification endpoint of the CAPTCHA service.
+	VerifyURL string `json:"verifyUrl"`
+}
+
+// Challenge providers.
+const (
+	// ChallengePoW is a built-in hashcash-style proof of work.
+	ChallengePoW = "pow"
+	// ChallengeHCaptcha verifies hCaptcha responses.
+	ChallengeHCaptcha = "hcaptcha"
+	// ChallengeTurnstile verifies Cloudflare Turnstile responses.
+	ChallengeTurnstile = "turnstile"
+)
+
+// ChallengeVerifyURLs are the verification endpoints of the CAPTCHA
+// providers.
+var ChallengeVerifyURLs = map[string]string{
+	ChallengeHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ChallengeTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// ChallengeEndpoints are the writes a challenge may be required for.
+var ChallengeEndpoints = []string{"save", "restore", "rename", "delete", "upload"}
+
+// TTL is how long a proof of work challenge stays valid.
+func (c ChallengeConfig) TTL() time.Duration {
+	return time.Duration(c.TTLSec) * time.Second
+}
+
+// Requires reports whether writes to endpoint need a solved challenge.
+func (c ChallengeConfig) Requires(endpoint string) bool {
+	return c.Enabled && slices.Contains(c.Endpoints, endpoint)
+}
+
+func (c *ChallengeConfig) validate() error {
+	for _, endpoint := range c.Endpoints {
+		if !slices.Contains(ChallengeEndpoints, endpoint) {
+			return fmt.Errorf("unknown endpoint %q", endpoint)
+		}
+	}
+	if c.Provider == ChallengePoW {
+		if c.Difficulty < 1 || c.Difficulty > 32 {
+			return fmt.Errorf("difficulty must be between 1 and 32")
+		}
+		return nil
+	}
+	if _, ok := ChallengeVerifyURLs[c.Provider]; !ok {
+		return fmt.Errorf("provider must be %q, %q or %q", ChallengePoW, ChallengeHCaptcha, ChallengeTurnstile)
+	}
+	if c.SiteKey == "" || c.Secret == "" {
+		return fmt.Errorf("%s needs siteKey and secret", c.Provider)
+	}
+	parsed, err := url.ParseRequestURI(c.VerifyURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid verifyUrl %q", c.VerifyURL)
+	}
+	return nil
+}
+
+// AssetConfig limits the repository files published next to the pages, so
+// stray files such as editor backups or dotfiles are neither copied to the
+// output nor served. A file is published when its extension or media type
+// is listed.
+type AssetConfig struct {
+	// Extensions, with their leading dot, eg. ".png".
+	Extensions []string `json:"extensions"`
+	// Types are media types or "type/*" patterns, looked up from the file
+	// extension.
+	Types []string `json:"types"`
+}
+
+// Allows reports whether the file name may be published as an asset.
+func (a AssetConfig) Allows(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return false
+	}
+	if slices.Contains(a.Extensions, ext) {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	if mediaType == "" {
+		return false
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, pattern := range a.Types {
+		if pattern == mediaType || pattern == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadConfig lets editors attach images and other files to pages. Uploads
+// are committed to the repository like page edits.
+type UploadConfig struct {
+	Enabled bool `json:"enabled"`
+	// Dir is the repository directory uploads are written to.
+	Dir      string `json:"dir"`
+	MaxBytes int64  `json:"maxBytes"`
+	// Types lists the accepted media types, checked against the sniffed
+	// content of the file.
+	Types []string `json:"types"`
+}
+
+// BotConfig enables the page API for automation such as monitoring systems
+// that keep status pages in the wiki.
+type BotConfig struct {
+	Enabled bool `json:"enabled"`
+	// Tokens maps bot names to their bearer tokens. The name is recorded as
+	// the editor of the bot's changes.
+	Tokens map[string]string `json:"tokens"`
+}
+
+// SiteAuthConfig puts the whole site behind HTTP basic auth or bearer
+// tokens, for small private wikis. Endpoints with their own authentication
+// (webhooks, admin, page API, metrics, health) stay reachable.
+type SiteAuthConfig struct {
+	Enabled bool   `json:"enabled"`
+	Realm   string `json:"realm"`
+	// Users maps user names to passwords, either in clear text or as
+	// "sha256:<hex digest>".
+	Users   map[string]string `json:"users"`
+	Tokens  []string          `json:"tokens"`
+	Exclude []string          `json:"exclude"`
+}
+
+// RobotsConfig controls indexing hints for crawlers and which user agents
+// are refused outright.
+type RobotsConfig struct {
+	Rules           []RobotsRule `json:"rules"`
+	BlockUserAgents []string     `json:"blockUserAgents"`
+}
+
+// RobotsRule applies robots directives (eg. "noindex, nofollow") to every
+// route under Prefix.
+type RobotsRule struct {
+	Prefix     string `json:"prefix"`
+	Directives string `json:"directives"`
+}
+
+// ACLConfig grants access to route prefixes by role. Routes without a
+// matching rule stay open to everyone the rest of the configuration lets
+// in.
+type ACLConfig struct {
+	// Roles maps role names to their members, named like editors:
+	// "user:<siteAuth user>", "oidc:<subject>", "token:<edit token subject>"
+	// or "bot:<name>".
+	Roles map[string][]string `json:"roles"`
+	Rules []ACLRule           `json:"rules"`
+}
+
+// ACLRule restricts the routes under Prefix. Each list names the roles
+// allowed, where "*" is everyone and "authenticated" anyone identified. An
+// empty list leaves that access unrestricted, except for Admin, which then
+// follows Write. Write implies read, and Admin implies write.
+type ACLRule struct {
+	Prefix string `json:"prefix"`
+	// Read covers viewing pages and their source, history and diffs.
+	Read []string `json:"read"`
+	// Write covers saving and restoring pages.
+	Write []string `json:"write"`
+	// Admin covers renaming and deleting pages.
+	Admin []string `json:"admin"`
+}
+
+// Access levels checked against ACL rules.
+const (
+	ACLRead = iota
+	ACLWrite
+	ACLAdmin
+)
+
+// Built-in ACL roles.
+const (
+	ACLRoleEveryone      = "*"
+	ACLRoleAuthenticated = "authenticated"
+)
+
+// Enabled reports whether any rule is configured.
+func (a *ACLConfig) Enabled() bool {
+	return len(a.Rules) > 0
+}
+
+// RolesOf returns the roles of a principal identified by members, which is
+// empty for anonymous requests.
+func (a *ACLConfig) RolesOf(members []string) []string {
+	roles := []string{ACLRoleEveryone}
+	if len(members) == 0 {
+		return roles
+	}
+	roles = append(roles, ACLRoleAuthenticated)
+	for role, listed := range a.Roles {
+		for _, member := range members {
+			if slices.Contains(listed, member) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// Allows reports whether roles grant access at level to route. The rule
+// with the longest matching prefix applies.
+func (a *ACLConfig) Allows(route string, roles []string, level int) bool {
+	rule := a.rule(route)
+	if rule == nil {
+		return true
+	}
+	granted := func(lists ...[]string) bool {
+		for _, list := range lists {
+			for _, role := range list {
+				if slices.Contains(roles, role) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch level {
+	case ACLRead:
+		return len(rule.Read) == 0 || granted(rule.Read, rule.Write, rule.Admin)
+	case ACLWrite:
+		return len(rule.Write) == 0 || granted(rule.Write, rule.Admin)
+	default:
+		if len(rule.Admin) == 0 {
+			return len(rule.Write) == 0 || granted(rule.Write)
+		}
+		return granted(rule.Admin)
+	}
+}
+
+// RestrictsRead reports whether route may not be read by everyone.
+func (a *ACLConfig) RestrictsRead(route string) bool {
+	return !a.Allows(route, []string{ACLRoleEveryone}, ACLRead)
+}
+
+func (a *ACLConfig) rule(route string) *ACLRule {
+	if len(a.Rules) == 0 {
+		return nil
+	}
+	normalized, err := normalizeRoute(route)
+	if err != nil {
+		return nil
+	}
+	if normalized == "" {
+		normalized = "/"
+	}
+	var match *ACLRule
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		if match != nil && len(rule.Prefix) <= len(match.Prefix) {
+			continue
+		}
+		if rule.Prefix == "/" || normalized == rule.Prefix || strings.HasPrefix(normalized, rule.Prefix+"/") {
+			match = rule
+		}
+	}
+	return match
+}
+
+func (a *ACLConfig) compile() error {
+	for role := range a.Roles {
+		if role == ACLRoleEveryone || role == ACLRoleAuthenticated || strings.TrimSpace(role) == "" {
+			return fmt.Errorf("invalid role name %q", role)
+		}
+	}
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		norm, err := normalizeRoute(rule.Prefix)
+		if err != nil {
+			return fmt.Errorf("invalid prefix %q: %w", rule.Prefix, err)
+		}
+		if norm == "" {
+			norm = "/"
+		}
+		rule.Prefix = norm
+		for _, list := range [][]string{rule.Read, rule.Write, rule.Admin} {
+			for _, role := range list {
+				if _, ok := a.Roles[role]; !ok && role != ACLRoleEveryone && role != ACLRoleAuthenticated {
+					return fmt.Errorf("rule for %q names unknown role %q", rule.Prefix, role)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LoggingConfig sends logs to sinks other than stdout and sets the level of
+// each subsystem.
+type LoggingConfig struct {
+	// Sinks replace logging to stdout when set.
+	Sinks []LogSink `json:"sinks"`
+	// Levels overrides logLevel for the subsystems in LogSubsystems.
+	Levels map[string]string `json:"levels"`
+}
+
+// LogSink is a destination for log records.
+type LogSink struct {
+	Type string `json:"type"`
+	// Level drops records below it from this sink only.
+	Level string `json:"level"`
+	// Path, MaxSizeMB and MaxBackups configure file sinks, which rotate to
+	// Path.1, Path.2 and so on once they reach MaxSizeMB.
+	Path       string `json:"path"`
+	MaxSizeMB  int    `json:"maxSizeMb"`
+	MaxBackups int    `json:"maxBackups"`
+	// Network and Address reach a remote syslog daemon; both empty use the
+	// local one.
+	Network string `json:"network"`
+	Address string `json:"address"`
+	// Tag identifies the wiki to syslog and journald.
+	Tag string `json:"tag"`
+}
+
+// AccessLogConfig writes a line for each HTTP request to a file of its own,
+// apart from the application logs.
+type AccessLogConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+	// Format is AccessLogCombined or AccessLogJSON.
+	Format string `json:"format"`
+	// The file is moved to Path.1 once it reaches MaxSizeMB or, when
+	// MaxAgeHours is set, once it was written to for that long, keeping
+	// MaxBackups older files.
+	MaxSizeMB   int `json:"maxSizeMb"`
+	MaxAgeHours int `json:"maxAgeHours"`
+	MaxBackups  int `json:"maxBackups"`
+}
+
+// Access log formats.
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// MaxAge returns how long a file is written to before it is rotated, or 0
+// when only its size counts.
+func (c AccessLogConfig) MaxAge() time.Duration {
+	return time.Duration(max(c.MaxAgeHours, 0)) * time.Hour
+}
+
+func (c *AccessLogConfig) validate() error {
+	if strings.TrimSpace(c.Path) == "" {
+		return fmt.Errorf("path is required")
+	}
+	if c.Format != AccessLogCombined && c.Format != AccessLogJSON {
+		return fmt.Errorf("unknown format %q (available: %s, %s)", c.Format, AccessLogCombined, AccessLogJSON)
+	}
+	return nil
+}
+
+// SlowLogConfig sets when requests and git commands are slow enough to be
+// logged as warnings and counted.
+type SlowLogConfig struct {
+	RequestMs int `json:"requestMs"`
+	GitMs     int `json:"gitMs"`
+}
+
+// RequestThreshold returns the slow request threshold, or 0 when disabled.
+func (c SlowLogConfig) RequestThreshold() time.Duration {
+	return time.Duration(max(c.RequestMs, 0)) * time.Millisecond
+}
+
+// GitThreshold returns the slow git command threshold, or 0 when disabled.
+func (c SlowLogConfig) GitThreshold() time.Duration {
+	return time.Duration(max(c.GitMs, 0)) * time.Millisecond
+}
+
+// InjectConfig adds HTML to every page without changing the templates, eg.
+// analytics scripts or custom CSS. The snippets are trusted and written
+// verbatim.
+type InjectConfig struct {
+	// Head is written at the end of <head>.
+	Head string `json:"head"`
+	// BodyEnd is written at the end of <body>.
+	BodyEnd string `json:"bodyEnd"`
+	// RepoFiles also injects the root _Head.html and _BodyEnd.html of the
+	// repository, after the configured snippets.
+	RepoFiles bool `json:"repoFiles"`
+}
+
+// DebugConfig turns on endpoints that help develop themes and
+// troubleshoot an instance. They are not meant for public instances.
+type DebugConfig struct {
+	// TemplateData serves /debug/template-data, the data a page template
+	// receives, as JSON.
+	TemplateData bool `json:"templateData"`
+	// Pprof serves net/http/pprof under /debug/pprof/ to requests bearing
+	// PprofToken, which is separate from the admin token.
+	Pprof      bool   `json:"pprof"`
+	PprofToken string `json:"pprofToken"`
+}
+
+// Log sink types.
+const (
+	LogSinkStdout   = "stdout"
+	LogSinkFile     = "file"
+	LogSinkSyslog   = "syslog"
+	LogSinkJournald = "journald"
+)
+
+// LogSubsystems are the parts of the wiki whose log level can be set apart.
+var LogSubsystems = []string{"git", "webhook", "server", "build"}
+
+// LogLevels are the accepted log level names.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+func (l *LoggingConfig) validate() error {
+	for i, sink := range l.Sinks {
+		switch sink.Type {
+		case LogSinkStdout, LogSinkJournald:
+		case LogSinkFile:
+			if strings.TrimSpace(sink.Path) == "" {
+				return fmt.Errorf("sink %d: file sinks need a path", i)
+			}
+		case LogSinkSyslog:
+			if (sink.Network == "") != (sink.Address == "") {
+				return fmt.Errorf("sink %d: syslog network and address must be set together", i)
+			}
+		default:
+			return fmt.Errorf("sink %d: unknown type %q", i, sink.Type)
+		}
+		if sink.Level != "" && !slices.Contains(LogLevels, sink.Level) {
+			return fmt.Errorf("sink %d: unknown level %q", i, sink.Level)
+		}
+	}
+	for name, level := range l.Levels {
+		if !slices.Contains(LogSubsystems, name) {
+			return fmt.Errorf("unknown subsystem %q", name)
+		}
+		if !slices.Contains(LogLevels, level) {
+			return fmt.Errorf("unknown level %q for %s", level, name)
+		}
+	}
+	return nil
+}
+
+// OutboundConfig controls how the instance reaches external HTTP services
+// such as notification endpoints that may only be routable inside DN42.
+type OutboundConfig struct {
+	Proxy     string `json:"proxy"`
+	DNSServer string `json:"dnsServer"`
+}
+
+// ClientOptions derives outbound HTTP client options for a caller.
+func (o OutboundConfig) ClientOptions(timeout time.Duration, skipVerify bool) netutil.ClientOptions {
+	return netutil.ClientOptions{
+		Proxy:      o.Proxy,
+		DNSServer:  o.DNSServer,
+		Timeout:    timeout,
+		SkipVerify: skipVerify,
+	}
 }
 
 // Config encapsulates runtime and build-time options.
 type Config struct {
-	Live                   bool           `json:"live"`
-	Editable               bool           `json:"editable"`
-	Listen                 string         `json:"listen"`
-	Git                    GitConfig      `json:"git"`
-	Webhook                WebhookConfig  `json:"webhook"`
-	OutputDir              string         `json:"outputDir"`
-	TemplateDir            string         `json:"templateDir"`
-	HomeDoc                string         `json:"homeDoc"`
-	BaseURL                string         `json:"baseUrl"`
-	SiteName               string         `json:"siteName"`
-	IgnoreHeader           bool           `json:"ignoreHeader"`
-	IgnoreFooter           bool           `json:"ignoreFooter"`
-	ServerFooter           string         `json:"serverFooter"`
-	EnableTLS              bool           `json:"enableTLS"`
-	TLSCert                string         `json:"tlsCert"`
-	TLSKey                 string         `json:"tlsKey"`
-	LogLevel               string         `json:"logLevel"`
-	TrustedProxies         []string       `json:"trustedProxies"`
-	TrustedRemoteAddrLevel int            `json:"trustedRemoteAddrLevel"`
-	PrivatePagesPrefix     []string       `json:"privatePagesPrefix"`
-	PullInterval           time.Duration  `json:"-"`
-	trustedProxyPrefixes   []netip.Prefix `json:"-"`
-	privatePagePrefixes    []string       `json:"-"`
+	Live                   bool                 `json:"live"`
+	Editable               bool                 `json:"editable"`
+	Listen                 string               `json:"listen"`
+	Git                    GitConfig            `json:"git"`
+	Webhook                WebhookConfig        `json:"webhook"`
+	Replica                ReplicaConfig        `json:"replica"`
+	Metrics                MetricsConfig        `json:"metrics"`
+	Outbound               OutboundConfig       `json:"outbound"`
+	CDN                    CDNConfig            `json:"cdn"`
+	Admin                  AdminConfig          `json:"admin"`
+	PullValidation         PullValidationConfig `json:"pullValidation"`
+	Cache                  CacheConfig          `json:"cache"`
+	CacheControl           map[string]string    `json:"cacheControl"`
+	Render                 RenderConfig         `json:"render"`
+	Precompress            PrecompressConfig    `json:"precompress"`
+	RecentChanges          RecentChangesConfig  `json:"recentChanges"`
+	Analytics              AnalyticsConfig      `json:"analytics"`
+	Search                 SearchConfig         `json:"search"`
+	Summary                SummaryConfig        `json:"summary"`
+	UI                     UIConfig             `json:"ui"`
+	Robots                 RobotsConfig         `json:"robots"`
+	ACL                    ACLConfig            `json:"acl"`
+	SiteAuth               SiteAuthConfig       `json:"siteAuth"`
+	EditTokens             EditTokenConfig      `json:"editTokens"`
+	Auth                   AuthConfig           `json:"auth"`
+	EditQuotas             EditQuotaConfig      `json:"editQuotas"`
+	RateLimits             RateLimitConfig      `json:"rateLimits"`
+	Challenge              ChallengeConfig      `json:"challenge"`
+	Uploads                UploadConfig         `json:"uploads"`
+	Assets                 AssetConfig          `json:"assets"`
+	Bots                   BotConfig            `json:"bots"`
+	OutputDir              string               `json:"outputDir"`
+	TemplateDir            string               `json:"templateDir"`
+	HomeDoc                string               `json:"homeDoc"`
+	BaseURL                string               `json:"baseUrl"`
+	SiteName               string               `json:"siteName"`
+	IgnoreHeader           bool                 `json:"ignoreHeader"`
+	IgnoreFooter           bool                 `json:"ignoreFooter"`
+	LayoutCascade          string               `json:"layoutCascade"`
+	RejectCollisions       bool                 `json:"rejectCollisions"`
+	ServerFooter           string               `json:"serverFooter"`
+	Inject                 InjectConfig         `json:"inject"`
+	EnableTLS              bool                 `json:"enableTLS"`
+	TLSCert                string               `json:"tlsCert"`
+	TLSKey                 string               `json:"tlsKey"`
+	LogLevel               string               `json:"logLevel"`
+	LogFormat              string               `json:"logFormat"`
+	Logging                LoggingConfig        `json:"logging"`
+	SlowLog                SlowLogConfig        `json:"slowLog"`
+	AccessLog              AccessLogConfig      `json:"accessLog"`
+	Debug                  DebugConfig          `json:"debug"`
+	Environment            string               `json:"environment"`
+	TrustedProxies         []string             `json:"trustedProxies"`
+	TrustedRemoteAddrLevel int                  `json:"trustedRemoteAddrLevel"`
+	PrivatePagesPrefix     []string             `json:"privatePagesPrefix"`
+	// ArchivedPagesPrefix marks routes whose pages are kept for the record
+	// and can no longer be edited.
+	ArchivedPagesPrefix  []string       `json:"archivedPagesPrefix"`
+	ServeStaleOutput     bool           `json:"serveStaleOutput"`
+	PullInterval         time.Duration  `json:"-"`
+	MinPullInterval      time.Duration  `json:"-"`
+	MaxPullInterval      time.Duration  `json:"-"`
+	trustedProxyPrefixes []netip.Prefix `json:"-"`
+	privatePagePrefixes  []string       `json:"-"`
+	archivedPagePrefixes []string       `json:"-"`
 }
 
 func (g *GitConfig) UnmarshalJSON(data []byte) error {
 	type rawGitConfig struct {
-		BinPath                       string `json:"binPath"`
-		Remote                        string `json:"remote"`
-		LocalDirectory                string `json:"localDirectory"`
-		PullIntervalSec               int    `json:"pullIntervalSec"`
-		Author                        string `json:"author"`
-		CommitMessagePrefix           string `json:"commitMessagePrefix"`
-		CommitMessageAppendRemoteAddr string `json:"commitMessageAppendRemoteAddr"`
-		CommandTimeoutSec             int    `json:"commandTimeoutSec"`
+		BinPath                       string       `json:"binPath"`
+		Remote                        string       `json:"remote"`
+		PushRemote                    string       `json:"pushRemote"`
+		Mirrors                       []string     `json:"mirrors"`
+		MirrorFailoverAfter           int          `json:"mirrorFailoverAfter"`
+		LocalDirectory                string       `json:"localDirectory"`
+		PullIntervalSec               int          `json:"pullIntervalSec"`
+		MinPullIntervalSec            int          `json:"minPullIntervalSec"`
+		MaxPullIntervalSec            int          `json:"maxPullIntervalSec"`
+		Author                        string       `json:"author"`
+		Committer                     string       `json:"committer"`
+		Attribution                   string       `json:"attribution"`
+		CommitMessagePrefix           string       `json:"commitMessagePrefix"`
+		CommitMessageAppendRemoteAddr string       `json:"commitMessageAppendRemoteAddr"`
+		CommandTimeoutSec             int          `json:"commandTimeoutSec"`
+		Hardening                     GitHardening `json:"hardening"`
 	}
 
 	var raw rawGitConfig
@@ -93,15 +952,76 @@ func (g *GitConfig) UnmarshalJSON(data []byte) error {
 
 	g.BinPath = raw.BinPath
 	g.Remote = raw.Remote
+	g.PushRemote = raw.PushRemote
+	g.Mirrors = raw.Mirrors
+	g.MirrorFailoverAfter = raw.MirrorFailoverAfter
 	g.LocalDirectory = raw.LocalDirectory
 	g.PullIntervalSec = raw.PullIntervalSec
+	g.MinPullIntervalSec = raw.MinPullIntervalSec
+	g.MaxPullIntervalSec = raw.MaxPullIntervalSec
 	g.Author = raw.Author
+	g.Committer = raw.Committer
+	g.Attribution = raw.Attribution
 	g.CommitMessagePrefix = raw.CommitMessagePrefix
 	g.CommitMessageAppendRemoteAddr = raw.CommitMessageAppendRemoteAddr
 	g.CommandTimeoutSec = raw.CommandTimeoutSec
+	g.Hardening = raw.Hardening
 	return nil
 }
 
+// CommitterIdentity splits the configured committer ("Name <email>") into
+// its parts.
+func (g *GitConfig) CommitterIdentity() (name, email string, ok bool) {
+	open := strings.LastIndex(g.Committer, "<")
+	if open < 0 || !strings.HasSuffix(g.Committer, ">") {
+		return "", "", false
+	}
+	name = strings.TrimSpace(g.Committer[:open])
+	email = strings.TrimSpace(g.Committer[open+1 : len(g.Committer)-1])
+	return name, email, name != "" && email != ""
+}
+
+func (g *GitConfig) validateHardening() error {
+	h := &g.Hardening
+	for _, protocol := range h.Protocols {
+		if !slices.Contains(GitProtocols, protocol) {
+			return fmt.Errorf("git hardening: unknown protocol %q", protocol)
+		}
+	}
+	for _, name := range h.PassEnv {
+		if !strings.HasPrefix(name, "GIT_") {
+			return fmt.Errorf("git hardening: passEnv %q is not a GIT_* variable", name)
+		}
+	}
+	if !h.Enabled {
+		return nil
+	}
+	remotes := append([]string{g.Remote, g.PushRemote}, g.Mirrors...)
+	for _, remote := range remotes {
+		if remote == "" {
+			continue
+		}
+		if protocol := remoteProtocol(remote); !slices.Contains(h.Protocols, protocol) {
+			return fmt.Errorf("git hardening: protocol %q of a remote is not allowed", protocol)
+		}
+	}
+	return nil
+}
+
+// remoteProtocol names the transport git uses for a remote: the URL scheme,
+// ssh for scp-like "host:path" remotes and file for local paths, including
+// those starting with a Windows drive letter.
+func remoteProtocol(remote string) string {
+	if scheme, _, ok := strings.Cut(remote, "://"); ok {
+		return strings.ToLower(strings.TrimPrefix(scheme, "git+"))
+	}
+	colon := strings.Index(remote, ":")
+	if colon > 1 && !strings.ContainsAny(remote[:colon], "/\\") {
+		return "ssh"
+	}
+	return "file"
+}
+
 // RepositoryPath reports the derived owner/name portion of the configured remote.
 func (g *GitConfig) RepositoryPath() string {
 	return g.repositoryPath
@@ -159,6 +1079,7 @@ func (c *Config) applyDefaults() error {
 
 	c.Git.BinPath = strings.TrimSpace(c.Git.BinPath)
 	c.Git.Remote = strings.TrimSpace(c.Git.Remote)
+	c.Git.PushRemote = strings.TrimSpace(c.Git.PushRemote)
 	c.Git.LocalDirectory = strings.TrimSpace(c.Git.LocalDirectory)
 
 	if c.Git.BinPath == "" {
@@ -170,17 +1091,89 @@ func (c *Config) applyDefaults() error {
 	if c.Git.PullIntervalSec <= 0 {
 		c.Git.PullIntervalSec = 3600
 	}
+	if c.Git.MinPullIntervalSec <= 0 {
+		c.Git.MinPullIntervalSec = c.Git.PullIntervalSec
+	}
+	if c.Git.MaxPullIntervalSec <= 0 {
+		c.Git.MaxPullIntervalSec = c.Git.PullIntervalSec
+	}
+	mirrors := make([]string, 0, len(c.Git.Mirrors))
+	for _, mirror := range c.Git.Mirrors {
+		if mirror = strings.TrimSpace(mirror); mirror != "" {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+	c.Git.Mirrors = mirrors
+	if c.Git.MirrorFailoverAfter <= 0 {
+		c.Git.MirrorFailoverAfter = 3
+	}
+	c.Environment = strings.ToLower(strings.TrimSpace(c.Environment))
+	if c.Environment == "" {
+		c.Environment = EnvironmentProduction
+	}
+	c.LayoutCascade = strings.ToLower(strings.TrimSpace(c.LayoutCascade))
+	if c.LayoutCascade == "" {
+		c.LayoutCascade = LayoutCascadeReplace
+	}
 	if c.LogLevel == "" {
 		c.LogLevel = "info"
 	}
+	c.LogFormat = strings.ToLower(strings.TrimSpace(c.LogFormat))
+	if c.LogFormat == "" {
+		c.LogFormat = LogFormatText
+	}
+	for i := range c.Logging.Sinks {
+		sink := &c.Logging.Sinks[i]
+		sink.Type = strings.ToLower(strings.TrimSpace(sink.Type))
+		sink.Level = strings.ToLower(strings.TrimSpace(sink.Level))
+		if sink.MaxSizeMB <= 0 {
+			sink.MaxSizeMB = 100
+		}
+		if sink.MaxBackups == 0 {
+			sink.MaxBackups = 5
+		}
+		if sink.Tag == "" {
+			sink.Tag = "dn42-wiki"
+		}
+	}
+	c.AccessLog.Format = strings.ToLower(strings.TrimSpace(c.AccessLog.Format))
+	if c.AccessLog.Format == "" {
+		c.AccessLog.Format = AccessLogCombined
+	}
+	if c.AccessLog.MaxSizeMB <= 0 {
+		c.AccessLog.MaxSizeMB = 100
+	}
+	if c.AccessLog.MaxBackups == 0 {
+		c.AccessLog.MaxBackups = 7
+	}
+	for name, level := range c.Logging.Levels {
+		c.Logging.Levels[name] = strings.ToLower(strings.TrimSpace(level))
+	}
+	if c.SlowLog.RequestMs == 0 {
+		c.SlowLog.RequestMs = 3000
+	}
+	if c.SlowLog.GitMs == 0 {
+		c.SlowLog.GitMs = 5000
+	}
 	if c.TrustedRemoteAddrLevel <= 0 {
 		c.TrustedRemoteAddrLevel = 1
 	}
 
+	c.Git.Committer = strings.TrimSpace(c.Git.Committer)
 	c.Git.Author = strings.TrimSpace(c.Git.Author)
 	if c.Git.Author == "" {
 		c.Git.Author = "Anonymous <anonymous@localhost>"
 	}
+	c.Git.Attribution = strings.ToLower(strings.TrimSpace(c.Git.Attribution))
+	if c.Git.Attribution == "" {
+		c.Git.Attribution = AttributionOptional
+	}
+	if len(c.Git.Hardening.Protocols) == 0 {
+		c.Git.Hardening.Protocols = []string{"https", "ssh"}
+	}
+	for i, protocol := range c.Git.Hardening.Protocols {
+		c.Git.Hardening.Protocols[i] = strings.ToLower(strings.TrimSpace(protocol))
+	}
 
 	c.Webhook.Secret = strings.TrimSpace(c.Webhook.Secret)
 	if c.Webhook.Secret == "" {
@@ -192,11 +1185,126 @@ func (c *Config) applyDefaults() error {
 		c.Webhook.Secret = hex.EncodeToString(b)
 	}
 
+	c.Metrics.Token = strings.TrimSpace(c.Metrics.Token)
+	c.Admin.Token = strings.TrimSpace(c.Admin.Token)
+	c.Debug.PprofToken = strings.TrimSpace(c.Debug.PprofToken)
+	if c.Webhook.HistorySize == 0 {
+		c.Webhook.HistorySize = 50
+	}
+	if c.Webhook.ReplayWindowSec == 0 {
+		c.Webhook.ReplayWindowSec = 300
+	}
+
+	if c.Render.Concurrency <= 0 {
+		c.Render.Concurrency = runtime.NumCPU()
+	}
+	if c.Render.SlowestPages == 0 {
+		c.Render.SlowestPages = 10
+	}
+	for i := range c.Render.External {
+		ext := &c.Render.External[i]
+		ext.Name = strings.TrimSpace(ext.Name)
+		if ext.Name == "" && len(ext.Command) > 0 {
+			ext.Name = filepath.Base(ext.Command[0])
+		}
+		for j, extension := range ext.Extensions {
+			ext.Extensions[j] = strings.ToLower(strings.TrimSpace(extension))
+		}
+		if ext.TimeoutSec <= 0 {
+			ext.TimeoutSec = 10
+		}
+	}
+
+	if c.Cache.MaxRenderedPages == 0 {
+		c.Cache.MaxRenderedPages = 1000
+	}
+	if c.Cache.MaxSearchIndexBytes == 0 {
+		c.Cache.MaxSearchIndexBytes = 8 << 20
+	}
+	c.Cache.RenderDir = strings.TrimSpace(c.Cache.RenderDir)
+	if c.Cache.MaxRenderDirBytes <= 0 {
+		c.Cache.MaxRenderDirBytes = 256 << 20
+	}
+
+	// Defining variables implies substituting them.
+	if len(c.Render.Variables) > 0 && !slices.Contains(c.Render.Transforms, "variables") {
+		c.Render.Transforms = append([]string{"variables"}, c.Render.Transforms...)
+	}
+
+	if c.RecentChanges.Limit == 0 {
+		c.RecentChanges.Limit = 50
+	}
+	c.Analytics.File = strings.TrimSpace(c.Analytics.File)
+	if c.Analytics.File == "" {
+		c.Analytics.File = "./analytics.json"
+	}
+	if c.Analytics.RetentionDays == 0 {
+		c.Analytics.RetentionDays = 365
+	}
+	if c.Analytics.FlushSec == 0 {
+		c.Analytics.FlushSec = 300
+	}
+	if c.Search.SnippetChars == 0 {
+		c.Search.SnippetChars = 1000
+	}
+	if len(c.Summary.Sources) == 0 {
+		c.Summary.Sources = []string{SummaryDescription, SummaryMore, SummaryParagraph, SummaryText}
+	}
+	for i, source := range c.Summary.Sources {
+		c.Summary.Sources[i] = strings.ToLower(strings.TrimSpace(source))
+	}
+	if c.Summary.MaxChars <= 0 {
+		c.Summary.MaxChars = 200
+	}
+	shortcuts := map[string]string{"search": "/", "edit": "e", "new": "n", "history": "h"}
+	for action, key := range c.UI.Shortcuts {
+		shortcuts[strings.ToLower(strings.TrimSpace(action))] = strings.TrimSpace(key)
+	}
+	c.UI.Shortcuts = shortcuts
+	if c.Precompress.MinBytes <= 0 {
+		c.Precompress.MinBytes = 1024
+	}
+
+	policies := make(map[string]string, len(c.CacheControl))
+	for mediaType, policy := range c.CacheControl {
+		policies[strings.ToLower(strings.TrimSpace(mediaType))] = strings.TrimSpace(policy)
+	}
+	c.CacheControl = policies
+
+	c.Outbound.Proxy = strings.TrimSpace(c.Outbound.Proxy)
+	dnsServer, err := netutil.NormalizeDNSServer(c.Outbound.DNSServer)
+	if err != nil {
+		return fmt.Errorf("outbound: %w", err)
+	}
+	c.Outbound.DNSServer = dnsServer
+
+	c.Replica.PrimaryURL = strings.TrimRight(strings.TrimSpace(c.Replica.PrimaryURL), "/")
+
+	c.CDN.Provider = strings.ToLower(strings.TrimSpace(c.CDN.Provider))
+	if c.CDN.Provider == "" {
+		c.CDN.Provider = CDNProviderURL
+	}
+	c.CDN.SiteURL = strings.TrimRight(strings.TrimSpace(c.CDN.SiteURL), "/")
+	c.CDN.PurgeURL = strings.TrimSpace(c.CDN.PurgeURL)
+	c.CDN.Method = strings.ToUpper(strings.TrimSpace(c.CDN.Method))
+	if c.CDN.Method == "" {
+		c.CDN.Method = http.MethodPost
+	}
+	c.CDN.APIBase = strings.TrimRight(strings.TrimSpace(c.CDN.APIBase), "/")
+	if c.CDN.APIBase == "" {
+		c.CDN.APIBase = "https://api.cloudflare.com/client/v4"
+	}
+	c.CDN.ZoneID = strings.TrimSpace(c.CDN.ZoneID)
+	c.CDN.Token = strings.TrimSpace(c.CDN.Token)
+
 	c.Webhook.Polling.CallbackURL = strings.TrimSpace(c.Webhook.Polling.CallbackURL)
 	c.Webhook.Polling.Endpoint = strings.TrimSpace(c.Webhook.Polling.Endpoint)
 	if c.Webhook.Polling.PollingIntervalSec <= 0 {
 		c.Webhook.Polling.PollingIntervalSec = 3600
 	}
+	if c.Webhook.Polling.ProtocolVersion <= 0 {
+		c.Webhook.Polling.ProtocolVersion = 1
+	}
 	if c.Webhook.Polling.Enabled {
 		c.Webhook.Polling.interval = time.Duration(c.Webhook.Polling.PollingIntervalSec) * time.Second
 	} else {
@@ -215,8 +1323,100 @@ func (c *Config) applyDefaults() error {
 	if err := c.compilePrivatePages(); err != nil {
 		return err
 	}
+	if err := c.compileArchivedPages(); err != nil {
+		return err
+	}
+	if err := c.compileRobotsRules(); err != nil {
+		return err
+	}
+	if err := c.ACL.compile(); err != nil {
+		return fmt.Errorf("acl: %w", err)
+	}
+
+	c.SiteAuth.Realm = strings.TrimSpace(c.SiteAuth.Realm)
+	if c.SiteAuth.Realm == "" {
+		c.SiteAuth.Realm = c.SiteName
+	}
+	c.EditTokens.Secret = strings.TrimSpace(c.EditTokens.Secret)
+	if c.EditTokens.MaxTTLSec <= 0 {
+		c.EditTokens.MaxTTLSec = 30 * 24 * 3600
+	}
+	c.Challenge.Provider = strings.ToLower(strings.TrimSpace(c.Challenge.Provider))
+	if c.Challenge.Provider == "" {
+		c.Challenge.Provider = ChallengePoW
+	}
+	if len(c.Challenge.Endpoints) == 0 {
+		c.Challenge.Endpoints = []string{"save", "restore"}
+	}
+	if c.Challenge.Difficulty == 0 {
+		c.Challenge.Difficulty = 18
+	}
+	if c.Challenge.TTLSec <= 0 {
+		c.Challenge.TTLSec = 300
+	}
+	c.Challenge.SiteKey = strings.TrimSpace(c.Challenge.SiteKey)
+	c.Challenge.Secret = strings.TrimSpace(c.Challenge.Secret)
+	c.Challenge.VerifyURL = strings.TrimSpace(c.Challenge.VerifyURL)
+	if c.Challenge.VerifyURL == "" {
+		c.Challenge.VerifyURL = ChallengeVerifyURLs[c.Challenge.Provider]
+	}
+	c.Auth.Issuer = strings.TrimRight(strings.TrimSpace(c.Auth.Issuer), "/")
+	c.Auth.ClientID = strings.TrimSpace(c.Auth.ClientID)
+	c.Auth.RedirectURL = strings.TrimSpace(c.Auth.RedirectURL)
+	c.Auth.SessionSecret = strings.TrimSpace(c.Auth.SessionSecret)
+	if len(c.Auth.Scopes) == 0 {
+		c.Auth.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.Auth.SessionTTLSec <= 0 {
+		c.Auth.SessionTTLSec = 7 * 24 * 3600
+	}
+	if c.Auth.CookieName = strings.TrimSpace(c.Auth.CookieName); c.Auth.CookieName == "" {
+		c.Auth.CookieName = "wiki_session"
+	}
+	for i, prefix := range c.SiteAuth.Exclude {
+		c.SiteAuth.Exclude[i] = "/" + strings.TrimLeft(strings.TrimSpace(prefix), "/")
+	}
+	c.Uploads.Dir = strings.Trim(path.Clean("/"+strings.ReplaceAll(strings.TrimSpace(c.Uploads.Dir), "\\", "/")), "/")
+	if c.Uploads.Dir == "" {
+		c.Uploads.Dir = "uploads"
+	}
+	for name, token := range c.Bots.Tokens {
+		c.Bots.Tokens[name] = strings.TrimSpace(token)
+	}
+	if c.Uploads.MaxBytes <= 0 {
+		c.Uploads.MaxBytes = 5 << 20
+	}
+	if len(c.Uploads.Types) == 0 {
+		c.Uploads.Types = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+	}
+	for i, mediaType := range c.Uploads.Types {
+		c.Uploads.Types[i] = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	if c.Assets.Extensions == nil && c.Assets.Types == nil {
+		c.Assets.Extensions = []string{
+			".css", ".js", ".mjs", ".json", ".geojson", ".ipynb", ".csv", ".txt", ".pdf",
+			".ico", ".woff", ".woff2", ".ttf", ".otf",
+		}
+		c.Assets.Types = []string{"image/*", "audio/*", "video/*", "font/*"}
+	}
+	for i, ext := range c.Assets.Extensions {
+		c.Assets.Extensions[i] = "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+	}
+	for i, mediaType := range c.Assets.Types {
+		c.Assets.Types[i] = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	if c.Uploads.Enabled {
+		// Uploaded files are always published.
+		for _, mediaType := range c.Uploads.Types {
+			if !slices.Contains(c.Assets.Types, mediaType) {
+				c.Assets.Types = append(c.Assets.Types, mediaType)
+			}
+		}
+	}
 
 	c.PullInterval = time.Duration(c.Git.PullIntervalSec) * time.Second
+	c.MinPullInterval = time.Duration(c.Git.MinPullIntervalSec) * time.Second
+	c.MaxPullInterval = time.Duration(c.Git.MaxPullIntervalSec) * time.Second
 	if c.Git.Remote == "" {
 		c.PullInterval = 0
 	}
@@ -224,9 +1424,112 @@ func (c *Config) applyDefaults() error {
 }
 
 func (c *Config) validate() error {
+	if c.Git.Committer != "" {
+		if _, _, ok := c.Git.CommitterIdentity(); !ok {
+			return fmt.Errorf("git committer must look like \"Name <email>\"")
+		}
+	}
+	switch c.Git.Attribution {
+	case AttributionOptional, AttributionRequired, AttributionForbidden:
+	default:
+		return fmt.Errorf("git attribution must be %q, %q or %q", AttributionOptional, AttributionRequired, AttributionForbidden)
+	}
+	if err := c.Git.validateHardening(); err != nil {
+		return err
+	}
+	if c.Environment != EnvironmentProduction && c.Environment != EnvironmentStaging {
+		return fmt.Errorf("environment must be %q or %q", EnvironmentProduction, EnvironmentStaging)
+	}
+	if c.LayoutCascade != LayoutCascadeReplace && c.LayoutCascade != LayoutCascadeAugment {
+		return fmt.Errorf("layoutCascade must be %q or %q", LayoutCascadeReplace, LayoutCascadeAugment)
+	}
+	for _, source := range c.Summary.Sources {
+		switch source {
+		case SummaryDescription, SummaryMore, SummaryParagraph, SummaryText:
+		default:
+			return fmt.Errorf("summary: unknown source %q", source)
+		}
+	}
+	if err := c.Logging.validate(); err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+	if c.AccessLog.Enabled {
+		if err := c.AccessLog.validate(); err != nil {
+			return fmt.Errorf("accessLog: %w", err)
+		}
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("unknown logFormat %q (available: %s, %s)", c.LogFormat, LogFormatText, LogFormatJSON)
+	}
+	for action, key := range c.UI.Shortcuts {
+		if !slices.Contains(ShortcutActions, action) {
+			return fmt.Errorf("ui: unknown shortcut action %q", action)
+		}
+		if utf8.RuneCountInString(key) > 1 {
+			return fmt.Errorf("ui: shortcut for %q must be a single key", action)
+		}
+	}
 	if c.PullInterval < 0 {
 		return fmt.Errorf("negative pull interval")
 	}
+	if c.PullInterval > 0 && (c.MinPullInterval > c.PullInterval || c.MaxPullInterval < c.PullInterval) {
+		return fmt.Errorf("git pull interval must lie between minPullIntervalSec and maxPullIntervalSec")
+	}
+	if len(c.Precompress.BrotliCommand) > 0 && strings.TrimSpace(c.Precompress.BrotliCommand[0]) == "" {
+		return fmt.Errorf("precompress: brotliCommand needs a program")
+	}
+	for mediaType, policy := range c.CacheControl {
+		if mediaType != "*" && !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("cacheControl: %q is not a media type, \"type/*\" or \"*\"", mediaType)
+		}
+		if policy == "" || strings.ContainsAny(policy, "\r\n") {
+			return fmt.Errorf("cacheControl: invalid policy for %q", mediaType)
+		}
+	}
+	for i, ext := range c.Render.External {
+		if len(ext.Command) == 0 || strings.TrimSpace(ext.Command[0]) == "" {
+			return fmt.Errorf("render.external[%d]: command is required", i)
+		}
+		if len(ext.Fences) == 0 && len(ext.Extensions) == 0 {
+			return fmt.Errorf("render.external[%d]: at least one fence or extension is required", i)
+		}
+		for _, extension := range ext.Extensions {
+			if !strings.HasPrefix(extension, ".") || strings.EqualFold(extension, ".md") {
+				return fmt.Errorf("render.external[%d]: invalid extension %q", i, extension)
+			}
+		}
+	}
+	for _, ext := range c.Render.Viewers {
+		if !renderer.HasViewer(ext) {
+			return fmt.Errorf("no viewer for %q (available: %s)", ext, strings.Join(renderer.ViewerExtensions(), ", "))
+		}
+	}
+	for _, name := range c.Render.Formats {
+		if _, ok := renderer.Format(name); !ok {
+			return fmt.Errorf("unknown render format %q (available: %s)", name, strings.Join(renderer.FormatNames(), ", "))
+		}
+	}
+	for _, name := range c.Render.Transforms {
+		if !renderer.HasTransform(name) {
+			return fmt.Errorf("unknown render transform %q (available: %s)", name, strings.Join(renderer.TransformNames(), ", "))
+		}
+	}
+	for name := range c.Render.Variables {
+		if !renderer.ValidVariableName(name) {
+			return fmt.Errorf("render.variables: %q must be upper case letters, digits and underscores", name)
+		}
+		if name == "SITE_NAME" || name == "BASE_URL" {
+			return fmt.Errorf("render.variables: %q is built in", name)
+		}
+	}
+	for prefix, target := range c.Render.Interwiki {
+		if !renderer.ValidInterwikiPrefix(prefix) {
+			return fmt.Errorf("render.interwiki: %q must be lower case letters, digits and dashes, and not a URL scheme", prefix)
+		}
+		if u, err := url.Parse(strings.ReplaceAll(target, "$1", "x")); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("render.interwiki: %q must map to an http or https URL", prefix)
+		}
+	}
 	if c.EnableTLS {
 		if c.TLSCert == "" || c.TLSKey == "" {
 			return fmt.Errorf("tls enabled but certificates missing")
@@ -242,6 +1545,121 @@ func (c *Config) validate() error {
 			return fmt.Errorf("invalid webhook polling endpoint: %w", err)
 		}
 	}
+	if c.Webhook.RequireTimestamp {
+		if c.Webhook.ReplayWindowSec < 0 {
+			return fmt.Errorf("webhook requireTimestamp needs a positive replayWindowSec")
+		}
+		if c.Webhook.Polling.Enabled {
+			return fmt.Errorf("webhook requireTimestamp cannot be used with polling, whose callbacks are not signed")
+		}
+	}
+	if c.Admin.Enabled && len(c.Admin.Token) < 16 {
+		return fmt.Errorf("admin token must be at least 16 characters when admin API is enabled")
+	}
+	if c.Debug.Pprof {
+		if len(c.Debug.PprofToken) < 16 {
+			return fmt.Errorf("debug: pprofToken must be at least 16 characters when pprof is enabled")
+		}
+		if c.Admin.Enabled && c.Debug.PprofToken == c.Admin.Token {
+			return fmt.Errorf("debug: pprofToken must differ from the admin token")
+		}
+	}
+	if c.PullValidation.MaxFileBytes < 0 {
+		return fmt.Errorf("pullValidation.maxFileBytes must not be negative")
+	}
+	if c.Outbound.Proxy != "" {
+		if _, err := netutil.ParseProxyURL(c.Outbound.Proxy); err != nil {
+			return fmt.Errorf("outbound: %w", err)
+		}
+	}
+	if c.SiteAuth.Enabled {
+		if len(c.SiteAuth.Users) == 0 && len(c.SiteAuth.Tokens) == 0 {
+			return fmt.Errorf("siteAuth requires at least one user or token")
+		}
+		for user, password := range c.SiteAuth.Users {
+			if user == "" || strings.Contains(user, ":") {
+				return fmt.Errorf("siteAuth: invalid user name %q", user)
+			}
+			if digest, ok := strings.CutPrefix(password, "sha256:"); ok {
+				if raw, err := hex.DecodeString(digest); err != nil || len(raw) != 32 {
+					return fmt.Errorf("siteAuth: user %q has an invalid sha256 digest", user)
+				}
+			}
+		}
+		for _, token := range c.SiteAuth.Tokens {
+			if len(strings.TrimSpace(token)) < 16 {
+				return fmt.Errorf("siteAuth tokens must be at least 16 characters")
+			}
+		}
+	}
+	if c.EditTokens.Enabled && len(c.EditTokens.Secret) < 32 {
+		return fmt.Errorf("editTokens secret must be at least 32 characters")
+	}
+	if c.Auth.Enabled {
+		if err := c.Auth.validate(); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if c.EditQuotas.Enabled && c.EditQuotas.DailyEdits <= 0 && c.EditQuotas.DailyBytes <= 0 {
+		return fmt.Errorf("editQuotas needs dailyEdits or dailyBytes")
+	}
+	for name := range c.RateLimits.Endpoints {
+		if _, ok := RateLimitEndpoints[name]; !ok {
+			return fmt.Errorf("rateLimits: unknown endpoint %q", name)
+		}
+	}
+	if c.Challenge.Enabled {
+		if err := c.Challenge.validate(); err != nil {
+			return fmt.Errorf("challenge: %w", err)
+		}
+	}
+	if c.Analytics.RetentionDays < 0 || c.Analytics.FlushSec < 0 {
+		return fmt.Errorf("analytics: retentionDays and flushSec must not be negative")
+	}
+	if c.Uploads.Enabled {
+		for _, segment := range strings.Split(c.Uploads.Dir, "/") {
+			if strings.HasPrefix(segment, ".") || strings.HasPrefix(segment, "-") {
+				return fmt.Errorf("uploads dir %q must not contain hidden or dash-prefixed segments", c.Uploads.Dir)
+			}
+		}
+		for _, mediaType := range c.Uploads.Types {
+			if _, _, err := mime.ParseMediaType(mediaType); err != nil {
+				return fmt.Errorf("uploads type %q: %w", mediaType, err)
+			}
+		}
+	}
+	for _, mediaType := range c.Assets.Types {
+		if !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("assets: %q is not a media type or \"type/*\"", mediaType)
+		}
+	}
+	if c.Bots.Enabled {
+		if len(c.Bots.Tokens) == 0 {
+			return fmt.Errorf("bots needs at least one token")
+		}
+		for name, token := range c.Bots.Tokens {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("bots token names must not be empty")
+			}
+			if len(token) < 16 {
+				return fmt.Errorf("bots token for %q must be at least 16 characters", name)
+			}
+		}
+	}
+	if c.CDN.Enabled {
+		if err := c.CDN.validate(); err != nil {
+			return fmt.Errorf("cdn: %w", err)
+		}
+	}
+	if c.Replica.Enabled {
+		if c.Replica.PrimaryURL == "" {
+			return fmt.Errorf("replica primaryUrl required when replica mode is enabled")
+		}
+		parsed, err := url.ParseRequestURI(c.Replica.PrimaryURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid replica primaryUrl %q", c.Replica.PrimaryURL)
+		}
+	}
 	if !c.Webhook.Enabled {
 		c.Webhook.Polling.Enabled = false
 	}
@@ -258,6 +1676,9 @@ func (c *Config) validate() error {
 		if c.Webhook.Polling.interval <= 0 {
 			return fmt.Errorf("webhook polling interval must be positive")
 		}
+		if v := c.Webhook.Polling.ProtocolVersion; v != 1 && v != 2 {
+			return fmt.Errorf("unsupported webhook polling protocolVersion %d", v)
+		}
 		if c.Git.repositoryPath == "" {
 			return fmt.Errorf("unable to derive repository path from git remote %q", c.Git.Remote)
 		}
@@ -265,8 +1686,108 @@ func (c *Config) validate() error {
 	return nil
 }
 
+// Redacted returns a copy of the configuration with secrets cleared, and
+// credentials stripped from remote, proxy and endpoint URLs, so it can be
+// exported alongside backups or diagnostics.
+func (c *Config) Redacted() *Config {
+	clone := *c
+	clone.Webhook.Secret = ""
+	clone.Metrics.Token = ""
+	clone.Admin.Token = ""
+	clone.CDN.Token = ""
+	clone.SiteAuth.Users = nil
+	clone.SiteAuth.Tokens = nil
+	clone.EditTokens.Secret = ""
+	clone.Auth.ClientSecret = ""
+	clone.Auth.SessionSecret = ""
+	clone.Bots.Tokens = nil
+	clone.Challenge.Secret = ""
+	clone.Debug.PprofToken = ""
+	clone.Git.Remote = gitutil.RedactURL(clone.Git.Remote)
+	clone.Git.PushRemote = gitutil.RedactURL(clone.Git.PushRemote)
+	if c.Git.Mirrors != nil {
+		clone.Git.Mirrors = make([]string, len(c.Git.Mirrors))
+		for i, mirror := range c.Git.Mirrors {
+			clone.Git.Mirrors[i] = gitutil.RedactURL(mirror)
+		}
+	}
+	clone.Outbound.Proxy = gitutil.RedactURL(clone.Outbound.Proxy)
+	clone.CDN.PurgeURL = redactEndpoint(clone.CDN.PurgeURL)
+	clone.Replica.PrimaryURL = redactEndpoint(clone.Replica.PrimaryURL)
+	clone.Webhook.Polling.Endpoint = redactEndpoint(clone.Webhook.Polling.Endpoint)
+	clone.Webhook.Polling.CallbackURL = redactEndpoint(clone.Webhook.Polling.CallbackURL)
+	return &clone
+}
+
+// redactEndpoint strips credentials and the query, which often carries an
+// API key, from an endpoint URL.
+func redactEndpoint(raw string) string {
+	redacted := gitutil.RedactURL(raw)
+	if i := strings.IndexAny(redacted, "?#"); i >= 0 {
+		redacted = redacted[:i]
+	}
+	return redacted
+}
+
+func (a *AuthConfig) validate() error {
+	for name, raw := range map[string]string{"issuer": a.Issuer, "redirectUrl": a.RedirectURL} {
+		parsed, err := url.ParseRequestURI(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid %s %q", name, raw)
+		}
+	}
+	if a.ClientID == "" {
+		return fmt.Errorf("clientId is required")
+	}
+	if !slices.Contains(a.Scopes, "openid") {
+		return fmt.Errorf("scopes must include openid")
+	}
+	if len(a.SessionSecret) < 32 {
+		return fmt.Errorf("sessionSecret must be at least 32 characters")
+	}
+	if strings.ContainsAny(a.CookieName, " \t;,=\"") {
+		return fmt.Errorf("invalid cookieName %q", a.CookieName)
+	}
+	return nil
+}
+
+func (c *CDNConfig) validate() error {
+	parsed, err := url.ParseRequestURI(c.SiteURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid siteUrl %q", c.SiteURL)
+	}
+	switch c.Provider {
+	case CDNProviderURL:
+		if !strings.Contains(c.PurgeURL, "{url}") && !strings.Contains(c.PurgeURL, "{path}") {
+			return fmt.Errorf("purgeUrl must contain {url} or {path}")
+		}
+		if _, err := url.ParseRequestURI(strings.NewReplacer("{url}", "x", "{path}", "x").Replace(c.PurgeURL)); err != nil {
+			return fmt.Errorf("invalid purgeUrl: %w", err)
+		}
+	case CDNProviderCloudflare:
+		if c.ZoneID == "" || c.Token == "" {
+			return fmt.Errorf("zoneId and token are required for the cloudflare provider")
+		}
+		if _, err := url.ParseRequestURI(c.APIBase); err != nil {
+			return fmt.Errorf("invalid apiBase: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q (available: %s, %s)", c.Provider, CDNProviderURL, CDNProviderCloudflare)
+	}
+	return nil
+}
+
 func (c *Config) IsPathPrivate(route string) bool {
-	if len(c.privatePagePrefixes) == 0 {
+	return matchRoutePrefixes(c.privatePagePrefixes, route)
+}
+
+// IsPathArchived reports whether route lies under archivedPagesPrefix.
+func (c *Config) IsPathArchived(route string) bool {
+	return matchRoutePrefixes(c.archivedPagePrefixes, route)
+}
+
+func matchRoutePrefixes(prefixes []string, route string) bool {
+	if len(prefixes) == 0 {
 		return false
 	}
 	normalized, err := normalizeRoute(route)
@@ -276,7 +1797,7 @@ func (c *Config) IsPathPrivate(route string) bool {
 	if normalized == "" {
 		normalized = "/"
 	}
-	for _, prefix := range c.privatePagePrefixes {
+	for _, prefix := range prefixes {
 		if prefix == "/" {
 			return true
 		}
@@ -288,14 +1809,30 @@ func (c *Config) IsPathPrivate(route string) bool {
 }
 
 func (c *Config) compilePrivatePages() error {
-	if c.privatePagePrefixes != nil {
-		c.privatePagePrefixes = c.privatePagePrefixes[:0]
+	prefixes, err := compileRoutePrefixes(c.PrivatePagesPrefix)
+	if err != nil {
+		return fmt.Errorf("invalid private %w", err)
 	}
+	c.privatePagePrefixes = prefixes
+	return nil
+}
+
+func (c *Config) compileArchivedPages() error {
+	prefixes, err := compileRoutePrefixes(c.ArchivedPagesPrefix)
+	if err != nil {
+		return fmt.Errorf("invalid archived %w", err)
+	}
+	c.archivedPagePrefixes = prefixes
+	return nil
+}
+
+func compileRoutePrefixes(raws []string) ([]string, error) {
+	var prefixes []string
 	seen := map[string]struct{}{}
-	for _, raw := range c.PrivatePagesPrefix {
+	for _, raw := range raws {
 		norm, err := normalizeRoute(raw)
 		if err != nil {
-			return fmt.Errorf("invalid private route prefix %q: %w", raw, err)
+			return nil, fmt.Errorf("route prefix %q: %w", raw, err)
 		}
 		if norm == "" {
 			continue
@@ -304,11 +1841,86 @@ func (c *Config) compilePrivatePages() error {
 			continue
 		}
 		seen[norm] = struct{}{}
-		c.privatePagePrefixes = append(c.privatePagePrefixes, norm)
+		prefixes = append(prefixes, norm)
+	}
+	return prefixes, nil
+}
+
+func (c *Config) compileRobotsRules() error {
+	for i := range c.Robots.Rules {
+		rule := &c.Robots.Rules[i]
+		norm, err := normalizeRoute(rule.Prefix)
+		if err != nil {
+			return fmt.Errorf("invalid robots prefix %q: %w", rule.Prefix, err)
+		}
+		if norm == "" {
+			norm = "/"
+		}
+		rule.Prefix = norm
+		rule.Directives = strings.TrimSpace(rule.Directives)
+		if rule.Directives == "" {
+			return fmt.Errorf("robots rule for %q has no directives", rule.Prefix)
+		}
+	}
+	agents := c.Robots.BlockUserAgents[:0]
+	for _, agent := range c.Robots.BlockUserAgents {
+		if agent = strings.TrimSpace(agent); agent != "" {
+			agents = append(agents, agent)
+		}
 	}
+	c.Robots.BlockUserAgents = agents
 	return nil
 }
 
+// IsStaging reports whether this instance is a test deployment.
+func (c *Config) IsStaging() bool {
+	return c.Environment == EnvironmentStaging
+}
+
+// RobotsDirectives returns the directives of the longest robots rule prefix
+// matching route, or an empty string when no rule applies. Staging instances
+// are never indexed.
+func (c *Config) RobotsDirectives(route string) string {
+	if c.IsStaging() {
+		return stagingRobots
+	}
+	if len(c.Robots.Rules) == 0 {
+		return ""
+	}
+	normalized, err := normalizeRoute(route)
+	if err != nil {
+		return ""
+	}
+	if normalized == "" {
+		normalized = "/"
+	}
+	directives, longest := "", -1
+	for _, rule := range c.Robots.Rules {
+		if len(rule.Prefix) <= longest {
+			continue
+		}
+		if rule.Prefix == "/" || normalized == rule.Prefix || strings.HasPrefix(normalized, rule.Prefix+"/") {
+			directives, longest = rule.Directives, len(rule.Prefix)
+		}
+	}
+	return directives
+}
+
+// IsUserAgentBlocked reports whether userAgent contains one of the blocked
+// crawler names, compared case-insensitively.
+func (c *Config) IsUserAgentBlocked(userAgent string) bool {
+	if userAgent == "" {
+		return false
+	}
+	lowered := strings.ToLower(userAgent)
+	for _, agent := range c.Robots.BlockUserAgents {
+		if strings.Contains(lowered, strings.ToLower(agent)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Config) compileTrustedProxies() error {
 	if c.trustedProxyPrefixes != nil {
 		c.trustedProxyPrefixes = c.trustedProxyPrefixes[:0]
@@ -0,0 +1,65 @@
+package edittoken
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/sealed"
+)
+
+// kind prefixes every token, so the format can change without accepting old
+// tokens by accident, and session cookies signed with the same secret are
+// not taken for edit tokens.
+const kind = "e1"
+
+var (
+	ErrMalformed = errors.New("malformed edit token")
+	ErrSignature = errors.New("invalid edit token signature")
+	ErrExpired   = errors.New("edit token expired")
+)
+
+// Claims are the grants carried by an edit token.
+type Claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Expires returns the expiry as a time.
+func (c Claims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0).UTC()
+}
+
+// Mint signs a token for subject that expires after ttl.
+func Mint(secret []byte, subject string, ttl time.Duration, now time.Time) (string, Claims, error) {
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "", Claims{}, errors.New("subject required")
+	}
+	if ttl <= 0 {
+		return "", Claims{}, errors.New("ttl must be positive")
+	}
+	claims := Claims{Subject: subject, IssuedAt: now.Unix(), ExpiresAt: now.Add(ttl).Unix()}
+	token, err := sealed.Seal(secret, kind, claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	return token, claims, nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func Verify(secret []byte, token string, now time.Time) (Claims, error) {
+	var claims Claims
+	err := sealed.Open(secret, kind, token, &claims)
+	switch {
+	case errors.Is(err, sealed.ErrSignature):
+		return Claims{}, ErrSignature
+	case err != nil || claims.Subject == "":
+		return Claims{}, ErrMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpired
+	}
+	return claims, nil
+}
@@ -1,13 +1,17 @@
 package gitutil
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,17 +20,57 @@ import (
 
 // Repository represents a cloned git repository and offers limited VCS operations.
 type Repository struct {
-	Dir            string
-	Remote         string
+	Dir    string
+	Remote string
+	// PushRemote optionally receives pushes instead of Remote, eg. a fork
+	// of a read-only upstream mirror. Fetches always use Remote.
+	PushRemote string
+	// Mirrors are tried in order once pulls from Remote have failed
+	// MirrorFailoverAfter times in a row.
+	Mirrors             []string
+	MirrorFailoverAfter int
+	// CommitterName and CommitterEmail, when set, override the git identity
+	// recorded as committer, leaving the per-edit author untouched.
+	CommitterName  string
+	CommitterEmail string
 	GitPath        string
 	CommandTimeout time.Duration
-	mu             sync.Mutex
+	// Logger, when set, receives the git commands run at debug level, and
+	// those slower than SlowThreshold as warnings.
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+	// Hardening, when set, isolates git from the host's configuration.
+	Hardening       *Hardening
+	mu              sync.Mutex
+	primaryFailures int
+	lastPullSource  string
+	logCache        map[logCacheKey]logCacheEntry
 }
 
+// logCacheKey identifies a memoized Log page. HEAD is part of the key so
+// any new commit naturally misses the cache.
+type logCacheKey struct {
+	head     string
+	path     string
+	page     int
+	pageSize int
+}
+
+type logCacheEntry struct {
+	commits []Commit
+	hasMore bool
+}
+
+// maxLogCacheEntries bounds the memoized Log pages kept between commits.
+const maxLogCacheEntries = 256
+
 // ErrRemoteAhead indicates the upstream repository contains commits the
 // local clone has not incorporated yet.
 var ErrRemoteAhead = errors.New("remote contains newer commits")
 
+// ErrUnknownRevision indicates a revision that does not name a commit.
+var ErrUnknownRevision = errors.New("unknown revision")
+
 // Commit encapsulates log metadata for UI consumption.
 type Commit struct {
 	Hash        string    `json:"hash"`
@@ -36,18 +80,44 @@ type Commit struct {
 	CommittedAt time.Time `json:"committedAt"`
 }
 
+// BlameLine attributes one line of a file to the commit that last changed
+// it.
+type BlameLine struct {
+	Line        int       `json:"line"`
+	Text        string    `json:"text"`
+	Hash        string    `json:"hash"`
+	Author      string    `json:"author"`
+	Email       string    `json:"email"`
+	Summary     string    `json:"summary"`
+	CommittedAt time.Time `json:"committedAt"`
+}
+
 // NewRepository ensures the repository exists locally by cloning if needed.
 func NewRepository(gitPath, remote, dir string, timeout time.Duration) (*Repository, error) {
-	if timeout <= 0 {
-		timeout = 120 * time.Second
-	}
-	repo := &Repository{Dir: dir, Remote: remote, GitPath: gitPath, CommandTimeout: timeout}
+	repo := OpenRepository(gitPath, remote, dir, timeout)
 	if err := repo.ensureClone(); err != nil {
 		return nil, err
 	}
 	return repo, nil
 }
 
+// OpenRepository returns a handle without touching the filesystem; call
+// EnsureClone before running other operations.
+func OpenRepository(gitPath, remote, dir string, timeout time.Duration) *Repository {
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	return &Repository{Dir: dir, Remote: remote, GitPath: gitPath, CommandTimeout: timeout}
+}
+
+// EnsureClone clones the remote, or initialises a local-only repository,
+// when the working copy does not exist yet.
+func (r *Repository) EnsureClone() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ensureClone()
+}
+
 // Pull updates the repository with remote changes.
 func (r *Repository) Pull(ctx context.Context) (bool, error) {
 	if strings.TrimSpace(r.Remote) == "" {
@@ -61,38 +131,101 @@ func (r *Repository) Pull(ctx context.Context) (bool, error) {
 	defer r.mu.Unlock()
 
 	prev, prevErr := r.headHash(ctx)
-
-	cmd := r.command(ctx, "pull", "--ff-only")
 	if prevErr != nil {
 		return false, prevErr
 	}
-	if out, err := cmd.CombinedOutput(); err != nil {
-		outStr := string(out)
-		if bytes.Contains(out, []byte("You have not concluded your merge")) {
-			return false, fmt.Errorf("pull aborted: %s", out)
-		}
-		if needsRebaseFallback(outStr) {
-			if err := r.pullWithRebase(ctx); err != nil {
-				return false, err
-			}
-			after, afterErr := r.headHash(ctx)
-			if afterErr != nil {
-				return false, afterErr
+
+	err := r.pullLocked(ctx)
+	if err == nil {
+		r.primaryFailures = 0
+		r.lastPullSource = r.Remote
+	} else if len(r.Mirrors) > 0 {
+		r.primaryFailures++
+		if r.primaryFailures >= max(r.MirrorFailoverAfter, 1) {
+			source, mirrorErr := r.pullFromMirrors(ctx)
+			if mirrorErr != nil {
+				return false, errors.Join(err, mirrorErr)
 			}
-			return after != prev, nil
+			err = nil
+			r.lastPullSource = source
 		}
-		return false, fmt.Errorf("git pull: %w (%s)", err, outStr)
 	}
+	if err != nil {
+		return false, err
+	}
+
 	after, afterErr := r.headHash(ctx)
 	if afterErr != nil {
 		return false, afterErr
 	}
+	if after != prev {
+		r.invalidateLogCacheLocked()
+	}
 	return after != prev, nil
 }
 
-func (r *Repository) pullWithRebase(ctx context.Context) error {
-	cmd := r.command(ctx, "pull", "--rebase")
-	out, err := cmd.CombinedOutput()
+// LastPullSource reports the remote that served the most recent successful pull.
+func (r *Repository) LastPullSource() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastPullSource
+}
+
+func (r *Repository) pullLocked(ctx context.Context, args ...string) error {
+	pullArgs := append([]string{"pull", "--ff-only"}, args...)
+	cmd := r.command(ctx, pullArgs...)
+	if out, err := r.combinedOutput(cmd); err != nil {
+		outStr := string(out)
+		if bytes.Contains(out, []byte("You have not concluded your merge")) {
+			return fmt.Errorf("pull aborted: %s", out)
+		}
+		if needsRebaseFallback(outStr) {
+			return r.pullWithRebase(ctx, args...)
+		}
+		return fmt.Errorf("git pull: %w (%s)", err, outStr)
+	}
+	return nil
+}
+
+// Branch returns the name of the branch checked out.
+func (r *Repository) Branch(ctx context.Context) (string, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.branchLocked(ctx)
+}
+
+func (r *Repository) branchLocked(ctx context.Context) (string, error) {
+	out, err := r.output(r.command(ctx, "rev-parse", "--abbrev-ref", "HEAD"))
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pullFromMirrors pulls the current branch from the first reachable mirror.
+func (r *Repository) pullFromMirrors(ctx context.Context) (string, error) {
+	branch, err := r.branchLocked(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []error
+	for _, mirror := range r.Mirrors {
+		if err := r.pullLocked(ctx, mirror, branch); err != nil {
+			errs = append(errs, fmt.Errorf("mirror %s: %w", RedactURL(mirror), err))
+			continue
+		}
+		return mirror, nil
+	}
+	return "", errors.Join(errs...)
+}
+
+func (r *Repository) pullWithRebase(ctx context.Context, args ...string) error {
+	cmd := r.command(ctx, append([]string{"pull", "--rebase"}, args...)...)
+	out, err := r.combinedOutput(cmd)
 	if err != nil {
 		return fmt.Errorf("git pull --rebase: %w (%s)", err, string(out))
 	}
@@ -118,9 +251,21 @@ func (r *Repository) RemoteAhead(ctx context.Context) (bool, error) {
 	return r.remoteAheadLocked(ctx)
 }
 
+// Head returns the commit hash currently checked out, or an empty string for
+// repositories without commits.
+func (r *Repository) Head(ctx context.Context) (string, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.headHash(ctx)
+}
+
 func (r *Repository) headHash(ctx context.Context) (string, error) {
 	cmd := r.command(ctx, "rev-parse", "HEAD")
-	out, err := cmd.Output()
+	out, err := r.output(cmd)
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
@@ -175,13 +320,21 @@ func (r *Repository) Log(ctx context.Context, path string, page, pageSize int) (
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	key := logCacheKey{path: filepath.ToSlash(path), page: page, pageSize: pageSize}
+	if head, err := r.headHash(ctx); err == nil && head != "" {
+		key.head = head
+		if cached, ok := r.logCache[key]; ok {
+			return append([]Commit(nil), cached.commits...), cached.hasMore, nil
+		}
+	}
+
 	offset := page * pageSize
 	args := []string{"log", fmt.Sprintf("--skip=%d", offset), fmt.Sprintf("-n%d", pageSize+1), "--date=unix", "--pretty=%H%x00%an%x00%ae%x00%at%x00%s"}
 	if path != "" {
 		args = append(args, "--", filepath.ToSlash(path))
 	}
 	cmd := r.command(ctx, args...)
-	out, err := cmd.Output()
+	out, err := r.output(cmd)
 	if err != nil {
 		return nil, false, fmt.Errorf("git log: %w", err)
 	}
@@ -212,9 +365,154 @@ func (r *Repository) Log(ctx context.Context, path string, page, pageSize int) (
 		})
 	}
 
+	if key.head != "" {
+		if r.logCache == nil || len(r.logCache) >= maxLogCacheEntries {
+			r.logCache = make(map[logCacheKey]logCacheEntry)
+		}
+		r.logCache[key] = logCacheEntry{commits: append([]Commit(nil), commits...), hasMore: hasMore}
+	}
 	return commits, hasMore, nil
 }
 
+// LastCommitPerPath returns the most recent commit touching each file, from
+// a single history traversal instead of one `git log` per file.
+func (r *Repository) LastCommitPerPath(ctx context.Context) (map[string]Commit, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := r.command(ctx, "-c", "core.quotePath=false", "log", "--name-only", "--no-renames", "--date=unix", "--pretty=%x1e%H%x00%an%x00%ae%x00%at%x00%s")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+	defer r.trace(cmd, time.Now())
+
+	latest := make(map[string]Commit)
+	var current Commit
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if header, ok := bytes.CutPrefix(line, []byte{0x1e}); ok {
+			parts := bytes.Split(header, []byte{0})
+			if len(parts) != 5 {
+				current = Commit{}
+				continue
+			}
+			seconds, err := parseUnix(parts[3])
+			if err != nil {
+				current = Commit{}
+				continue
+			}
+			current = Commit{
+				Hash:        string(parts[0]),
+				Author:      string(parts[1]),
+				Email:       string(parts[2]),
+				CommittedAt: time.Unix(seconds, 0).UTC(),
+				Message:     string(parts[4]),
+			}
+			continue
+		}
+		if len(line) == 0 || current.Hash == "" {
+			continue
+		}
+		// History is newest first, so the first sighting wins.
+		if _, seen := latest[string(line)]; !seen {
+			latest[string(line)] = current
+		}
+	}
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(latest) == 0 {
+			// Repositories without commits have no history to report.
+			return latest, nil
+		}
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+	if scanErr != nil {
+		return nil, fmt.Errorf("git log: %w", scanErr)
+	}
+	return latest, nil
+}
+
+// FileChange is a file touched by a commit. Status is git's change letter,
+// eg. "A", "M" or "D".
+type FileChange struct {
+	Path   string
+	Status string
+}
+
+// ChangeSet is a commit together with the files it touched.
+type ChangeSet struct {
+	Commit
+	Files []FileChange
+}
+
+// RecentChanges returns the last limit commits with the files each touched,
+// newest first.
+func (r *Repository) RecentChanges(ctx context.Context, limit int) ([]ChangeSet, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := r.command(ctx, "-c", "core.quotePath=false", "log", fmt.Sprintf("-n%d", limit), "--name-status", "--no-renames", "--date=unix", "--pretty=%x1e%H%x00%an%x00%ae%x00%at%x00%s")
+	out, err := r.output(cmd)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) == 0 {
+			// Repositories without commits have no history to report.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+
+	var changes []ChangeSet
+	for _, record := range bytes.Split(out, []byte{0x1e}) {
+		lines := bytes.Split(bytes.TrimSpace(record), []byte("\n"))
+		parts := bytes.Split(lines[0], []byte{0})
+		if len(parts) != 5 {
+			continue
+		}
+		seconds, err := parseUnix(parts[3])
+		if err != nil {
+			return nil, err
+		}
+		change := ChangeSet{Commit: Commit{
+			Hash:        string(parts[0]),
+			Author:      string(parts[1]),
+			Email:       string(parts[2]),
+			CommittedAt: time.Unix(seconds, 0).UTC(),
+			Message:     string(parts[4]),
+		}}
+		for _, line := range lines[1:] {
+			status, path, ok := bytes.Cut(line, []byte("\t"))
+			if !ok {
+				continue
+			}
+			change.Files = append(change.Files, FileChange{Path: string(path), Status: string(status)})
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// invalidateLogCacheLocked drops memoized history after HEAD moved.
+func (r *Repository) invalidateLogCacheLocked() {
+	r.logCache = nil
+}
+
 // Diff renders a colored diff between two commits for a path.
 func (r *Repository) Diff(ctx context.Context, path, from, to string) (string, error) {
 	ctx, cancel := r.ensureContext(ctx)
@@ -227,20 +525,206 @@ func (r *Repository) Diff(ctx context.Context, path, from, to string) (string, e
 		return "", errors.New("from and to commit hashes are required")
 	}
 	args := []string{"diff", fmt.Sprintf("%s..%s", from, to), "--", filepath.ToSlash(path)}
-	cmd := r.command(ctx, args...)
-	out, err := cmd.CombinedOutput()
+	out, err := r.output(r.command(ctx, args...))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git diff: %w (%s)", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git diff: %w", err)
+	}
+	return string(out), nil
+}
+
+// DiffContent renders the diff a commit of content to path would show
+// against HEAD. Nothing is written to the repository: the content at HEAD
+// and the new content are compared as files outside of it.
+func (r *Repository) DiffContent(ctx context.Context, path string, content []byte) (string, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := os.MkdirTemp("", "wiki-diff-")
 	if err != nil {
-		return "", fmt.Errorf("git diff: %w (%s)", err, string(out))
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	rel := filepath.ToSlash(path)
+
+	// Named a/<path> and b/<path>, the files show up in the diff as they
+	// would in one of the repository.
+	oldName := os.DevNull
+	if current, err := r.output(r.command(ctx, "cat-file", "blob", "HEAD:"+rel)); err == nil {
+		oldName = filepath.Join("a", filepath.FromSlash(rel))
+		if err := writeDiffFile(filepath.Join(dir, oldName), current); err != nil {
+			return "", err
+		}
+	}
+	newName := filepath.Join("b", filepath.FromSlash(rel))
+	if err := writeDiffFile(filepath.Join(dir, newName), content); err != nil {
+		return "", err
+	}
+	cmd := r.command(ctx, "diff", "--no-index", "--no-prefix", "--", oldName, newName)
+	cmd.Dir = dir
+	out, err := r.output(cmd)
+	if err != nil {
+		// The exit status is 1 when the files differ.
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return "", fmt.Errorf("git diff: %w", err)
+		}
+	}
+	if oldName == os.DevNull {
+		out = bytes.Replace(out, []byte("diff --git b/"), []byte("diff --git a/"), 1)
 	}
 	return string(out), nil
 }
 
+func writeDiffFile(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(name, content, 0o644)
+}
+
+// Blame attributes every line of a file at HEAD to the commit that last
+// changed it.
+func (r *Repository) Blame(ctx context.Context, path string) ([]BlameLine, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, err := r.output(r.command(ctx, "blame", "--porcelain", "HEAD", "--", filepath.ToSlash(path)))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "no such path") {
+			return nil, fmt.Errorf("git blame %s: %w", path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("git blame: %w", err)
+	}
+	return parseBlame(out), nil
+}
+
+// parseBlame reads the output of git blame --porcelain. Commit details are
+// only given with the first line of each commit.
+func parseBlame(out []byte) []BlameLine {
+	commits := make(map[string]*BlameLine)
+	var lines []BlameLine
+	var current *BlameLine
+	lineNo := 0
+	for _, raw := range strings.Split(string(out), "\n") {
+		if text, ok := strings.CutPrefix(raw, "\t"); ok {
+			if current != nil {
+				line := *current
+				line.Line, line.Text = lineNo, text
+				lines = append(lines, line)
+			}
+			current = nil
+			continue
+		}
+		key, value, _ := strings.Cut(raw, " ")
+		if current == nil {
+			fields := strings.Fields(raw)
+			if len(fields) < 3 {
+				continue
+			}
+			lineNo, _ = strconv.Atoi(fields[2])
+			if current = commits[fields[0]]; current == nil {
+				current = &BlameLine{Hash: fields[0]}
+				commits[fields[0]] = current
+			}
+			continue
+		}
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.Email = strings.Trim(value, "<>")
+		case "committer-time":
+			if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.CommittedAt = time.Unix(unix, 0).UTC()
+			}
+		case "summary":
+			current.Summary = value
+		}
+	}
+	return lines
+}
+
 // ReadFile reads repository content at HEAD.
 func (r *Repository) ReadFile(path string) ([]byte, error) {
 	full := filepath.Join(r.Dir, filepath.FromSlash(path))
 	return os.ReadFile(full)
 }
 
+// ReadFileAt reads a file as of the given commit. It returns the full hash
+// of the commit, ErrUnknownRevision when revision names no commit, and
+// os.ErrNotExist when the file did not exist in it.
+func (r *Repository) ReadFileAt(ctx context.Context, path, revision string) ([]byte, string, error) {
+	revision = strings.TrimSpace(revision)
+	if revision == "" || strings.HasPrefix(revision, "-") {
+		return nil, "", ErrUnknownRevision
+	}
+
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, err := r.output(r.command(ctx, "rev-parse", "--verify", "--quiet", revision+"^{commit}"))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownRevision, revision)
+	}
+	hash := strings.TrimSpace(string(out))
+	content, err := r.output(r.command(ctx, "cat-file", "blob", hash+":"+filepath.ToSlash(path)))
+	if err != nil {
+		return nil, hash, fmt.Errorf("%s at %s: %w", path, hash, os.ErrNotExist)
+	}
+	return content, hash, nil
+}
+
+// MergeFile merges the changes from base to theirs into ours with git
+// merge-file, returning the result and the number of conflicts left in it.
+// Conflicts are marked diff3 style, with the given labels naming ours, base
+// and theirs.
+func (r *Repository) MergeFile(ctx context.Context, ours, base, theirs []byte, labels [3]string) ([]byte, int, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "wiki-merge-")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"merge-file", "-p", "--diff3"}
+	for _, label := range labels {
+		args = append(args, "-L", label)
+	}
+	for i, content := range [][]byte{ours, base, theirs} {
+		name := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.WriteFile(name, content, 0o600); err != nil {
+			return nil, 0, err
+		}
+		args = append(args, name)
+	}
+
+	out, err := r.output(r.command(ctx, args...))
+	if err != nil {
+		// The exit status counts the conflicts; errors exit negative.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+			return out, exitErr.ExitCode(), nil
+		}
+		return nil, 0, fmt.Errorf("git merge-file: %w", err)
+	}
+	return out, 0, nil
+}
+
 // WriteFile writes to a file inside the repository.
 func (r *Repository) WriteFile(path string, data []byte) error {
 	full := filepath.Join(r.Dir, filepath.FromSlash(path))
@@ -259,7 +743,7 @@ func (r *Repository) Rename(ctx context.Context, oldPath, newPath string) error
 	defer r.mu.Unlock()
 
 	cmd := r.command(ctx, "mv", filepath.ToSlash(oldPath), filepath.ToSlash(newPath))
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		return fmt.Errorf("git mv: %w (%s)", err, string(out))
 	}
 	return nil
@@ -277,8 +761,12 @@ func (r *Repository) Push(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	cmd := r.command(ctx, "push")
-	if out, err := cmd.CombinedOutput(); err != nil {
+	args := []string{"push"}
+	if target := strings.TrimSpace(r.PushRemote); target != "" {
+		args = append(args, target, "HEAD")
+	}
+	cmd := r.command(ctx, args...)
+	if out, err := r.combinedOutput(cmd); err != nil {
 		outStr := string(out)
 		if isNonFastForward(outStr) {
 			return errors.Join(ErrRemoteAhead, fmt.Errorf("git push rejected: %s", strings.TrimSpace(outStr)))
@@ -299,6 +787,7 @@ func (r *Repository) CommitChanges(ctx context.Context, paths []string, message
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	defer r.invalidateLogCacheLocked()
 
 	sanitized := normalizePaths(paths)
 	stageArgs := []string{"add"}
@@ -309,13 +798,13 @@ func (r *Repository) CommitChanges(ctx context.Context, paths []string, message
 		stageArgs = append(stageArgs, sanitized...)
 	}
 	cmd := r.command(ctx, stageArgs...)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		outStr := strings.TrimSpace(string(out))
 		if len(sanitized) > 0 && (strings.Contains(outStr, "did not match any files") || strings.Contains(outStr, "pathspec")) {
 			fallback := []string{"add", "--update", "--"}
 			fallback = append(fallback, sanitized...)
 			cmd = r.command(ctx, fallback...)
-			if retryOut, retryErr := cmd.CombinedOutput(); retryErr != nil {
+			if retryOut, retryErr := r.combinedOutput(cmd); retryErr != nil {
 				return fmt.Errorf("git add: %w (%s)", retryErr, strings.TrimSpace(string(retryOut)))
 			}
 		} else {
@@ -331,14 +820,14 @@ func (r *Repository) CommitChanges(ctx context.Context, paths []string, message
 		commitArgs = append(commitArgs, "--author", author)
 	}
 	cmd = r.command(ctx, commitArgs...)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		outStr := string(out)
 		if strings.Contains(outStr, "nothing added to commit") {
 			if err := r.stageAll(ctx); err != nil {
 				return fmt.Errorf("git commit: %w", err)
 			}
 			cmd = r.command(ctx, commitArgs...)
-			if retryOut, retryErr := cmd.CombinedOutput(); retryErr != nil {
+			if retryOut, retryErr := r.combinedOutput(cmd); retryErr != nil {
 				return fmt.Errorf("git commit: %w (%s)", retryErr, string(retryOut))
 			}
 			return nil
@@ -350,12 +839,43 @@ func (r *Repository) CommitChanges(ctx context.Context, paths []string, message
 
 func (r *Repository) stageAll(ctx context.Context) error {
 	cmd := r.command(ctx, "add", "--all")
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		return fmt.Errorf("git add: %w (%s)", err, string(out))
 	}
 	return nil
 }
 
+// BlobHashes returns the staged blob hash of every tracked file whose base
+// name is one of names, keyed by path.
+func (r *Repository) BlobHashes(ctx context.Context, names ...string) (map[string]string, error) {
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := r.command(ctx, "-c", "core.quotePath=false", "ls-files", "-s", "-z")
+	out, err := r.output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+
+	blobs := make(map[string]string)
+	for _, entry := range bytes.Split(out, []byte{0}) {
+		// <mode> SP <blob> SP <stage> TAB <path>
+		meta, path, ok := bytes.Cut(entry, []byte("\t"))
+		if !ok {
+			continue
+		}
+		fields := bytes.Fields(meta)
+		if len(fields) != 3 || !slices.Contains(names, filepath.Base(string(path))) {
+			continue
+		}
+		blobs[string(path)] = string(fields[1])
+	}
+	return blobs, nil
+}
+
 // ListTrackedFiles returns all tracked files.
 func (r *Repository) ListTrackedFiles(ctx context.Context) ([]string, error) {
 	ctx, cancel := r.ensureContext(ctx)
@@ -365,7 +885,7 @@ func (r *Repository) ListTrackedFiles(ctx context.Context) ([]string, error) {
 	defer r.mu.Unlock()
 
 	cmd := r.command(ctx, "ls-files")
-	out, err := cmd.Output()
+	out, err := r.output(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("git ls-files: %w", err)
 	}
@@ -392,7 +912,8 @@ func (r *Repository) ensureClone() error {
 
 		cmd := exec.CommandContext(ctx, r.GitPath, "init")
 		cmd.Dir = r.Dir
-		if out, err := cmd.CombinedOutput(); err != nil {
+		r.harden(cmd)
+		if out, err := r.combinedOutput(cmd); err != nil {
 			return fmt.Errorf("git init: %w (%s)", err, string(out))
 		}
 		return nil
@@ -401,7 +922,8 @@ func (r *Repository) ensureClone() error {
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, r.GitPath, "clone", r.Remote, r.Dir)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	r.harden(cmd)
+	if out, err := r.combinedOutput(cmd); err != nil {
 		return fmt.Errorf("git clone: %w (%s)", err, string(out))
 	}
 	return nil
@@ -415,10 +937,17 @@ func (r *Repository) command(ctx context.Context, args ...string) *exec.Cmd {
 	baseArgs := []string{
 		"-c", "credential.helper=", // Disable credential helper to prevent daemon spawning
 	}
+	if r.CommitterName != "" && r.CommitterEmail != "" {
+		baseArgs = append(baseArgs, "-c", "user.name="+r.CommitterName, "-c", "user.email="+r.CommitterEmail)
+	}
+	if r.Hardening != nil {
+		baseArgs = append(baseArgs, "-c", r.safeDirectory())
+	}
 	fullArgs := append(baseArgs, args...)
 
 	cmd := exec.CommandContext(ctx, r.GitPath, fullArgs...)
 	cmd.Dir = r.Dir
+	r.harden(cmd)
 	return cmd
 }
 
@@ -447,7 +976,7 @@ func parseUnix(raw []byte) (int64, error) {
 
 func (r *Repository) fetchLocked(ctx context.Context) error {
 	cmd := r.command(ctx, "fetch", "--quiet")
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		return fmt.Errorf("git fetch: %w (%s)", err, strings.TrimSpace(string(out)))
 	}
 	return nil
@@ -455,7 +984,7 @@ func (r *Repository) fetchLocked(ctx context.Context) error {
 
 func (r *Repository) remoteAheadLocked(ctx context.Context) (bool, error) {
 	cmd := r.command(ctx, "rev-list", "--left-right", "--count", "HEAD...@{u}")
-	out, err := cmd.CombinedOutput()
+	out, err := r.combinedOutput(cmd)
 	output := strings.TrimSpace(string(out))
 	if err != nil {
 		if output == "" {
@@ -492,9 +1021,58 @@ func (r *Repository) ResetSoft(ctx context.Context, target string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.invalidateLogCacheLocked()
 	cmd := r.command(ctx, "reset", "--soft", target)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := r.combinedOutput(cmd); err != nil {
 		return fmt.Errorf("git reset --soft %s: %w (%s)", target, err, strings.TrimSpace(string(out)))
 	}
 	return nil
 }
+
+// ResetHard moves HEAD, the index and the working tree to target, discarding
+// any uncommitted changes.
+func (r *Repository) ResetHard(ctx context.Context, target string) error {
+	if strings.TrimSpace(target) == "" {
+		return errors.New("reset target required")
+	}
+
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.invalidateLogCacheLocked()
+	cmd := r.command(ctx, "reset", "--hard", "--quiet", target)
+	if out, err := r.combinedOutput(cmd); err != nil {
+		return fmt.Errorf("git reset --hard %s: %w (%s)", target, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ChangedFiles lists the paths that differ between two commits. Renames are
+// reported as a deletion plus an addition.
+func (r *Repository) ChangedFiles(ctx context.Context, from, to string) ([]string, error) {
+	if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+		return nil, errors.New("commit range required")
+	}
+
+	ctx, cancel := r.ensureContext(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := r.command(ctx, "diff", "--name-only", "--no-renames", "-z", from, to, "--")
+	out, err := r.output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s..%s: %w", from, to, err)
+	}
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,61 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Hardening isolates the git commands of a Repository from the host: the
+// system gitconfig is ignored, inherited GIT_* variables are dropped and
+// only the listed transports are allowed.
+type Hardening struct {
+	// Protocols are passed to git as GIT_ALLOW_PROTOCOL.
+	Protocols []string
+	// IgnoreGlobalConfig also ignores the gitconfig in $HOME.
+	IgnoreGlobalConfig bool
+	// PassEnv lists inherited GIT_* variables to keep.
+	PassEnv []string
+}
+
+// environ returns the environment of hardened git commands.
+func (h *Hardening) environ() []string {
+	inherited := os.Environ()
+	env := make([]string, 0, len(inherited)+4)
+	for _, kv := range inherited {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "GIT_") && !slices.Contains(h.PassEnv, name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	env = append(env,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_ALLOW_PROTOCOL="+strings.Join(h.Protocols, ":"),
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	if h.IgnoreGlobalConfig {
+		env = append(env, "GIT_CONFIG_GLOBAL="+os.DevNull)
+	}
+	return env
+}
+
+// harden runs cmd with the hardened environment, if any.
+func (r *Repository) harden(cmd *exec.Cmd) {
+	if r.Hardening != nil {
+		cmd.Env = r.Hardening.environ()
+	}
+}
+
+// safeDirectory returns the safe.directory setting that lets git trust the
+// working copy even when another user owns it. Hardened commands name it
+// explicitly instead of relying on host configuration.
+func (r *Repository) safeDirectory() string {
+	dir, err := filepath.Abs(r.Dir)
+	if err != nil {
+		dir = r.Dir
+	}
+	return "safe.directory=" + filepath.ToSlash(dir)
+}
@@ -0,0 +1,46 @@
+package gitutil
+
+import (
+	"os/exec"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var slowCommands = metrics.NewCounter("wiki_git_slow_commands_total", "Git commands slower than slowLog.gitMs.")
+
+// output runs cmd like cmd.Output, tracing it.
+func (r *Repository) output(cmd *exec.Cmd) ([]byte, error) {
+	defer r.trace(cmd, time.Now())
+	return cmd.Output()
+}
+
+// combinedOutput runs cmd like cmd.CombinedOutput, tracing it. The output
+// is meant for errors and logs: it is capped to maxCapturedOutput and
+// credentials in URLs are redacted.
+func (r *Repository) combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	defer r.trace(cmd, time.Now())
+	var buf cappedBuffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	return []byte(RedactURL(string(buf.Bytes()))), err
+}
+
+// trace logs a finished command with its arguments and duration, as a
+// warning when it took longer than SlowThreshold.
+func (r *Repository) trace(cmd *exec.Cmd, start time.Time) {
+	elapsed := time.Since(start)
+	slow := r.SlowThreshold > 0 && elapsed >= r.SlowThreshold
+	if slow {
+		slowCommands.Inc()
+	}
+	if r.Logger == nil {
+		return
+	}
+	if slow {
+		r.Logger.Warn("slow git command", "args", redactArgs(cmd.Args[1:]), "dir", cmd.Dir, "duration", elapsed)
+	} else {
+		r.Logger.Debug("git", "args", redactArgs(cmd.Args[1:]), "dir", cmd.Dir, "duration", elapsed)
+	}
+}
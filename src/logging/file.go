@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// rotatingFile appends to a log file, moving it to path.1 once it would grow
+// past maxSize, or was written to for maxAge, and shifting older backups up
+// to path.<maxBackups>.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// OpenRotatingFile opens a file that rotates like file sinks do, and also
+// once it was written to for maxAge, unless that is 0. Age counts from when
+// the file was created or, for a file left by an earlier run, opened.
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (io.WriteCloser, error) {
+	return openRotatingFile(path, maxSize, maxAge, maxBackups)
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	w := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingFile) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size, w.started = f, info.Size(), time.Now()
+	return nil
+}
+
+func (w *rotatingFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	full := w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize
+	old := w.maxAge > 0 && time.Since(w.started) >= w.maxAge
+	if w.size > 0 && (full || old) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new file. Without backups the
+// current file is truncated instead.
+func (w *rotatingFile) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if w.maxBackups > 0 {
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(w.backup(i), w.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(w.path, w.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(w.path, 0); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", w.path, n)
+}
+
+func (w *rotatingFile) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is where systemd-journald accepts its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+type journalWriter struct {
+	conn net.Conn
+	tag  string
+}
+
+func dialJournal(tag string) (*journalWriter, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn, tag: tag}, nil
+}
+
+func (w *journalWriter) WriteLine(level slog.Level, line string) error {
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", line)
+	journalField(&buf, "PRIORITY", strconv.Itoa(priority(level)))
+	journalField(&buf, "SYSLOG_IDENTIFIER", w.tag)
+	_, err := w.conn.Write(buf.Bytes())
+	return err
+}
+
+func (w *journalWriter) Close() error {
+	return w.conn.Close()
+}
+
+// journalField appends a field, switching to the length-prefixed form for
+// values spanning lines.
+func journalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
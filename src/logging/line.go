@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// lineWriter is a sink that takes one formatted record at a time along with
+// its level, such as syslog and journald.
+type lineWriter interface {
+	WriteLine(level slog.Level, line string) error
+	Close() error
+}
+
+// lineHandler formats records like the stdout handler, leaving out the
+// time, which these sinks record themselves.
+type lineHandler struct {
+	text slog.Handler
+	out  *lineOutput
+}
+
+// lineOutput is shared by a handler and those derived from it.
+type lineOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   lineWriter
+}
+
+func newLineHandler(w lineWriter, format string, level slog.Level) *lineHandler {
+	out := &lineOutput{w: w}
+	text := newHandler(&out.buf, format, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return &lineHandler{text: text, out: out}
+}
+
+func (h *lineHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.text.Enabled(ctx, level)
+}
+
+func (h *lineHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.buf.Reset()
+	if err := h.text.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.out.w.WriteLine(r.Level, strings.TrimSuffix(h.out.buf.String(), "\n"))
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &lineHandler{text: h.text.WithAttrs(attrs), out: h.out}
+}
+
+func (h *lineHandler) WithGroup(name string) slog.Handler {
+	return &lineHandler{text: h.text.WithGroup(name), out: h.out}
+}
+
+// priority maps a level to its syslog severity.
+func priority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
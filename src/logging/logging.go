@@ -0,0 +1,203 @@
+// Package logging builds the wiki's loggers from its configuration: the sinks
+// records are written to and the level of each subsystem.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+// Subsystems whose level can be set in logging.levels.
+const (
+	Git     = "git"
+	Webhook = "webhook"
+	Server  = "server"
+	Build   = "build"
+)
+
+// Loggers hands out loggers writing to the configured sinks.
+type Loggers struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+	closers []io.Closer
+}
+
+// New opens the sinks of cfg, or logs to stdout when none are configured.
+func New(cfg *config.Config) (*Loggers, error) {
+	l := &Loggers{level: ParseLevel(cfg.LogLevel), levels: make(map[string]slog.Level)}
+	for name, level := range cfg.Logging.Levels {
+		l.levels[name] = ParseLevel(level)
+	}
+	sinks := cfg.Logging.Sinks
+	if len(sinks) == 0 {
+		sinks = []config.LogSink{{Type: config.LogSinkStdout}}
+	}
+	var handlers fanout
+	for i, sink := range sinks {
+		handler, closer, err := openSink(sink, cfg.LogFormat)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("log sink %d (%s): %w", i, sink.Type, err)
+		}
+		if closer != nil {
+			l.closers = append(l.closers, closer)
+		}
+		handlers = append(handlers, handler)
+	}
+	if len(handlers) == 1 {
+		l.handler = handlers[0]
+	} else {
+		l.handler = handlers
+	}
+	return l, nil
+}
+
+// Logger returns the logger for records outside any subsystem, at logLevel.
+func (l *Loggers) Logger() *slog.Logger {
+	return slog.New(&leveled{level: l.level, next: l.handler})
+}
+
+// For returns the logger of a subsystem, at its own level when one is set.
+func (l *Loggers) For(subsystem string) *slog.Logger {
+	level, ok := l.levels[subsystem]
+	if !ok {
+		level = l.level
+	}
+	return slog.New(&leveled{level: level, next: l.handler}).With("subsystem", subsystem)
+}
+
+// Close closes the sinks that hold files or connections.
+func (l *Loggers) Close() error {
+	var errs []error
+	for _, closer := range l.closers {
+		errs = append(errs, closer.Close())
+	}
+	l.closers = nil
+	return errors.Join(errs...)
+}
+
+// ParseLevel maps a level name to its slog level; unknown names are info.
+func ParseLevel(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func openSink(sink config.LogSink, format string) (slog.Handler, io.Closer, error) {
+	level := slog.LevelDebug
+	if sink.Level != "" {
+		level = ParseLevel(sink.Level)
+	}
+	switch sink.Type {
+	case config.LogSinkStdout:
+		return newHandler(os.Stdout, format, &slog.HandlerOptions{Level: level}), nil, nil
+	case config.LogSinkFile:
+		file, err := openRotatingFile(sink.Path, int64(sink.MaxSizeMB)<<20, 0, sink.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newHandler(file, format, &slog.HandlerOptions{Level: level}), file, nil
+	case config.LogSinkSyslog:
+		w, err := dialSyslog(sink.Network, sink.Address, sink.Tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newLineHandler(w, format, level), w, nil
+	case config.LogSinkJournald:
+		w, err := dialJournal(sink.Tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newLineHandler(w, format, level), w, nil
+	}
+	return nil, nil, fmt.Errorf("unknown sink type %q", sink.Type)
+}
+
+// newHandler formats records as logfmt-like text, or as one JSON object per
+// line for log collectors.
+func newHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if format == config.LogFormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// leveled drops records below the level of a subsystem before they reach
+// the sinks, which apply their own levels, and tags records logged for a
+// request with its ID.
+type leveled struct {
+	level slog.Level
+	next  slog.Handler
+}
+
+func (h *leveled) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.next.Enabled(ctx, level)
+}
+
+func (h *leveled) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("requestId", id))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *leveled) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveled{level: h.level, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *leveled) WithGroup(name string) slog.Handler {
+	return &leveled{level: h.level, next: h.next.WithGroup(name)}
+}
+
+// fanout writes each record to every sink enabled for its level.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
@@ -0,0 +1,17 @@
+package logging
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID records the ID of the request ctx serves. Records logged
+// with ctx carry it as requestId.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID recorded by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,23 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"errors"
+	"log/slog"
+)
+
+type syslogWriter struct{}
+
+// dialSyslog is not implemented on this platform.
+func dialSyslog(network, address, tag string) (*syslogWriter, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (s *syslogWriter) WriteLine(level slog.Level, line string) error {
+	return errors.ErrUnsupported
+}
+
+func (s *syslogWriter) Close() error {
+	return nil
+}
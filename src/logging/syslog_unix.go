@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"log/slog"
+	"log/syslog"
+)
+
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// dialSyslog connects to a syslog daemon; an empty network and address use
+// the local one.
+func dialSyslog(network, address, tag string) (*syslogWriter, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) WriteLine(level slog.Level, line string) error {
+	switch priority(level) {
+	case 3:
+		return s.w.Err(line)
+	case 4:
+		return s.w.Warning(line)
+	case 6:
+		return s.w.Info(line)
+	default:
+		return s.w.Debug(line)
+	}
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
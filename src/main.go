@@ -6,12 +6,13 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/iedon/dn42-wiki-go/cdn"
 	"github.com/iedon/dn42-wiki-go/config"
 	"github.com/iedon/dn42-wiki-go/gitutil"
+	"github.com/iedon/dn42-wiki-go/logging"
 	"github.com/iedon/dn42-wiki-go/server"
 	"github.com/iedon/dn42-wiki-go/site"
 	"github.com/iedon/dn42-wiki-go/templatex"
@@ -19,6 +20,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	cfgPath := flag.String("config", "config.json", "path to configuration file")
 	buildFlag := flag.Bool("build", false, "force static build mode")
 	flag.Parse()
@@ -32,13 +39,31 @@ func main() {
 		cfg.Live = false
 	}
 
-	logger := newLogger(cfg.LogLevel)
+	loggers, err := logging.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	defer loggers.Close()
+	logger := loggers.Logger()
+	// The standard logger, used while building, goes to the same sinks.
+	slog.SetDefault(loggers.For(logging.Build))
 	logger.Info("starting", "live", cfg.Live)
 
-	repo, err := gitutil.NewRepository(cfg.Git.BinPath, cfg.Git.Remote, cfg.Git.LocalDirectory, time.Duration(cfg.Git.CommandTimeoutSec)*time.Second)
-	if err != nil {
-		logger.Error("repository", "error", err)
-		os.Exit(1)
+	// Live mode clones in the background once the listener is up.
+	timeout := time.Duration(cfg.Git.CommandTimeoutSec) * time.Second
+	repo := gitutil.OpenRepository(cfg.Git.BinPath, cfg.Git.Remote, cfg.Git.LocalDirectory, timeout)
+	repo.PushRemote = cfg.Git.PushRemote
+	repo.Mirrors = cfg.Git.Mirrors
+	repo.MirrorFailoverAfter = cfg.Git.MirrorFailoverAfter
+	repo.CommitterName, repo.CommitterEmail, _ = cfg.Git.CommitterIdentity()
+	repo.Logger = loggers.For(logging.Git)
+	repo.SlowThreshold = cfg.SlowLog.GitThreshold()
+	repo.Hardening = gitHardening(cfg)
+	if !cfg.Live {
+		if err := repo.EnsureClone(); err != nil {
+			logger.Error("repository", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	templates, err := templatex.Load(cfg.TemplateDir)
@@ -48,6 +73,15 @@ func main() {
 	}
 
 	svc := site.NewService(cfg, repo, templates)
+	svc.UseGitLogger(loggers.For(logging.Git))
+	if cfg.CDN.Enabled {
+		purger, err := cdn.New(cfg, SERVER_SIGNATURE)
+		if err != nil {
+			logger.Error("cdn", "error", err)
+			os.Exit(1)
+		}
+		svc.UsePurger(purger)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -62,51 +96,88 @@ func main() {
 		return
 	}
 
-	go pullLoop(ctx, svc, cfg.PullInterval, logger)
+	srv := server.New(cfg, svc, loggers.For(logging.Server), SERVER_SIGNATURE)
+	srv.UseWebhookLogger(loggers.For(logging.Webhook))
+	if cfg.AccessLog.Enabled {
+		access, err := logging.OpenRotatingFile(cfg.AccessLog.Path, int64(cfg.AccessLog.MaxSizeMB)<<20, cfg.AccessLog.MaxAge(), cfg.AccessLog.MaxBackups)
+		if err != nil {
+			logger.Error("access log", "error", err)
+			os.Exit(1)
+		}
+		defer access.Close()
+		srv.UseAccessLog(access)
+	}
+	srv.SetVersion(server.Version{Name: SERVER_NAME, Version: SERVER_VERSION, Commit: GIT_COMMIT, BuildTime: BUILD_TIME})
+
+	go pullLoop(ctx, svc, cfg, loggers.For(logging.Git))
+	if cfg.PullValidation.Enabled {
+		srv.AddHealthCheck("pullValidation", func() (bool, any) {
+			if rejected := svc.PullRejection(); rejected != nil {
+				return false, rejected
+			}
+			return true, nil
+		})
+	}
 	if cfg.Webhook.Enabled && cfg.Webhook.Polling.Enabled {
-		if poller, err := webhook.NewPoller(cfg, svc, logger, SERVER_SIGNATURE); err != nil {
+		if poller, err := webhook.NewPoller(cfg, svc, loggers.For(logging.Webhook), SERVER_SIGNATURE); err != nil {
 			logger.Warn("webhook poller", "error", err)
 		} else {
-			go poller.Run(ctx)
+			srv.AddHealthCheck("poller", poller.Health)
+			go func() {
+				if svc.WaitReady(ctx) == nil {
+					poller.Run(ctx)
+				}
+			}()
 		}
 	}
 
-	srv := server.New(cfg, svc, logger, SERVER_SIGNATURE)
 	if err := srv.Start(ctx); err != nil {
 		logger.Error("server", "error", err)
 		os.Exit(1)
 	}
 }
 
-func pullLoop(ctx context.Context, svc *site.Service, interval time.Duration, logger *slog.Logger) {
+// pullLoop polls the remote on an adaptive schedule: any new commit since the
+// previous tick (from this loop, webhooks or local edits) resets the interval
+// to the minimum, while idle ticks double it up to the maximum.
+func pullLoop(ctx context.Context, svc *site.Service, cfg *config.Config, logger *slog.Logger) {
+	interval := cfg.PullInterval
 	if interval <= 0 {
 		return
 	}
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	if svc.WaitReady(ctx) != nil {
+		return
+	}
+	lastHead, _ := svc.HeadCommit(ctx)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			if err := svc.Pull(ctx); err != nil {
 				logger.Warn("pull", "error", err)
 			}
+			head, err := svc.HeadCommit(ctx)
+			if err == nil && head != lastHead {
+				interval = cfg.MinPullInterval
+				lastHead = head
+			} else {
+				interval = min(interval*2, cfg.MaxPullInterval)
+			}
+			logger.Debug("pull scheduled", "interval", interval)
+			timer.Reset(interval)
 		}
 	}
 }
 
-func newLogger(level string) *slog.Logger {
-	var lvl slog.Level
-	switch strings.ToLower(level) {
-	case "debug":
-		lvl = slog.LevelDebug
-	case "warn":
-		lvl = slog.LevelWarn
-	case "error":
-		lvl = slog.LevelError
-	default:
-		lvl = slog.LevelInfo
-	}
-	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+// gitHardening returns the isolation git commands run with, or nil when
+// git.hardening is disabled.
+func gitHardening(cfg *config.Config) *gitutil.Hardening {
+	h := cfg.Git.Hardening
+	if !h.Enabled {
+		return nil
+	}
+	return &gitutil.Hardening{Protocols: h.Protocols, IgnoreGlobalConfig: h.IgnoreGlobalConfig, PassEnv: h.PassEnv}
 }
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds named metrics and renders them in the Prometheus text format.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]collector
+}
+
+type collector interface {
+	describe() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Default is the process-wide registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) collector {
+	name, _, _ := c.describe()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.metrics[name]; ok {
+		return existing
+	}
+	r.metrics[name] = c
+	return c
+}
+
+// Write renders every registered metric.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.metrics[name])
+	}
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		name, help, kind := c.describe()
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		c.write(w)
+	}
+}
+
+// Handler serves the registry over HTTP.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	name, help string
+	value      atomic.Uint64
+}
+
+// NewCounter registers a counter on the default registry.
+func NewCounter(name, help string) *Counter {
+	return Default.register(&Counter{name: name, help: help}).(*Counter)
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add increases the counter by n.
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+func (c *Counter) describe() (string, string, string) { return c.name, c.help, "counter" }
+
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d\n", c.name, c.value.Load())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name, help string
+	bits       atomic.Uint64
+}
+
+// NewGauge registers a gauge on the default registry.
+func NewGauge(name, help string) *Gauge {
+	return Default.register(&Gauge{name: name, help: help}).(*Gauge)
+}
+
+// Set replaces the gauge value.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Add shifts the gauge value by delta.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) describe() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.Value()))
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.RWMutex
+	values     map[string]*atomic.Uint64
+}
+
+// NewCounterVec registers a labelled counter family on the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.register(&CounterVec{name: name, help: help, labels: labels, values: make(map[string]*atomic.Uint64)}).(*CounterVec)
+}
+
+// Inc increments the counter identified by the label values.
+func (v *CounterVec) Inc(labelValues ...string) { v.Add(1, labelValues...) }
+
+// Add increases the counter identified by the label values.
+func (v *CounterVec) Add(n uint64, labelValues ...string) {
+	key := labelKey(v.labels, labelValues)
+	v.mu.RLock()
+	counter, ok := v.values[key]
+	v.mu.RUnlock()
+	if !ok {
+		v.mu.Lock()
+		if counter, ok = v.values[key]; !ok {
+			counter = &atomic.Uint64{}
+			v.values[key] = counter
+		}
+		v.mu.Unlock()
+	}
+	counter.Add(n)
+}
+
+func (v *CounterVec) describe() (string, string, string) { return v.name, v.help, "counter" }
+
+func (v *CounterVec) write(w io.Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", v.name, key, v.values[key].Load())
+	}
+}
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec struct {
+	name, help string
+	labels     []string
+	mu         sync.RWMutex
+	values     map[string]float64
+}
+
+// NewGaugeVec registers a labelled gauge family on the default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.register(&GaugeVec{name: name, help: help, labels: labels, values: make(map[string]float64)}).(*GaugeVec)
+}
+
+// Set replaces the gauge identified by the label values.
+func (v *GaugeVec) Set(value float64, labelValues ...string) {
+	key := labelKey(v.labels, labelValues)
+	v.mu.Lock()
+	v.values[key] = value
+	v.mu.Unlock()
+}
+
+// Reset drops all series, useful when the label set is recomputed wholesale.
+func (v *GaugeVec) Reset() {
+	v.mu.Lock()
+	v.values = make(map[string]float64)
+	v.mu.Unlock()
+}
+
+func (v *GaugeVec) describe() (string, string, string) { return v.name, v.help, "gauge" }
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s} %s\n", v.name, key, formatFloat(v.values[key]))
+	}
+}
+
+func labelKey(names, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(value))
+	}
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
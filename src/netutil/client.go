@@ -0,0 +1,108 @@
+package netutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ClientOptions configures outbound HTTP clients used for notifications,
+// replication, and other calls to services that may only be reachable over DN42.
+type ClientOptions struct {
+	// Proxy is an http://, https:// or socks5:// URL. Empty uses the environment.
+	Proxy string
+	// DNSServer is a host:port resolver used instead of the system resolver.
+	DNSServer string
+	// Timeout bounds the whole request; zero means no client-side timeout.
+	Timeout time.Duration
+	// SkipVerify disables TLS certificate verification.
+	SkipVerify bool
+}
+
+// NewTransport builds an HTTP transport honouring the proxy and resolver options.
+func NewTransport(opts ClientOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy := strings.TrimSpace(opts.Proxy); proxy != "" {
+		proxyURL, err := ParseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if server := strings.TrimSpace(opts.DNSServer); server != "" {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  NewResolver(server),
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	if opts.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport, nil
+}
+
+// NewHTTPClient builds a client from the provided options.
+func NewHTTPClient(opts ClientOptions) (*http.Client, error) {
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: opts.Timeout, Transport: transport}, nil
+}
+
+// NewResolver returns a resolver that sends every query to server.
+func NewResolver(server string) *net.Resolver {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// ParseProxyURL validates a proxy URL and its scheme.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", raw)
+	}
+	return parsed, nil
+}
+
+// NormalizeDNSServer appends the default DNS port when missing.
+func NormalizeDNSServer(raw string) (string, error) {
+	server := strings.TrimSpace(raw)
+	if server == "" {
+		return "", nil
+	}
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+	if strings.Count(server, ":") > 1 && !strings.HasPrefix(server, "[") {
+		server = "[" + server + "]"
+	}
+	server += ":53"
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return "", fmt.Errorf("invalid dns server %q: %w", raw, err)
+	}
+	return server, nil
+}
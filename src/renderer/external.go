@@ -0,0 +1,224 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// maxExternalOutput caps the HTML accepted from an external renderer.
+const maxExternalOutput = 8 << 20
+
+// External delegates fenced code blocks or whole files to a command that
+// reads the source on stdin and writes an HTML fragment to stdout.
+type External struct {
+	Name string
+	// Command is the executable followed by its arguments.
+	Command []string
+	// Fences lists fenced code block languages handled by the command.
+	Fences []string
+	// Extensions lists file extensions (eg. ".adoc") rendered as pages.
+	Extensions []string
+	Timeout    time.Duration
+}
+
+// UseExternal registers external renderers. It must be called before the
+// renderer is shared between goroutines.
+func (r *Renderer) UseExternal(externals ...External) {
+	if r.fences == nil {
+		r.fences = make(map[string]*External)
+	}
+	if r.extensions == nil {
+		r.extensions = make(map[string]*External)
+	}
+	for i := range externals {
+		ext := &externals[i]
+		for _, fence := range ext.Fences {
+			r.fences[strings.ToLower(strings.TrimSpace(fence))] = ext
+		}
+		for _, extension := range ext.Extensions {
+			r.extensions[strings.ToLower(strings.TrimSpace(extension))] = ext
+		}
+	}
+}
+
+// HandlesFile reports whether a non-Markdown file is rendered as a page.
+func (r *Renderer) HandlesFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := r.extensions[ext]; ok {
+		return true
+	}
+	_, ok := r.viewers[ext]
+	return ok
+}
+
+// RenderFile renders a repository file, choosing the renderer by extension.
+func (r *Renderer) RenderFile(name string, src []byte) (*RenderResult, error) {
+	ext, ok := r.extensions[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		if r.IsViewer(name) {
+			return r.renderViewer(name, src)
+		}
+		return r.Render(src)
+	}
+	src, err := r.applySource(src)
+	if err != nil {
+		return nil, err
+	}
+	out, err := ext.run(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ext.Name, err)
+	}
+	result := resultFromHTML(out)
+	if result.HTML, err = r.applyHTML(result.HTML); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *External) run(src []byte) ([]byte, error) {
+	if len(e.Command) == 0 {
+		return nil, errors.New("no command configured")
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(src)
+	var stdout, stderr bytes.Buffer
+	output := &limitedBuffer{buf: &stdout, limit: maxExternalOutput}
+	cmd.Stdout = output
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096}
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	case output.truncated:
+		// Cut off HTML would break the page it ends up in.
+		return nil, fmt.Errorf("output exceeds %d bytes", maxExternalOutput)
+	case err != nil:
+		return nil, fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and notes whether
+// more were dropped.
+type limitedBuffer struct {
+	buf       *bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write always reports p as written, so the command is drained rather than
+// stalled on a full pipe.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.limit - b.buf.Len(); n > remaining {
+		b.truncated = true
+		p = p[:max(remaining, 0)]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// renderFences replaces fenced code blocks claimed by an external renderer
+// with the command output, or an inline error when the command fails.
+func (r *Renderer) renderFences(blocks []*ast.FencedCodeBlock, src []byte) {
+	for _, block := range blocks {
+		lang := strings.ToLower(string(block.Language(src)))
+		ext := r.fences[lang]
+		var code bytes.Buffer
+		lines := block.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(src))
+		}
+		out, err := ext.run(code.Bytes())
+		if err != nil {
+			out = fmt.Appendf(nil, `<pre class="render-error">%s: %s</pre>`, html.EscapeString(ext.Name), html.EscapeString(err.Error()))
+		}
+		replacement := &externalBlock{html: out}
+		block.Parent().ReplaceChild(block.Parent(), block, replacement)
+	}
+}
+
+var kindExternalBlock = ast.NewNodeKind("ExternalBlock")
+
+// externalBlock carries pre-rendered HTML produced by an external command.
+type externalBlock struct {
+	ast.BaseBlock
+	html []byte
+}
+
+func (n *externalBlock) Kind() ast.NodeKind { return kindExternalBlock }
+
+func (n *externalBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type externalBlockRenderer struct{}
+
+func (externalBlockRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindExternalBlock, func(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.Write(node.(*externalBlock).html)
+			_ = w.WriteByte('\n')
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+var (
+	htmlHeadingPattern = regexp.MustCompile(`(?is)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]>`)
+	htmlIDPattern      = regexp.MustCompile(`(?i)\sid="([^"]*)"`)
+	htmlTagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlStripPattern   = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+)
+
+// resultFromHTML derives headings and plain text from an HTML fragment so
+// externally rendered pages get a table of contents and search entries.
+// Headings without an id receive one.
+func resultFromHTML(fragment []byte) *RenderResult {
+	headings := make([]Heading, 0, 16)
+	slugCounts := make(map[string]int)
+	out := htmlHeadingPattern.ReplaceAllFunc(fragment, func(match []byte) []byte {
+		parts := htmlHeadingPattern.FindSubmatch(match)
+		level := int(parts[1][0] - '0')
+		attrs := string(parts[2])
+		text := strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(string(parts[3]), "")))
+		if m := htmlIDPattern.FindStringSubmatch(attrs); m != nil {
+			headings = append(headings, Heading{ID: m[1], Text: text, Level: level})
+			slugCounts[m[1]]++
+			return match
+		}
+		base := slugify(text)
+		id := base
+		if count := slugCounts[base]; count > 0 {
+			id = fmt.Sprintf("%s-%d", base, count)
+		}
+		slugCounts[base]++
+		headings = append(headings, Heading{ID: id, Text: text, Level: level})
+		return fmt.Appendf(nil, `<h%d id="%s"%s>%s</h%d>`, level, id, attrs, parts[3], level)
+	})
+
+	plain := htmlStripPattern.ReplaceAll(out, nil)
+	plain = htmlTagPattern.ReplaceAll(plain, []byte(" "))
+	text := strings.Join(strings.Fields(html.UnescapeString(string(plain))), " ")
+	return &RenderResult{HTML: out, PlainText: text, Headings: headings}
+}
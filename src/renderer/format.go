@@ -0,0 +1,129 @@
+package renderer
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/Kunde21/markdownfmt/v3/markdown"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ErrFormatChangesOutput rejects formatting that would change how a page
+// renders, which happens with syntax the formatter does not know, such as
+// footnotes and definition lists.
+var ErrFormatChangesOutput = errors.New("formatting would change the rendered page")
+
+// formatter writes parsed Markdown back out in a consistent layout: ATX
+// headings with a blank line around them, aligned tables, "-" bullets and
+// renumbered ordered lists. Line breaks within paragraphs are kept.
+var formatter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithAttribute(),
+		parser.WithASTTransformers(
+			util.Prioritized(listMarkers{}, 100),
+			util.Prioritized(headingSpacing{}, 100),
+		),
+	),
+	goldmark.WithRenderer(formatRenderer()),
+)
+
+func formatRenderer() *markdown.Renderer {
+	r := markdown.NewRenderer()
+	r.AddMarkdownOptions(markdown.WithSoftWraps())
+	return r
+}
+
+// Format normalizes the layout of Markdown source, leaving front matter as
+// it is. It returns ErrFormatChangesOutput rather than a result that
+// renders differently from src.
+func (r *Renderer) Format(src []byte) ([]byte, error) {
+	front, body := splitFrontMatter(src)
+	var buf bytes.Buffer
+	buf.Write(front)
+	if err := formatter.Convert(body, &buf); err != nil {
+		return nil, err
+	}
+	out := append(bytes.TrimRight(buf.Bytes(), "\n"), '\n')
+	if bytes.Equal(out, src) {
+		return out, nil
+	}
+
+	var before, after bytes.Buffer
+	if err := r.md.Convert(src, &before); err != nil {
+		return nil, err
+	}
+	if err := r.md.Convert(out, &after); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(before.Bytes(), after.Bytes()) {
+		return nil, ErrFormatChangesOutput
+	}
+	return out, nil
+}
+
+// splitFrontMatter separates a leading YAML block between "---" lines.
+func splitFrontMatter(src []byte) ([]byte, []byte) {
+	if !bytes.HasPrefix(src, []byte("---\n")) && !bytes.HasPrefix(src, []byte("---\r\n")) {
+		return nil, src
+	}
+	rest := src[bytes.IndexByte(src, '\n')+1:]
+	for offset := 0; offset < len(rest); {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end+1]
+		}
+		if string(bytes.TrimRight(line, "\r\n")) == "---" {
+			split := len(src) - len(rest) + offset + len(line)
+			return src[:split], src[split:]
+		}
+		offset += len(line)
+	}
+	return nil, src
+}
+
+// listMarkers switches bullet lists to "-" and ordered lists to "1.".
+// Neighbouring lists are only kept apart by differing markers, so a list
+// following another one of its kind gets the alternative marker.
+type listMarkers struct{}
+
+func (listMarkers) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		list, ok := node.(*ast.List)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		marker, alternative := byte('-'), byte('*')
+		if list.IsOrdered() {
+			marker, alternative = '.', ')'
+		}
+		if prev, ok := list.PreviousSibling().(*ast.List); ok && prev.IsOrdered() == list.IsOrdered() && prev.Marker == marker {
+			marker = alternative
+		}
+		list.Marker = marker
+		return ast.WalkContinue, nil
+	})
+}
+
+// headingSpacing puts a blank line between headings and the lists or HTML
+// blocks right below them, which the renderer only separates by a blank
+// line when the source had one.
+type headingSpacing struct{}
+
+func (headingSpacing) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if _, ok := node.PreviousSibling().(*ast.Heading); entering && ok {
+			switch node.(type) {
+			case *ast.List, *ast.HTMLBlock:
+				node.SetBlankPreviousLines(true)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,40 @@
+package renderer
+
+import "sort"
+
+// formats are ready-made external renderers for common documentation markup,
+// enabled by name through the render.formats setting. Both rely on the usual
+// converters being installed on the host.
+var formats = map[string]External{
+	"asciidoc": {
+		Name:       "asciidoc",
+		Command:    []string{"asciidoctor", "--embedded", "--out-file", "-", "-"},
+		Extensions: []string{".adoc", ".asciidoc"},
+	},
+	"rst": {
+		Name:       "rst",
+		Command:    []string{"pandoc", "--from", "rst", "--to", "html5"},
+		Extensions: []string{".rst"},
+	},
+}
+
+// Format returns the built-in external renderer registered under name.
+func Format(name string) (External, bool) {
+	format, ok := formats[name]
+	if !ok {
+		return External{}, false
+	}
+	format.Command = append([]string(nil), format.Command...)
+	format.Extensions = append([]string(nil), format.Extensions...)
+	return format, true
+}
+
+// FormatNames lists the built-in formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
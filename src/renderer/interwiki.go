@@ -0,0 +1,105 @@
+package renderer
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// InterwikiClass marks links whose target named an interwiki prefix.
+const InterwikiClass = "interwiki-link"
+
+var interwikiPrefixName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// reservedInterwikiPrefixes are URL schemes pages link with, which a prefix
+// must not shadow.
+var reservedInterwikiPrefixes = map[string]bool{
+	"http": true, "https": true, "mailto": true, "ftp": true, "tel": true,
+	"data": true, "javascript": true, "irc": true, "ircs": true, "xmpp": true,
+}
+
+// ValidInterwikiPrefix reports whether name can be used as an interwiki
+// prefix: lower case letters, digits and dashes, and not a common URL
+// scheme.
+func ValidInterwikiPrefix(name string) bool {
+	return interwikiPrefixName.MatchString(name) && !reservedInterwikiPrefixes[name]
+}
+
+// interwikiTransformer rewrites links to prefix:target, in Markdown links
+// and [[wiki links]], to the URL the prefix maps to.
+type interwikiTransformer struct {
+	prefixes map[string]string
+}
+
+func (t interwikiTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	var wikiLinks []*wikiLink
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			if href, ok := t.expand(string(n.Destination)); ok {
+				n.Destination = []byte(href)
+				n.SetAttributeString("class", []byte(InterwikiClass))
+			}
+		case *wikiLink:
+			wikiLinks = append(wikiLinks, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range wikiLinks {
+		href, ok := t.expand(n.Target)
+		if !ok {
+			continue
+		}
+		link := ast.NewLink()
+		link.Destination = []byte(href)
+		link.SetAttributeString("class", []byte(InterwikiClass))
+		for child := n.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			link.AppendChild(link, child)
+			child = next
+		}
+		n.Parent().ReplaceChild(n.Parent(), n, link)
+	}
+}
+
+// expand resolves prefix:target. The URL of the prefix has $1 replaced by
+// the escaped target, or the target appended when it has none; a #fragment
+// of the target is kept.
+func (t interwikiTransformer) expand(target string) (string, bool) {
+	prefix, rest, ok := strings.Cut(strings.TrimSpace(target), ":")
+	if !ok {
+		return "", false
+	}
+	pattern, ok := t.prefixes[strings.ToLower(prefix)]
+	if !ok || rest == "" || strings.HasPrefix(rest, "//") {
+		return "", false
+	}
+	rest, fragment, _ := strings.Cut(rest, "#")
+	escaped := (&url.URL{Path: rest}).EscapedPath()
+	href := pattern + escaped
+	if strings.Contains(pattern, "$1") {
+		href = strings.ReplaceAll(pattern, "$1", escaped)
+	}
+	if fragment != "" {
+		href += "#" + (&url.URL{Fragment: fragment}).EscapedFragment()
+	}
+	return href, true
+}
+
+// UseInterwiki expands links to prefix:target with the URLs prefixes maps
+// the lower case prefixes to. It must be called before the renderer is
+// shared between goroutines.
+func (r *Renderer) UseInterwiki(prefixes map[string]string) {
+	if len(prefixes) == 0 {
+		return
+	}
+	r.md.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(interwikiTransformer{prefixes: prefixes}, 100)))
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	gmrenderer "github.com/yuin/goldmark/renderer"
 	htmlRenderer "github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
@@ -31,11 +32,26 @@ type RenderResult struct {
 	HTML      []byte
 	PlainText string
 	Headings  []Heading
+	// Meta holds the YAML front matter of Markdown sources, if any.
+	Meta map[string]any `json:",omitempty"`
+	// Lead is the plain text of the first top-level paragraph.
+	Lead string `json:",omitempty"`
+	// Excerpt is the plain text before a <!--more--> marker, if the
+	// source has one.
+	Excerpt string `json:",omitempty"`
 }
 
+// moreMarker separates the excerpt of a page from the rest of it.
+const moreMarker = "<!--more-->"
+
 // Renderer transforms markdown sources into HTML fragments.
 type Renderer struct {
-	md goldmark.Markdown
+	md         goldmark.Markdown
+	transforms []Transform
+	fences     map[string]*External
+	extensions map[string]*External
+	viewers    map[string]viewerFunc
+	minify     bool
 }
 
 func init() {
@@ -76,6 +92,7 @@ func New() *Renderer {
 		),
 		goldmark.WithRendererOptions(
 			htmlRenderer.WithUnsafe(),
+			gmrenderer.WithNodeRenderers(util.Prioritized(externalBlockRenderer{}, 100)),
 		),
 	)
 
@@ -84,15 +101,52 @@ func New() *Renderer {
 
 // Render converts the provided markdown into HTML and extracts metadata for navigation and search.
 func (r *Renderer) Render(src []byte) (*RenderResult, error) {
+	src, err := r.applySource(src)
+	if err != nil {
+		return nil, err
+	}
+
 	reader := text.NewReader(src)
-	doc := r.md.Parser().Parse(reader)
+	pc := parser.NewContext()
+	doc := r.md.Parser().Parse(reader, parser.WithContext(pc))
 
 	headings := make([]Heading, 0, 16)
 	plainBuilder := &strings.Builder{}
 	slugCounts := make(map[string]int)
+	var externalFences []*ast.FencedCodeBlock
+	leadStart, lead, excerpt := -1, "", ""
+	markExcerpt := func() {
+		if excerpt == "" {
+			excerpt = strings.TrimSpace(plainBuilder.String())
+		}
+	}
 
 	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		switch node := n.(type) {
+		case *ast.Paragraph:
+			if node.Parent() != doc || lead != "" {
+				break
+			}
+			if entering {
+				leadStart = plainBuilder.Len()
+			} else if leadStart >= 0 {
+				lead = strings.TrimSpace(plainBuilder.String()[leadStart:])
+				leadStart = -1
+			}
+		case *ast.HTMLBlock:
+			if entering && node.Parent() == doc && isMoreMarker(node.Lines().Value(src)) {
+				markExcerpt()
+			}
+		case *ast.RawHTML:
+			if entering && isMoreMarker(node.Segments.Value(src)) {
+				markExcerpt()
+			}
+		case *ast.FencedCodeBlock:
+			if entering && len(r.fences) > 0 {
+				if _, ok := r.fences[strings.ToLower(string(node.Language(src)))]; ok {
+					externalFences = append(externalFences, node)
+				}
+			}
 		case *ast.Heading:
 			if entering {
 				attr, _ := node.AttributeString("id")
@@ -121,19 +175,69 @@ func (r *Renderer) Render(src []byte) (*RenderResult, error) {
 		}
 		return ast.WalkContinue, nil
 	})
+	r.renderFences(externalFences, src)
 
 	var buf bytes.Buffer
 	if err := r.md.Renderer().Render(&buf, src, doc); err != nil {
 		return nil, err
 	}
+	html, err := r.applyHTML(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
 
-	return &RenderResult{HTML: buf.Bytes(), PlainText: strings.TrimSpace(plainBuilder.String()), Headings: headings}, nil
+	result := &RenderResult{HTML: html, PlainText: strings.TrimSpace(plainBuilder.String()), Headings: headings, Lead: lead, Excerpt: excerpt}
+	if front, ok := normalizeMeta(meta.Get(pc)).(map[string]any); ok && len(front) > 0 {
+		result.Meta = front
+	}
+	return result, nil
+}
+
+func isMoreMarker(raw []byte) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(string(raw)), ""), moreMarker)
 }
 
-// MinifyHTML optimizes raw HTML markup.
-// Currently a no-op, does not modify the input.
+// normalizeMeta converts the maps decoded from YAML front matter into
+// string-keyed ones, so results can be encoded as JSON.
+func normalizeMeta(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = normalizeMeta(item)
+		}
+		return out
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[fmt.Sprint(key)] = normalizeMeta(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeMeta(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// MinifyHTML strips comments and redundant whitespace from a full page,
+// including inline CSS and JavaScript. Without UseMinify it returns the
+// input unchanged.
 func (r *Renderer) MinifyHTML(raw []byte) ([]byte, error) {
-	return raw, nil
+	if !r.minify {
+		return raw, nil
+	}
+	return minifyHTML(raw), nil
+}
+
+// UseMinify enables MinifyHTML. It must be called before the renderer is
+// shared between goroutines.
+func (r *Renderer) UseMinify() {
+	r.minify = true
 }
 
 func extractText(root ast.Node, source []byte) string {
@@ -0,0 +1,182 @@
+package renderer
+
+import (
+	"bytes"
+	"html"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Math is emitted as TeX inside \( \) and \[ \] delimiters, the defaults of
+// both KaTeX auto-render and MathJax, so templates can typeset it client-side:
+//
+//	<span class="math math-inline">\(...\)</span>
+//	<div class="math math-display">\[...\]</div>
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+type mathInline struct {
+	ast.BaseInline
+	TeX     []byte
+	Display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.TeX)}, nil)
+}
+
+type mathBlock struct {
+	ast.BaseBlock
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathInlineParser handles $...$ and $$...$$ within a paragraph. Like
+// Pandoc, the opening $ must be followed and the closing $ preceded by a
+// non-space, and the closing $ must not be followed by a digit, so prices
+// such as "$5 and $10" stay text.
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(_ ast.Node, block text.Reader, _ parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		block.Advance(end + 4)
+		return &mathInline{TeX: bytes.TrimSpace(line[2 : end+2]), Display: true}
+	}
+	if len(line) < 3 || unicode.IsSpace(rune(line[1])) {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			if unicode.IsSpace(rune(line[i-1])) || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9') {
+				continue
+			}
+			block.Advance(i + 1)
+			return &mathInline{TeX: line[1:i]}
+		}
+	}
+	return nil
+}
+
+// mathBlockParser handles display math on lines of its own:
+//
+//	$$
+//	E = mc^2
+//	$$
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(_ ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &mathBlock{}
+	rest := bytes.TrimSpace(line[pos+2:])
+	if len(rest) > 0 {
+		// Single line form: $$ ... $$
+		if !bytes.HasSuffix(rest, []byte("$$")) || len(rest) < 3 {
+			return nil, parser.NoChildren
+		}
+		start := segment.Start + pos + 2
+		inner := text.NewSegment(start, start+bytes.LastIndex(line[pos+2:], []byte("$$")))
+		node.Lines().Append(inner)
+		node.closed = true
+	}
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, _ parser.Context) parser.State {
+	block := node.(*mathBlock)
+	if block.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if before := bytes.LastIndex(line, []byte("$$")); len(bytes.TrimSpace(line[:before])) > 0 {
+			block.Lines().Append(text.NewSegment(segment.Start, segment.Start+before))
+		}
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	block.Lines().Append(segment)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(ast.Node, text.Reader, parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, func(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			n := node.(*mathInline)
+			if n.Display {
+				_, _ = w.WriteString(`<span class="math math-display">\[` + html.EscapeString(string(n.TeX)) + `\]</span>`)
+			} else {
+				_, _ = w.WriteString(`<span class="math math-inline">\(` + html.EscapeString(string(n.TeX)) + `\)</span>`)
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	reg.Register(kindMathBlock, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString(`<div class="math math-display">\[`)
+			lines := node.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				_, _ = w.WriteString(html.EscapeString(string(segment.Value(source))))
+			}
+			_, _ = w.WriteString("\\]</div>\n")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// UseMath enables $...$ and $$...$$ math. It is opt-in because dollar signs
+// are common in shell examples. It must be called before the renderer is
+// shared between goroutines.
+func (r *Renderer) UseMath() {
+	r.md.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 90)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 150)),
+	)
+	r.md.Renderer().AddOptions(gmrenderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 100)))
+}
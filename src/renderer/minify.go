@@ -0,0 +1,308 @@
+package renderer
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The minifier is deliberately conservative: it only removes what never
+// changes how a page renders. Whitespace runs in text collapse to a single
+// character instead of disappearing, since a space between inline elements
+// is significant, and the contents of preformatted elements are left alone.
+var (
+	preservedElements = map[string]bool{"pre": true, "textarea": true, "code": true}
+	scriptTypes       = map[string]bool{"": true, "module": true, "text/javascript": true, "application/javascript": true, "application/ld+json": true}
+)
+
+// minifyHTML strips comments and redundant whitespace from markup, including
+// inline <style> and <script> bodies.
+func minifyHTML(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '<' && bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			comment := src[i : i+4+end+3]
+			// Conditional comments and <!--! ... --> are kept on purpose.
+			if bytes.HasPrefix(comment, []byte("<!--[")) || bytes.HasPrefix(comment, []byte("<!--!")) {
+				out = append(out, comment...)
+			}
+			i += len(comment)
+		case c == '<' && i+1 < len(src) && (isASCIILetter(src[i+1]) || src[i+1] == '/' || src[i+1] == '!'):
+			end := tagEnd(src, i)
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			tag := src[i:end]
+			out = append(out, minifyTag(tag)...)
+			i = end
+			name := tagName(tag)
+			if tag[1] == '/' || tag[len(tag)-2] == '/' {
+				continue
+			}
+			if name == "style" || name == "script" || preservedElements[name] {
+				closing := indexClosingTag(src[i:], name)
+				if closing < 0 {
+					closing = len(src) - i
+				}
+				body := src[i : i+closing]
+				switch {
+				case name == "style":
+					body = minifyCSS(body)
+				case name == "script" && scriptTypes[strings.ToLower(attrValue(tag, "type"))]:
+					body = minifyJS(body)
+				}
+				out = append(out, body...)
+				i += closing
+			}
+		case isHTMLSpace(c):
+			j := i
+			newline := false
+			for j < len(src) && isHTMLSpace(src[j]) {
+				newline = newline || src[j] == '\n'
+				j++
+			}
+			if len(out) > 0 && j < len(src) {
+				if newline {
+					out = append(out, '\n')
+				} else {
+					out = append(out, ' ')
+				}
+			}
+			i = j
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+// tagEnd returns the index just past the '>' closing the tag starting at
+// start, skipping quoted attribute values, or -1 if the tag never ends.
+func tagEnd(src []byte, start int) int {
+	var quote byte
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// minifyTag collapses whitespace between attributes, leaving quoted values
+// untouched.
+func minifyTag(tag []byte) []byte {
+	out := make([]byte, 0, len(tag))
+	var quote byte
+	space := false
+	for _, c := range tag {
+		if quote == 0 && isHTMLSpace(c) {
+			space = true
+			continue
+		}
+		if space {
+			if c != '>' && !(c == '/' && len(out) > 0) && c != '=' && out[len(out)-1] != '=' {
+				out = append(out, ' ')
+			}
+			space = false
+		}
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func tagName(tag []byte) string {
+	i := 1
+	if i < len(tag) && tag[i] == '/' {
+		i++
+	}
+	j := i
+	for j < len(tag) && (isASCIILetter(tag[j]) || (tag[j] >= '0' && tag[j] <= '9') || tag[j] == '-') {
+		j++
+	}
+	return strings.ToLower(string(tag[i:j]))
+}
+
+// attrValue returns the value of a quoted or bare attribute, or "" when the
+// tag does not carry it.
+func attrValue(tag []byte, name string) string {
+	lower := strings.ToLower(string(tag))
+	for offset := 0; ; {
+		idx := strings.Index(lower[offset:], name)
+		if idx < 0 {
+			return ""
+		}
+		idx += offset
+		offset = idx + len(name)
+		if idx == 0 || !isHTMLSpace(lower[idx-1]) {
+			continue
+		}
+		rest := strings.TrimLeft(lower[offset:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			return ""
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+				return strings.TrimSpace(rest[1 : end+1])
+			}
+			return ""
+		}
+		end := strings.IndexAny(rest, " \t\r\n/>")
+		if end < 0 {
+			end = len(rest)
+		}
+		return rest[:end]
+	}
+}
+
+// minifyCSS drops comments and whitespace that carries no meaning. Spaces
+// are only removed next to braces, semicolons, commas and child combinators,
+// so descendant selectors and calc() expressions keep theirs.
+func minifyCSS(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	space := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+			space = true
+			continue
+		case isHTMLSpace(c):
+			space = true
+			continue
+		}
+		if space && len(out) > 0 && !strings.ContainsRune("{};,>(", rune(out[len(out)-1])) && !strings.ContainsRune("{};,>)", rune(c)) {
+			out = append(out, ' ')
+		}
+		space = false
+		if c == '"' || c == '\'' {
+			end := i + 1
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return append(out, src[i:]...)
+			}
+			out = append(out, src[i:end+1]...)
+			i = end
+			continue
+		}
+		if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+			out = out[:len(out)-1]
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// minifyJS trims indentation and drops blank lines and whole-line comments.
+// Anything smarter needs a real JavaScript parser; lines inside template
+// literals and block comments are kept verbatim.
+func minifyJS(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	inTemplate, inComment := false, false
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		if inTemplate || inComment {
+			out = append(out, line...)
+			out = append(out, '\n')
+		} else if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && !bytes.HasPrefix(trimmed, []byte("//")) {
+			out = append(out, trimmed...)
+			out = append(out, '\n')
+		}
+		inTemplate, inComment = scanJSLine(line, inTemplate, inComment)
+	}
+	return bytes.TrimRight(out, "\n")
+}
+
+// scanJSLine reports whether a template literal or block comment is still
+// open at the end of line.
+func scanJSLine(line []byte, inTemplate, inComment bool) (bool, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inComment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				inComment = false
+				i++
+			}
+		case inTemplate:
+			if c == '\\' {
+				i++
+			} else if c == '`' {
+				inTemplate = false
+			}
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '`':
+			inTemplate = true
+		case c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return inTemplate, inComment
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			inComment = true
+			i++
+		}
+	}
+	return inTemplate, inComment
+}
+
+// indexClosingTag finds the case-insensitive "</name" ending a raw or
+// preserved element.
+func indexClosingTag(src []byte, name string) int {
+	for offset := 0; ; {
+		idx := bytes.Index(src[offset:], []byte("</"))
+		if idx < 0 {
+			return -1
+		}
+		idx += offset
+		end := idx + 2 + len(name)
+		if end <= len(src) && strings.EqualFold(string(src[idx+2:end]), name) {
+			return idx
+		}
+		offset = idx + 2
+	}
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
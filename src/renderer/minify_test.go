@@ -0,0 +1,148 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "collapses whitespace between elements",
+			in:   "<p>a  <b>b</b>\n\n  c</p>",
+			want: "<p>a <b>b</b>\nc</p>",
+		},
+		{
+			name: "drops comments but keeps conditional ones",
+			in:   "<p>a<!-- gone -->b<!--[if IE]>x<![endif]--></p>",
+			want: "<p>ab<!--[if IE]>x<![endif]--></p>",
+		},
+		{
+			name: "keeps pre verbatim",
+			in:   "<div>\n  <pre>\n  a   b\n\n  c\n</pre>\n</div>",
+			want: "<div>\n<pre>\n  a   b\n\n  c\n</pre>\n</div>",
+		},
+		{
+			name: "keeps textarea verbatim",
+			in:   "<textarea  name=\"x\"  rows=\"3\">  keep\n\n   this  </textarea>",
+			want: "<textarea name=\"x\" rows=\"3\">  keep\n\n   this  </textarea>",
+		},
+		{
+			name: "keeps code verbatim",
+			in:   "<p>run <code>  x   y </code></p>",
+			want: "<p>run <code>  x   y </code></p>",
+		},
+		{
+			name: "keeps quoted attribute values",
+			in:   "<a  title=\"a   b\"   href='/x  y'>l</a>",
+			want: "<a title=\"a   b\" href='/x  y'>l</a>",
+		},
+		{
+			name: "keeps script strings",
+			in:   "<script>\n  var s = \"a   //  b\";\n  // drop me\n  var t = '  x  ';\n</script>",
+			want: "<script>var s = \"a   //  b\";\nvar t = '  x  ';</script>",
+		},
+		{
+			name: "keeps script regex literals",
+			in:   "<script>\n  var re = /\\/\\/+/g;\n  var q = /\"/;\n  var u = 1;\n</script>",
+			want: "<script>var re = /\\/\\/+/g;\nvar q = /\"/;\nvar u = 1;</script>",
+		},
+		{
+			name: "keeps script template literals",
+			in:   "<script>\n  var t = `\n  // kept\n    indented`;\n  var v = 2;\n</script>",
+			want: "<script>var t = `\n  // kept\n    indented`;\nvar v = 2;</script>",
+		},
+		{
+			name: "keeps block comments spanning lines",
+			in:   "<script>\n  /* a\n  // b\n  */\n  go();\n</script>",
+			want: "<script>/* a\n  // b\n  */\ngo();</script>",
+		},
+		{
+			name: "leaves other script types alone",
+			in:   "<script type=\"text/x-template\">\n  <p>  x  </p>\n</script>",
+			want: "<script type=\"text/x-template\">\n  <p>  x  </p>\n</script>",
+		},
+		{
+			name: "minifies inline style",
+			in:   "<style>\n a  > b { color : red ; }\n /* c */ .x .y{margin:0 auto;}\n</style>",
+			want: "<style>a>b{color : red}.x .y{margin:0 auto}</style>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(minifyHTML([]byte(tt.in))); got != tt.want {
+				t.Errorf("minifyHTML(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"a , b > c { x : 1 ; }", "a,b>c{x : 1}"},
+		{".a .b{width:calc(100% - 2px)}", ".a .b{width:calc(100% - 2px)}"},
+		{"a::before{content:\"  /* x */  \"}", "a::before{content:\"  /* x */  \"}"},
+		{"a{}/* unterminated", "a{}"},
+	}
+	for _, tt := range tests {
+		if got := string(minifyCSS([]byte(tt.in))); got != tt.want {
+			t.Errorf("minifyCSS(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// benchmarkMinify runs minify over src and reports how many bytes it saves.
+func benchmarkMinify(b *testing.B, src []byte, minify func([]byte) []byte) {
+	b.Helper()
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	var out []byte
+	for i := 0; i < b.N; i++ {
+		out = minify(src)
+	}
+	b.ReportMetric(float64(len(src)-len(out)), "saved-bytes")
+	b.ReportMetric(100*float64(len(src)-len(out))/float64(len(src)), "saved-%")
+}
+
+// templateAsset reads a file shipped with the default template.
+func templateAsset(b *testing.B, name string) []byte {
+	b.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "template", "assets", filepath.FromSlash(name)))
+	if err != nil {
+		b.Skipf("template asset unavailable: %v", err)
+	}
+	return data
+}
+
+func BenchmarkMinifyHTML(b *testing.B) {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n  <head>\n    <style>\n")
+	page.Write(templateAsset(b, "style.css"))
+	page.WriteString("    </style>\n  </head>\n  <body>\n    <!-- content -->\n")
+	for i := 0; i < 200; i++ {
+		page.WriteString("    <section  class=\"entry\">\n      <h2 id=\"s\">Section</h2>\n")
+		page.WriteString("      <p>Some   text with <a  href=\"/x\">a link</a>\n      and more.</p>\n")
+		page.WriteString("      <pre><code>  indented\n    code  </code></pre>\n    </section>\n")
+	}
+	page.WriteString("    <script>\n")
+	page.Write(templateAsset(b, "js/editor.js"))
+	page.WriteString("    </script>\n  </body>\n</html>\n")
+	benchmarkMinify(b, []byte(page.String()), minifyHTML)
+}
+
+func BenchmarkMinifyCSS(b *testing.B) {
+	benchmarkMinify(b, templateAsset(b, "style.css"), minifyCSS)
+}
+
+func BenchmarkMinifyJS(b *testing.B) {
+	benchmarkMinify(b, templateAsset(b, "js/editor.js"), minifyJS)
+}
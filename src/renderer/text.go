@@ -0,0 +1,166 @@
+package renderer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ellipsis marks text shortened by Summarize.
+const Ellipsis = "..."
+
+var punctuationSpacing = strings.NewReplacer(
+	" ,", ",",
+	" .", ".",
+	" ;", ";",
+	" :", ":",
+	" !", "!",
+	" ?", "?",
+	" %", "%",
+	" )", ")",
+	" ]", "]",
+	" }", "}",
+	" '", "'",
+	" \"", "\"",
+	"( ", "(",
+	"[ ", "[",
+	"{ ", "{",
+)
+
+// Summarize collapses the whitespace of plain text, such as
+// RenderResult.PlainText, and shortens it to at most limit user-perceived
+// characters. Text is only cut between grapheme clusters, so combining
+// marks, emoji sequences and flags stay whole. It prefers to end after the
+// last complete sentence in the second half of the limit, then at the last
+// word or CJK clause boundary near it, and only then mid-word, which is
+// the norm for CJK text without spaces. Shortened text not ending on a
+// sentence gets Ellipsis appended. A limit of zero or less only collapses
+// whitespace.
+func Summarize(text string, limit int) string {
+	text = punctuationSpacing.Replace(strings.Join(strings.Fields(text), " "))
+	if limit <= 0 {
+		return text
+	}
+	clusters := graphemes(text, limit+1)
+	if len(clusters) <= limit {
+		return text
+	}
+	// clusters[limit] starts the first cluster past the limit.
+	head := text[:clusters[limit]]
+	bounds := clusters[:limit]
+
+	sentence, word := -1, -1
+	for i := len(bounds) - 1; i > 0; i-- {
+		prev := lastRune(head[:bounds[i]])
+		next := firstRune(head[bounds[i]:])
+		if sentence < 0 && i >= limit/2 && endsSentence(prev, next) {
+			sentence = bounds[i]
+			break
+		}
+		if word < 0 && i >= limit*4/5 && (unicode.IsSpace(next) || isClauseMark(prev)) {
+			word = bounds[i]
+		}
+	}
+	// The whole head may end a sentence, too.
+	if prev := lastRune(head); endsSentence(prev, firstRune(text[len(head):])) {
+		return strings.TrimSpace(head)
+	}
+	switch {
+	case sentence > 0:
+		return strings.TrimSpace(head[:sentence])
+	case word > 0:
+		head = head[:word]
+	}
+	head = strings.TrimRightFunc(head, func(r rune) bool {
+		return unicode.IsSpace(r) || (unicode.IsPunct(r) && !isClosingMark(r))
+	})
+	if head == "" {
+		return ""
+	}
+	return head + Ellipsis
+}
+
+// graphemes returns the byte offsets of the first max grapheme clusters of
+// text. Clusters are approximated: a base character followed by combining
+// marks, variation selectors and emoji modifiers, characters joined by ZWJ,
+// and regional indicator pairs.
+func graphemes(text string, max int) []int {
+	var starts []int
+	var prev rune
+	regional := 0
+	for i, r := range text {
+		extends := i > 0 && (unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+			isVariationSelector(r) || (r >= 0x1F3FB && r <= 0x1F3FF) || r == '\u200d' || prev == '\u200d')
+		if isRegionalIndicator(r) {
+			regional++
+			if regional%2 == 0 {
+				extends = true
+			}
+		} else {
+			regional = 0
+		}
+		if !extends {
+			if len(starts) == max {
+				break
+			}
+			starts = append(starts, i)
+		}
+		prev = r
+	}
+	return starts
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// endsSentence reports whether a sentence ends between prev and next:
+// after full-width terminators, or after ASCII ones followed by a space or
+// the end of the text.
+func endsSentence(prev, next rune) bool {
+	switch prev {
+	case '。', '！', '？', '｡', '…':
+		return true
+	case '.', '!', '?':
+		return next == 0 || unicode.IsSpace(next)
+	}
+	return false
+}
+
+// isClauseMark reports CJK punctuation text may be broken after.
+func isClauseMark(r rune) bool {
+	switch r {
+	case '，', '、', '；', '：', '」', '』', '）', '】', '》':
+		return true
+	}
+	return false
+}
+
+// isClosingMark reports punctuation that closes a span and is kept at the
+// end of shortened text.
+func isClosingMark(r rune) bool {
+	switch r {
+	case ')', ']', '}', '"', '\'', '」', '』', '）', '】', '》':
+		return true
+	}
+	return false
+}
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+func lastRune(s string) rune {
+	if s == "" {
+		return 0
+	}
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
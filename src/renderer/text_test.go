@@ -0,0 +1,43 @@
+package renderer
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{name: "empty", text: "", limit: 10, want: ""},
+		{name: "whitespace only", text: "   \n\t ", limit: 10, want: ""},
+		{name: "whitespace only without limit", text: " \n ", limit: 0, want: ""},
+		{name: "collapses whitespace without limit", text: "  a \n\n b  ", limit: 0, want: "a b"},
+		{name: "tidies punctuation spacing", text: "( spaced ) words , here", limit: 40, want: "(spaced) words, here"},
+		{name: "fits exactly", text: "Exactly ten", limit: 11, want: "Exactly ten"},
+		{name: "ends on a sentence at the limit", text: "Ends with a dot. More", limit: 16, want: "Ends with a dot."},
+
+		{name: "cuts after the last sentence", text: "The first sentence is here. The second one is much longer than that.", limit: 40, want: "The first sentence is here."},
+		{name: "sentence in the first half is ignored", text: "Short one. Then a very long sentence that keeps going", limit: 30, want: "Short one. Then a very long..."},
+		{name: "decimal point is no sentence end", text: "Version 1.2 is out and it fixes things", limit: 14, want: "Version 1.2..."},
+		{name: "cuts at a word", text: "A single very long sentence without any break at all here", limit: 20, want: "A single very long..."},
+
+		{name: "CJK cuts after a full stop", text: "维基百科是一个自由的百科全书。任何人都可以编辑。我们欢迎你的贡献", limit: 16, want: "维基百科是一个自由的百科全书。"},
+		{name: "CJK cuts after a clause mark", text: "维基百科是一个自由的百科全书，任何人都可以编辑和改进这里的内容", limit: 16, want: "维基百科是一个自由的百科全书..."},
+		{name: "CJK cuts mid-text without marks", text: "维基百科是一个自由的百科全书任何人都可以编辑", limit: 10, want: "维基百科是一个自由的..."},
+		{name: "CJK fits", text: "维基百科", limit: 4, want: "维基百科"},
+
+		{name: "combining mark stays with its base", text: "Cafe\u0301 au lait", limit: 4, want: "Cafe\u0301..."},
+		{name: "skin tone modifier stays whole", text: "Hello 👍🏽👍🏽👍🏽 world", limit: 8, want: "Hello 👍🏽👍🏽..."},
+		{name: "ZWJ sequence counts once", text: "Hi 👨‍👩‍👧‍👦 family", limit: 4, want: "Hi 👨‍👩‍👧‍👦..."},
+		{name: "flags are not split", text: "Flags 🇩🇪🇫🇷🇯🇵 here", limit: 8, want: "Flags 🇩🇪🇫🇷..."},
+		{name: "variation selector stays whole", text: "❤️❤️❤️❤️", limit: 2, want: "❤️❤️..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.text, tt.limit); got != tt.want {
+				t.Errorf("Summarize(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
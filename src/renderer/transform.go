@@ -0,0 +1,183 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Transform hooks into rendering: Source runs on the Markdown before it is
+// parsed and HTML runs on the rendered fragment. Either may return its input
+// unchanged.
+type Transform interface {
+	Source(src []byte) ([]byte, error)
+	HTML(html []byte) ([]byte, error)
+}
+
+// TransformOptions carries site settings available to transform factories.
+type TransformOptions struct {
+	SiteName  string
+	BaseURL   string
+	Variables map[string]string
+}
+
+// TransformFactory builds a transform for the given site settings.
+type TransformFactory func(opts TransformOptions) Transform
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]TransformFactory{
+		"variables":    newVariableTransform,
+		"absoluteUrls": newBaseURLTransform,
+	}
+)
+
+// RegisterTransform makes a transform available by name to the
+// render.transforms setting. Forks typically call it from an init function.
+func RegisterTransform(name string, factory TransformFactory) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[name] = factory
+}
+
+// HasTransform reports whether a transform is registered under name.
+func HasTransform(name string) bool {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	_, ok := transforms[name]
+	return ok
+}
+
+// TransformNames lists the registered transforms.
+func TransformNames() []string {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuildTransforms instantiates the named transforms in order.
+func BuildTransforms(names []string, opts TransformOptions) ([]Transform, error) {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	result := make([]Transform, 0, len(names))
+	for _, name := range names {
+		factory, ok := transforms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown render transform %q", name)
+		}
+		result = append(result, factory(opts))
+	}
+	return result, nil
+}
+
+// Use appends transforms to the rendering pipeline. It must be called before
+// the renderer is shared between goroutines.
+func (r *Renderer) Use(t ...Transform) {
+	r.transforms = append(r.transforms, t...)
+}
+
+func (r *Renderer) applySource(src []byte) ([]byte, error) {
+	for _, t := range r.transforms {
+		var err error
+		if src, err = t.Source(src); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+func (r *Renderer) applyHTML(html []byte) ([]byte, error) {
+	for _, t := range r.transforms {
+		var err error
+		if html, err = t.HTML(html); err != nil {
+			return nil, err
+		}
+	}
+	return html, nil
+}
+
+var (
+	variablePattern = regexp.MustCompile(`\\?\{\{\s*([A-Z][A-Z0-9_]*)\s*\}\}`)
+	variableName    = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// ValidVariableName reports whether name can be used as a {{NAME}}
+// placeholder.
+func ValidVariableName(name string) bool {
+	return variableName.MatchString(name)
+}
+
+// variableTransform replaces {{NAME}} placeholders in Markdown sources with
+// configured values. Unknown names are left untouched, and a backslash, as in
+// \{{NAME}}, keeps a placeholder literally.
+type variableTransform struct {
+	values map[string]string
+}
+
+func newVariableTransform(opts TransformOptions) Transform {
+	values := make(map[string]string, len(opts.Variables)+2)
+	for name, value := range opts.Variables {
+		values[name] = value
+	}
+	values["SITE_NAME"] = opts.SiteName
+	values["BASE_URL"] = "/" + strings.Trim(opts.BaseURL, "/")
+	return &variableTransform{values: values}
+}
+
+func (t *variableTransform) Source(src []byte) ([]byte, error) {
+	if !bytes.Contains(src, []byte("{{")) {
+		return src, nil
+	}
+	return variablePattern.ReplaceAllFunc(src, func(match []byte) []byte {
+		if match[0] == '\\' {
+			return match[1:]
+		}
+		name := string(variablePattern.FindSubmatch(match)[1])
+		if value, ok := t.values[name]; ok {
+			return []byte(value)
+		}
+		return match
+	}), nil
+}
+
+func (t *variableTransform) HTML(html []byte) ([]byte, error) { return html, nil }
+
+var rootRelativeAttr = regexp.MustCompile(`(\s(?:href|src)=")(/[^/"][^"]*|/)"`)
+
+// baseURLTransform prefixes root-relative links with the configured base path
+// so pages written for a root-hosted wiki keep working under a subdirectory.
+type baseURLTransform struct {
+	prefix string
+}
+
+func newBaseURLTransform(opts TransformOptions) Transform {
+	trimmed := strings.Trim(strings.TrimSpace(opts.BaseURL), "/")
+	if trimmed == "" {
+		return &baseURLTransform{}
+	}
+	return &baseURLTransform{prefix: "/" + trimmed}
+}
+
+func (t *baseURLTransform) Source(src []byte) ([]byte, error) { return src, nil }
+
+func (t *baseURLTransform) HTML(html []byte) ([]byte, error) {
+	if t.prefix == "" {
+		return html, nil
+	}
+	return rootRelativeAttr.ReplaceAllFunc(html, func(match []byte) []byte {
+		parts := rootRelativeAttr.FindSubmatch(match)
+		target := string(parts[2])
+		if target == t.prefix || strings.HasPrefix(target, t.prefix+"/") {
+			return match
+		}
+		return []byte(string(parts[1]) + t.prefix + target + `"`)
+	}), nil
+}
@@ -0,0 +1,460 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxViewerRows caps the rows rendered for tabular data files.
+const maxViewerRows = 1000
+
+// viewerFunc renders a data file into an HTML fragment.
+type viewerFunc func(r *Renderer, src []byte) ([]byte, error)
+
+var viewers = map[string]viewerFunc{
+	".csv":     renderCSV(','),
+	".tsv":     renderCSV('\t'),
+	".geojson": renderGeoJSON,
+	".ipynb":   renderNotebook,
+}
+
+// ViewerExtensions lists the file extensions with a built-in viewer.
+func ViewerExtensions() []string {
+	exts := make([]string, 0, len(viewers))
+	for ext := range viewers {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// HasViewer reports whether ext (eg. ".csv") has a built-in viewer.
+func HasViewer(ext string) bool {
+	_, ok := viewers[strings.ToLower(ext)]
+	return ok
+}
+
+// UseViewers enables built-in viewer pages for the given extensions. It must
+// be called before the renderer is shared between goroutines.
+func (r *Renderer) UseViewers(exts ...string) {
+	if r.viewers == nil {
+		r.viewers = make(map[string]viewerFunc)
+	}
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if fn, ok := viewers[ext]; ok {
+			r.viewers[ext] = fn
+		}
+	}
+}
+
+// IsViewer reports whether a file is rendered by a built-in viewer. Such
+// files are still published as-is next to their viewer page.
+func (r *Renderer) IsViewer(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := r.extensions[ext]; ok {
+		return false
+	}
+	_, ok := r.viewers[ext]
+	return ok
+}
+
+func (r *Renderer) renderViewer(name string, src []byte) (*RenderResult, error) {
+	fn := r.viewers[strings.ToLower(filepath.Ext(name))]
+	body, err := fn(r, src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(body)
+	// Viewer pages live at /<name>/ while the raw file keeps its own path.
+	fmt.Fprintf(&buf, "<p class=\"viewer-download\"><a href=\"../%s\" download>Download %s</a></p>\n",
+		html.EscapeString(path.Base(filepath.ToSlash(name))), html.EscapeString(path.Base(filepath.ToSlash(name))))
+
+	result := resultFromHTML(buf.Bytes())
+	if result.HTML, err = r.applyHTML(result.HTML); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func renderCSV(comma rune) viewerFunc {
+	return func(_ *Renderer, src []byte) ([]byte, error) {
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))))
+		reader.Comma = comma
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		var buf bytes.Buffer
+		buf.WriteString("<div class=\"viewer viewer-table\"><table>\n")
+		rows := 0
+		truncated := false
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if rows > maxViewerRows {
+				truncated = true
+				break
+			}
+			cell := "td"
+			if rows == 0 {
+				cell = "th"
+				buf.WriteString("<thead>")
+			}
+			buf.WriteString("<tr>")
+			for _, field := range record {
+				fmt.Fprintf(&buf, "<%s>%s</%s>", cell, html.EscapeString(field), cell)
+			}
+			buf.WriteString("</tr>")
+			if rows == 0 {
+				buf.WriteString("</thead>\n<tbody>")
+			}
+			buf.WriteByte('\n')
+			rows++
+		}
+		if rows > 0 {
+			buf.WriteString("</tbody>")
+		}
+		buf.WriteString("</table></div>\n")
+		if truncated {
+			fmt.Fprintf(&buf, "<p class=\"viewer-note\">Showing the first %d rows.</p>\n", maxViewerRows)
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+type geoObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometries  []geoObject     `json:"geometries"`
+	Geometry    *geoObject      `json:"geometry"`
+	Features    []geoObject     `json:"features"`
+	Properties  map[string]any  `json:"properties"`
+}
+
+type geoShape struct {
+	kind  string // point, line or polygon
+	rings [][][2]float64
+}
+
+// renderGeoJSON draws the geometries as an inline SVG using an
+// equirectangular projection, followed by a table of feature properties.
+// It needs no client-side map library or tile server.
+func renderGeoJSON(_ *Renderer, src []byte) ([]byte, error) {
+	var root geoObject
+	if err := json.Unmarshal(src, &root); err != nil {
+		return nil, fmt.Errorf("parse geojson: %w", err)
+	}
+
+	var features []geoObject
+	switch root.Type {
+	case "FeatureCollection":
+		features = root.Features
+	case "Feature":
+		features = []geoObject{root}
+	default:
+		features = []geoObject{{Type: "Feature", Geometry: &root}}
+	}
+
+	var shapes []geoShape
+	for _, feature := range features {
+		if feature.Geometry != nil {
+			collected, err := collectShapes(*feature.Geometry)
+			if err != nil {
+				return nil, err
+			}
+			shapes = append(shapes, collected...)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<div class=\"viewer viewer-map\">")
+	writeGeoSVG(&buf, shapes)
+	buf.WriteString("</div>\n")
+	writeGeoProperties(&buf, features)
+	return buf.Bytes(), nil
+}
+
+func collectShapes(g geoObject) ([]geoShape, error) {
+	decode := func(v any) error {
+		if err := json.Unmarshal(g.Coordinates, v); err != nil {
+			return fmt.Errorf("parse %s coordinates: %w", g.Type, err)
+		}
+		return nil
+	}
+	switch g.Type {
+	case "Point":
+		var p [2]float64
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return []geoShape{{kind: "point", rings: [][][2]float64{{p}}}}, nil
+	case "MultiPoint":
+		var ps [][2]float64
+		if err := decode(&ps); err != nil {
+			return nil, err
+		}
+		shapes := make([]geoShape, 0, len(ps))
+		for _, p := range ps {
+			shapes = append(shapes, geoShape{kind: "point", rings: [][][2]float64{{p}}})
+		}
+		return shapes, nil
+	case "LineString":
+		var line [][2]float64
+		if err := decode(&line); err != nil {
+			return nil, err
+		}
+		return []geoShape{{kind: "line", rings: [][][2]float64{line}}}, nil
+	case "MultiLineString":
+		var lines [][][2]float64
+		if err := decode(&lines); err != nil {
+			return nil, err
+		}
+		return []geoShape{{kind: "line", rings: lines}}, nil
+	case "Polygon":
+		var rings [][][2]float64
+		if err := decode(&rings); err != nil {
+			return nil, err
+		}
+		return []geoShape{{kind: "polygon", rings: rings}}, nil
+	case "MultiPolygon":
+		var polygons [][][][2]float64
+		if err := decode(&polygons); err != nil {
+			return nil, err
+		}
+		shapes := make([]geoShape, 0, len(polygons))
+		for _, rings := range polygons {
+			shapes = append(shapes, geoShape{kind: "polygon", rings: rings})
+		}
+		return shapes, nil
+	case "GeometryCollection":
+		var shapes []geoShape
+		for _, child := range g.Geometries {
+			collected, err := collectShapes(child)
+			if err != nil {
+				return nil, err
+			}
+			shapes = append(shapes, collected...)
+		}
+		return shapes, nil
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+}
+
+func writeGeoSVG(buf *bytes.Buffer, shapes []geoShape) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, shape := range shapes {
+		for _, ring := range shape.rings {
+			for _, p := range ring {
+				minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+				minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+			}
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return
+	}
+	// Pad the bounds so single points and straight lines stay visible.
+	pad := math.Max(math.Max(maxX-minX, maxY-minY)*0.05, 0.01)
+	minX, minY, maxX, maxY = minX-pad, minY-pad, maxX+pad, maxY+pad
+	width, height := maxX-minX, maxY-minY
+	stroke := math.Max(width, height) / 400
+
+	// SVG y grows downwards, latitude grows upwards.
+	project := func(p [2]float64) string {
+		return fmt.Sprintf("%.6g,%.6g", p[0]-minX, maxY-p[1])
+	}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %.6g %.6g" preserveAspectRatio="xMidYMid meet" role="img">`, width, height)
+	for _, shape := range shapes {
+		switch shape.kind {
+		case "point":
+			fmt.Fprintf(buf, `<circle cx="%.6g" cy="%.6g" r="%.6g" class="geo-point"/>`, shape.rings[0][0][0]-minX, maxY-shape.rings[0][0][1], stroke*3)
+		case "line":
+			for _, ring := range shape.rings {
+				points := make([]string, 0, len(ring))
+				for _, p := range ring {
+					points = append(points, project(p))
+				}
+				fmt.Fprintf(buf, `<polyline points="%s" fill="none" stroke="currentColor" stroke-width="%.6g" class="geo-line"/>`, strings.Join(points, " "), stroke)
+			}
+		case "polygon":
+			var d strings.Builder
+			for _, ring := range shape.rings {
+				for i, p := range ring {
+					if i == 0 {
+						d.WriteString("M")
+					} else {
+						d.WriteString(" L")
+					}
+					d.WriteString(project(p))
+				}
+				d.WriteString(" Z")
+			}
+			fmt.Fprintf(buf, `<path d="%s" fill-rule="evenodd" fill-opacity="0.3" stroke="currentColor" stroke-width="%.6g" class="geo-polygon"/>`, d.String(), stroke)
+		}
+	}
+	buf.WriteString("</svg>")
+}
+
+func writeGeoProperties(buf *bytes.Buffer, features []geoObject) {
+	keySet := make(map[string]struct{})
+	for _, feature := range features {
+		for key := range feature.Properties {
+			keySet[key] = struct{}{}
+		}
+	}
+	if len(keySet) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString("<div class=\"viewer viewer-table\"><table>\n<thead><tr>")
+	for _, key := range keys {
+		fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(key))
+	}
+	buf.WriteString("</tr></thead>\n<tbody>")
+	for i, feature := range features {
+		if i == maxViewerRows {
+			break
+		}
+		buf.WriteString("<tr>")
+		for _, key := range keys {
+			value := ""
+			if v, ok := feature.Properties[key]; ok && v != nil {
+				value = fmt.Sprint(v)
+			}
+			fmt.Fprintf(buf, "<td>%s</td>", html.EscapeString(value))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</tbody></table></div>\n")
+}
+
+// notebookText decodes nbformat multiline strings, stored either as a single
+// string or as a list of lines. Other JSON values (eg. application/json
+// outputs) decode to an empty string.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = notebookText(s)
+	}
+	return nil
+}
+
+type notebook struct {
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string       `json:"cell_type"`
+		Source   notebookText `json:"source"`
+		Outputs  []struct {
+			OutputType string                  `json:"output_type"`
+			Text       notebookText            `json:"text"`
+			Data       map[string]notebookText `json:"data"`
+			EName      string                  `json:"ename"`
+			EValue     string                  `json:"evalue"`
+		} `json:"outputs"`
+	} `json:"cells"`
+}
+
+// renderNotebook renders a Jupyter notebook (nbformat 4) as static HTML:
+// Markdown cells through the site's Markdown pipeline, code cells with
+// syntax highlighting and their stored outputs. Nothing is executed.
+func renderNotebook(r *Renderer, src []byte) ([]byte, error) {
+	var nb notebook
+	if err := json.Unmarshal(src, &nb); err != nil {
+		return nil, fmt.Errorf("parse notebook: %w", err)
+	}
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.KernelSpec.Language
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<div class=\"viewer viewer-notebook\">\n")
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			buf.WriteString("<div class=\"nb-cell nb-markdown\">\n")
+			if err := r.md.Convert([]byte(cell.Source), &buf); err != nil {
+				return nil, err
+			}
+			buf.WriteString("</div>\n")
+		case "code":
+			buf.WriteString("<div class=\"nb-cell nb-code\">\n")
+			fence := "```"
+			for strings.Contains(string(cell.Source), fence) {
+				fence += "`"
+			}
+			code := fmt.Sprintf("%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(string(cell.Source), "\n"), fence)
+			if err := r.md.Convert([]byte(code), &buf); err != nil {
+				return nil, err
+			}
+			for _, output := range cell.Outputs {
+				writeNotebookOutput(&buf, output.OutputType, string(output.Text), output.Data, output.EName, output.EValue)
+			}
+			buf.WriteString("</div>\n")
+		case "raw":
+			fmt.Fprintf(&buf, "<pre class=\"nb-cell nb-raw\">%s</pre>\n", html.EscapeString(string(cell.Source)))
+		}
+	}
+	buf.WriteString("</div>\n")
+	return buf.Bytes(), nil
+}
+
+func writeNotebookOutput(buf *bytes.Buffer, kind, text string, data map[string]notebookText, ename, evalue string) {
+	switch kind {
+	case "stream":
+		fmt.Fprintf(buf, "<pre class=\"nb-output\">%s</pre>\n", html.EscapeString(text))
+	case "error":
+		fmt.Fprintf(buf, "<pre class=\"nb-output nb-error\">%s: %s</pre>\n", html.EscapeString(ename), html.EscapeString(evalue))
+	case "execute_result", "display_data":
+		// Prefer the richest representation the notebook stored.
+		switch {
+		case data["text/html"] != "":
+			fmt.Fprintf(buf, "<div class=\"nb-output\">%s</div>\n", data["text/html"])
+		case data["image/svg+xml"] != "":
+			fmt.Fprintf(buf, "<div class=\"nb-output\">%s</div>\n", data["image/svg+xml"])
+		case data["image/png"] != "":
+			fmt.Fprintf(buf, "<div class=\"nb-output\"><img alt=\"\" src=\"data:image/png;base64,%s\"></div>\n", strings.TrimSpace(string(data["image/png"])))
+		case data["image/jpeg"] != "":
+			fmt.Fprintf(buf, "<div class=\"nb-output\"><img alt=\"\" src=\"data:image/jpeg;base64,%s\"></div>\n", strings.TrimSpace(string(data["image/jpeg"])))
+		case data["text/plain"] != "":
+			fmt.Fprintf(buf, "<pre class=\"nb-output\">%s</pre>\n", html.EscapeString(string(data["text/plain"])))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package renderer
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// WikiLinkClass marks links written as [[Page]]. The site adds
+// WikiLinkMissingClass to those whose target does not exist.
+const (
+	WikiLinkClass        = "wiki-link"
+	WikiLinkMissingClass = "wiki-link-missing"
+)
+
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+// wikiLink is a [[target]] or [[target|label]] link. Its children hold the
+// label text.
+type wikiLink struct {
+	ast.BaseInline
+	Target string
+}
+
+func (n *wikiLink) Kind() ast.NodeKind { return kindWikiLink }
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target}, nil)
+}
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte { return []byte{'['} }
+
+func (wikiLinkParser) Parse(_ ast.Node, block text.Reader, _ parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 3 {
+		return nil
+	}
+	inner := line[2:end]
+	if bytes.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+	target, label := inner, inner
+	labelStart := segment.Start + 2
+	if pipe := bytes.IndexByte(inner, '|'); pipe >= 0 {
+		target, label = inner[:pipe], inner[pipe+1:]
+		labelStart += pipe + 1
+	}
+	if len(bytes.TrimSpace(target)) == 0 || len(bytes.TrimSpace(label)) == 0 {
+		return nil
+	}
+	node := &wikiLink{Target: strings.TrimSpace(string(target))}
+	labelSegment := text.NewSegment(labelStart, labelStart+len(label))
+	labelSegment = labelSegment.TrimLeftSpace(block.Source())
+	labelSegment = labelSegment.TrimRightSpace(block.Source())
+	node.AppendChild(node, ast.NewTextSegment(labelSegment))
+	block.Advance(end + 2)
+	return node
+}
+
+type wikiLinkRenderer struct {
+	base string
+}
+
+func (r *wikiLinkRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, func(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			href := WikiLinkHref(r.base, node.(*wikiLink).Target)
+			_, _ = w.WriteString(`<a class="` + WikiLinkClass + `" href="` + html.EscapeString(href) + `">`)
+		} else {
+			_, _ = w.WriteString("</a>")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// WikiLinkHref resolves a [[Page Name]] target to the page route below base,
+// Gollum style: spaces become dashes and a ".md" suffix is dropped. A
+// "#section" suffix is kept as the fragment.
+func WikiLinkHref(base, target string) string {
+	target, fragment, _ := strings.Cut(strings.TrimSpace(target), "#")
+	target = strings.Trim(strings.TrimSpace(target), "/")
+	if strings.HasSuffix(strings.ToLower(target), ".md") {
+		target = target[:len(target)-len(".md")]
+	}
+	target = strings.ReplaceAll(target, " ", "-")
+	fragment = strings.TrimSpace(fragment)
+	if target == "" && fragment != "" {
+		return "#" + slugify(fragment)
+	}
+
+	prefix := "/" + strings.Trim(strings.TrimSpace(base), "/")
+	if prefix != "/" {
+		prefix += "/"
+	}
+	href := prefix
+	if target != "" {
+		href += (&url.URL{Path: target}).EscapedPath() + "/"
+	}
+	if fragment != "" {
+		href += "#" + slugify(fragment)
+	}
+	return href
+}
+
+// UseWikiLinks enables [[Page]] link syntax with routes under base. It must
+// be called before the renderer is shared between goroutines.
+func (r *Renderer) UseWikiLinks(base string) {
+	r.md.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199)))
+	r.md.Renderer().AddOptions(gmrenderer.WithNodeRenderers(util.Prioritized(&wikiLinkRenderer{base: base}, 100)))
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/logging"
+)
+
+// accessLog writes a line per request to the access log file.
+type accessLog struct {
+	format string
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// UseAccessLog writes the access log, in accessLog.format, to w.
+func (s *Server) UseAccessLog(w io.Writer) {
+	s.accessLog = &accessLog{format: s.cfg.AccessLog.Format, w: w}
+}
+
+// accessEntry is a request as the access log records it.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	DurationMs float64   `json:"durationMs"`
+	RequestID  string    `json:"requestId,omitempty"`
+}
+
+// recordAccess logs a finished request, with the client IP derived through
+// trustedProxies.
+func (s *Server) recordAccess(r *http.Request, rw *responseWriter, start time.Time) {
+	entry := accessEntry{
+		Time:       start,
+		Client:     s.clientRemoteAddr(r),
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Status:     rw.status,
+		Bytes:      rw.bytes,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		RequestID:  logging.RequestID(r.Context()),
+	}
+	if user, _, ok := r.BasicAuth(); ok && s.cfg.SiteAuth.Enabled {
+		entry.User = user
+	}
+	s.accessLog.write(entry)
+}
+
+func (l *accessLog) write(entry accessEntry) {
+	var line []byte
+	if l.format == config.AccessLogJSON {
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		line = combinedLine(entry)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+// combinedLine formats entry in the combined log format of Apache and nginx,
+// which log analyzers read, followed by the duration in seconds.
+func combinedLine(entry accessEntry) []byte {
+	b := make([]byte, 0, 256)
+	b = append(b, entry.Client...)
+	b = append(b, " - "...)
+	b = append(b, orDash(entry.User)...)
+	b = append(b, " ["...)
+	b = entry.Time.AppendFormat(b, "02/Jan/2006:15:04:05 -0700")
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, entry.Method+" "+entry.URI+" "+entry.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(entry.Status), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, entry.Bytes, 10)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(entry.Referer))
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, orDash(entry.UserAgent))
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, entry.DurationMs/1000, 'f', 3, 64)
+	return append(b, '\n')
+}
+
+func orDash(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return value
+}
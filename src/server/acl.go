@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/edittoken"
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// identifyPrincipal records who a request acts for, so the site can apply
+// ACL rules. Only verified credentials count; requests without any are
+// anonymous.
+func (s *Server) identifyPrincipal(next http.Handler) http.Handler {
+	if !s.cfg.ACL.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(site.WithPrincipal(r.Context(), s.principalMembers(r))))
+	})
+}
+
+// principalMembers names the request's credentials the way ACL roles list
+// their members.
+func (s *Server) principalMembers(r *http.Request) []string {
+	var members []string
+	if identity, ok := s.sessionIdentity(r); ok {
+		members = append(members, "oidc:"+identity.Subject)
+	}
+	if s.cfg.SiteAuth.Enabled {
+		if user, _, ok := r.BasicAuth(); ok && s.authorizeSite(r) {
+			members = append(members, "user:"+user)
+		}
+	}
+	if s.cfg.EditTokens.Enabled {
+		if token := strings.TrimSpace(r.Header.Get(EditTokenHeader)); token != "" {
+			if claims, err := edittoken.Verify([]byte(s.cfg.EditTokens.Secret), token, time.Now()); err == nil {
+				members = append(members, "token:"+claims.Subject)
+			}
+		}
+	}
+	if s.cfg.Bots.Enabled {
+		if name, ok := s.authorizeBot(r); ok {
+			members = append(members, "bot:"+name)
+		}
+	}
+	return members
+}
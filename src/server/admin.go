@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// requireAdmin guards operator-only endpoints behind the configured admin token.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.Admin.Enabled {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !s.authorizeAdmin(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) authorizeAdmin(r *http.Request) bool {
+	token := strings.TrimSpace(s.cfg.Admin.Token)
+	if token == "" {
+		return false
+	}
+	provided, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Authorization")), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(provided)), []byte(token)) == 1
+}
+
+func (s *Server) handleAdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": s.webhookLog.snapshot()})
+}
+
+// handleAdminBuild reports the active build, the page collisions it found
+// and the pages it spent most time on.
+func (s *Server) handleAdminBuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	commit, built := s.svc.ActiveBuild()
+	nav, err := s.svc.Snapshot(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	collisions := nav.Collisions
+	if collisions == nil {
+		collisions = []site.Collision{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"commit":     commit,
+		"builtAt":    built,
+		"pages":      len(nav.Pages),
+		"collisions": collisions,
+		"slowest":    s.svc.SlowestPages(),
+	})
+}
+
+// handleAdminOrphans lists the pages of the active build that cannot be
+// reached by following links from the home page or a sidebar.
+func (s *Server) handleAdminOrphans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	commit, _ := s.svc.ActiveBuild()
+	nav, err := s.svc.Snapshot(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	type orphan struct {
+		Route string `json:"route"`
+		Title string `json:"title"`
+	}
+	orphans := make([]orphan, 0, len(nav.Orphans))
+	for _, route := range nav.Orphans {
+		orphans = append(orphans, orphan{Route: route, Title: nav.Titles[route]})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"commit":  commit,
+		"pages":   len(nav.Pages),
+		"orphans": orphans,
+	})
+}
+
+// handleAdminPull reports the upstream commit held back by pull validation,
+// if any.
+func (s *Server) handleAdminPull(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"validation": s.cfg.PullValidation.Enabled,
+		"rejected":   s.svc.PullRejection(),
+	})
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+// maxBeaconBytes bounds the body of a beacon, which is just a path.
+const maxBeaconBytes = 1 << 10
+
+var pageViews = metrics.NewCounter("wiki_page_views_total", "Page views counted by the analytics beacon.")
+
+// pageViewCounts holds the views of each page per UTC day, and nothing
+// about who viewed them.
+type pageViewCounts struct {
+	file      string
+	retention int
+	mu        sync.Mutex
+	days      map[string]map[string]int64
+	dirty     bool
+}
+
+func newPageViewCounts(file string, retentionDays int) *pageViewCounts {
+	return &pageViewCounts{file: file, retention: retentionDays, days: make(map[string]map[string]int64)}
+}
+
+// load reads the counts persisted by an earlier run, if any.
+func (c *pageViewCounts) load() error {
+	data, err := os.ReadFile(c.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Unmarshal(data, &c.days)
+}
+
+func (c *pageViewCounts) record(route string, now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.days[day] == nil {
+		c.days[day] = make(map[string]int64)
+	}
+	c.days[day][route]++
+	c.dirty = true
+}
+
+// prune drops the days older than the retention. The caller holds c.mu.
+func (c *pageViewCounts) prune(now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -c.retention+1).Format(time.DateOnly)
+	for day := range c.days {
+		if day < oldest {
+			delete(c.days, day)
+			c.dirty = true
+		}
+	}
+}
+
+// flush writes the counts to the file when they changed since the last
+// flush.
+func (c *pageViewCounts) flush(now time.Time) error {
+	c.mu.Lock()
+	c.prune(now)
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.days)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), ".__analytics-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
+
+type pageViewTotal struct {
+	Route string `json:"route"`
+	Views int64  `json:"views"`
+}
+
+type pageViewDay struct {
+	Day   string `json:"day"`
+	Views int64  `json:"views"`
+}
+
+// summary adds up the views of the last days days, by page, busiest first,
+// and by day, oldest first.
+func (c *pageViewCounts) summary(days int, now time.Time) ([]pageViewTotal, []pageViewDay) {
+	oldest := now.UTC().AddDate(0, 0, -days+1).Format(time.DateOnly)
+	routes := make(map[string]int64)
+	var daily []pageViewDay
+	c.mu.Lock()
+	for _, day := range slices.Sorted(maps.Keys(c.days)) {
+		if day < oldest {
+			continue
+		}
+		var views int64
+		for route, n := range c.days[day] {
+			routes[route] += n
+			views += n
+		}
+		daily = append(daily, pageViewDay{Day: day, Views: views})
+	}
+	c.mu.Unlock()
+
+	pages := make([]pageViewTotal, 0, len(routes))
+	for route, views := range routes {
+		pages = append(pages, pageViewTotal{Route: route, Views: views})
+	}
+	slices.SortFunc(pages, func(a, b pageViewTotal) int {
+		return cmp.Or(cmp.Compare(b.Views, a.Views), strings.Compare(a.Route, b.Route))
+	})
+	return pages, daily
+}
+
+// runAnalytics writes the counts every analytics.flushSec until ctx ends,
+// and once more then.
+func (s *Server) runAnalytics(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.cfg.Analytics.FlushSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.flushAnalytics()
+			return
+		case <-ticker.C:
+			s.flushAnalytics()
+		}
+	}
+}
+
+func (s *Server) flushAnalytics() {
+	if err := s.pageViews.flush(time.Now()); err != nil {
+		s.logger.Warn("analytics", "error", err)
+	}
+}
+
+// handleBeacon counts a view of the page whose path, as in
+// location.pathname, is the request body. Paths that are not readable pages
+// are ignored, so the counts only grow with the wiki. Clients asking not to
+// be tracked are not counted.
+func (s *Server) handleBeacon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBeaconBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "beacon too large")
+		return
+	}
+	route, err := url.PathUnescape(strings.TrimSpace(string(body)))
+	if err != nil || !strings.HasPrefix(route, "/") {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	route = path.Clean(route)
+	if s.countablePage(r, route) {
+		s.pageViews.record(route, time.Now())
+		pageViews.Inc()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// countablePage reports whether route is a page of the active build that
+// the client may read.
+func (s *Server) countablePage(r *http.Request, route string) bool {
+	if s.svc.EnsureRequestAccessible(r.Context(), route) != nil {
+		return false
+	}
+	staticPath, err := s.svc.StaticDocumentPath(route)
+	if err != nil || !isWithin(s.cfg.OutputDir, staticPath) {
+		return false
+	}
+	_, ok := s.svc.LookupOutput(staticPath)
+	return ok
+}
+
+// handleAdminAnalytics reports the page views of the last ?days= days,
+// 30 by default.
+func (s *Server) handleAdminAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.pageViews == nil {
+		writeError(w, http.StatusNotFound, "analytics disabled")
+		return
+	}
+	days := 30
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid days")
+			return
+		}
+		days = min(n, s.cfg.Analytics.RetentionDays)
+	}
+	pages, daily := s.pageViews.summary(days, time.Now())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"days":  days,
+		"pages": pages,
+		"daily": daily,
+	})
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/auth"
+	"github.com/iedon/dn42-wiki-go/netutil"
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// loginPath starts a login; the editor sends users there when a write is
+// refused with the Login challenge.
+const loginPath = "/auth/login"
+
+// newAuth sets up the provider and sessions when auth is enabled.
+func (s *Server) newAuth() error {
+	client, err := netutil.NewHTTPClient(s.cfg.Outbound.ClientOptions(30*time.Second, s.cfg.Auth.SkipRemoteCert))
+	if err != nil {
+		return err
+	}
+	secret := []byte(s.cfg.Auth.SessionSecret)
+	s.provider = auth.NewProvider(auth.Config{
+		Issuer:       s.cfg.Auth.Issuer,
+		ClientID:     s.cfg.Auth.ClientID,
+		ClientSecret: s.cfg.Auth.ClientSecret,
+		RedirectURL:  s.cfg.Auth.RedirectURL,
+		Scopes:       s.cfg.Auth.Scopes,
+		Secret:       secret,
+	}, client)
+	s.sessions = auth.NewSessions(secret, s.cfg.Auth.SessionTTL())
+	return nil
+}
+
+// requireLogin refuses writes without a session when auth is enabled, and
+// makes the signed-in user the editor and commit author of the others.
+func (s *Server) requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	if !s.cfg.Auth.Enabled {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := s.sessionIdentity(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Login url="`+loginPath+`"`)
+			writeError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		r = withEditor(r, "oidc:"+identity.Subject)
+		ctx := site.WithCommitAuthor(r.Context(), identity.Author(s.provider.Host()))
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// sessionIdentity returns the user signed in with the request's session
+// cookie.
+func (s *Server) sessionIdentity(r *http.Request) (auth.Identity, bool) {
+	if s.sessions == nil {
+		return auth.Identity{}, false
+	}
+	cookie, err := r.Cookie(s.cfg.Auth.CookieName)
+	if err != nil {
+		return auth.Identity{}, false
+	}
+	identity, err := s.sessions.Verify(cookie.Value, time.Now())
+	if err != nil {
+		return auth.Identity{}, false
+	}
+	return identity, true
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authAvailable(w) {
+		return
+	}
+	target, state, err := s.provider.Begin(r.Context(), s.returnPath(r.URL.Query().Get("return")), time.Now())
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "login", "error", err)
+		writeError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+	http.SetCookie(w, s.authCookie(s.loginCookieName(), state, "/auth/", 10*time.Minute))
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) handleLoginCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authAvailable(w) {
+		return
+	}
+	query := r.URL.Query()
+	http.SetCookie(w, s.authCookie(s.loginCookieName(), "", "/auth/", -1))
+	if failure := query.Get("error"); failure != "" {
+		writeError(w, http.StatusForbidden, strings.TrimSpace("login failed: "+failure+" "+query.Get("error_description")))
+		return
+	}
+	pending, err := r.Cookie(s.loginCookieName())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "login not started or expired")
+		return
+	}
+	identity, returnTo, err := s.provider.Finish(r.Context(), pending.Value, query.Get("state"), query.Get("code"), time.Now())
+	if err != nil {
+		s.logger.WarnContext(r.Context(), "login", "error", err)
+		writeError(w, http.StatusForbidden, "login failed: "+err.Error())
+		return
+	}
+	value, err := s.sessions.Issue(identity, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), "login", "subject", identity.Subject, "name", identity.DisplayName())
+	http.SetCookie(w, s.authCookie(s.cfg.Auth.CookieName, value, "/", s.sessions.TTL()))
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Auth.Enabled {
+		writeError(w, http.StatusNotFound, "auth disabled")
+		return
+	}
+	http.SetCookie(w, s.authCookie(s.cfg.Auth.CookieName, "", "/", -1))
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, s.returnPath(r.URL.Query().Get("return")), http.StatusFound)
+}
+
+func (s *Server) handleAuthMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Auth.Enabled {
+		writeError(w, http.StatusNotFound, "auth disabled")
+		return
+	}
+	payload := map[string]any{"authenticated": false, "loginUrl": loginPath}
+	if identity, ok := s.sessionIdentity(r); ok {
+		payload["authenticated"] = true
+		payload["subject"] = identity.Subject
+		payload["name"] = identity.DisplayName()
+		if identity.Email != "" {
+			payload["email"] = identity.Email
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// authAvailable answers requests for login endpoints that cannot be served.
+func (s *Server) authAvailable(w http.ResponseWriter) bool {
+	switch {
+	case !s.cfg.Auth.Enabled:
+		writeError(w, http.StatusNotFound, "auth disabled")
+		return false
+	case s.provider == nil:
+		writeError(w, http.StatusServiceUnavailable, "auth unavailable")
+		return false
+	}
+	return true
+}
+
+func (s *Server) loginCookieName() string {
+	return s.cfg.Auth.CookieName + "_login"
+}
+
+// authCookie builds a session or login cookie; a negative maxAge removes
+// it. Cookies are only sent over HTTPS when the callback is served there.
+func (s *Server) authCookie(name, value, cookiePath string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.Auth.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge / time.Second)
+	}
+	return cookie
+}
+
+// returnPath keeps a return target on this site, falling back to the home
+// page.
+func (s *Server) returnPath(raw string) string {
+	home := strings.TrimSuffix(path.Join("/", s.cfg.BaseURL), "/") + "/"
+	if raw == "" || !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.Contains(raw, "\\") {
+		return home
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return home
+	}
+	return parsed.RequestURI()
+}
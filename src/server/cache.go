@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiCacheMaxAge bounds how long clients may reuse read-only API responses
+// without revalidating. Editable wikis always revalidate so fresh edits show up.
+const apiCacheMaxAge = 60
+
+// notModified attaches an ETag built from tag, a Last-Modified header when
+// modTime is set, and caching headers. It reports whether the client's copy
+// is current, in which case a 304 has already been written.
+func (s *Server) notModified(w http.ResponseWriter, r *http.Request, tag string, modTime time.Time) bool {
+	etag := `"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if s.cfg.SiteAuth.Enabled || s.cfg.ACL.Enabled() {
+		// Answers depend on who asks, or are only for signed in readers.
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else if policy, ok := s.cachePolicy("application/json"); ok {
+		w.Header().Set("Cache-Control", policy)
+	} else if s.cfg.Editable {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", apiCacheMaxAge))
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	// If-Modified-Since is only consulted without If-None-Match (RFC 9110).
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.IsZero() && !modTime.Truncate(time.Second).After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// cachePolicy returns the configured Cache-Control value for a content type,
+// trying the exact media type, then "type/*", then "*".
+func (s *Server) cachePolicy(contentType string) (string, bool) {
+	if len(s.cfg.CacheControl) == 0 {
+		return "", false
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if policy, ok := s.cfg.CacheControl[mediaType]; ok {
+		return policy, true
+	}
+	if major, _, ok := strings.Cut(mediaType, "/"); ok {
+		if policy, ok := s.cfg.CacheControl[major+"/*"]; ok {
+			return policy, true
+		}
+	}
+	policy, ok := s.cfg.CacheControl["*"]
+	return policy, ok
+}
+
+// commitTag derives a validator from the checked-out commit and the request
+// query, so identical requests between commits are answered without git.
+func (s *Server) commitTag(r *http.Request) (string, bool) {
+	head, err := s.svc.HeadCommit(r.Context())
+	if err != nil || head == "" {
+		return "", false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(r.URL.RawQuery))
+	return fmt.Sprintf("%s-%x", head, h.Sum64()), true
+}
+
+// contentTag derives a validator from the response body itself.
+func contentTag(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:16])
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
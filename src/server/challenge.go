@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/challenge"
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/metrics"
+	"github.com/iedon/dn42-wiki-go/netutil"
+)
+
+// ChallengeResponseHeader carries the solution of an anti-abuse challenge
+// on write requests.
+const ChallengeResponseHeader = "X-Challenge-Response"
+
+var challengeFailures = metrics.NewCounterVec("wiki_challenge_failures_total", "Anonymous writes refused for a missing or wrong challenge response, by endpoint.", "endpoint")
+
+// newChallenge sets up the verifier of the configured challenge provider.
+func (s *Server) newChallenge() error {
+	cfg := s.cfg.Challenge
+	if cfg.Provider == config.ChallengePoW {
+		pow, err := challenge.NewPoW(cfg.Difficulty, cfg.TTL())
+		if err != nil {
+			return err
+		}
+		s.challenge = pow
+		return nil
+	}
+	client, err := netutil.NewHTTPClient(s.cfg.Outbound.ClientOptions(10*time.Second, false))
+	if err != nil {
+		return err
+	}
+	s.challenge = &challenge.SiteVerify{Name: cfg.Provider, URL: cfg.VerifyURL, Secret: cfg.Secret, Client: client}
+	return nil
+}
+
+// requireChallenge refuses anonymous writes to endpoint that carry no
+// solved challenge. Editors known by edit token, login or site user are
+// not anonymous; requireLogin and requireEditToken have named them by now.
+func (s *Server) requireChallenge(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	if !s.cfg.Challenge.Requires(endpoint) {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			next(w, r)
+			return
+		}
+		if !strings.HasPrefix(s.editorOf(r), "ip:") {
+			next(w, r)
+			return
+		}
+		if s.challenge == nil {
+			writeError(w, http.StatusServiceUnavailable, "challenge unavailable")
+			return
+		}
+		remoteIP := s.clientRemoteAddr(r)
+		err := s.challenge.Verify(r.Context(), r.Header.Get(ChallengeResponseHeader), remoteIP)
+		if err == nil {
+			next(w, r)
+			return
+		}
+		challengeFailures.Inc(endpoint)
+		if !errors.Is(err, challenge.ErrMissing) && !errors.Is(err, challenge.ErrRejected) {
+			s.logger.ErrorContext(r.Context(), "challenge", "provider", s.challenge.Provider(), "error", err)
+			writeError(w, http.StatusBadGateway, "challenge verification unavailable")
+			return
+		}
+		s.logger.InfoContext(r.Context(), "challenge", "endpoint", endpoint, "client", remoteIP, "error", err)
+		w.Header().Set("WWW-Authenticate", `Challenge provider="`+s.challenge.Provider()+`"`)
+		writeError(w, http.StatusUnauthorized, err.Error())
+	}
+}
+
+// handleChallenge hands out what the editor needs to solve a challenge: a
+// fresh proof of work, or the site key of the CAPTCHA service.
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Challenge.Enabled {
+		writeError(w, http.StatusNotFound, "challenge disabled")
+		return
+	}
+	if s.challenge == nil {
+		writeError(w, http.StatusServiceUnavailable, "challenge unavailable")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	pow, ok := s.challenge.(*challenge.PoW)
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]any{"provider": s.challenge.Provider(), "siteKey": s.cfg.Challenge.SiteKey})
+		return
+	}
+	token, expires, err := pow.Issue(time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"provider":   pow.Provider(),
+		"challenge":  token,
+		"difficulty": pow.Difficulty,
+		"expiresAt":  expires,
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// handleTemplateData dumps the PageData a page template receives for
+// ?path=, so theme developers can see what they have to work with.
+func (s *Server) handleTemplateData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	data, err := s.svc.RenderPage(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, os.ErrNotExist):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	// Indented, with the HTML fields left readable.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// registerPprof serves the runtime profiles of net/http/pprof. They are
+// registered on the wiki's own mux rather than through the package's init,
+// which would only reach http.DefaultServeMux.
+func (s *Server) registerPprof() {
+	s.mux.HandleFunc("/debug/pprof/", s.requirePprofToken(pprof.Index))
+	s.mux.HandleFunc("/debug/pprof/cmdline", s.requirePprofToken(pprof.Cmdline))
+	s.mux.HandleFunc("/debug/pprof/profile", s.requirePprofToken(extendWriteDeadline(30, pprof.Profile)))
+	s.mux.HandleFunc("/debug/pprof/symbol", s.requirePprofToken(pprof.Symbol))
+	s.mux.HandleFunc("/debug/pprof/trace", s.requirePprofToken(extendWriteDeadline(1, pprof.Trace)))
+}
+
+// pprofWriteMargin is left on top of the requested duration for writing the
+// profile out.
+const pprofWriteMargin = 30 * time.Second
+
+// extendWriteDeadline moves the write deadline past the ?seconds= a profile
+// or trace runs for, defaultSec when unset, as the server's write timeout
+// would otherwise cut it off.
+func extendWriteDeadline(defaultSec int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sec, err := strconv.Atoi(r.FormValue("seconds"))
+		if err != nil || sec <= 0 {
+			sec = defaultSec
+		}
+		deadline := time.Now().Add(time.Duration(sec)*time.Second + pprofWriteMargin)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+			writeError(w, http.StatusInternalServerError, "cannot extend write deadline")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requirePprofToken lets through requests bearing debug.pprofToken, which
+// CPU profiles and traces are costly enough to need.
+func (s *Server) requirePprofToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Authorization")), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(provided)), []byte(s.cfg.Debug.PprofToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/edittoken"
+)
+
+// EditTokenHeader carries a signed edit token on write requests.
+const EditTokenHeader = "X-Edit-Token"
+
+// defaultEditTokenTTL applies when a mint request names no lifetime.
+const defaultEditTokenTTL = 24 * time.Hour
+
+// requireEditToken refuses writes without a valid edit token when
+// editTokens is enabled. The WWW-Authenticate challenge lets the editor
+// prompt for a token.
+func (s *Server) requireEditToken(next http.HandlerFunc) http.HandlerFunc {
+	if !s.cfg.EditTokens.Enabled {
+		return next
+	}
+	secret := []byte(s.cfg.EditTokens.Secret)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(r.Header.Get(EditTokenHeader))
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "EditToken")
+			writeError(w, http.StatusUnauthorized, "edit token required")
+			return
+		}
+		claims, err := edittoken.Verify(secret, token, time.Now())
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "EditToken")
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), "edit token", "subject", claims.Subject, "path", r.URL.Path, "expires", claims.Expires())
+		next(w, withEditor(r, "token:"+claims.Subject))
+	}
+}
+
+func (s *Server) handleAdminEditTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.EditTokens.Enabled {
+		writeError(w, http.StatusNotFound, "edit tokens disabled")
+		return
+	}
+	var payload struct {
+		Subject string `json:"subject"`
+		TTLSec  int    `json:"ttlSec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	ttl := time.Duration(payload.TTLSec) * time.Second
+	if ttl <= 0 {
+		ttl = defaultEditTokenTTL
+	}
+	ttl = min(ttl, s.cfg.EditTokens.MaxTTL())
+	token, claims, err := edittoken.Mint([]byte(s.cfg.EditTokens.Secret), payload.Subject, ttl, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), "edit token minted", "subject", claims.Subject, "expires", claims.Expires())
+	writeJSON(w, http.StatusOK, map[string]any{"token": token, "subject": claims.Subject, "expiresAt": claims.Expires()})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// precompressedVariant picks the precompressed sibling of file preferred by
+// the client's Accept-Encoding. Responses for files with siblings vary on
+// that header either way.
+func (s *Server) precompressedVariant(w http.ResponseWriter, r *http.Request, file site.OutputFile) (site.OutputFile, string, bool) {
+	accept := r.Header.Get("Accept-Encoding")
+	varies := false
+	for _, encoding := range []string{site.EncodingBrotli, site.EncodingGzip} {
+		variant, ok := s.svc.Precompressed(file, encoding)
+		if !ok {
+			continue
+		}
+		if !varies {
+			w.Header().Add("Vary", "Accept-Encoding")
+			varies = true
+		}
+		if acceptsEncoding(accept, encoding) {
+			return variant, encoding, true
+		}
+	}
+	return site.OutputFile{}, "", false
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding,
+// either by name or through "*", with a non-zero quality.
+func acceptsEncoding(header, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if name == encoding {
+			// An explicit entry overrides the wildcard.
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
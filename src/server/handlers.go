@@ -3,13 +3,19 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/iedon/dn42-wiki-go/gitutil"
+	"github.com/iedon/dn42-wiki-go/renderer"
 	"github.com/iedon/dn42-wiki-go/site"
 )
 
@@ -26,6 +32,20 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	if pageSize <= 0 {
 		pageSize = 25
 	}
+	if err := s.svc.CheckRead(r.Context(), path); err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if tag, ok := s.commitTag(r); ok && s.notModified(w, r, tag, time.Time{}) {
+		return
+	}
 
 	commits, hasMore, err := s.svc.History(r.Context(), path, page, pageSize)
 	if err != nil {
@@ -42,6 +62,47 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"items": commits, "hasMore": hasMore})
 }
 
+func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if err := s.svc.CheckRead(r.Context(), path); err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if tag, ok := s.commitTag(r); ok && s.notModified(w, r, tag, time.Time{}) {
+		return
+	}
+
+	lines, err := s.svc.Blame(r.Context(), path)
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, os.ErrNotExist):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if lines == nil {
+		lines = []gitutil.BlameLine{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"lines": lines})
+}
+
 func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -58,6 +119,11 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid revision reference")
 		return
 	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "html" {
+		writeError(w, http.StatusBadRequest, "format must be text or html")
+		return
+	}
 	diff, err := s.svc.Diff(r.Context(), path, from, to)
 	if err != nil {
 		switch {
@@ -70,6 +136,10 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if format == "html" {
+		writeJSON(w, http.StatusOK, map[string]string{"html": string(site.SideBySideDiff(diff))})
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"diff": diff})
 }
 
@@ -79,7 +149,7 @@ func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	path := r.URL.Query().Get("path")
-	content, err := s.svc.LoadRaw(path)
+	content, err := s.svc.LoadRaw(r.Context(), path)
 	if err != nil {
 		switch {
 		case errors.Is(err, site.ErrInvalidPath):
@@ -93,7 +163,35 @@ func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"path": path, "content": string(content)})
+	hash, revision, err := s.svc.PageVersion(r.Context(), path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"path": path, "content": string(content), "hash": hash, "revision": revision})
+}
+
+func (s *Server) handleDraftCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	base := site.DraftBase{Hash: query.Get("hash"), Revision: query.Get("revision")}
+	check, err := s.svc.CheckDraft(r.Context(), query.Get("path"), base)
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, check)
 }
 
 func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
@@ -109,20 +207,43 @@ func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
 		Path    string `json:"path"`
 		Content string `json:"content"`
 		Message string `json:"message"`
+		// Base is the revision the content was edited from, as returned
+		// by /api/document.
+		Base string `json:"base"`
+		// DisplayName and Email optionally name the author of the edit.
+		DisplayName string `json:"displayName"`
+		Email       string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
+	ctx, err := s.svc.Attribute(r.Context(), payload.DisplayName, payload.Email)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	remote := s.clientRemoteAddr(r)
-	if err := s.svc.SavePage(r.Context(), payload.Path, []byte(payload.Content), payload.Message, remote); err != nil {
+	merged, err := s.svc.SavePage(ctx, payload.Path, []byte(payload.Content), payload.Base, payload.Message, remote)
+	if err != nil {
+		var conflict *site.MergeConflictError
 		switch {
+		case errors.As(err, &conflict):
+			writeJSON(w, http.StatusConflict, map[string]any{"error": conflict.Error(), "conflict": conflict})
+		case errors.Is(err, site.ErrUnchanged):
+			writeJSON(w, http.StatusOK, map[string]any{"status": "unchanged", "merged": merged})
+		case errors.Is(err, gitutil.ErrUnknownRevision):
+			writeError(w, http.StatusBadRequest, err.Error())
 		case errors.Is(err, site.ErrRepositoryBehind):
 			writeError(w, http.StatusConflict, "remote repository has newer revisions; please save current work and reload")
+		case errors.Is(err, site.ErrPathCollision):
+			writeError(w, http.StatusConflict, err.Error())
 		case errors.Is(err, site.ErrReservedPath):
 			writeError(w, http.StatusBadRequest, "The specified path is reserved and cannot be used")
 		case errors.Is(err, site.ErrInvalidPath):
 			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
 		case errors.Is(err, site.ErrForbiddenRoute):
 			writeError(w, http.StatusForbidden, "requested path is restricted")
 		default:
@@ -130,7 +251,110 @@ func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "saved"})
+	writeJSON(w, http.StatusOK, map[string]any{"status": "saved", "merged": merged})
+}
+
+// handlePreviewSave returns the diff /api/save would commit for the same
+// path, content and base, for editors to review before saving.
+func (s *Server) handlePreviewSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Editable {
+		writeError(w, http.StatusForbidden, "editing disabled")
+		return
+	}
+	var payload struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Base    string `json:"base"`
+		Format  string `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if payload.Format != "" && payload.Format != "text" && payload.Format != "html" {
+		writeError(w, http.StatusBadRequest, "format must be text or html")
+		return
+	}
+	diff, merged, err := s.svc.PreviewSave(r.Context(), payload.Path, []byte(payload.Content), payload.Base)
+	if err != nil {
+		var conflict *site.MergeConflictError
+		switch {
+		case errors.As(err, &conflict):
+			writeJSON(w, http.StatusConflict, map[string]any{"error": conflict.Error(), "conflict": conflict})
+		case errors.Is(err, gitutil.ErrUnknownRevision):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	response := map[string]any{"diff": diff, "merged": merged}
+	if payload.Format == "html" {
+		response = map[string]any{"html": string(site.SideBySideDiff(diff)), "merged": merged}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleRestore commits the content a page had at an earlier revision.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Editable {
+		writeError(w, http.StatusForbidden, "editing disabled")
+		return
+	}
+	var payload struct {
+		Path     string `json:"path"`
+		Revision string `json:"revision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(payload.Path) == "" || strings.TrimSpace(payload.Revision) == "" {
+		writeError(w, http.StatusBadRequest, "path and revision required")
+		return
+	}
+	remote := s.clientRemoteAddr(r)
+	revision, err := s.svc.RestorePage(r.Context(), payload.Path, payload.Revision, remote)
+	if err != nil {
+		switch {
+		case errors.Is(err, gitutil.ErrUnknownRevision):
+			writeError(w, http.StatusBadRequest, "unknown revision")
+		case errors.Is(err, os.ErrNotExist):
+			writeError(w, http.StatusNotFound, "document did not exist at this revision")
+		case errors.Is(err, site.ErrUnchanged):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, site.ErrRepositoryBehind):
+			writeError(w, http.StatusConflict, "remote repository has newer revisions; please reload")
+		case errors.Is(err, site.ErrPathCollision):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, site.ErrReservedPath):
+			writeError(w, http.StatusBadRequest, "The specified path is reserved and cannot be used")
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "restored", "revision": revision})
 }
 
 func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
@@ -143,8 +367,10 @@ func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var payload struct {
-		OldPath string `json:"oldPath"`
-		NewPath string `json:"newPath"`
+		OldPath     string `json:"oldPath"`
+		NewPath     string `json:"newPath"`
+		DisplayName string `json:"displayName"`
+		Email       string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json")
@@ -154,15 +380,24 @@ func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "newPath required")
 		return
 	}
+	ctx, err := s.svc.Attribute(r.Context(), payload.DisplayName, payload.Email)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	remote := s.clientRemoteAddr(r)
-	if err := s.svc.RenamePage(r.Context(), payload.OldPath, payload.NewPath, remote); err != nil {
+	if err := s.svc.RenamePage(ctx, payload.OldPath, payload.NewPath, remote); err != nil {
 		switch {
 		case errors.Is(err, site.ErrRepositoryBehind):
 			writeError(w, http.StatusConflict, "remote repository has newer revisions; please reload")
+		case errors.Is(err, site.ErrPathCollision):
+			writeError(w, http.StatusConflict, err.Error())
 		case errors.Is(err, site.ErrReservedPath):
 			writeError(w, http.StatusBadRequest, "The specified path is reserved and cannot be used")
 		case errors.Is(err, site.ErrInvalidPath):
 			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
 		case errors.Is(err, site.ErrForbiddenRoute):
 			writeError(w, http.StatusForbidden, "requested path is restricted")
 		default:
@@ -199,6 +434,8 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, site.ErrRepositoryBehind):
 			writeError(w, http.StatusConflict, "remote repository has newer revisions; please reload")
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
 		case errors.Is(err, site.ErrForbiddenRoute):
 			writeError(w, http.StatusForbidden, "requested path is restricted")
 		case errors.Is(err, site.ErrProtectedDocument):
@@ -235,17 +472,66 @@ func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"html": string(rendered.HTML), "headings": rendered.Headings})
 }
 
+func (s *Server) handleFormat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var payload struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	formatted, err := s.svc.FormatMarkdown([]byte(payload.Content))
+	if err != nil {
+		if errors.Is(err, renderer.ErrFormatChangesOutput) {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"content": string(formatted), "changed": string(formatted) != payload.Content})
+}
+
 func (s *Server) handleSearchIndex(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 	payload := s.svc.SearchIndex()
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
 	if len(payload) == 0 {
 		payload = []byte(`{}`)
 	}
+	// The index follows the last build rather than HEAD, so validate on the
+	// commit of that build, or on content before the first build.
+	commit, built := s.svc.ActiveBuild()
+	tag := contentTag(payload)
+	if commit != "" {
+		tag = fmt.Sprintf("%s-%x", commit, built.UnixNano())
+	}
+	// Send the build's precompressed copy to clients accepting it.
+	var variant site.OutputFile
+	encoding := ""
+	if file, ok := s.svc.LookupOutput(filepath.Join(s.cfg.OutputDir, "search-index.json")); ok && commit != "" {
+		if found, accepted, ok := s.precompressedVariant(w, r, file); ok {
+			variant, encoding = found, accepted
+			tag += "-" + encoding
+		}
+	}
+	if s.notModified(w, r, tag, built) {
+		return
+	}
+	if encoding != "" {
+		if data, err := os.ReadFile(variant.Path); err == nil {
+			payload = data
+			w.Header().Set("Content-Encoding", encoding)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(payload)
 }
 
@@ -253,10 +539,14 @@ func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
 	if s.tryStatic(w, r) {
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, site.HistoryFeedSuffix) {
+		s.serveHistoryFeed(w, r)
+		return
+	}
 	if s.redirectCanonical(w, r) {
 		return
 	}
-	if err := s.svc.EnsureRequestAccessible(r.URL.Path); err != nil {
+	if err := s.svc.EnsureRequestAccessible(r.Context(), r.URL.Path); err != nil {
 		switch {
 		case errors.Is(err, site.ErrForbiddenRoute):
 			s.serveForbidden(w, r)
@@ -268,6 +558,11 @@ func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Add("Vary", "Accept")
+	if s.servePageRepresentation(w, r) {
+		return
+	}
+
 	staticPath, err := s.svc.StaticDocumentPath(r.URL.Path)
 	if err != nil {
 		s.serveNotFound(w, r)
@@ -277,20 +572,62 @@ func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
 		s.serveNotFound(w, r)
 		return
 	}
-	info, err := os.Stat(staticPath)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
+	file, ok := s.svc.LookupOutput(staticPath)
+	if !ok {
+		s.serveNotFound(w, r)
+		return
+	}
+	s.serveOutputFile(w, r, file)
+}
+
+// serveHistoryFeed answers /<page>/history.atom with the page's commits.
+func (s *Server) serveHistoryFeed(w http.ResponseWriter, r *http.Request) {
+	pagePath := strings.TrimSuffix(r.URL.Path, site.HistoryFeedSuffix)
+	if err := s.svc.EnsureRequestAccessible(r.Context(), pagePath); err != nil {
+		switch {
+		case errors.Is(err, site.ErrForbiddenRoute):
+			s.serveForbidden(w, r)
+		case errors.Is(err, site.ErrInvalidPath):
 			s.serveNotFound(w, r)
-			return
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
 		}
-		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if info.IsDir() {
-		s.serveNotFound(w, r)
+	if tag, ok := s.commitTag(r); ok && s.notModified(w, r, tag, time.Time{}) {
+		return
+	}
+	feed, err := s.svc.HistoryFeed(r.Context(), r.URL.Path, s.requestOrigin(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrForbiddenRoute):
+			s.serveForbidden(w, r)
+		case errors.Is(err, os.ErrNotExist), errors.Is(err, site.ErrInvalidPath):
+			s.serveNotFound(w, r)
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
-	http.ServeFile(w, r, staticPath)
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(feed)
+	}
+}
+
+// requestOrigin returns the scheme and host a request was addressed to,
+// trusting X-Forwarded-Proto only from configured proxies.
+func (s *Server) requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto == "https" {
+		if peer, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && s.cfg.IsTrustedProxy(peer.Addr().Unmap()) {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host
 }
 
 func (s *Server) serveNotFound(w http.ResponseWriter, r *http.Request) {
@@ -321,7 +658,7 @@ func (s *Server) redirectCanonical(w http.ResponseWriter, r *http.Request) bool
 		if errors.Is(err, site.ErrInvalidPath) {
 			return false
 		}
-		s.logger.Error("canonical redirect", "error", err, "path", r.URL.Path)
+		s.logger.ErrorContext(r.Context(), "canonical redirect", "error", err, "path", r.URL.Path)
 		return false
 	}
 	if !redirect {
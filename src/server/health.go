@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+// HealthCheck reports the state of an optional subsystem for /healthz.
+// Unhealthy checks degrade the overall status without failing the probe.
+type HealthCheck func() (healthy bool, detail any)
+
+type healthRegistry struct {
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+// AddHealthCheck registers a named subsystem probe exposed via /healthz.
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	if check == nil {
+		return
+	}
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.checks == nil {
+		s.health.checks = make(map[string]HealthCheck)
+	}
+	s.health.checks[name] = check
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.health.mu.RLock()
+	defer s.health.mu.RUnlock()
+
+	status := "ok"
+	checks := make(map[string]any, len(s.health.checks))
+	for name, check := range s.health.checks {
+		healthy, detail := check()
+		if !healthy {
+			status = "degraded"
+		}
+		checks[name] = map[string]any{"healthy": healthy, "detail": detail}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "checks": checks})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Metrics.Enabled {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if token := s.cfg.Metrics.Token; token != "" {
+		provided := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+	metrics.Default.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+const (
+	mediaHTML     = "text/html"
+	mediaMarkdown = "text/markdown"
+	mediaJSON     = "application/json"
+)
+
+// negotiatePage picks the representation of a page for an Accept header.
+// HTML wins ties and is the default, so browsers and bare clients are
+// unaffected.
+func negotiatePage(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return mediaHTML
+	}
+	best, bestQ := mediaHTML, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		media := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		switch media {
+		case mediaHTML, "application/xhtml+xml", "text/*", "*/*":
+			media = mediaHTML
+		case mediaMarkdown, "text/x-markdown":
+			media = mediaMarkdown
+		case mediaJSON:
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && media == mediaHTML) {
+			best, bestQ = media, q
+		}
+	}
+	return best
+}
+
+// servePageRepresentation answers page requests asking for Markdown or JSON.
+// It reports false when HTML should be served instead, including for routes
+// without a Markdown source.
+func (s *Server) servePageRepresentation(w http.ResponseWriter, r *http.Request) bool {
+	media := negotiatePage(r.Header.Get("Accept"))
+	if media == mediaHTML {
+		return false
+	}
+	export, err := s.svc.ExportPage(r.Context(), r.URL.Path)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist), errors.Is(err, site.ErrInvalidPath):
+			return false
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return true
+	}
+	if media == mediaMarkdown {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(export.Markdown)
+		}
+		return true
+	}
+	writeJSON(w, http.StatusOK, export)
+	return true
+}
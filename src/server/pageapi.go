@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+const (
+	// pageAPIPrefix is the route of the page API; the rest of the URL path
+	// names the page.
+	pageAPIPrefix = "/api/v1/pages/"
+	// maxPageAPIBytes bounds the body of a page write.
+	maxPageAPIBytes = 4 << 20
+	// CommitMessageHeader carries the commit message of a page API write.
+	CommitMessageHeader = "X-Commit-Message"
+)
+
+// requireBot admits requests carrying one of the configured bot tokens and
+// records the bot as the editor.
+func (s *Server) requireBot(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.Bots.Enabled {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		name, ok := s.authorizeBot(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, withEditor(r, "bot:"+name))
+	}
+}
+
+func (s *Server) authorizeBot(r *http.Request) (string, bool) {
+	provided, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Authorization")), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	provided = strings.TrimSpace(provided)
+	matched := ""
+	for name, token := range s.cfg.Bots.Tokens {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			matched = name
+		}
+	}
+	return matched, matched != ""
+}
+
+// handlePageAPI serves GET and PUT of /api/v1/pages/{path}. Pages are
+// exchanged as raw Markdown, and the ETag is the SHA-256 of the content.
+func (s *Server) handlePageAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.handlePageAPIGet(w, r)
+	case http.MethodPut:
+		s.forwardWrites(s.limitEdits(s.handlePageAPIPut))(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handlePageAPIGet(w http.ResponseWriter, r *http.Request) {
+	content, hash, err := s.svc.PageSource(r.Context(), strings.TrimPrefix(r.URL.Path, pageAPIPrefix))
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, os.ErrNotExist):
+			writeError(w, http.StatusNotFound, "document not found")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// handlePageAPIPut creates or replaces a page with the request body. If-Match
+// makes the write conditional on the current content hash, and
+// "If-None-Match: *" on the page not existing yet.
+func (s *Server) handlePageAPIPut(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPageAPIBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "page too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "read body")
+		return
+	}
+	pre := site.PagePrecondition{
+		IfMatch:     entityTags(r.Header.Get("If-Match")),
+		IfNoneMatch: strings.TrimSpace(r.Header.Get("If-None-Match")) == "*",
+	}
+	result, err := s.svc.PutPage(r.Context(), strings.TrimPrefix(r.URL.Path, pageAPIPrefix), content, pre,
+		r.Header.Get(CommitMessageHeader), s.clientRemoteAddr(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrPreconditionFailed):
+			writeError(w, http.StatusPreconditionFailed, err.Error())
+		case errors.Is(err, site.ErrRepositoryBehind):
+			writeError(w, http.StatusConflict, "remote repository has newer revisions; retry later")
+		case errors.Is(err, site.ErrPathCollision):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, site.ErrReservedPath):
+			writeError(w, http.StatusBadRequest, "The specified path is reserved and cannot be used")
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	s.logger.InfoContext(r.Context(), "page api", "editor", s.editorOf(r), "path", result.Path, "status", result.Status)
+	status := http.StatusOK
+	if result.Status == "created" {
+		status = http.StatusCreated
+	}
+	w.Header().Set("ETag", `"`+result.ETag+`"`)
+	writeJSON(w, status, result)
+}
+
+// entityTags splits an If-Match header into its entity tags, without quotes
+// and weak markers.
+func entityTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag = strings.Trim(tag, `"`); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var quotaRejections = metrics.NewCounter("wiki_edit_quota_rejections_total", "Writes refused because the editor's daily quota was used up.")
+
+type editorKey struct{}
+
+// withEditor records who a write request acts for, eg. an edit token subject.
+func withEditor(r *http.Request, editor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), editorKey{}, editor))
+}
+
+// editorOf names the editor a quota is charged to: the edit token subject,
+// the site user or, for anonymous edits, the client IP.
+func (s *Server) editorOf(r *http.Request) string {
+	if editor, ok := r.Context().Value(editorKey{}).(string); ok && editor != "" {
+		return editor
+	}
+	if s.cfg.SiteAuth.Enabled && !s.siteAuthExempt(r.URL.Path) {
+		if user, _, ok := r.BasicAuth(); ok {
+			return "user:" + user
+		}
+	}
+	return "ip:" + s.clientRemoteAddr(r)
+}
+
+type quotaUsage struct {
+	edits int
+	bytes int64
+}
+
+// editQuotas counts the writes of each editor during the current UTC day.
+type editQuotas struct {
+	maxEdits int
+	maxBytes int64
+	mu       sync.Mutex
+	day      string
+	usage    map[string]*quotaUsage
+}
+
+func newEditQuotas(maxEdits int, maxBytes int64) *editQuotas {
+	return &editQuotas{maxEdits: maxEdits, maxBytes: maxBytes, usage: make(map[string]*quotaUsage)}
+}
+
+// current returns the usage of editor, starting a new day when needed. The
+// caller holds q.mu.
+func (q *editQuotas) current(editor string, now time.Time) *quotaUsage {
+	if day := now.UTC().Format(time.DateOnly); day != q.day {
+		q.day = day
+		clear(q.usage)
+	}
+	usage := q.usage[editor]
+	if usage == nil {
+		usage = &quotaUsage{}
+		q.usage[editor] = usage
+	}
+	return usage
+}
+
+// check explains why a write of size bytes would exceed the quota of editor,
+// or returns "" when it fits. A negative size is not known up front.
+func (q *editQuotas) check(editor string, size int64, now time.Time) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := q.current(editor, now)
+	if q.maxEdits > 0 && usage.edits >= q.maxEdits {
+		return fmt.Sprintf("daily quota of %d edits used up", q.maxEdits)
+	}
+	if q.maxBytes > 0 && (usage.bytes >= q.maxBytes || (size > 0 && usage.bytes+size > q.maxBytes)) {
+		return fmt.Sprintf("edit exceeds the daily quota of %d bytes", q.maxBytes)
+	}
+	return ""
+}
+
+func (q *editQuotas) charge(editor string, size int64, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := q.current(editor, now)
+	usage.edits++
+	usage.bytes += size
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitEdits refuses writes with 429 once their editor used up the daily
+// edit or byte quota. Only successful writes are charged, with the size of
+// their request body.
+func (s *Server) limitEdits(next http.HandlerFunc) http.HandlerFunc {
+	if s.quotas == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			next(w, r)
+			return
+		}
+		editor := s.editorOf(r)
+		now := time.Now()
+		if reason := s.quotas.check(editor, r.ContentLength, now); reason != "" {
+			quotaRejections.Inc()
+			reset := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			s.logger.WarnContext(r.Context(), "edit quota", "editor", editor, "path", r.URL.Path, "reason", reason)
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, reason+"; resets at "+reset.Format(time.RFC3339))
+			return
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+		if rw.status >= 200 && rw.status < 300 {
+			s.quotas.charge(editor, body.n, now)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var rateLimited = metrics.NewCounterVec("wiki_rate_limited_total", "Requests refused by rateLimits, by endpoint.", "endpoint")
+
+// rateSweepInterval is how often buckets that refilled completely are
+// dropped.
+const rateSweepInterval = time.Minute
+
+// rateLimiter keeps a token bucket per client.
+type rateLimiter struct {
+	rate      float64 // tokens per second
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: perMinute / 60, burst: float64(max(burst, 1)), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the bucket of key. When it is empty, allow
+// returns how long until the next token.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets clients whose bucket is full again. The caller holds l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimit refuses write requests to endpoint with 429 once their client
+// IP used up its bucket, as configured in rateLimits. Routes limited as the
+// same endpoint share its buckets.
+func (s *Server) rateLimit(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := s.cfg.RateLimits.Limit(endpoint)
+	if !ok {
+		return next
+	}
+	// Routes are registered before serving starts, so this needs no lock.
+	limiter := s.rateLimiters[endpoint]
+	if limiter == nil {
+		limiter = newRateLimiter(limit.PerMinute, limit.Burst)
+		s.rateLimiters[endpoint] = limiter
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			next(w, r)
+			return
+		}
+		if allowed, wait := limiter.allow(s.clientRemoteAddr(r), time.Now()); !allowed {
+			rateLimited.Inc(endpoint)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
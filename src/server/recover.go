@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var handlerPanics = metrics.NewCounter("wiki_http_panics_total", "Requests whose handler panicked.")
+
+// recoverPanics answers requests whose handler panicked with a 500, logging
+// the stack under a reference shown to the user, instead of dropping the
+// connection. Responses already started can only be cut short.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+			handlerPanics.Inc()
+			id := requestIDOf(r)
+			s.logger.ErrorContext(r.Context(), "panic", "method", r.Method, "path", r.URL.Path, "panic", recovered, "stack", string(debug.Stack()))
+			if tw.wrote {
+				panic(http.ErrAbortHandler)
+			}
+			s.serveInternalError(w, r, id)
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// serveInternalError answers with the themed 500 page, or a JSON error for
+// API requests and when the page cannot be rendered.
+func (s *Server) serveInternalError(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set(RequestIDHeader, id)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("Content-Encoding")
+	w.Header().Del("Content-Length")
+	w.Header().Del("ETag")
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		if page, ok := s.renderErrorPage(r, id); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(page)
+			return
+		}
+	}
+	writeError(w, http.StatusInternalServerError, "internal error, reference "+id)
+}
+
+// renderErrorPage renders the 500 page, giving up should that panic too.
+func (s *Server) renderErrorPage(r *http.Request, id string) (page []byte, ok bool) {
+	defer func() {
+		if recover() != nil {
+			page, ok = nil, false
+		}
+	}()
+	page, err := s.svc.RenderErrorPage(r.Context(), r.URL.Path, id)
+	return page, err == nil
+}
+
+// trackingWriter notes whether a response was started.
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/netutil"
+)
+
+// newReplicaProxy builds the reverse proxy used to forward write calls to the
+// primary instance when running as a replica.
+func (s *Server) newReplicaProxy() (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(s.cfg.Replica.PrimaryURL)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := netutil.NewTransport(s.cfg.Outbound.ClientOptions(0, s.cfg.Replica.SkipRemoteCert))
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = path.Join("/", target.Path, pr.In.URL.Path)
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = target.Host
+			// Preserve the chain so the primary can attribute the edit to the
+			// original client when the replica is listed as a trusted proxy.
+			// Only chains from a trusted proxy are passed on, or any client
+			// could pick the address the primary sees.
+			if prior := pr.In.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+				if peer, err := netip.ParseAddrPort(pr.In.RemoteAddr); err == nil && s.cfg.IsTrustedProxy(peer.Addr().Unmap()) {
+					pr.Out.Header["X-Forwarded-For"] = prior
+				}
+			}
+			pr.SetXForwarded()
+		},
+		Transport: transport,
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+				s.scheduleReplicaSync()
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.logger.ErrorContext(r.Context(), "replica proxy", "path", r.URL.Path, "error", err)
+			writeError(w, http.StatusBadGateway, "primary instance unreachable")
+		},
+	}
+	return proxy, nil
+}
+
+// forwardWrites routes write endpoints to the primary when replica mode is active.
+func (s *Server) forwardWrites(next http.HandlerFunc) http.HandlerFunc {
+	if s.replicaProxy == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.replicaProxy.ServeHTTP(w, r)
+	}
+}
+
+// scheduleReplicaSync asks for a pull shortly after a forwarded write
+// succeeded so the replica reflects the change without waiting for the next
+// poll. Writes arriving while a sync is pending share it.
+func (s *Server) scheduleReplicaSync() {
+	select {
+	case s.replicaSync <- struct{}{}:
+	default:
+	}
+}
+
+// runReplicaSync performs the pulls scheduled by scheduleReplicaSync, one at
+// a time, until ctx ends.
+func (s *Server) runReplicaSync(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.replicaSync:
+		}
+		pullCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		if err := s.svc.Pull(pullCtx); err != nil {
+			s.logger.Warn("replica sync", "error", err)
+		}
+		cancel()
+	}
+}
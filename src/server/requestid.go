@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/iedon/dn42-wiki-go/logging"
+)
+
+// RequestIDHeader carries the reference a request is logged under. One sent
+// by a proxy in front of the wiki is kept.
+const RequestIDHeader = "X-Request-ID"
+
+// assignRequestID gives each request an ID, which is returned in
+// RequestIDHeader and error responses and logged with every record of the
+// request, to correlate them with the logs of proxies.
+func (s *Server) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID(r)
+		w.Header().Set(RequestIDHeader, id)
+		// Writes forwarded to the primary are logged there under it too.
+		r.Header.Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// requestIDOf returns the ID assigned to r.
+func requestIDOf(r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	return newRequestID(r)
+}
+
+// newRequestID returns the reference sent by a proxy, when it looks like
+// one, or a new random one.
+func newRequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
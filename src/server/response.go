@@ -17,9 +17,15 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	}
 }
 
+// writeError answers with a JSON error, along with the ID of the request
+// to look it up in the logs.
 func writeError(w http.ResponseWriter, status int, message string) {
 	if strings.TrimSpace(message) == "" {
 		message = http.StatusText(status)
 	}
-	writeJSON(w, status, map[string]string{"error": message})
+	payload := map[string]string{"error": message}
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		payload["requestId"] = id
+	}
+	writeJSON(w, status, payload)
 }
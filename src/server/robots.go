@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// robotsPolicy refuses blocked crawler user agents and attaches the
+// configured X-Robots-Tag to responses. robots.txt stays reachable so blocked
+// crawlers can still read why.
+func (s *Server) robotsPolicy(next http.Handler) http.Handler {
+	if len(s.cfg.Robots.Rules) == 0 && len(s.cfg.Robots.BlockUserAgents) == 0 && !s.cfg.IsStaging() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/robots.txt") && s.cfg.IsUserAgentBlocked(r.UserAgent()) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if directives := s.svc.RobotsDirectives(r.URL.Path); directives != "" {
+			w.Header().Set("X-Robots-Tag", directives)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -5,9 +5,11 @@ import (
 	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httputil"
 	"os"
 	"path"
 	"path/filepath"
@@ -15,17 +17,39 @@ import (
 	"strings"
 	"time"
 
+	"github.com/iedon/dn42-wiki-go/auth"
+	"github.com/iedon/dn42-wiki-go/challenge"
 	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/metrics"
 	"github.com/iedon/dn42-wiki-go/site"
+	"github.com/iedon/dn42-wiki-go/webhook"
 )
 
+var slowRequests = metrics.NewCounter("wiki_http_slow_requests_total", "Requests slower than slowLog.requestMs.")
+
 // Server ties HTTP handlers to the site service.
 type Server struct {
-	cfg          *config.Config
-	svc          *site.Service
-	logger       *slog.Logger
-	mux          *http.ServeMux
-	serverHeader string
+	cfg           *config.Config
+	svc           *site.Service
+	logger        *slog.Logger
+	webhookLogger *slog.Logger
+	mux           *http.ServeMux
+	serverHeader  string
+	replicaProxy  *httputil.ReverseProxy
+	replicaSync   chan struct{}
+	health        healthRegistry
+	webhookLog    *webhookLog
+	replayGuard   *replayGuard
+	quotas        *editQuotas
+	// rateLimiters holds the limiter of each rateLimits endpoint, shared by
+	// the routes counted against it.
+	rateLimiters map[string]*rateLimiter
+	provider     *auth.Provider
+	sessions     *auth.Sessions
+	challenge    challenge.Verifier
+	pageViews    *pageViewCounts
+	accessLog    *accessLog
+	version      Version
 }
 
 // New constructs a server instance.
@@ -33,16 +57,78 @@ func New(cfg *config.Config, svc *site.Service, logger *slog.Logger, serverHeade
 	if logger == nil {
 		logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 	}
-	srv := &Server{cfg: cfg, svc: svc, logger: logger, mux: http.NewServeMux(), serverHeader: strings.TrimSpace(serverHeader)}
+	srv := &Server{
+		cfg:           cfg,
+		svc:           svc,
+		logger:        logger,
+		webhookLogger: logger,
+		mux:           http.NewServeMux(),
+		serverHeader:  strings.TrimSpace(serverHeader),
+		webhookLog:    newWebhookLog(cfg.Webhook.HistorySize),
+		replayGuard:   newReplayGuard(time.Duration(cfg.Webhook.ReplayWindowSec)*time.Second, cfg.Webhook.RequireTimestamp),
+		rateLimiters:  make(map[string]*rateLimiter),
+		replicaSync:   make(chan struct{}, 1),
+	}
+	if cfg.EditQuotas.Enabled {
+		srv.quotas = newEditQuotas(cfg.EditQuotas.DailyEdits, cfg.EditQuotas.DailyBytes)
+	}
+	if cfg.Analytics.Enabled {
+		srv.pageViews = newPageViewCounts(cfg.Analytics.File, cfg.Analytics.RetentionDays)
+		if err := srv.pageViews.load(); err != nil {
+			logger.Error("analytics", "error", err)
+		}
+	}
+	if cfg.Auth.Enabled {
+		if err := srv.newAuth(); err != nil {
+			logger.Error("auth", "error", err)
+		}
+	}
+	if cfg.Challenge.Enabled {
+		if err := srv.newChallenge(); err != nil {
+			logger.Error("challenge", "error", err)
+		}
+	}
+	if cfg.Replica.Enabled {
+		proxy, err := srv.newReplicaProxy()
+		if err != nil {
+			logger.Error("replica proxy", "error", err)
+		} else {
+			srv.replicaProxy = proxy
+		}
+	}
+	srv.AddHealthCheck("startup", srv.startupHealth)
+	srv.AddHealthCheck("output", srv.outputHealth)
 	srv.routes()
 	return srv
 }
 
+// UseWebhookLogger logs webhook deliveries to logger instead of the server's
+// logger.
+func (s *Server) UseWebhookLogger(logger *slog.Logger) {
+	s.webhookLogger = logger
+}
+
 // Start launches the HTTP server and attaches graceful shutdown behaviour.
 func (s *Server) Start(ctx context.Context) error {
-	// Build static pages on startup
-	if err := s.svc.BuildStatic(ctx); err != nil {
-		s.logger.Warn("static build", "error", err)
+	// Clone and build in the background so the listener is up immediately
+	go func() {
+		if err := s.svc.Initialize(ctx); err != nil {
+			s.logger.Warn("initialize", "error", err)
+			return
+		}
+		s.logger.Info("wiki ready")
+	}()
+	if s.replicaProxy != nil {
+		go s.runReplicaSync(ctx)
+	}
+	analyticsDone := make(chan struct{})
+	if s.pageViews != nil {
+		go func() {
+			s.runAnalytics(ctx)
+			close(analyticsDone)
+		}()
+	} else {
+		close(analyticsDone)
 	}
 
 	listener, err := s.listen(s.cfg.Listen)
@@ -51,7 +137,7 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	server := &http.Server{
-		Handler:      s.withServerHeader(s.logRequests(s.mux)),
+		Handler:      s.withServerHeader(s.assignRequestID(s.logRequests(s.recoverPanics(s.robotsPolicy(s.requireSiteAuth(s.identifyPrincipal(s.awaitStartup(s.mux)))))))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -75,6 +161,7 @@ func (s *Server) Start(ctx context.Context) error {
 
 	if errors.Is(serveErr, http.ErrServerClosed) {
 		<-shutdownDone
+		<-analyticsDone
 		return nil
 	}
 	return serveErr
@@ -83,14 +170,47 @@ func (s *Server) Start(ctx context.Context) error {
 func (s *Server) routes() {
 	s.mux.HandleFunc("/api/history", s.handleHistory)
 	s.mux.HandleFunc("/api/diff", s.handleDiff)
+	s.mux.HandleFunc("/api/blame", s.handleBlame)
 	s.mux.HandleFunc("/api/document", s.handleDocument)
-	s.mux.HandleFunc("/api/save", s.handleSave)
-	s.mux.HandleFunc("/api/rename", s.handleRename)
-	s.mux.HandleFunc("/api/delete", s.handleDelete)
-	s.mux.HandleFunc("/api/preview", s.handlePreview)
+	s.mux.HandleFunc("/api/draft/check", s.handleDraftCheck)
+	s.mux.HandleFunc("/api/save", s.rateLimit("save", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("save", s.limitEdits(s.handleSave)))))))
+	// The diff preview is gated like the save it previews, and forwarded so it
+	// compares against the primary's HEAD.
+	s.mux.HandleFunc("/api/save/preview-diff", s.rateLimit("preview", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("save", s.handlePreviewSave))))))
+	s.mux.HandleFunc("/api/rename", s.rateLimit("rename", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("rename", s.limitEdits(s.handleRename)))))))
+	s.mux.HandleFunc("/api/restore", s.rateLimit("restore", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("restore", s.limitEdits(s.handleRestore)))))))
+	s.mux.HandleFunc("/api/delete", s.rateLimit("delete", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("delete", s.limitEdits(s.handleDelete)))))))
+	s.mux.HandleFunc("/api/upload", s.rateLimit("upload", s.forwardWrites(s.requireEditToken(s.requireLogin(s.requireChallenge("upload", s.limitEdits(s.handleUpload)))))))
+	s.mux.HandleFunc("/api/challenge", s.forwardWrites(s.handleChallenge))
+	if s.cfg.Analytics.Enabled {
+		s.mux.HandleFunc("/api/beacon", s.rateLimit("beacon", s.handleBeacon))
+	}
+	s.mux.HandleFunc("/api/preview", s.rateLimit("preview", s.handlePreview))
+	s.mux.HandleFunc("/api/format", s.rateLimit("format", s.handleFormat))
+	s.mux.HandleFunc("/api/ui-config", s.handleUIConfig)
+	s.mux.HandleFunc("/api/auth/me", s.handleAuthMe)
+	s.mux.HandleFunc(loginPath, s.handleLogin)
+	s.mux.HandleFunc("/auth/callback", s.handleLoginCallback)
+	s.mux.HandleFunc("/auth/logout", s.handleLogout)
+	s.mux.HandleFunc(pageAPIPrefix, s.requireBot(s.handlePageAPI))
 	s.mux.HandleFunc("/api/webhook/pull", s.handleWebhookPull)
 	s.mux.HandleFunc("/api/webhook/push", s.handleWebhookPush)
 	s.mux.HandleFunc("/search-index.json", s.handleSearchIndex)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/api/version", s.handleVersion)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/api/admin/webhooks", s.requireAdmin(s.handleAdminWebhooks))
+	s.mux.HandleFunc("/api/admin/pull", s.requireAdmin(s.handleAdminPull))
+	s.mux.HandleFunc("/api/admin/build", s.requireAdmin(s.handleAdminBuild))
+	s.mux.HandleFunc("/api/admin/orphans", s.requireAdmin(s.handleAdminOrphans))
+	s.mux.HandleFunc("/api/admin/edit-tokens", s.requireAdmin(s.handleAdminEditTokens))
+	s.mux.HandleFunc("/api/admin/analytics", s.requireAdmin(s.handleAdminAnalytics))
+	if s.cfg.Debug.TemplateData {
+		s.mux.HandleFunc("/debug/template-data", s.handleTemplateData)
+	}
+	if s.cfg.Debug.Pprof {
+		s.registerPprof()
+	}
 	s.mux.HandleFunc("/", s.handlePage)
 }
 
@@ -159,7 +279,16 @@ func (s *Server) logRequests(next http.Handler) http.Handler {
 		start := time.Now()
 		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(rw, r)
-		s.logger.Info("http", "method", r.Method, "path", r.URL.Path, "status", rw.status, "duration", time.Since(start))
+		if s.accessLog != nil {
+			s.recordAccess(r, rw, start)
+		}
+		elapsed := time.Since(start)
+		if threshold := s.cfg.SlowLog.RequestThreshold(); threshold > 0 && elapsed >= threshold {
+			slowRequests.Inc()
+			s.logger.WarnContext(r.Context(), "slow request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "status", rw.status, "duration", elapsed)
+			return
+		}
+		s.logger.InfoContext(r.Context(), "http", "method", r.Method, "path", r.URL.Path, "status", rw.status, "duration", elapsed)
 	})
 }
 
@@ -176,14 +305,59 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request, action st
 		writeError(w, http.StatusNotFound, "not found")
 		return
 	}
+
+	started := time.Now()
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	w = rw
+	delivery := webhookDelivery{
+		ReceivedAt: started.UTC(),
+		Action:     action,
+		Method:     r.Method,
+		RemoteAddr: s.clientRemoteAddr(r),
+	}
+	defer func() {
+		delivery.Status = rw.status
+		delivery.Duration = time.Since(started).Round(time.Millisecond).String()
+		s.webhookLog.add(delivery)
+	}()
+
 	if !allowWebhookMethod(r.Method) {
+		delivery.Result = "method not allowed"
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	if !s.authorizeWebhook(r) {
+	// The body is read first, as signatures cover it.
+	var payload []byte
+	if r.Method == http.MethodPost && r.Body != nil {
+		limit := int64(webhook.MaxNotificationBytes)
+		if webhook.ForgeEvent(r.Header) != "" {
+			limit = webhook.MaxPushBytes
+		}
+		var err error
+		payload, err = io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				delivery.Result = "payload too large"
+				writeError(w, http.StatusRequestEntityTooLarge, "payload too large")
+				return
+			}
+			delivery.Result = "read body"
+			writeError(w, http.StatusBadRequest, "read body")
+			return
+		}
+	}
+	if !s.authorizeWebhook(r, payload) {
+		delivery.Result = "unauthorized"
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	if ok, reason := s.replayGuard.check(r.Header.Get(webhook.TimestampHeader), webhookNonce(r.Header.Get), r.Header.Get(webhook.SignatureHeader), started); !ok {
+		delivery.Result = reason
+		writeError(w, http.StatusConflict, reason)
+		return
+	}
+	delivery.Payload = truncatePayload(payload)
 
 	ctx := r.Context()
 	var (
@@ -193,6 +367,15 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request, action st
 
 	switch action {
 	case "pull":
+		skip, reason := s.pushUpToDate(ctx, r.Header, payload)
+		if !skip && webhook.ForgeEvent(r.Header) == "" {
+			skip, reason = s.notificationUpToDate(ctx, payload)
+		}
+		if skip {
+			delivery.Result = reason
+			writeJSON(w, http.StatusOK, map[string]string{"status": reason})
+			return
+		}
 		err = s.svc.Pull(ctx)
 		status = "synced"
 	case "push":
@@ -203,14 +386,82 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request, action st
 	}
 
 	if err != nil {
-		s.logger.Error("webhook", "action", action, "error", err)
+		delivery.Result = err.Error()
+		s.webhookLogger.ErrorContext(r.Context(), "webhook", "action", action, "error", err)
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	delivery.Result = status
 	writeJSON(w, http.StatusOK, map[string]string{"status": status})
 }
 
+// notificationUpToDate inspects a dn42notifyd v2 delta payload, if any, and
+// reports whether the pull can be skipped because nothing relevant changed.
+func (s *Server) notificationUpToDate(ctx context.Context, payload []byte) (bool, string) {
+	notification, err := webhook.ParseNotification(payload)
+	if err != nil {
+		s.webhookLogger.WarnContext(ctx, "webhook notification", "error", err)
+		return false, ""
+	}
+	if notification == nil {
+		return false, ""
+	}
+	// Without a repository path the notification cannot be matched, so
+	// every delivery pulls as legacy ones do.
+	repo := s.cfg.Git.RepositoryPath()
+	if repo == "" {
+		return false, ""
+	}
+	update, ok := notification.Lookup(repo)
+	if !ok {
+		return true, "ignored"
+	}
+	head, err := s.svc.HeadCommit(ctx)
+	if err != nil {
+		return false, ""
+	}
+	if update.UpToDate(head) {
+		return true, "up-to-date"
+	}
+	s.webhookLogger.InfoContext(ctx, "webhook notification", "repo", repo, "commit", update.Commit, "paths", len(update.Paths))
+	return false, ""
+}
+
+// pushUpToDate inspects a forge push event, when the delivery comes from a
+// repository webhook, and reports whether the pull can be skipped: other
+// events, tag pushes and pushes to other repositories or branches are
+// ignored, and commits already checked out need no pull.
+func (s *Server) pushUpToDate(ctx context.Context, header http.Header, payload []byte) (bool, string) {
+	event := webhook.ForgeEvent(header)
+	if event == "" {
+		return false, ""
+	}
+	if !webhook.IsPushEvent(event) {
+		return true, "ignored"
+	}
+	push, err := webhook.ParsePush(payload)
+	if err != nil {
+		s.webhookLogger.WarnContext(ctx, "webhook push", "error", err)
+		return false, ""
+	}
+	branch, ok := push.Branch()
+	if !ok || push.Deleted() {
+		return true, "ignored"
+	}
+	if repo := s.cfg.Git.RepositoryPath(); repo != "" && !push.IsRepo(repo) {
+		return true, "ignored"
+	}
+	if current, err := s.svc.Branch(ctx); err == nil && current != branch {
+		return true, "ignored"
+	}
+	if head, err := s.svc.HeadCommit(ctx); err == nil && push.After != "" && strings.EqualFold(head, push.After) {
+		return true, "up-to-date"
+	}
+	s.webhookLogger.InfoContext(ctx, "webhook push", "repo", push.Repo, "branch", branch, "commit", push.After)
+	return false, ""
+}
+
 func allowWebhookMethod(method string) bool {
 	switch method {
 	case http.MethodGet, http.MethodPost:
@@ -220,11 +471,23 @@ func allowWebhookMethod(method string) bool {
 	}
 }
 
-func (s *Server) authorizeWebhook(r *http.Request) bool {
+// authorizeWebhook accepts the secret in the Authorization header, or an
+// HMAC-SHA256 keyed with it in X-Hub-Signature-256, as GitHub and Gitea
+// repository webhooks send. A signature, when present, must match; it
+// covers the X-Webhook-Timestamp too when one is sent. With
+// webhook.requireTimestamp only signed deliveries are accepted.
+func (s *Server) authorizeWebhook(r *http.Request, body []byte) bool {
 	secret := strings.TrimSpace(s.cfg.Webhook.Secret)
 	if secret == "" {
 		return true
 	}
+	if signature := strings.TrimSpace(r.Header.Get(webhook.SignatureHeader)); signature != "" {
+		timestamp := strings.TrimSpace(r.Header.Get(webhook.TimestampHeader))
+		return webhook.ValidSignature(secret, timestamp, body, signature)
+	}
+	if s.cfg.Webhook.RequireTimestamp {
+		return false
+	}
 
 	token := strings.TrimSpace(r.Header.Get("Authorization"))
 	if token == "" {
@@ -249,14 +512,63 @@ func (s *Server) tryStatic(w http.ResponseWriter, r *http.Request) bool {
 	if !isWithin(s.cfg.OutputDir, target) {
 		return false
 	}
-	info, err := os.Stat(target)
-	if err != nil || info.IsDir() {
+	file, ok := s.svc.LookupOutput(target)
+	if !ok {
 		return false
 	}
-	http.ServeFile(w, r, target)
+	if !s.svc.PublishedAsset(clean) {
+		s.serveNotFound(w, r)
+		return true
+	}
+	if !s.svc.CanRead(r.Context(), clean) {
+		s.serveForbidden(w, r)
+		return true
+	}
+	s.serveOutputFile(w, r, file)
 	return true
 }
 
+// serveOutputFile streams a build artifact using the size, modification time,
+// validator and content type recorded in the output manifest, or its
+// precompressed sibling when the client accepts one. Conditional requests
+// are answered with 304 by http.ServeContent.
+func (s *Server) serveOutputFile(w http.ResponseWriter, r *http.Request, file site.OutputFile) {
+	body, encoding := file, ""
+	if variant, accepted, ok := s.precompressedVariant(w, r, file); ok {
+		body, encoding = variant, accepted
+	}
+	f, err := os.Open(body.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+	if file.ContentType != "" {
+		w.Header().Set("Content-Type", file.ContentType)
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if file.ETag != "" {
+		etag := file.ETag
+		if encoding != "" {
+			etag += "-" + encoding
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+	if s.svc.ReadRestricted(r.URL.Path) {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	if policy, ok := s.cachePolicy(file.ContentType); ok && w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", policy)
+	}
+	http.ServeContent(w, r, file.Path, file.ModTime, f)
+}
+
 func isWithin(base, target string) bool {
 	baseAbs, err := filepath.Abs(base)
 	if err != nil {
@@ -294,9 +606,21 @@ func sanitizeRequestPath(p string) string {
 type responseWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (rw *responseWriter) WriteHeader(status int) {
 	rw.status = status
 	rw.ResponseWriter.WriteHeader(status)
 }
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
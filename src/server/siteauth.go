@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// siteAuthExempt lists endpoints that authenticate callers on their own and
+// must stay reachable for machines that do not know the site credentials.
+var siteAuthExempt = []string{"/api/admin", "/api/v1", "/api/version"}
+
+// requireSiteAuth gates every request behind basic auth or a bearer token
+// when siteAuth is enabled.
+func (s *Server) requireSiteAuth(next http.Handler) http.Handler {
+	if !s.cfg.SiteAuth.Enabled {
+		return next
+	}
+	challenge := "Basic realm=" + strconv.Quote(s.cfg.SiteAuth.Realm) + `, charset="UTF-8"`
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.siteAuthExempt(r.URL.Path) || s.authorizeSite(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+func (s *Server) siteAuthExempt(path string) bool {
+	exempt := siteAuthExempt
+	// These only authenticate callers when given a secret of their own;
+	// /healthz never does and stays behind site auth unless excluded.
+	if strings.TrimSpace(s.cfg.Webhook.Secret) != "" {
+		exempt = append(exempt[:len(exempt):len(exempt)], "/api/webhook")
+	}
+	if s.cfg.Metrics.Token != "" {
+		exempt = append(exempt[:len(exempt):len(exempt)], "/metrics")
+	}
+	for _, prefix := range exempt {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	for _, prefix := range s.cfg.SiteAuth.Exclude {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) authorizeSite(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Authorization")), "Bearer "); ok {
+		token = strings.TrimSpace(token)
+		granted := false
+		for _, candidate := range s.cfg.SiteAuth.Tokens {
+			// Check every token so timing does not reveal which one matched.
+			if subtle.ConstantTimeCompare([]byte(token), []byte(strings.TrimSpace(candidate))) == 1 {
+				granted = true
+			}
+		}
+		return granted
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, known := s.cfg.SiteAuth.Users[user]
+	if !known {
+		// Compare anyway to keep unknown users as slow as wrong passwords.
+		expected = "sha256:" + strings.Repeat("0", 64)
+	}
+	var match bool
+	if digest, hashed := strings.CutPrefix(expected, "sha256:"); hashed {
+		sum := sha256.Sum256([]byte(password))
+		match = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(digest))) == 1
+	} else {
+		match = subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+	}
+	return known && match
+}
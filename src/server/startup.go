@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// awaitStartup answers requests with a placeholder, or the previous build when
+// serveStaleOutput is set, until the initial clone and build have completed.
+// Probes and template assets stay reachable so supervisors and the
+// placeholder page keep working meanwhile.
+func (s *Server) awaitStartup(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.svc.Ready() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		clean := sanitizeRequestPath(r.URL.Path)
+		switch {
+		case clean == "/healthz" || clean == "/metrics" || clean == "/api/version":
+			next.ServeHTTP(w, r)
+			return
+		case strings.HasPrefix(clean, "/assets/"):
+			if s.serveTemplateAsset(w, r, strings.TrimPrefix(clean, "/assets/")) {
+				return
+			}
+		}
+
+		if s.cfg.ServeStaleOutput && !strings.HasPrefix(clean, "/api/") && s.serveStaleOutput(w, r) {
+			return
+		}
+
+		w.Header().Set("Retry-After", "10")
+		w.Header().Set("Cache-Control", "no-store")
+		if strings.HasPrefix(clean, "/api/") {
+			writeError(w, http.StatusServiceUnavailable, "wiki is initializing")
+			return
+		}
+		page, err := s.svc.RenderInitializingPage()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "wiki is initializing")
+			return
+		}
+		w.Header().Set("Refresh", "10")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write(page)
+	})
+}
+
+// serveStaleOutput serves a previous build from OutputDir read-only while the
+// repository is unavailable. It reports false when no earlier build exists or
+// its files no longer match the build's manifest.
+func (s *Server) serveStaleOutput(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if check := s.svc.OutputVerification(); check != nil && !check.OK() {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.OutputDir, "index.html")); err != nil {
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	if s.tryStatic(w, r) {
+		return true
+	}
+	if err := s.svc.EnsureRequestAccessible(r.Context(), r.URL.Path); err != nil {
+		if errors.Is(err, site.ErrForbiddenRoute) {
+			serveStaticStatus(w, r, s.svc.ForbiddenDocumentPath(), http.StatusForbidden)
+		} else {
+			serveStaticStatus(w, r, s.svc.NotFoundDocumentPath(), http.StatusNotFound)
+		}
+		return true
+	}
+	staticPath, err := s.svc.StaticDocumentPath(r.URL.Path)
+	if err == nil && isWithin(s.cfg.OutputDir, staticPath) {
+		if file, ok := s.svc.LookupOutput(staticPath); ok {
+			s.serveOutputFile(w, r, file)
+			return true
+		}
+	}
+	serveStaticStatus(w, r, s.svc.NotFoundDocumentPath(), http.StatusNotFound)
+	return true
+}
+
+func serveStaticStatus(w http.ResponseWriter, r *http.Request, file string, status int) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		writeError(w, status, "")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+}
+
+func (s *Server) serveTemplateAsset(w http.ResponseWriter, r *http.Request, name string) bool {
+	dir := s.svc.AssetsDir()
+	if dir == "" || name == "" {
+		return false
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !isWithin(dir, target) {
+		return false
+	}
+	http.ServeFile(w, r, target)
+	return true
+}
+
+func (s *Server) startupHealth() (bool, any) {
+	return s.svc.Ready(), s.svc.StartupStatus()
+}
+
+func (s *Server) outputHealth() (bool, any) {
+	check := s.svc.OutputVerification()
+	if check == nil {
+		return true, "not verified yet"
+	}
+	return check.OK(), check
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"path"
+)
+
+// uiConfig is what the bundled frontend reads from /api/ui-config to set
+// itself up instead of hard-coding endpoints and features.
+type uiConfig struct {
+	BaseURL  string `json:"baseUrl"`
+	SiteName string `json:"siteName"`
+	Editable bool   `json:"editable"`
+	// Attribution is git.attribution on editable wikis.
+	Attribution string            `json:"attribution,omitempty"`
+	Features    map[string]bool   `json:"features"`
+	Search      uiSearchConfig    `json:"search"`
+	Uploads     *uiUploadConfig   `json:"uploads,omitempty"`
+	Endpoints   map[string]string `json:"endpoints"`
+	Shortcuts   map[string]string `json:"shortcuts"`
+}
+
+type uiSearchConfig struct {
+	IndexURL     string `json:"indexUrl"`
+	SnippetChars int    `json:"snippetChars"`
+}
+
+type uiUploadConfig struct {
+	MaxBytes int64    `json:"maxBytes"`
+	Types    []string `json:"types"`
+}
+
+func (s *Server) handleUIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cfg := s.cfg
+	payload := uiConfig{
+		BaseURL:  cfg.BaseURL,
+		SiteName: cfg.SiteName,
+		Editable: cfg.Editable,
+		Features: map[string]bool{
+			"history":       true,
+			"blame":         true,
+			"restore":       cfg.Editable,
+			"uploads":       cfg.Editable && cfg.Uploads.Enabled,
+			"editTokens":    cfg.Editable && cfg.EditTokens.Enabled,
+			"recentChanges": cfg.RecentChanges.Limit > 0,
+			"math":          cfg.Render.Math,
+			"formatOnSave":  cfg.Render.FormatOnSave,
+			"login":         cfg.Editable && cfg.Auth.Enabled,
+			"challenge":     cfg.Editable && cfg.Challenge.Enabled,
+		},
+		Search: uiSearchConfig{
+			IndexURL:     path.Join("/", cfg.BaseURL, "search-index.json"),
+			SnippetChars: max(cfg.Search.SnippetChars, 0),
+		},
+		Endpoints: map[string]string{
+			"preview":    "/api/preview",
+			"format":     "/api/format",
+			"document":   "/api/document",
+			"draftCheck": "/api/draft/check",
+			"history":    "/api/history",
+			"diff":       "/api/diff",
+			"blame":      "/api/blame",
+		},
+		Shortcuts: make(map[string]string, len(cfg.UI.Shortcuts)),
+	}
+	if cfg.Editable {
+		for _, name := range []string{"save", "rename", "restore", "delete"} {
+			payload.Endpoints[name] = "/api/" + name
+		}
+		payload.Endpoints["previewSave"] = "/api/save/preview-diff"
+		payload.Attribution = cfg.Git.Attribution
+		if cfg.Auth.Enabled {
+			payload.Endpoints["login"] = loginPath
+			payload.Endpoints["logout"] = "/auth/logout"
+			payload.Endpoints["me"] = "/api/auth/me"
+		}
+		if cfg.Challenge.Enabled {
+			payload.Endpoints["challenge"] = "/api/challenge"
+		}
+		if cfg.Uploads.Enabled {
+			payload.Endpoints["upload"] = "/api/upload"
+			payload.Uploads = &uiUploadConfig{MaxBytes: cfg.Uploads.MaxBytes, Types: cfg.Uploads.Types}
+		}
+	}
+	for action, key := range cfg.UI.Shortcuts {
+		if key != "" {
+			payload.Shortcuts[action] = key
+		}
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/iedon/dn42-wiki-go/site"
+)
+
+// uploadFormOverhead is the room left for multipart headers and the other
+// form fields on top of uploads.maxBytes.
+const uploadFormOverhead = 64 << 10
+
+// handleUpload commits a file sent as the "file" field of a multipart form
+// and answers with the Markdown to embed it. An optional "message" field
+// replaces the default commit message.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.cfg.Editable || !s.cfg.Uploads.Enabled {
+		writeError(w, http.StatusForbidden, "uploads disabled")
+		return
+	}
+	limit := s.cfg.Uploads.MaxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, limit+uploadFormOverhead)
+	if err := r.ParseMultipartForm(uploadFormOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file required")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read file")
+		return
+	}
+
+	upload, err := s.svc.SaveUpload(r.Context(), header.Filename, data, r.FormValue("message"), s.clientRemoteAddr(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, site.ErrUploadTooLarge):
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, site.ErrUploadType):
+			writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, site.ErrRepositoryBehind):
+			writeError(w, http.StatusConflict, "remote repository has newer revisions; please reload")
+		case errors.Is(err, site.ErrInvalidPath):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, site.ErrArchivedRoute):
+			writeError(w, http.StatusForbidden, "page is archived")
+		case errors.Is(err, site.ErrForbiddenRoute):
+			writeError(w, http.StatusForbidden, "requested path is restricted")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, upload)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// Version identifies the running build of the wiki.
+type Version struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Commit and BuildTime are set at link time and may be empty.
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+}
+
+// SetVersion sets the build reported by /api/version.
+func (s *Server) SetVersion(v Version) {
+	s.version = v
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":      s.version.Name,
+		"version":   s.version.Version,
+		"commit":    s.version.Commit,
+		"buildTime": s.version.BuildTime,
+		"go":        runtime.Version(),
+		"os":        runtime.GOOS,
+		"arch":      runtime.GOARCH,
+		"features":  s.featureFlags(),
+	})
+}
+
+// featureFlags lists the optional subsystems enabled in the configuration,
+// so operators can compare what their mirrors run.
+func (s *Server) featureFlags() map[string]bool {
+	cfg := s.cfg
+	return map[string]bool{
+		"editable":       cfg.Editable,
+		"replica":        cfg.Replica.Enabled,
+		"webhook":        cfg.Webhook.Enabled,
+		"polling":        cfg.Webhook.Enabled && cfg.Webhook.Polling.Enabled,
+		"metrics":        cfg.Metrics.Enabled,
+		"cdn":            cfg.CDN.Enabled,
+		"pullValidation": cfg.PullValidation.Enabled,
+		"siteAuth":       cfg.SiteAuth.Enabled,
+		"auth":           cfg.Auth.Enabled,
+		"acl":            cfg.ACL.Enabled(),
+		"editTokens":     cfg.EditTokens.Enabled,
+		"editQuotas":     cfg.EditQuotas.Enabled,
+		"rateLimits":     cfg.RateLimits.Enabled,
+		"challenge":      cfg.Challenge.Enabled,
+		"uploads":        cfg.Uploads.Enabled,
+		"bots":           cfg.Bots.Enabled,
+		"precompress":    cfg.Precompress.Enabled,
+		"math":           cfg.Render.Math,
+		"formatOnSave":   cfg.Render.FormatOnSave,
+		"recentChanges":  cfg.RecentChanges.Limit > 0,
+		"analytics":      cfg.Analytics.Enabled,
+		"tls":            cfg.EnableTLS,
+	}
+}
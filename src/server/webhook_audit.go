@@ -0,0 +1,173 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const maxRecordedPayload = 2048
+
+// webhookDelivery records a single inbound webhook call for inspection.
+type webhookDelivery struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Action     string    `json:"action"`
+	Method     string    `json:"method"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Status     int       `json:"status"`
+	Result     string    `json:"result"`
+	Duration   string    `json:"duration"`
+	Payload    string    `json:"payload,omitempty"`
+}
+
+// webhookLog keeps the most recent deliveries in a fixed-size ring.
+type webhookLog struct {
+	mu    sync.Mutex
+	items []webhookDelivery
+	next  int
+	full  bool
+}
+
+func newWebhookLog(size int) *webhookLog {
+	if size <= 0 {
+		return &webhookLog{}
+	}
+	return &webhookLog{items: make([]webhookDelivery, size)}
+}
+
+func (l *webhookLog) add(d webhookDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.items) == 0 {
+		return
+	}
+	l.items[l.next] = d
+	l.next = (l.next + 1) % len(l.items)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// snapshot returns recorded deliveries, newest first.
+func (l *webhookLog) snapshot() []webhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.items)
+	}
+	result := make([]webhookDelivery, 0, count)
+	for i := 1; i <= count; i++ {
+		idx := (l.next - i + len(l.items)) % len(l.items)
+		result = append(result, l.items[idx])
+	}
+	return result
+}
+
+func truncatePayload(data []byte) string {
+	if len(data) > maxRecordedPayload {
+		data = data[:maxRecordedPayload]
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+		return string(data) + "…"
+	}
+	return string(data)
+}
+
+// replayGuard rejects deliveries whose timestamp is outside the accepted
+// window, or whose nonce or signature was already seen within it.
+//
+// Neither header is covered by the Authorization secret, and the nonce is not
+// signed either, so on its own the guard only filters retried and duplicate
+// deliveries. Signatures are remembered too, so a signed delivery cannot be
+// sent again within the window under a fresh nonce. Only a timestamp signed
+// along with the body, which authorizeWebhook verifies, stops a captured
+// delivery from being replayed later; requireTimestamp refuses deliveries
+// without one.
+type replayGuard struct {
+	window           time.Duration
+	requireTimestamp bool
+	mu               sync.Mutex
+	seen             map[string]time.Time
+	// order lists the keys of seen by the time they were recorded, so
+	// expired ones are dropped from its front.
+	order []seenDelivery
+}
+
+type seenDelivery struct {
+	key string
+	at  time.Time
+}
+
+func newReplayGuard(window time.Duration, requireTimestamp bool) *replayGuard {
+	return &replayGuard{window: window, requireTimestamp: requireTimestamp, seen: make(map[string]time.Time)}
+}
+
+// check validates the timestamp, nonce and signature. Unless timestamps are
+// required, providers that send none of them are accepted unchanged.
+func (g *replayGuard) check(timestamp, nonce, signature string, now time.Time) (bool, string) {
+	if g == nil || g.window <= 0 {
+		return true, ""
+	}
+	ts := strings.TrimSpace(timestamp)
+	if ts == "" && g.requireTimestamp {
+		return false, "missing timestamp"
+	}
+	if ts != "" {
+		seconds, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return false, "invalid timestamp"
+		}
+		skew := now.Sub(time.Unix(seconds, 0))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > g.window {
+			return false, "timestamp outside replay window"
+		}
+	}
+	var keys []string
+	if nonce = strings.TrimSpace(nonce); nonce != "" {
+		keys = append(keys, "nonce:"+nonce)
+	}
+	if signature = strings.ToLower(strings.TrimSpace(signature)); signature != "" {
+		keys = append(keys, "signature:"+signature)
+	}
+	if len(keys) == 0 {
+		return true, ""
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.order) > 0 && now.Sub(g.order[0].at) > g.window {
+		oldest := g.order[0]
+		if g.seen[oldest.key].Equal(oldest.at) {
+			delete(g.seen, oldest.key)
+		}
+		g.order = g.order[1:]
+	}
+	for _, key := range keys {
+		if _, ok := g.seen[key]; ok {
+			return false, "replayed delivery"
+		}
+	}
+	for _, key := range keys {
+		g.seen[key] = now
+		g.order = append(g.order, seenDelivery{key: key, at: now})
+	}
+	return true, ""
+}
+
+// webhookNonce picks the delivery identifier from the generic header or
+// well-known forge headers.
+func webhookNonce(get func(string) string) string {
+	for _, header := range []string{"X-Webhook-Nonce", "X-GitHub-Delivery", "X-Gitea-Delivery", "X-Gogs-Delivery"} {
+		if value := strings.TrimSpace(get(header)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package site
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+type principalKey struct{}
+
+// WithPrincipal records who requests made with ctx act for, by the names
+// ACL roles list their members under, eg. "oidc:<subject>". Requests
+// without one are anonymous.
+func WithPrincipal(ctx context.Context, members []string) context.Context {
+	return context.WithValue(ctx, principalKey{}, members)
+}
+
+func principalOf(ctx context.Context) []string {
+	members, _ := ctx.Value(principalKey{}).([]string)
+	return members
+}
+
+// checkAccess refuses requests for rel that the route is private for, that
+// would change an archived page, or that the ACL does not grant level to.
+func (s *Service) checkAccess(ctx context.Context, rel string, level int) error {
+	if err := s.ensureRouteAccessible(rel); err != nil {
+		return err
+	}
+	route := routeFromPath(rel, s.homeDoc)
+	if level >= config.ACLWrite && s.cfg.IsPathArchived(route) {
+		return fmt.Errorf("%w: %s", ErrArchivedRoute, route)
+	}
+	return s.checkRouteACL(ctx, route, level)
+}
+
+func (s *Service) checkRouteACL(ctx context.Context, route string, level int) error {
+	acl := &s.cfg.ACL
+	if !s.cfg.Live || !acl.Enabled() {
+		return nil
+	}
+	if !acl.Allows(route, acl.RolesOf(principalOf(ctx)), level) {
+		return fmt.Errorf("%w: %s access to %s denied", ErrForbiddenRoute, accessName(level), route)
+	}
+	return nil
+}
+
+// CanRead reports whether the principal of ctx may read the route an HTTP
+// request path maps to, or the asset it names.
+func (s *Service) CanRead(ctx context.Context, requestPath string) bool {
+	return s.checkRouteACL(ctx, s.aclRoute(requestPath), config.ACLRead) == nil
+}
+
+// ReadRestricted reports whether the route of an HTTP request path is not
+// readable by everyone, so responses for it must not be cached publicly.
+func (s *Service) ReadRestricted(requestPath string) bool {
+	if !s.cfg.ACL.Enabled() {
+		return false
+	}
+	return s.cfg.ACL.RestrictsRead(s.aclRoute(requestPath))
+}
+
+// aclRoute maps a request path to the route ACL rules match against. Paths
+// that are not pages, such as uploads, match by their own path.
+func (s *Service) aclRoute(requestPath string) string {
+	if route, err := s.routeFromRequestPath(requestPath); err == nil {
+		return route
+	}
+	return requestPath
+}
+
+// routeIsUnlisted reports whether route is left out of pages and feeds
+// shared by every reader: private routes and those not everyone may read.
+func (s *Service) routeIsUnlisted(route string) bool {
+	return s.routeIsPrivate(route) || (s.cfg.Live && s.cfg.ACL.RestrictsRead(route))
+}
+
+func accessName(level int) string {
+	switch level {
+	case config.ACLRead:
+		return "read"
+	case config.ACLWrite:
+		return "write"
+	}
+	return "admin"
+}
@@ -0,0 +1,101 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metaAliases reads the aliases key of a page's front matter, eg.
+// aliases: [peering, Old/Peering-Guide], as routes from the site root.
+// Entries that are not valid page paths are dropped.
+func metaAliases(value any, homeDoc string) []string {
+	var routes []string
+	for _, alias := range metaStrings(value) {
+		rel, err := normalizeRelPath(alias, homeDoc)
+		if err != nil || strings.EqualFold(rel, homeDoc) {
+			log.Printf("alias %q: not a page path, ignored", alias)
+			continue
+		}
+		routes = append(routes, routeFromPath(rel, homeDoc))
+	}
+	return routes
+}
+
+// pageAliasTargets maps the alias routes of docs to the routes they point
+// at. Aliases naming an existing page or a reserved route are ignored, and
+// the first page in route order keeps an alias claimed twice. Aliases are
+// matched case-insensitively like page routes.
+func (s *Service) pageAliasTargets(docs []page) map[string]string {
+	claimed := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		claimed[strings.ToLower(doc.Route)] = doc.Route
+	}
+	targets := make(map[string]string)
+	for _, doc := range docs {
+		if len(doc.Aliases) == 0 || s.routeIsUnlisted(doc.Route) {
+			continue
+		}
+		for _, alias := range doc.Aliases {
+			key := strings.ToLower(alias)
+			if target, ok := claimed[key]; ok {
+				if target != doc.Route {
+					log.Printf("alias %s of %s: route already taken by %s, ignored", alias, doc.Source, target)
+				}
+				continue
+			}
+			if isReservedPath(strings.Trim(alias, "/")) {
+				log.Printf("alias %s of %s: reserved route, ignored", alias, doc.Source)
+				continue
+			}
+			claimed[key] = doc.Route
+			targets[alias] = doc.Route
+		}
+	}
+	return targets
+}
+
+// aliasTarget returns the route a page alias points at.
+func (s *Service) aliasTarget(route string) (string, bool) {
+	nav := s.snapshot.Load()
+	if nav == nil {
+		return "", false
+	}
+	if target, ok := nav.Aliases[route]; ok {
+		return target, true
+	}
+	for alias, target := range nav.Aliases {
+		if strings.EqualFold(alias, route) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// writeAliasPages writes a redirect stub for every page alias, so static
+// hosts send visitors of an alias to the page. Live mode answers aliases with
+// a redirect instead.
+func (s *Service) writeAliasPages(baseDir string, nav *SiteSnapshot) error {
+	for alias, target := range nav.Aliases {
+		output := filepath.Join(baseDir, filepath.FromSlash(htmlPathFrom(strings.Trim(alias, "/")+".md", s.homeDoc)))
+		if _, err := os.Stat(output); err == nil {
+			log.Printf("alias %s of %s: output exists, ignored", alias, target)
+			continue
+		}
+		url := html.EscapeString(resolveDirectoryURL(s.cfg.BaseURL, target))
+		stub := fmt.Sprintf(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Redirecting</title>`+
+			`<link rel="canonical" href="%[1]s"><meta name="robots" content="noindex">`+
+			`<meta http-equiv="refresh" content="0; url=%[1]s"></head>`+
+			`<body><p>This page has moved to <a href="%[1]s">%[1]s</a>.</p></body></html>`, url)
+		if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(output, []byte(stub), 0o644); err != nil {
+			return fmt.Errorf("write alias %s: %w", alias, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+// ErrInvalidAttribution reports an author name or email that cannot be
+// used, or one missing or given against git.attribution.
+var ErrInvalidAttribution = errors.New("invalid attribution")
+
+const (
+	maxAttributionName  = 64
+	maxAttributionEmail = 254
+)
+
+type attributionKey struct{}
+
+// Attribute makes the commits of edits made with the returned context
+// authored by the editor's own name and email, after checking them against
+// git.attribution. An empty email falls back to that of git.author. Users
+// signed in with auth are always authored as themselves, so their
+// attribution is ignored.
+func (s *Service) Attribute(ctx context.Context, displayName, email string) (context.Context, error) {
+	name := sanitizeDisplayName(displayName)
+	email = strings.TrimSpace(email)
+	given := strings.TrimSpace(displayName) != "" || email != ""
+	if commitAuthor(ctx) != "" {
+		return ctx, nil
+	}
+	switch s.cfg.Git.Attribution {
+	case config.AttributionForbidden:
+		if given {
+			return ctx, fmt.Errorf("%w: edits are not attributed on this wiki", ErrInvalidAttribution)
+		}
+		return ctx, nil
+	case config.AttributionRequired:
+		if name == "" {
+			return ctx, fmt.Errorf("%w: a display name is required", ErrInvalidAttribution)
+		}
+	}
+	if !given {
+		return ctx, nil
+	}
+	if name == "" {
+		return ctx, fmt.Errorf("%w: display name required", ErrInvalidAttribution)
+	}
+	if email == "" {
+		email = authorEmail(s.cfg.Git.Author)
+	} else if !validAttributionEmail(email) {
+		return ctx, fmt.Errorf("%w: malformed email", ErrInvalidAttribution)
+	}
+	return context.WithValue(ctx, attributionKey{}, name+" <"+email+">"), nil
+}
+
+func attribution(ctx context.Context) string {
+	author, _ := ctx.Value(attributionKey{}).(string)
+	return author
+}
+
+// sanitizeDisplayName drops characters that would break the author line or
+// logs, collapses whitespace and caps the length.
+func sanitizeDisplayName(raw string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), r == '<', r == '>', r == '"', r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, raw)
+	name := strings.Join(strings.Fields(cleaned), " ")
+	if utf8.RuneCountInString(name) > maxAttributionName {
+		name = strings.TrimSpace(string([]rune(name)[:maxAttributionName]))
+	}
+	return name
+}
+
+func validAttributionEmail(email string) bool {
+	if len(email) > maxAttributionEmail || strings.ContainsAny(email, "<>\" \t\r\n") {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Name == "" && addr.Address == email
+}
+
+// authorEmail returns the email of a "Name <email>" author line.
+func authorEmail(author string) string {
+	open := strings.LastIndex(author, "<")
+	if open < 0 || !strings.HasSuffix(author, ">") {
+		return ""
+	}
+	return author[open+1 : len(author)-1]
+}
@@ -0,0 +1,69 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// badgeDir is the output directory of the status badges.
+const badgeDir = "badge"
+
+// writeBadges writes SVG badges with the build time and the number of
+// public, published pages, for embedding in dashboards and READMEs. Badges
+// tracked in the repository are left alone.
+func (s *Service) writeBadges(baseDir string, files []string, nav *SiteSnapshot) error {
+	pages := 0
+	for _, info := range nav.Pages {
+		if !info.Draft && !s.routeIsUnlisted(info.Route) {
+			pages++
+		}
+	}
+	badges := []struct {
+		name, label, value string
+	}{
+		{"last-update.svg", "last update", nav.BuiltAt.UTC().Format("2006-01-02 15:04 UTC")},
+		{"pages.svg", "pages", strconv.Itoa(pages)},
+	}
+	if err := os.MkdirAll(filepath.Join(baseDir, badgeDir), 0o755); err != nil {
+		return err
+	}
+	for _, badge := range badges {
+		rel := path.Join(badgeDir, badge.name)
+		if slices.Contains(files, rel) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(baseDir, filepath.FromSlash(rel)), renderBadge(badge.label, badge.value), 0o644); err != nil {
+			return fmt.Errorf("write badge %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// renderBadge draws a flat two-part badge in the common shields style.
+func renderBadge(label, value string) []byte {
+	labelWidth, valueWidth := badgeTextWidth(label)+10, badgeTextWidth(value)+10
+	width := labelWidth + valueWidth
+	title := html.EscapeString(label + ": " + value)
+	return fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s">`+
+		`<title>%[2]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[3]d" height="20" fill="#555"/><rect x="%[3]d" width="%[4]d" height="20" fill="#007ec6"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[5]d" y="14" textLength="%[6]d" lengthAdjust="spacingAndGlyphs">%[7]s</text>`+
+		`<text x="%[8]d" y="14" textLength="%[9]d" lengthAdjust="spacingAndGlyphs">%[10]s</text></g></svg>`,
+		width, title, labelWidth, valueWidth,
+		labelWidth/2, labelWidth-10, html.EscapeString(label),
+		labelWidth+valueWidth/2, valueWidth-10, html.EscapeString(value))
+}
+
+// badgeTextWidth estimates the width of text set in 11px Verdana.
+func badgeTextWidth(text string) int {
+	return utf8.RuneCountInString(text) * 7
+}
@@ -6,7 +6,14 @@ import (
 	"github.com/iedon/dn42-wiki-go/templatex"
 )
 
-func buildBreadcrumbs(route, title, base string) []templatex.Breadcrumb {
+// directoryIndexNames are the pages, besides one named like the directory
+// itself, that introduce a directory.
+var directoryIndexNames = []string{"index", "Index", "README", "Readme", "readme"}
+
+// buildBreadcrumbs lists the directories above route and the page itself.
+// Directories with an index page, found in titles, link to it under its
+// title; others link to their entry on the directory page.
+func buildBreadcrumbs(route, title, base string, titles map[string]string) []templatex.Breadcrumb {
 	trimmedBase := strings.Trim(strings.TrimSpace(base), "/")
 	rootHref := directoryPageHref(trimmedBase)
 
@@ -36,6 +43,9 @@ func buildBreadcrumbs(route, title, base string) []templatex.Breadcrumb {
 		if isLast {
 			crumb.Title = title
 			crumb.Path = ""
+		} else if indexRoute, indexTitle, ok := directoryIndex(strings.Join(segments[:i+1], "/"), titles); ok {
+			crumb.Title = indexTitle
+			crumb.Path = resolveDirectoryURL(base, indexRoute)
 		} else {
 			anchor := breadcrumbAnchor(segment)
 			if anchor != "" {
@@ -49,3 +59,19 @@ func buildBreadcrumbs(route, title, base string) []templatex.Breadcrumb {
 
 	return crumbs
 }
+
+// directoryIndex finds the page introducing dir: an index or README page in
+// it, or a page named like it next to it.
+func directoryIndex(dir string, titles map[string]string) (string, string, bool) {
+	for _, name := range directoryIndexNames {
+		route := "/" + dir + "/" + name + "/"
+		if title, ok := titles[route]; ok {
+			return route, title, true
+		}
+	}
+	route := "/" + dir + "/"
+	if title, ok := titles[route]; ok {
+		return route, title, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,136 @@
+package site
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/renderer"
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// batchHistoryThreshold is the number of pages to render above which their
+// last commits are read in one pass over the history.
+const batchHistoryThreshold = 8
+
+// incrementalBuild lists the documents a build has to render again. All
+// other pages are carried over from the active output, which was built from
+// the commit recorded in buildReuse.
+type incrementalBuild struct {
+	previous map[string]page
+	dirty    map[string]bool
+}
+
+// pages returns the commit and documents of the active build.
+func (b *buildReuse) pages() (string, map[string]page) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commit, b.docs
+}
+
+// storePages records the documents of a build once its output is active.
+func (b *buildReuse) storePages(commit string, docs []page) {
+	bySource := make(map[string]page, len(docs))
+	for _, doc := range docs {
+		bySource[doc.Source] = doc
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commit, b.docs = commit, bySource
+}
+
+// planIncremental diffs head against the commit of the active build. It
+// returns nil, asking for a full build, when there is no previous build to
+// start from or a layout fragment changed, since those appear on every page.
+func (s *Service) planIncremental(ctx context.Context, head string, files []string) *incrementalBuild {
+	prevCommit, previous := s.reuse.pages()
+	if head == "" || prevCommit == "" || previous == nil {
+		return nil
+	}
+	changed, err := s.repo.ChangedFiles(ctx, prevCommit, head)
+	if err != nil {
+		log.Printf("build static: %v, doing a full build", err)
+		return nil
+	}
+
+	current := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		current[file] = struct{}{}
+	}
+	dirty := make(map[string]bool, len(changed))
+	routesChanged := false
+	for _, file := range changed {
+		if isLayoutFragment(file) {
+			return nil
+		}
+		dirty[file] = true
+		if s.documents.IsDocument(file) {
+			_, before := previous[file]
+			_, after := current[file]
+			routesChanged = routesChanged || before != after
+		}
+	}
+	// Adding or removing a page changes which [[links]] elsewhere resolve.
+	if routesChanged {
+		for source, doc := range previous {
+			if strings.Contains(string(doc.HTML), renderer.WikiLinkClass) {
+				dirty[source] = true
+			}
+		}
+	}
+	return &incrementalBuild{previous: previous, dirty: dirty}
+}
+
+// navigationChanged reports whether the breadcrumbs or section navigation
+// of doc differ between the active build and the next one, so a carried
+// over page has to be written again.
+func (s *Service) navigationChanged(doc page, active, next *SiteSnapshot) bool {
+	if active == nil {
+		return true
+	}
+	before, after := &templatex.PageData{}, &templatex.PageData{}
+	s.applyNavigation(before, doc, active)
+	s.applyNavigation(after, doc, next)
+	return !reflect.DeepEqual(before.Breadcrumbs, after.Breadcrumbs) || !reflect.DeepEqual(before.Section, after.Section)
+}
+
+// reuse returns the previous render of file when it is still current.
+func (b *incrementalBuild) reuse(file string) (page, bool) {
+	if b == nil || b.dirty[file] {
+		return page{}, false
+	}
+	doc, ok := b.previous[file]
+	return doc, ok
+}
+
+// pending counts the sources that have to be rendered again.
+func (b *incrementalBuild) pending(sources []string) int {
+	if b == nil {
+		return len(sources)
+	}
+	count := 0
+	for _, source := range sources {
+		if _, ok := b.reuse(source); !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// reusePage copies an unchanged page from the active output, restoring the
+// modification time writeDocuments would have set.
+func reusePage(activeDir, buildDir string, doc page) bool {
+	if !reuseOutput(activeDir, buildDir, doc.OutputPath) {
+		return false
+	}
+	if !doc.LastMod.IsZero() {
+		stamp := doc.LastMod.UTC()
+		if err := os.Chtimes(filepath.Join(buildDir, filepath.FromSlash(doc.OutputPath)), stamp, stamp); err != nil {
+			return false
+		}
+	}
+	return true
+}
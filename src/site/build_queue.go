@@ -0,0 +1,100 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var buildsSuperseded = metrics.NewCounter("wiki_builds_superseded_total", "Static builds aborted because a newer build was requested.")
+
+// buildQueue runs static builds one at a time. A request arriving while a
+// build is running supersedes it: the running build is cancelled and a fresh
+// one starts, answering every request made since the superseded one began.
+// Bursts of edits or webhook deliveries therefore cost one extra build at
+// most.
+type buildQueue struct {
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	pending []*buildWaiter
+	current []*buildWaiter
+}
+
+type buildWaiter struct {
+	ctx  context.Context
+	done chan error
+}
+
+// submit queues a build and returns the channel receiving its result. The
+// build is cancelled early only once every caller waiting on it has given up.
+func (q *buildQueue) submit(ctx context.Context, build func(context.Context) error) <-chan error {
+	waiter := &buildWaiter{ctx: ctx, done: make(chan error, 1)}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, waiter)
+	if !q.running {
+		q.running = true
+		go q.run(build)
+		return waiter.done
+	}
+	if q.current != nil {
+		q.pending = append(q.current, q.pending...)
+		q.current = nil
+		q.cancel()
+	}
+	return waiter.done
+}
+
+func (q *buildQueue) run(build func(context.Context) error) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		waiters := q.pending
+		q.pending = nil
+		q.current = waiters
+		ctx, cancel := context.WithCancel(context.Background())
+		q.cancel = cancel
+		q.mu.Unlock()
+
+		remaining := int32(len(waiters))
+		stops := make([]func() bool, 0, len(waiters))
+		for _, w := range waiters {
+			stops = append(stops, context.AfterFunc(w.ctx, func() {
+				if atomic.AddInt32(&remaining, -1) == 0 {
+					cancel()
+				}
+			}))
+		}
+
+		err := build(ctx)
+		cancel()
+		for _, stop := range stops {
+			stop()
+		}
+
+		q.mu.Lock()
+		superseded := q.current == nil
+		q.current = nil
+		q.mu.Unlock()
+		if superseded {
+			buildsSuperseded.Inc()
+			log.Printf("build static: superseded by a newer request")
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			log.Printf("build static: cancelled")
+		}
+		for _, w := range waiters {
+			w.done <- err
+		}
+	}
+}
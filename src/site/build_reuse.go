@@ -0,0 +1,89 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/iedon/dn42-wiki-go/fsutil"
+)
+
+// buildReuse remembers fingerprints of the inputs behind the site-wide
+// outputs of the active build. When a rebuild finds the same inputs, the
+// previous file is carried over instead of being regenerated.
+type buildReuse struct {
+	mu        sync.Mutex
+	directory [sha256.Size]byte
+	search    [sha256.Size]byte
+	commit    string
+	docs      map[string]page
+}
+
+func (b *buildReuse) sums() (directory, search [sha256.Size]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.directory, b.search
+}
+
+// store records the fingerprints of a build once its output is active.
+func (b *buildReuse) store(directory, search [sha256.Size]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.directory, b.search = directory, search
+}
+
+// directoryFingerprint covers everything the directory page is rendered
+// from: the tracked document names and the layout fragments around it.
+func (s *Service) directoryFingerprint(files []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, file := range files {
+		if s.documents.IsDocument(file) && !isLayoutFragment(file) {
+			writeField(h, file)
+		}
+	}
+	layout := s.layout.Snapshot()
+	writeField(h, string(layout.Header))
+	writeField(h, string(layout.Footer))
+	writeField(h, string(layout.ServerFooter))
+	writeField(h, string(layout.Sidebar))
+	writeField(h, string(layout.Head))
+	writeField(h, string(layout.BodyEnd))
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// searchFingerprint covers the fields indexed for search. Documents come
+// from the render cache, so hashing them is much cheaper than building and
+// encoding the index.
+func searchFingerprint(docs []page) [sha256.Size]byte {
+	h := sha256.New()
+	for _, doc := range docs {
+		writeField(h, doc.Route)
+		writeField(h, doc.Title)
+		writeField(h, doc.Summary)
+		writeField(h, doc.PlainText)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+func writeField(h hash.Hash, value string) {
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	h.Write(size[:])
+	h.Write([]byte(value))
+}
+
+// reuseOutput copies rel from the active output into the build directory.
+func reuseOutput(activeDir, buildDir, rel string) bool {
+	src := filepath.Join(activeDir, filepath.FromSlash(rel))
+	if _, err := os.Stat(src); err != nil {
+		return false
+	}
+	return fsutil.CopyFile(src, filepath.Join(buildDir, filepath.FromSlash(rel))) == nil
+}
@@ -0,0 +1,122 @@
+package site
+
+import (
+	"cmp"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var slowestPageSeconds = metrics.NewGaugeVec("wiki_build_page_seconds", "Render and write time of the slowest pages of the last build.", "page")
+
+// PageTiming is the time a build spent on one page. Pages carried over
+// from the previous build are not timed.
+type PageTiming struct {
+	Route    string  `json:"route"`
+	Source   string  `json:"source"`
+	RenderMs float64 `json:"renderMs"`
+	WriteMs  float64 `json:"writeMs"`
+	TotalMs  float64 `json:"totalMs"`
+}
+
+// buildTimings collects the render and write time of every page of a
+// build. A nil *buildTimings records nothing.
+type buildTimings struct {
+	mu     sync.Mutex
+	render map[string]time.Duration
+	write  map[string]time.Duration
+	routes map[string]string
+}
+
+func newBuildTimings(enabled bool) *buildTimings {
+	if !enabled {
+		return nil
+	}
+	return &buildTimings{
+		render: make(map[string]time.Duration),
+		write:  make(map[string]time.Duration),
+		routes: make(map[string]string),
+	}
+}
+
+func (t *buildTimings) rendered(doc page, start time.Time) {
+	if t == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.render[doc.Source] += elapsed
+	t.routes[doc.Source] = doc.Route
+}
+
+func (t *buildTimings) written(doc page, start time.Time) {
+	if t == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write[doc.Source] += elapsed
+	t.routes[doc.Source] = doc.Route
+}
+
+// slowest returns the n pages that took longest, slowest first.
+func (t *buildTimings) slowest(n int) []PageTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := make([]PageTiming, 0, len(t.routes))
+	for source, route := range t.routes {
+		render, write := t.render[source], t.write[source]
+		timings = append(timings, PageTiming{
+			Route:    route,
+			Source:   source,
+			RenderMs: milliseconds(render),
+			WriteMs:  milliseconds(write),
+			TotalMs:  milliseconds(render + write),
+		})
+	}
+	slices.SortFunc(timings, func(a, b PageTiming) int {
+		if c := cmp.Compare(b.TotalMs, a.TotalMs); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Route, b.Route)
+	})
+	return timings[:min(n, len(timings))]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// recordSlowestPages keeps the slowest pages of the build that just went
+// live for /api/admin/build and the metrics.
+func (s *Service) recordSlowestPages(timings *buildTimings) {
+	if timings == nil {
+		return
+	}
+	slowest := timings.slowest(s.cfg.Render.SlowestPages)
+	s.slowestPages.Store(&slowest)
+	slowestPageSeconds.Reset()
+	for _, timing := range slowest {
+		slowestPageSeconds.Set(timing.TotalMs/1000, timing.Route)
+	}
+	if len(slowest) > 0 {
+		log.Printf("build static: slowest page %s took %.1f ms", slowest[0].Route, slowest[0].TotalMs)
+	}
+}
+
+// SlowestPages returns the pages the last build spent most time on,
+// slowest first, or nil when builds are not timed.
+func (s *Service) SlowestPages() []PageTiming {
+	if slowest := s.slowestPages.Load(); slowest != nil {
+		return *slowest
+	}
+	return nil
+}
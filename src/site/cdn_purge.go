@@ -0,0 +1,115 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/cdn"
+)
+
+// UsePurger makes every build purge the public URLs it changed. It must be
+// called before the first build.
+func (s *Service) UsePurger(purger *cdn.Purger) {
+	s.purger = purger
+}
+
+// changedOutputs lists the files whose content differs between two build
+// outputs, including files only present in one of them.
+func changedOutputs(oldDir, newDir string) ([]string, error) {
+	changed := make(map[string]struct{})
+	seen := make(map[string]struct{})
+	err := filepath.WalkDir(newDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(newDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = struct{}{}
+		if !sameFile(filepath.Join(oldDir, filepath.FromSlash(rel)), p) {
+			changed[rel] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(oldDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(oldDir, p)
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[filepath.ToSlash(rel)]; !ok {
+			changed[filepath.ToSlash(rel)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(changed))
+	for file := range changed {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil || infoA.Size() != infoB.Size() {
+		return false
+	}
+	dataA, errA := os.ReadFile(a)
+	dataB, errB := os.ReadFile(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// publicPath maps an output file to the URL it is served at. Pages are
+// published as <route>/index.html and requested as <route>/.
+func (s *Service) publicPath(rel string) string {
+	if rel == "index.html" {
+		rel = ""
+	} else if dir, ok := strings.CutSuffix(rel, "/index.html"); ok {
+		rel = dir + "/"
+	}
+	return strings.TrimSuffix(path.Join("/", s.baseTrimmed), "/") + "/" + rel
+}
+
+// purgeChanged tells the CDN about the URLs that differ between the previous
+// and the new build output.
+func (s *Service) purgeChanged(ctx context.Context, oldDir, newDir string) {
+	files, err := changedOutputs(oldDir, newDir)
+	if err != nil {
+		log.Printf("cdn purge: %v", err)
+		return
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if s.isPrecompressedSibling(file) {
+			continue
+		}
+		paths = append(paths, s.publicPath(file))
+	}
+	if err := s.purger.Purge(ctx, paths); err != nil {
+		log.Printf("cdn purge: %v", err)
+		return
+	}
+	if len(paths) > 0 {
+		log.Printf("cdn purge: %d urls", len(paths))
+	}
+}
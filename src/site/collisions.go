@@ -0,0 +1,138 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrPathCollision rejects a new page whose route differs from an existing
+// one only in case, when rejectCollisions is set.
+var ErrPathCollision = errors.New("path differs from an existing page only in case")
+
+// Kinds of Collision.
+const (
+	// CollisionCase marks routes, or directories along them, that differ
+	// only in case. They overwrite each other on case-insensitive file
+	// systems and are served by the same live route.
+	CollisionCase = "case"
+	// CollisionTitle marks pages sharing a title, which makes search
+	// results and page lists ambiguous.
+	CollisionTitle = "title"
+)
+
+// Collision is a group of pages that clash with each other.
+type Collision struct {
+	Kind  string   `json:"kind"`
+	Paths []string `json:"paths"`
+	// Title is the shared title of a title collision.
+	Title string `json:"title,omitempty"`
+}
+
+// findCollisions reports the case and title collisions among docs.
+func findCollisions(docs []page) []Collision {
+	var collisions []Collision
+
+	// Every directory along a route must be spelled the same way by all
+	// pages below it, so compare each route prefix.
+	spellings := make(map[string]map[string]struct{})
+	for _, doc := range docs {
+		for _, prefix := range routePrefixes(doc.Route) {
+			key := strings.ToLower(prefix)
+			if spellings[key] == nil {
+				spellings[key] = make(map[string]struct{})
+			}
+			spellings[key][prefix] = struct{}{}
+		}
+	}
+	var keys []string
+	for key, variants := range spellings {
+		if len(variants) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// Report only the shallowest clash; deeper ones follow from it.
+		if shallower := routePrefixes(key); len(shallower) > 1 && len(spellings[shallower[len(shallower)-2]]) > 1 {
+			continue
+		}
+		paths := make([]string, 0, len(spellings[key]))
+		for variant := range spellings[key] {
+			paths = append(paths, variant)
+		}
+		sort.Strings(paths)
+		collisions = append(collisions, Collision{Kind: CollisionCase, Paths: paths})
+	}
+
+	byTitle := make(map[string][]page)
+	var titles []string
+	for _, doc := range docs {
+		key := strings.ToLower(doc.Title)
+		if _, ok := byTitle[key]; !ok {
+			titles = append(titles, key)
+		}
+		byTitle[key] = append(byTitle[key], doc)
+	}
+	sort.Strings(titles)
+	for _, key := range titles {
+		group := byTitle[key]
+		if len(group) < 2 {
+			continue
+		}
+		paths := make([]string, 0, len(group))
+		for _, doc := range group {
+			paths = append(paths, doc.Source)
+		}
+		sort.Strings(paths)
+		collisions = append(collisions, Collision{Kind: CollisionTitle, Paths: paths, Title: group[0].Title})
+	}
+	return collisions
+}
+
+// routePrefixes returns the routes of the directories along route and the
+// route itself, without trailing slashes: "/a/b/" gives "/a" and "/a/b".
+func routePrefixes(route string) []string {
+	trimmed := strings.Trim(route, "/")
+	if trimmed == "" {
+		return nil
+	}
+	segments := strings.Split(trimmed, "/")
+	prefixes := make([]string, len(segments))
+	for i := range segments {
+		prefixes[i] = "/" + strings.Join(segments[:i+1], "/")
+	}
+	return prefixes
+}
+
+// checkCaseCollision refuses a new page at rel whose route, or a directory
+// along it, is spelled differently in case by an existing page. The page at
+// except, such as the source of a rename, is not compared.
+func (s *Service) checkCaseCollision(ctx context.Context, rel, except string) error {
+	if !s.cfg.RejectCollisions {
+		return nil
+	}
+	files, err := s.documents.ListTracked(ctx)
+	if err != nil {
+		return err
+	}
+	wanted := routePrefixes(routeFromPath(rel, s.homeDoc))
+	for _, file := range files {
+		if file == except || !s.documents.IsDocument(file) || isLayoutFragment(file) {
+			continue
+		}
+		existing := routePrefixes(routeFromPath(file, s.homeDoc))
+		for i := 0; i < len(wanted) && i < len(existing); i++ {
+			if wanted[i] == existing[i] {
+				continue
+			}
+			if strings.EqualFold(wanted[i], existing[i]) {
+				return fmt.Errorf("%w: %s conflicts with %s", ErrPathCollision, wanted[i], existing[i])
+			}
+			break
+		}
+	}
+	return nil
+}
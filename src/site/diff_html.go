@@ -0,0 +1,211 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxInlineDiffTokens bounds the tokens of a changed line compared word by
+// word; longer lines only get their common prefix and suffix unmarked.
+const maxInlineDiffTokens = 400
+
+// diffSideLine is one side of a row of a side-by-side diff.
+type diffSideLine struct {
+	num  int
+	text string
+}
+
+// SideBySideDiff renders the unified diff of a single file, as returned by
+// Diff, into an HTML table with the old revision on the left and the new
+// one on the right. Changed lines are paired up, and the words that differ
+// between them are wrapped in <del> and <ins>. File headers are dropped.
+func SideBySideDiff(unified string) template.HTML {
+	var b strings.Builder
+	b.WriteString(`<table class="diff-side"><tbody>`)
+
+	var dels, adds []diffSideLine
+	oldNum, newNum := 0, 0
+	flush := func() {
+		for i := 0; i < len(dels) || i < len(adds); i++ {
+			switch {
+			case i < len(dels) && i < len(adds):
+				oldHTML, newHTML := inlineDiff(dels[i].text, adds[i].text)
+				writeDiffRow(&b, dels[i].num, "diff-del", oldHTML, adds[i].num, "diff-add", newHTML)
+			case i < len(dels):
+				writeDiffRow(&b, dels[i].num, "diff-del", html.EscapeString(dels[i].text), 0, "diff-empty", "")
+			default:
+				writeDiffRow(&b, 0, "diff-empty", "", adds[i].num, "diff-add", html.EscapeString(adds[i].text))
+			}
+		}
+		dels, adds = dels[:0], adds[:0]
+	}
+
+	inHunk := false
+	for _, line := range strings.Split(unified, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			flush()
+			inHunk = true
+			oldNum, newNum = parseHunkHeader(line)
+			fmt.Fprintf(&b, `<tr class="diff-hunk"><td colspan="4">%s</td></tr>`, html.EscapeString(line))
+			continue
+		}
+		if !inHunk {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "-"):
+			dels = append(dels, diffSideLine{num: oldNum, text: line[1:]})
+			oldNum++
+		case strings.HasPrefix(line, "+"):
+			adds = append(adds, diffSideLine{num: newNum, text: line[1:]})
+			newNum++
+		case strings.HasPrefix(line, " "):
+			flush()
+			text := html.EscapeString(line[1:])
+			writeDiffRow(&b, oldNum, "", text, newNum, "", text)
+			oldNum++
+			newNum++
+		case strings.HasPrefix(line, "diff "):
+			// A following file; Diff only covers one.
+			flush()
+			inHunk = false
+		}
+	}
+	flush()
+	b.WriteString(`</tbody></table>`)
+	return template.HTML(b.String())
+}
+
+func writeDiffRow(b *strings.Builder, oldNum int, oldClass, oldHTML string, newNum int, newClass, newHTML string) {
+	b.WriteString("<tr>")
+	for _, side := range []struct {
+		num         int
+		class, html string
+	}{{oldNum, oldClass, oldHTML}, {newNum, newClass, newHTML}} {
+		num := ""
+		if side.num > 0 {
+			num = strconv.Itoa(side.num)
+		}
+		fmt.Fprintf(b, `<td class="diff-num">%s</td><td class="%s">%s</td>`, num, strings.TrimSpace("diff-line "+side.class), side.html)
+	}
+	b.WriteString("</tr>")
+}
+
+// parseHunkHeader reads the first old and new line numbers of a hunk
+// header such as "@@ -12,7 +12,8 @@".
+func parseHunkHeader(line string) (int, int) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	start := func(field string) int {
+		field, _, _ = strings.Cut(field[1:], ",")
+		n, _ := strconv.Atoi(field)
+		return n
+	}
+	return start(fields[1]), start(fields[2])
+}
+
+// inlineDiff escapes a removed and an added line, wrapping the words only
+// one of them has in <del> and <ins>.
+func inlineDiff(oldLine, newLine string) (string, string) {
+	a, b := diffTokens(oldLine), diffTokens(newLine)
+	var keepA, keepB []bool
+	if len(a) <= maxInlineDiffTokens && len(b) <= maxInlineDiffTokens {
+		keepA, keepB = commonTokens(a, b)
+	} else {
+		keepA, keepB = make([]bool, len(a)), make([]bool, len(b))
+		prefix := 0
+		for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+			keepA[prefix], keepB[prefix] = true, true
+			prefix++
+		}
+		for i, j := len(a)-1, len(b)-1; i >= prefix && j >= prefix && a[i] == b[j]; i, j = i-1, j-1 {
+			keepA[i], keepB[j] = true, true
+		}
+	}
+	return markTokens(a, keepA, "del"), markTokens(b, keepB, "ins")
+}
+
+// diffTokens splits a line into runs of letters and digits, runs of spaces,
+// and single other characters.
+func diffTokens(line string) []string {
+	var tokens []string
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+	start, prev := 0, -1
+	for i, r := range line {
+		c := class(r)
+		if i > start && (c != prev || c == 0) {
+			tokens = append(tokens, line[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(line) {
+		tokens = append(tokens, line[start:])
+	}
+	return tokens
+}
+
+// commonTokens marks the tokens of a longest common subsequence of a and b.
+func commonTokens(a, b []string) ([]bool, []bool) {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	keepA, keepB := make([]bool, len(a)), make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			keepA[i], keepB[j] = true, true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return keepA, keepB
+}
+
+// markTokens escapes tokens, wrapping runs of unkept ones in tag.
+func markTokens(tokens []string, keep []bool, tag string) string {
+	var b strings.Builder
+	open := false
+	for i, token := range tokens {
+		if !keep[i] && !open {
+			b.WriteString("<" + tag + ">")
+			open = true
+		} else if keep[i] && open {
+			b.WriteString("</" + tag + ">")
+			open = false
+		}
+		b.WriteString(html.EscapeString(token))
+	}
+	if open {
+		b.WriteString("</" + tag + ">")
+	}
+	return b.String()
+}
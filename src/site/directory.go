@@ -1,7 +1,6 @@
 package site
 
 import (
-	"context"
 	"fmt"
 	"path"
 	"path/filepath"
@@ -46,26 +45,6 @@ func breadcrumbAnchor(segment string) string {
 	return anchor
 }
 
-func (s *Service) directoryEntries(ctx context.Context) ([]*templatex.DirectoryEntry, error) {
-	files, err := s.documents.ListTracked(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	tree := newDirectoryTree(s.cfg.BaseURL, s.homeDoc)
-	for _, file := range files {
-		if !isMarkdown(file) {
-			continue
-		}
-		if isLayoutFragment(file) {
-			continue
-		}
-		tree.add(file)
-	}
-
-	return tree.entries(), nil
-}
-
 type directoryTree struct {
 	base    string
 	homeDoc string
@@ -82,7 +61,9 @@ func newDirectoryTree(base, homeDoc string) *directoryTree {
 	}
 }
 
-func (t *directoryTree) add(relPath string) {
+// add places the document at relPath in the tree, listed under title, or a
+// title derived from its file name when title is empty.
+func (t *directoryTree) add(relPath, title string) {
 	slashed := filepath.ToSlash(strings.TrimSpace(relPath))
 	if slashed == "" {
 		return
@@ -105,8 +86,10 @@ func (t *directoryTree) add(relPath string) {
 				break
 			}
 
-			title := deriveTitle(segment)
-			baseSlug := normalizeAnchorCandidate(title)
+			baseSlug := normalizeAnchorCandidate(deriveTitle(segment))
+			if title == "" {
+				title = deriveTitle(segment)
+			}
 			fullSlug := anchorFromRoute(route)
 			id := t.allocateID(baseSlug)
 			aliases := collectAliases(baseSlug, id, fullSlug)
@@ -1,14 +1,17 @@
 package site
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"html/template"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 
+	"github.com/iedon/dn42-wiki-go/config"
 	"github.com/iedon/dn42-wiki-go/gitutil"
 	"github.com/iedon/dn42-wiki-go/renderer"
 	"github.com/iedon/dn42-wiki-go/templatex"
@@ -18,11 +21,15 @@ import (
 type DocumentStore struct {
 	repo     *gitutil.Repository
 	renderer *renderer.Renderer
+	cache    *renderCache
 	homeDoc  string
+	summary  config.SummaryConfig
+	// titleFromHeading titles pages after their first H1.
+	titleFromHeading bool
 }
 
-func newDocumentStore(repo *gitutil.Repository, renderer *renderer.Renderer, homeDoc string) *DocumentStore {
-	return &DocumentStore{repo: repo, renderer: renderer, homeDoc: ensureHomeDoc(homeDoc)}
+func newDocumentStore(repo *gitutil.Repository, renderer *renderer.Renderer, cache *renderCache, homeDoc string, summary config.SummaryConfig, titleFromHeading bool) *DocumentStore {
+	return &DocumentStore{repo: repo, renderer: renderer, cache: cache, homeDoc: ensureHomeDoc(homeDoc), summary: summary, titleFromHeading: titleFromHeading}
 }
 
 func (d *DocumentStore) ListTracked(ctx context.Context) ([]string, error) {
@@ -38,6 +45,12 @@ func (d *DocumentStore) Read(relPath string) ([]byte, error) {
 	return d.repo.ReadFile(relPath)
 }
 
+// ReadAt reads a document as of the given commit and returns the commit's
+// full hash.
+func (d *DocumentStore) ReadAt(ctx context.Context, relPath, revision string) ([]byte, string, error) {
+	return d.repo.ReadFileAt(ctx, relPath, revision)
+}
+
 func (d *DocumentStore) Write(relPath string, content []byte) error {
 	return d.repo.WriteFile(relPath, content)
 }
@@ -63,15 +76,32 @@ func (d *DocumentStore) Delete(relPath string) error {
 }
 
 func (d *DocumentStore) RenderDocument(ctx context.Context, relPath string) (page, error) {
+	return d.renderDocument(ctx, relPath, nil)
+}
+
+// renderDocument renders relPath, taking its last commit from history when
+// the map is provided and asking git for it otherwise.
+func (d *DocumentStore) renderDocument(ctx context.Context, relPath string, history map[string]gitutil.Commit) (page, error) {
 	data, err := d.repo.ReadFile(relPath)
 	if err != nil {
 		return page{}, fmt.Errorf("read %s: %w", relPath, err)
 	}
 
-	rendered, err := d.renderer.Render(data)
+	rendered, err := d.cache.Render(d.renderer, relPath, data)
 	if err != nil {
 		return page{}, fmt.Errorf("render %s: %w", relPath, err)
 	}
+	var pinned string
+	var newerThanPin bool
+	if revision := metaString(relPath, rendered.Meta, "pinned"); revision != "" {
+		if at, hash, err := d.renderAt(ctx, relPath, revision); err != nil {
+			log.Printf("render %s: pinned revision %s: %v, showing the current one", relPath, revision, err)
+		} else {
+			pinned = hash
+			newerThanPin = !bytes.Equal(at.HTML, rendered.HTML)
+			rendered = at
+		}
+	}
 
 	sections := make([]templatex.TOCEntry, 0, len(rendered.Headings))
 	for _, heading := range rendered.Headings {
@@ -79,7 +109,11 @@ func (d *DocumentStore) RenderDocument(ctx context.Context, relPath string) (pag
 	}
 
 	title := deriveTitle(relPath)
-	summary := summarize(rendered.PlainText)
+	if d.titleFromHeading {
+		if heading := firstHeading(rendered.Headings, 1); heading != "" {
+			title = heading
+		}
+	}
 
 	doc := page{
 		Source:     relPath,
@@ -88,22 +122,54 @@ func (d *DocumentStore) RenderDocument(ctx context.Context, relPath string) (pag
 		Title:      title,
 		HTML:       template.HTML(rendered.HTML),
 		Sections:   sections,
-		Summary:    summary,
 		PlainText:  rendered.PlainText,
+		Tags:       metaTags(rendered.Meta["tags"]),
+		Aliases:    metaAliases(rendered.Meta["aliases"], d.homeDoc),
+	}
+	applyFrontMatter(&doc, rendered.Meta)
+	doc.Pinned = pinned
+	doc.NewerThanPin = newerThanPin
+	doc.Summary = summarize(d.summary, doc.Description, rendered)
+	if query, err := parsePageQuery(rendered.Meta); err != nil {
+		log.Printf("render %s: %v, listing no pages", relPath, err)
+	} else {
+		doc.Query = query
 	}
-	if commits, _, err := d.repo.Log(ctx, relPath, 0, 1); err == nil && len(commits) > 0 {
+	if history != nil {
+		if commit, ok := history[filepath.ToSlash(relPath)]; ok {
+			doc.LastHash = commit.Hash
+			doc.LastMod = commit.CommittedAt
+		}
+	} else if commits, _, err := d.repo.Log(ctx, relPath, 0, 1); err == nil && len(commits) > 0 {
 		doc.LastHash = commits[0].Hash
 		doc.LastMod = commits[0].CommittedAt
 	}
 	return doc, nil
 }
 
-func (d *DocumentStore) RenderFragment(name string) (*renderer.RenderResult, error) {
-	bytes, err := d.repo.ReadFile(name)
+// renderAt renders relPath as of revision, for pages pinned to it, and
+// returns the revision's full hash.
+func (d *DocumentStore) renderAt(ctx context.Context, relPath, revision string) (*renderer.RenderResult, string, error) {
+	data, hash, err := d.repo.ReadFileAt(ctx, relPath, revision)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return d.renderer.Render(bytes)
+	rendered, err := d.cache.Render(d.renderer, relPath, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return rendered, hash, nil
+}
+
+// IsDocument reports whether a tracked file is rendered as a page: Markdown,
+// or an extension claimed by an external renderer.
+func (d *DocumentStore) IsDocument(relPath string) bool {
+	return isMarkdown(relPath) || d.renderer.HandlesFile(relPath)
+}
+
+// ReadFragment returns the raw source of a layout fragment.
+func (d *DocumentStore) ReadFragment(name string) ([]byte, error) {
+	return d.repo.ReadFile(name)
 }
 
 func (d *DocumentStore) Rename(ctx context.Context, oldPath, newPath string) error {
@@ -118,6 +184,15 @@ func (d *DocumentStore) Diff(ctx context.Context, relPath, from, to string) (str
 	return d.repo.Diff(ctx, relPath, from, to)
 }
 
+// DiffContent renders the diff from relPath at HEAD to content.
+func (d *DocumentStore) DiffContent(ctx context.Context, relPath string, content []byte) (string, error) {
+	return d.repo.DiffContent(ctx, relPath, content)
+}
+
+func (d *DocumentStore) Blame(ctx context.Context, relPath string) ([]gitutil.BlameLine, error) {
+	return d.repo.Blame(ctx, relPath)
+}
+
 func (d *DocumentStore) History(ctx context.Context, relPath string, page, pageSize int) ([]gitutil.Commit, bool, error) {
 	return d.repo.Log(ctx, relPath, page, pageSize)
 }
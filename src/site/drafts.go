@@ -0,0 +1,141 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/gitutil"
+)
+
+// maxDraftCommits bounds the commits a draft conflict lists.
+const maxDraftCommits = 20
+
+// DraftBase identifies the version of a page an editor draft started from,
+// as returned by PageVersion when the page was loaded. Both are empty for
+// drafts of new pages.
+type DraftBase struct {
+	Hash     string
+	Revision string
+}
+
+// DraftCheck compares a locally kept draft's base with the page as it is
+// now.
+type DraftCheck struct {
+	Path     string `json:"path"`
+	Exists   bool   `json:"exists"`
+	Hash     string `json:"hash,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	// Changed reports that the page is no longer the draft's base, so
+	// saving the draft would discard someone else's changes.
+	Changed  bool           `json:"changed"`
+	Conflict *DraftConflict `json:"conflict,omitempty"`
+}
+
+// DraftConflict describes what happened to a page since a draft's base.
+type DraftConflict struct {
+	BaseHash     string `json:"baseHash,omitempty"`
+	BaseRevision string `json:"baseRevision,omitempty"`
+	// Deleted reports that the page was removed.
+	Deleted bool `json:"deleted"`
+	// Created reports that a page was created where the draft would
+	// create one.
+	Created bool `json:"created"`
+	// Commits touching the page since the base revision, newest first.
+	Commits []gitutil.Commit `json:"commits"`
+	// Truncated reports that more commits than listed changed the page.
+	Truncated bool `json:"truncated"`
+}
+
+// PageVersion returns the content hash of a page and the last commit that
+// changed it, which editors keep as the base of their changes.
+func (s *Service) PageVersion(ctx context.Context, relPath string) (string, string, error) {
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
+		return "", "", err
+	}
+	content, err := s.documents.Read(rel)
+	if err != nil {
+		return "", "", err
+	}
+	revision, err := s.pageRevision(ctx, rel)
+	if err != nil {
+		return "", "", err
+	}
+	return ContentHash(content), revision, nil
+}
+
+// CheckDraft reports whether a page changed since the base of a draft, and
+// how, so clients can reconcile drafts kept while offline.
+func (s *Service) CheckDraft(ctx context.Context, relPath string, base DraftBase) (*DraftCheck, error) {
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
+		return nil, err
+	}
+
+	check := &DraftCheck{Path: rel}
+	content, err := s.documents.Read(rel)
+	switch {
+	case err == nil:
+		check.Exists = true
+		check.Hash = ContentHash(content)
+		if check.Revision, err = s.pageRevision(ctx, rel); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	newPage := base.Hash == "" && base.Revision == ""
+	switch {
+	case newPage:
+		check.Changed = check.Exists
+	case base.Hash != "":
+		check.Changed = base.Hash != check.Hash
+	default:
+		check.Changed = base.Revision != check.Revision
+	}
+	if !check.Changed {
+		return check, nil
+	}
+
+	conflict := &DraftConflict{
+		BaseHash:     base.Hash,
+		BaseRevision: base.Revision,
+		Deleted:      !newPage && !check.Exists,
+		Created:      newPage,
+		Commits:      []gitutil.Commit{},
+	}
+	commits, hasMore, err := s.documents.History(ctx, rel, 0, maxDraftCommits)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, commit := range commits {
+		if base.Revision != "" && commit.Hash == base.Revision {
+			found = true
+			break
+		}
+		conflict.Commits = append(conflict.Commits, commit)
+	}
+	conflict.Truncated = !found && hasMore
+	check.Conflict = conflict
+	return check, nil
+}
+
+// pageRevision returns the last commit that changed rel, or an empty
+// string for files not committed yet.
+func (s *Service) pageRevision(ctx context.Context, rel string) (string, error) {
+	commits, _, err := s.documents.History(ctx, rel, 0, 1)
+	if err != nil || len(commits) == 0 {
+		return "", err
+	}
+	return commits[0].Hash, nil
+}
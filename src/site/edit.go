@@ -1,51 +1,124 @@
 package site
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/iedon/dn42-wiki-go/config"
 	"github.com/iedon/dn42-wiki-go/gitutil"
+	"github.com/iedon/dn42-wiki-go/renderer"
 )
 
-// SavePage writes content to disk, stages, and commits the change.
-func (s *Service) SavePage(ctx context.Context, relPath string, content []byte, message, remoteAddr string) error {
+// SavePage writes content to disk, stages, and commits the change. With a
+// baseRevision, the commit content was edited from, changes committed to
+// the page since are merged with content, and SavePage reports whether
+// they were. Overlapping changes fail with a *MergeConflictError, and a
+// merge that leaves the page as it is with ErrUnchanged. Content is
+// formatted first when render.formatOnSave is set.
+func (s *Service) SavePage(ctx context.Context, relPath string, content []byte, baseRevision, message, remoteAddr string) (bool, error) {
+	return s.savePage(ctx, relPath, content, baseRevision, message, remoteAddr, s.cfg.Render.FormatOnSave)
+}
+
+func (s *Service) savePage(ctx context.Context, relPath string, content []byte, baseRevision, message, remoteAddr string, format bool) (bool, error) {
 	if !s.cfg.Editable {
-		return fmt.Errorf("editing disabled")
+		return false, fmt.Errorf("editing disabled")
 	}
 
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
 
 	if err := s.ensureRepositoryFresh(ctx); err != nil {
-		return err
+		return false, err
 	}
 
 	rel, err := normalizeRelPath(relPath, s.homeDoc)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if err := s.ensureRouteAccessible(rel); err != nil {
-		return err
+	if err := s.checkAccess(ctx, rel, config.ACLWrite); err != nil {
+		return false, err
+	}
+	merged := false
+	if baseRevision != "" {
+		if content, merged, err = s.mergeEdit(ctx, rel, content, baseRevision); err != nil {
+			return merged, err
+		}
+	}
+	if format {
+		// Pages the formatter cannot handle are kept as written.
+		if formatted, err := s.renderer.Format(content); err == nil {
+			content = formatted
+		} else if !errors.Is(err, renderer.ErrFormatChangesOutput) {
+			log.Printf("format %s: %v", rel, err)
+		}
 	}
 	exists, err := s.documents.Exists(rel)
 	if err != nil {
-		return err
+		return merged, err
 	}
 	if !exists && isReservedPath(rel) {
-		return fmt.Errorf("%w: %s", ErrReservedPath, rel)
+		return merged, fmt.Errorf("%w: %s", ErrReservedPath, rel)
 	}
-	if err := s.documents.Write(rel, content); err != nil {
-		return err
+	if !exists {
+		if err := s.checkCaseCollision(ctx, rel, ""); err != nil {
+			return merged, err
+		}
 	}
+	return merged, s.commitPage(ctx, rel, content, message, remoteAddr)
+}
+
+// PreviewSave renders the diff SavePage would commit for content, merged
+// with the changes since baseRevision and formatted as it would be, without
+// committing anything; the diff is empty when the save would change
+// nothing. It fails as SavePage would for paths that cannot be written, and
+// with a *MergeConflictError when the merge conflicts.
+func (s *Service) PreviewSave(ctx context.Context, relPath string, content []byte, baseRevision string) (string, bool, error) {
+	if !s.cfg.Editable {
+		return "", false, fmt.Errorf("editing disabled")
+	}
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return "", false, err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLWrite); err != nil {
+		return "", false, err
+	}
+	merged := false
+	if baseRevision != "" {
+		content, merged, err = s.mergeEdit(ctx, rel, content, baseRevision)
+		if errors.Is(err, ErrUnchanged) {
+			return "", merged, nil
+		}
+		if err != nil {
+			return "", merged, err
+		}
+	}
+	if s.cfg.Render.FormatOnSave {
+		if formatted, err := s.renderer.Format(content); err == nil {
+			content = formatted
+		}
+	}
+	diff, err := s.documents.DiffContent(ctx, rel, content)
+	return diff, merged, err
+}
+
+// commitPage writes and commits a page, pushes it and queues a rebuild. The
+// caller holds writeMu and has validated rel.
+func (s *Service) commitPage(ctx context.Context, rel string, content []byte, message, remoteAddr string) error {
 	finalMessage, err := s.composeCommitMessage(message, remoteAddr)
 	if err != nil {
 		return err
 	}
-	finalAuthor := s.composeCommitAuthor("")
+	if err := s.documents.Write(rel, content); err != nil {
+		return err
+	}
+	finalAuthor := s.composeCommitAuthor(ctx)
 	if err := s.documents.Commit(ctx, []string{rel}, finalMessage, finalAuthor); err != nil {
 		return err
 	}
@@ -56,6 +129,32 @@ func (s *Service) SavePage(ctx context.Context, relPath string, content []byte,
 	return nil
 }
 
+// RestorePage saves the content a page had at revision as a new commit,
+// which also brings back deleted pages. It returns the full hash of the
+// revision.
+func (s *Service) RestorePage(ctx context.Context, relPath, revision, remoteAddr string) (string, error) {
+	if !s.cfg.Editable {
+		return "", fmt.Errorf("editing disabled")
+	}
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLWrite); err != nil {
+		return "", err
+	}
+	content, hash, err := s.documents.ReadAt(ctx, rel, revision)
+	if err != nil {
+		return "", err
+	}
+	if current, err := s.documents.Read(rel); err == nil && bytes.Equal(current, content) {
+		return hash, ErrUnchanged
+	}
+	message := fmt.Sprintf("Restore page: `%s` to %s", s.commitLabel(rel), shortCommit(hash))
+	_, err = s.savePage(ctx, rel, content, "", message, remoteAddr, false)
+	return hash, err
+}
+
 // RenamePage moves a document and commits the rename.
 func (s *Service) RenamePage(ctx context.Context, oldPath, newPath, remoteAddr string) error {
 	if !s.cfg.Editable {
@@ -80,10 +179,10 @@ func (s *Service) RenamePage(ctx context.Context, oldPath, newPath, remoteAddr s
 	if err != nil {
 		return err
 	}
-	if err := s.ensureRouteAccessible(oldRel); err != nil {
+	if err := s.checkAccess(ctx, oldRel, config.ACLAdmin); err != nil {
 		return err
 	}
-	if err := s.ensureRouteAccessible(newRel); err != nil {
+	if err := s.checkAccess(ctx, newRel, config.ACLAdmin); err != nil {
 		return err
 	}
 	if oldRel == newRel {
@@ -92,6 +191,9 @@ func (s *Service) RenamePage(ctx context.Context, oldPath, newPath, remoteAddr s
 	if isReservedPath(newRel) {
 		return fmt.Errorf("%w: %s", ErrReservedPath, newRel)
 	}
+	if err := s.checkCaseCollision(ctx, newRel, oldRel); err != nil {
+		return err
+	}
 	if err := s.documents.Rename(ctx, oldRel, newRel); err != nil {
 		return err
 	}
@@ -101,7 +203,7 @@ func (s *Service) RenamePage(ctx context.Context, oldPath, newPath, remoteAddr s
 	if err != nil {
 		return err
 	}
-	if err := s.documents.Commit(ctx, []string{newRel}, finalMessage, s.composeCommitAuthor("")); err != nil {
+	if err := s.documents.Commit(ctx, []string{newRel}, finalMessage, s.composeCommitAuthor(ctx)); err != nil {
 		return err
 	}
 	if err := s.finalizeCommit(ctx); err != nil {
@@ -128,7 +230,7 @@ func (s *Service) DeletePage(ctx context.Context, relPath, remoteAddr string) er
 	if err != nil {
 		return err
 	}
-	if err := s.ensureRouteAccessible(rel); err != nil {
+	if err := s.checkAccess(ctx, rel, config.ACLAdmin); err != nil {
 		return err
 	}
 	if strings.EqualFold(rel, s.homeDoc) {
@@ -152,7 +254,7 @@ func (s *Service) DeletePage(ctx context.Context, relPath, remoteAddr string) er
 	if err != nil {
 		return err
 	}
-	if err := s.documents.Commit(ctx, []string{rel}, finalMessage, s.composeCommitAuthor("")); err != nil {
+	if err := s.documents.Commit(ctx, []string{rel}, finalMessage, s.composeCommitAuthor(ctx)); err != nil {
 		return err
 	}
 	if err := s.finalizeCommit(ctx); err != nil {
@@ -168,31 +270,55 @@ func (s *Service) History(ctx context.Context, relPath string, page, pageSize in
 	if err != nil {
 		return nil, false, err
 	}
-	if err := s.ensureRouteAccessible(rel); err != nil {
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
 		return nil, false, err
 	}
 	return s.documents.History(ctx, rel, page, pageSize)
 }
 
+// CheckRead reports whether the provided path may be read by the caller,
+// without touching the repository, so cached answers are only confirmed to
+// readers allowed to see them.
+func (s *Service) CheckRead(ctx context.Context, relPath string) error {
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return err
+	}
+	return s.checkAccess(ctx, rel, config.ACLRead)
+}
+
+// Blame attributes each line of the provided path to the commit that last
+// changed it.
+func (s *Service) Blame(ctx context.Context, relPath string) ([]gitutil.BlameLine, error) {
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
+		return nil, err
+	}
+	return s.documents.Blame(ctx, rel)
+}
+
 // Diff renders a diff between two commits for the provided path.
 func (s *Service) Diff(ctx context.Context, relPath, from, to string) (string, error) {
 	rel, err := normalizeRelPath(relPath, s.homeDoc)
 	if err != nil {
 		return "", err
 	}
-	if err := s.ensureRouteAccessible(rel); err != nil {
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
 		return "", err
 	}
 	return s.documents.Diff(ctx, rel, from, to)
 }
 
 // LoadRaw returns the underlying markdown content for editing purposes.
-func (s *Service) LoadRaw(relPath string) ([]byte, error) {
+func (s *Service) LoadRaw(ctx context.Context, relPath string) ([]byte, error) {
 	rel, err := normalizeRelPath(relPath, s.homeDoc)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.ensureRouteAccessible(rel); err != nil {
+	if err := s.checkAccess(ctx, rel, config.ACLRead); err != nil {
 		return nil, err
 	}
 	return s.documents.Read(rel)
@@ -234,11 +360,28 @@ func (s *Service) composeCommitMessage(raw, remote string) (string, error) {
 }
 
 // Use empty author to use default from config
-func (s *Service) composeCommitAuthor(author string) string {
-	trimmed := strings.TrimSpace(author)
-	if trimmed != "" {
+type commitAuthorKey struct{}
+
+// WithCommitAuthor makes the commits of edits made with ctx authored by
+// author, eg. a signed-in user, instead of git.author.
+func WithCommitAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, commitAuthorKey{}, author)
+}
+
+func commitAuthor(ctx context.Context) string {
+	author, _ := ctx.Value(commitAuthorKey{}).(string)
+	return author
+}
+
+// composeCommitAuthor picks the author of an edit: the signed-in user, else
+// the name the editor gave, else git.author.
+func (s *Service) composeCommitAuthor(ctx context.Context) string {
+	if trimmed := strings.TrimSpace(commitAuthor(ctx)); trimmed != "" {
 		return trimmed
 	}
+	if author := attribution(ctx); author != "" {
+		return author
+	}
 	return strings.TrimSpace(s.cfg.Git.Author)
 }
 
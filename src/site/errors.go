@@ -6,4 +6,7 @@ var (
 	// ErrRepositoryBehind signals that the local clone is stale vs the remote.
 	ErrRepositoryBehind  = errors.New("repository has newer remote revisions")
 	ErrProtectedDocument = errors.New("document is protected")
+	// ErrUnchanged rejects a restore, or a merged save, that would leave a
+	// page with the content it already has.
+	ErrUnchanged = errors.New("page already has this content")
 )
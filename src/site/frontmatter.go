@@ -0,0 +1,64 @@
+package site
+
+import (
+	"log"
+	"strings"
+)
+
+// applyFrontMatter lets the front matter of a page override what is derived
+// from its file: title replaces the name-based title, description the meta
+// description, "toc: false" hides the table of contents, and "draft: true"
+// keeps the page out of search and listings and asks robots not to index it.
+func applyFrontMatter(doc *page, meta map[string]any) {
+	if title := metaString(doc.Source, meta, "title"); title != "" {
+		doc.Title = title
+	}
+	doc.Description = metaString(doc.Source, meta, "description")
+	if !metaBool(doc.Source, meta, "toc", true) {
+		doc.Sections = nil
+	}
+	doc.Draft = metaBool(doc.Source, meta, "draft", false)
+}
+
+// metaString reads a single line of text from the front matter.
+func metaString(source string, meta map[string]any, key string) string {
+	raw, ok := meta[key]
+	if !ok || raw == nil {
+		return ""
+	}
+	value, ok := raw.(string)
+	if !ok {
+		log.Printf("render %s: front matter %s must be a string, ignored", source, key)
+		return ""
+	}
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// metaBool reads a flag from the front matter, falling back when it is
+// missing or not a boolean.
+func metaBool(source string, meta map[string]any, key string, fallback bool) bool {
+	raw, ok := meta[key]
+	if !ok || raw == nil {
+		return fallback
+	}
+	value, ok := raw.(bool)
+	if !ok {
+		log.Printf("render %s: front matter %s must be true or false, ignored", source, key)
+		return fallback
+	}
+	return value
+}
+
+// draftRobots adds noindex to the robots directives of a draft page.
+func draftRobots(directives string) string {
+	for _, directive := range strings.Split(directives, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex", "none":
+			return directives
+		}
+	}
+	if strings.TrimSpace(directives) == "" {
+		return "noindex"
+	}
+	return "noindex, " + directives
+}
@@ -0,0 +1,135 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Checks reported by Fsck.
+const (
+	FsckRender         = "render"
+	FsckBrokenLink     = "broken-link"
+	FsckBrokenAnchor   = "broken-anchor"
+	FsckOrphan         = "orphan"
+	FsckReservedName   = "reserved-name"
+	FsckCaseCollision  = "case-collision"
+	FsckDuplicateTitle = "duplicate-title"
+	FsckOversized      = "oversized"
+)
+
+// FsckIssue is a single problem found in the repository.
+type FsckIssue struct {
+	Check  string `json:"check"`
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+}
+
+// FsckReport is the result of checking the repository.
+type FsckReport struct {
+	Commit string         `json:"commit"`
+	Files  int            `json:"files"`
+	Pages  int            `json:"pages"`
+	Counts map[string]int `json:"counts"`
+	Issues []FsckIssue    `json:"issues"`
+}
+
+// FsckOptions tunes Fsck.
+type FsckOptions struct {
+	// MaxFileBytes reports tracked files above this size; 0 skips the scan.
+	MaxFileBytes int64
+}
+
+func (r *FsckReport) add(check, path, format string, args ...any) {
+	r.Issues = append(r.Issues, FsckIssue{Check: check, Path: path, Detail: fmt.Sprintf(format, args...)})
+	r.Counts[check]++
+}
+
+// Fsck checks the checked out repository for problems that break pages or
+// confuse readers: documents that fail to render, broken links and anchors,
+// pages not reachable from the home page or a sidebar, pages named like generated routes, routes that
+// differ only in case, pages sharing a title, and oversized files. It reads the working tree only.
+func (s *Service) Fsck(ctx context.Context, opts FsckOptions) (*FsckReport, error) {
+	files, err := s.documents.ListTracked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &FsckReport{Files: len(files), Counts: map[string]int{}, Issues: []FsckIssue{}}
+	if head, err := s.repo.Head(ctx); err == nil {
+		report.Commit = head
+	}
+
+	tracked := make(map[string]struct{}, len(files))
+	var docs, fragments []page
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tracked[file] = struct{}{}
+		if opts.MaxFileBytes > 0 {
+			if info, err := os.Stat(filepath.Join(s.documents.RepoDir(), filepath.FromSlash(file))); err == nil && info.Size() > opts.MaxFileBytes {
+				report.add(FsckOversized, file, "%d bytes exceeds the %d byte limit", info.Size(), opts.MaxFileBytes)
+			}
+		}
+		if !s.documents.IsDocument(file) {
+			continue
+		}
+		doc, err := s.documents.RenderDocument(ctx, file)
+		if err != nil {
+			report.add(FsckRender, file, "%s", strings.TrimPrefix(err.Error(), "render "+file+": "))
+			continue
+		}
+		if isLayoutFragment(file) {
+			fragments = append(fragments, doc)
+			continue
+		}
+		if isReservedPath(file) {
+			report.add(FsckReservedName, file, "route %s is reserved for a generated page", doc.Route)
+		}
+		docs = append(docs, doc)
+	}
+	report.Pages = len(docs)
+
+	titles := make(map[string]string, len(docs))
+	anchors := make(map[string]map[string]struct{}, len(docs))
+	for _, doc := range docs {
+		titles[doc.Route] = doc.Title
+		anchors[doc.Route] = pageAnchors(doc.HTML)
+	}
+
+	sidebars := make(map[string]template.HTML)
+	for _, fragment := range fragments {
+		if path.Base(fragment.Source) == "_Sidebar.md" {
+			sidebars[path.Dir(fragment.Source)] = fragment.HTML
+		}
+	}
+	for _, doc := range docs {
+		for _, match := range hrefAttr.FindAllStringSubmatch(string(doc.HTML), -1) {
+			href := html.UnescapeString(match[1])
+			if !s.linkResolves(href, titles, tracked) {
+				report.add(FsckBrokenLink, doc.Source, "%s", href)
+				continue
+			}
+			if !s.anchorResolves(href, doc.Route, titles, anchors) {
+				report.add(FsckBrokenAnchor, doc.Source, "%s", href)
+			}
+		}
+	}
+	for _, doc := range s.findOrphans(docs, sidebars) {
+		report.add(FsckOrphan, doc.Source, "%s is not reachable from the home page or a sidebar", doc.Route)
+	}
+	for _, collision := range findCollisions(docs) {
+		switch collision.Kind {
+		case CollisionCase:
+			report.add(FsckCaseCollision, collision.Paths[0], "routes differ only in case: %s", strings.Join(collision.Paths, ", "))
+		case CollisionTitle:
+			report.add(FsckDuplicateTitle, collision.Paths[0], "title %q is shared with %s", collision.Title, strings.Join(collision.Paths[1:], ", "))
+		}
+	}
+	return report, nil
+}
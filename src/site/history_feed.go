@@ -0,0 +1,124 @@
+package site
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+// HistoryFeedSuffix ends the URL of a page's history feed, eg.
+// /Howto/Peering/history.atom.
+const HistoryFeedSuffix = "/history.atom"
+
+// historyFeedEntries is the number of commits listed in a history feed.
+const historyFeedEntries = 30
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Link    atomLink   `xml:"link"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// historyFeedURL returns the path of the history feed of a page route.
+func (s *Service) historyFeedURL(route string) string {
+	return strings.TrimSuffix(s.pathWithBase(route), "/") + HistoryFeedSuffix
+}
+
+// HistoryFeed renders an Atom feed of the commits touching the page whose
+// feed URL is requestPath. origin is the scheme and host the feed is served
+// from, used to build absolute links.
+func (s *Service) HistoryFeed(ctx context.Context, requestPath, origin string) ([]byte, error) {
+	pagePath, ok := strings.CutSuffix(requestPath, HistoryFeedSuffix)
+	if !ok {
+		return nil, ErrInvalidPath
+	}
+	info, ok := s.analyzeRequestPath(pagePath)
+	if !ok || info.relative == directoryPageRoute || (info.relative == recentPageRoute && s.recentPageEnabled()) {
+		return nil, ErrInvalidPath
+	}
+	rel, route, _, err := info.documentTargets(s.homeDoc)
+	if err != nil {
+		return nil, err
+	}
+	if s.routeIsPrivate(route) {
+		return nil, ErrForbiddenRoute
+	}
+	if err := s.checkRouteACL(ctx, route, config.ACLRead); err != nil {
+		return nil, err
+	}
+	exists, err := s.documents.Exists(rel)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	commits, _, err := s.documents.History(ctx, rel, 0, historyFeedEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	title := s.commitLabel(rel)
+	if nav := s.snapshot.Load(); nav != nil && nav.Titles[route] != "" {
+		title = nav.Titles[route]
+	}
+	origin = strings.TrimSuffix(origin, "/")
+	pageURL := origin + s.pathWithBase(route)
+	feedURL := origin + s.historyFeedURL(route)
+	feed := atomFeed{
+		ID:    feedURL,
+		Title: "History of " + title + " - " + s.cfg.SiteName,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: feedURL},
+			{Rel: "alternate", Type: "text/html", Href: pageURL},
+		},
+		Entries: make([]atomEntry, 0, len(commits)),
+	}
+	updated := time.Unix(0, 0)
+	for _, commit := range commits {
+		if commit.CommittedAt.After(updated) {
+			updated = commit.CommittedAt
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      "urn:git:" + commit.Hash,
+			Title:   commit.Message,
+			Updated: commit.CommittedAt.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: commit.Author},
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: pageURL},
+			Summary: shortCommit(commit.Hash) + " by " + commit.Author,
+		})
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
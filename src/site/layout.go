@@ -2,42 +2,101 @@ package site
 
 import (
 	"html/template"
+	"path"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
-// LayoutSnapshot holds the cached header/footer/sidebar fragments.
+// LayoutSnapshot holds the root header/footer/sidebar fragments.
 type LayoutSnapshot struct {
 	Header       template.HTML
 	Footer       template.HTML
 	ServerFooter template.HTML
 	Sidebar      template.HTML
-	LoadedAt     time.Time
+	// Head and BodyEnd are injected at the end of <head> and <body>.
+	Head     template.HTML
+	BodyEnd  template.HTML
+	LoadedAt time.Time
 }
 
+// LayoutCache keeps the rendered layout fragments of every directory. Each
+// rendering remembers the git blob it came from, so a refresh only renders
+// fragments whose content changed, and page renders never read fragment
+// files.
 type LayoutCache struct {
 	mu       sync.RWMutex
 	snapshot LayoutSnapshot
+	// dirs maps a directory, "." for the root, to its fragments by file name.
+	dirs map[string]map[string]layoutFragment
+}
+
+// layoutFragment is the rendering of a fragment file at a given blob.
+type layoutFragment struct {
+	blob string
+	html template.HTML
 }
 
 func newLayoutCache() *LayoutCache {
-	return &LayoutCache{}
+	return &LayoutCache{dirs: make(map[string]map[string]layoutFragment)}
+}
+
+// fragment returns the cached rendering of the fragment name in dir.
+func (c *LayoutCache) fragment(dir, name string) (layoutFragment, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.dirs[dir][name]
+	return entry, ok
 }
 
-func (c *LayoutCache) Update(header, footer, serverFooter, sidebar template.HTML) {
+// replace swaps in the fragments found by a refresh. configured holds the
+// parts that come from the configuration rather than the repository.
+func (c *LayoutCache) replace(dirs map[string]map[string]layoutFragment, configured LayoutSnapshot) {
+	root := dirs["."]
 	c.mu.Lock()
+	c.dirs = dirs
 	c.snapshot = LayoutSnapshot{
-		Header:       header,
-		Footer:       footer,
-		ServerFooter: serverFooter,
-		Sidebar:      sidebar,
+		Header:       root["_Header.md"].html,
+		Footer:       root["_Footer.md"].html,
+		ServerFooter: configured.ServerFooter,
+		Sidebar:      root["_Sidebar.md"].html,
+		Head:         configured.Head + root["_Head.html"].html,
+		BodyEnd:      configured.BodyEnd + root["_BodyEnd.html"].html,
 		LoadedAt:     time.Now(),
 	}
 	c.mu.Unlock()
 }
 
+// Nested returns the renderings of the fragment name in the directories
+// above the page at rel, nearest first. The root fragment is not included.
+func (c *LayoutCache) Nested(name, rel string) []template.HTML {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var found []template.HTML
+	for dir := path.Dir(filepath.ToSlash(rel)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if entry, ok := c.dirs[dir][name]; ok {
+			found = append(found, entry.html)
+		}
+	}
+	return found
+}
+
 func (c *LayoutCache) Snapshot() LayoutSnapshot {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.snapshot
 }
+
+// Fragments returns the renderings of the fragment name by directory, "."
+// for the root.
+func (c *LayoutCache) Fragments(name string) map[string]template.HTML {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	found := make(map[string]template.HTML)
+	for dir, fragments := range c.dirs {
+		if entry, ok := fragments[name]; ok {
+			found[dir] = entry.html
+		}
+	}
+	return found
+}
@@ -0,0 +1,147 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Labels of the sides of a merge, as they appear in conflict markers.
+const (
+	mergeLabelCurrent = "current"
+	mergeLabelBase    = "base"
+	mergeLabelYours   = "yours"
+)
+
+// MergeConflictError rejects a save whose changes overlap changes made to
+// the page since the revision the editor loaded.
+type MergeConflictError struct {
+	Path         string `json:"path"`
+	BaseRevision string `json:"baseRevision"`
+	// Revision is the last commit that changed the page.
+	Revision string `json:"revision,omitempty"`
+	// Deleted reports that the page was removed since the base revision.
+	Deleted bool           `json:"deleted"`
+	Hunks   []ConflictHunk `json:"hunks"`
+	// Merged is the merge result with diff3 style conflict markers.
+	Merged string `json:"merged,omitempty"`
+}
+
+func (e *MergeConflictError) Error() string {
+	if e.Deleted {
+		return fmt.Sprintf("%s was deleted since %s", e.Path, shortCommit(e.BaseRevision))
+	}
+	return fmt.Sprintf("%s changed since %s and %d change(s) conflict with yours", e.Path, shortCommit(e.BaseRevision), len(e.Hunks))
+}
+
+// ConflictHunk is a region of a page changed both by a save and by commits
+// made since its base revision.
+type ConflictHunk struct {
+	// Line is where the region starts in the current page, from 1.
+	Line    int    `json:"line"`
+	Current string `json:"current"`
+	Base    string `json:"base"`
+	Yours   string `json:"yours"`
+}
+
+// mergeEdit brings content, edited from the page as of baseRevision, up to
+// date with commits made to the page since, merging the changes on both
+// sides. It reports whether a merge took place, and returns a
+// *MergeConflictError when the changes overlap.
+func (s *Service) mergeEdit(ctx context.Context, rel string, content []byte, baseRevision string) ([]byte, bool, error) {
+	revision, err := s.pageRevision(ctx, rel)
+	if err != nil {
+		return nil, false, err
+	}
+	if revision == baseRevision {
+		return content, false, nil
+	}
+	base, baseHash, err := s.documents.ReadAt(ctx, rel, baseRevision)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	if baseHash == revision {
+		return content, false, nil
+	}
+	current, err := s.documents.Read(rel)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, &MergeConflictError{Path: rel, BaseRevision: baseHash, Deleted: true, Hunks: []ConflictHunk{}}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	labels := [3]string{mergeLabelCurrent, mergeLabelBase, mergeLabelYours}
+	merged, conflicts, err := s.repo.MergeFile(ctx, current, base, content, labels)
+	if err != nil {
+		return nil, false, err
+	}
+	if conflicts > 0 {
+		return nil, false, &MergeConflictError{
+			Path:         rel,
+			BaseRevision: baseHash,
+			Revision:     revision,
+			Hunks:        parseConflictHunks(merged),
+			Merged:       string(merged),
+		}
+	}
+	if bytes.Equal(merged, current) {
+		return merged, true, ErrUnchanged
+	}
+	return merged, true, nil
+}
+
+// parseConflictHunks reads the conflicts marked in the output of a diff3
+// style merge.
+func parseConflictHunks(merged []byte) []ConflictHunk {
+	const (
+		outside = iota
+		inCurrent
+		inBase
+		inYours
+	)
+	hunks := []ConflictHunk{}
+	var current, base, yours []string
+	state, line := outside, 1
+	for _, text := range strings.SplitAfter(string(merged), "\n") {
+		marker := strings.TrimRight(text, "\r\n")
+		switch {
+		case state == outside && marker == "<<<<<<< "+mergeLabelCurrent:
+			state = inCurrent
+			current, base, yours = nil, nil, nil
+			continue
+		case state == inCurrent && marker == "||||||| "+mergeLabelBase:
+			state = inBase
+			continue
+		case (state == inCurrent || state == inBase) && marker == "=======":
+			state = inYours
+			continue
+		case state == inYours && marker == ">>>>>>> "+mergeLabelYours:
+			hunks = append(hunks, ConflictHunk{
+				Line:    line,
+				Current: strings.Join(current, ""),
+				Base:    strings.Join(base, ""),
+				Yours:   strings.Join(yours, ""),
+			})
+			line += len(current)
+			state = outside
+			continue
+		}
+		switch state {
+		case outside:
+			if text != "" {
+				line++
+			}
+		case inCurrent:
+			current = append(current, text)
+		case inBase:
+			base = append(base, text)
+		case inYours:
+			yours = append(yours, text)
+		}
+	}
+	return hunks
+}
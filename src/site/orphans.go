@@ -0,0 +1,94 @@
+package site
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// findOrphans follows links from the home page and the sidebars shown with
+// each page it reaches, and returns the pages never reached, sorted by
+// route. sidebars maps directories, "." for the root, to their sidebar.
+// Drafts are not reported, as they are unlisted on purpose.
+func (s *Service) findOrphans(docs []page, sidebars map[string]template.HTML) []page {
+	byRoute := make(map[string]page, len(docs))
+	titles := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		byRoute[doc.Route] = doc
+		titles[doc.Route] = doc.Title
+	}
+
+	reached := map[string]bool{"/": true}
+	queue := []string{"/"}
+	shownSidebars := make(map[string]bool)
+	follow := func(from string, body template.HTML) {
+		for _, match := range hrefAttr.FindAllStringSubmatch(string(body), -1) {
+			route, ok := s.resolvePageLink(from, html.UnescapeString(match[1]), titles)
+			if ok && !reached[route] {
+				reached[route] = true
+				queue = append(queue, route)
+			}
+		}
+	}
+	// The root sidebar is shown even when there is no home page.
+	if body, ok := sidebars["."]; ok {
+		shownSidebars["."] = true
+		follow("/", body)
+	}
+	for len(queue) > 0 {
+		route := queue[0]
+		queue = queue[1:]
+		doc, ok := byRoute[route]
+		if !ok {
+			continue
+		}
+		follow(route, doc.HTML)
+		for dir := path.Dir(doc.Source); ; dir = path.Dir(dir) {
+			if body, ok := sidebars[dir]; ok && !shownSidebars[dir] {
+				shownSidebars[dir] = true
+				follow(directoryRoute(dir), body)
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+
+	var orphans []page
+	for _, doc := range docs {
+		if !reached[doc.Route] && !doc.Draft {
+			orphans = append(orphans, doc)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Route < orphans[j].Route })
+	return orphans
+}
+
+// directoryRoute returns the route of a directory, "." for the root.
+func directoryRoute(dir string) string {
+	if dir == "." || dir == "" {
+		return "/"
+	}
+	return "/" + dir + "/"
+}
+
+// resolvePageLink resolves a link found on the page at route, relative ones
+// included, to the route of a known document.
+func (s *Service) resolvePageLink(route, href string, titles map[string]string) (string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.Scheme != "" || ref.Host != "" || ref.Path == "" {
+		return "", false
+	}
+	pageURL := resolveDirectoryURL(s.cfg.BaseURL, route)
+	if strings.HasSuffix(route, "/") && !strings.HasSuffix(pageURL, "/") {
+		pageURL += "/"
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", false
+	}
+	return s.linkedRoute(base.ResolveReference(ref).EscapedPath(), titles)
+}
@@ -0,0 +1,119 @@
+package site
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// OutputFile describes a file in the active build output.
+type OutputFile struct {
+	Path        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	// ETag is a validator derived from the commit the output was built from,
+	// empty when serving output of an unknown build.
+	ETag string
+}
+
+// outputIndex is a manifest of the output directory captured after each build
+// so serving a request does not need to stat the filesystem.
+type outputIndex struct {
+	files  map[string]OutputFile
+	commit string
+	built  time.Time
+}
+
+type outputIndexHolder struct {
+	current atomic.Pointer[outputIndex]
+}
+
+func scanOutput(dir, commit string) (*outputIndex, error) {
+	index := &outputIndex{files: make(map[string]OutputFile), commit: commit, built: time.Now()}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		file := OutputFile{
+			Path:        p,
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			ContentType: mime.TypeByExtension(strings.ToLower(filepath.Ext(p))),
+		}
+		if commit != "" {
+			// Size and time tell apart builds of one commit with different
+			// templates or settings, eg. after an upgrade.
+			file.ETag = fmt.Sprintf("%s-%x-%x", shortCommit(commit), file.Size, file.ModTime.UnixNano())
+		}
+		index.files[filepath.ToSlash(rel)] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// refreshOutputIndex rescans the active output directory, built from commit.
+func (s *Service) refreshOutputIndex(commit string) error {
+	index, err := scanOutput(s.cfg.OutputDir, commit)
+	if err != nil {
+		s.outputIndex.current.Store(nil)
+		return err
+	}
+	s.outputIndex.current.Store(index)
+	return nil
+}
+
+// ActiveBuild reports the commit the active output was built from and when
+// it went live. The commit is empty before the first build.
+func (s *Service) ActiveBuild() (string, time.Time) {
+	if index := s.outputIndex.current.Load(); index != nil {
+		return index.commit, index.built
+	}
+	return "", time.Time{}
+}
+
+// LookupOutput resolves a path inside the output directory using the manifest
+// of the last build, falling back to the filesystem before the first build
+// (eg. when serving stale output).
+func (s *Service) LookupOutput(target string) (OutputFile, bool) {
+	if index := s.outputIndex.current.Load(); index != nil {
+		rel, err := filepath.Rel(s.cfg.OutputDir, target)
+		if err != nil {
+			return OutputFile{}, false
+		}
+		file, ok := index.files[filepath.ToSlash(rel)]
+		return file, ok
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return OutputFile{}, false
+	}
+	return OutputFile{
+		Path:        target,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(strings.ToLower(filepath.Ext(target))),
+	}, true
+}
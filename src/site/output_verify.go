@@ -0,0 +1,247 @@
+package site
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// outputVerifyInterval is how often the active output is checked against its
+// manifest between builds.
+const outputVerifyInterval = time.Hour
+
+// maxVerifyPaths bounds the paths an output verification lists.
+const maxVerifyPaths = 20
+
+// outputManifest records the files a build wrote, next to the output
+// directory, so later checks can tell whether something else changed them.
+type outputManifest struct {
+	Commit  string                         `json:"commit"`
+	BuiltAt time.Time                      `json:"builtAt"`
+	Files   map[string]outputManifestEntry `json:"files"`
+}
+
+type outputManifestEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// OutputVerification is the result of checking the output directory against
+// the manifest of the build that wrote it.
+type OutputVerification struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Commit    string    `json:"commit,omitempty"`
+	Files     int       `json:"files"`
+	Missing   int       `json:"missing"`
+	Modified  int       `json:"modified"`
+	// Paths lists some of the missing and modified files.
+	Paths []string `json:"paths,omitempty"`
+	// Error is set when the manifest could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether every file in the manifest was found unchanged.
+func (v *OutputVerification) OK() bool {
+	return v.Error == "" && v.Missing == 0 && v.Modified == 0
+}
+
+// OutputVerification returns the last check of the output directory, or
+// nil before the first one.
+func (s *Service) OutputVerification() *OutputVerification {
+	return s.outputCheck.Load()
+}
+
+func (s *Service) outputManifestPath() string {
+	return filepath.Clean(s.cfg.OutputDir) + ".manifest.json"
+}
+
+// hashOutput fingerprints every regular file below dir.
+func hashOutput(dir string) (map[string]outputManifestEntry, error) {
+	files := make(map[string]outputManifestEntry)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		entry, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = entry
+		return nil
+	})
+	return files, err
+}
+
+func hashFile(name string) (outputManifestEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return outputManifestEntry{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return outputManifestEntry{}, err
+	}
+	return outputManifestEntry{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// writeOutputManifest replaces the manifest of the active output.
+func (s *Service) writeOutputManifest(commit string, files map[string]outputManifestEntry) error {
+	data, err := json.Marshal(outputManifest{Commit: commit, BuiltAt: time.Now().UTC(), Files: files})
+	if err != nil {
+		return err
+	}
+	target := s.outputManifestPath()
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".__manifest-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// checkOutput hashes every file in the manifest of the active output and
+// compares it with the recorded content.
+func (s *Service) checkOutput() *OutputVerification {
+	check := &OutputVerification{CheckedAt: time.Now().UTC()}
+	data, err := os.ReadFile(s.outputManifestPath())
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	var manifest outputManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		check.Error = fmt.Sprintf("invalid manifest: %v", err)
+		return check
+	}
+	check.Commit = manifest.Commit
+	s.compareOutput(check, manifest.Files, func(name string, want outputManifestEntry) (bool, error) {
+		got, err := hashFile(name)
+		return got == want, err
+	})
+	return check
+}
+
+// compareOutput counts the manifest files that same cannot find or finds
+// changed in the output directory.
+func (s *Service) compareOutput(check *OutputVerification, files map[string]outputManifestEntry, same func(name string, want outputManifestEntry) (bool, error)) {
+	check.Files = len(files)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		ok, err := same(filepath.Join(s.cfg.OutputDir, filepath.FromSlash(name)), files[name])
+		switch {
+		case err != nil:
+			check.Missing++
+		case !ok:
+			check.Modified++
+		default:
+			continue
+		}
+		if len(check.Paths) < maxVerifyPaths {
+			check.Paths = append(check.Paths, name)
+		}
+	}
+}
+
+// verifyStaleOutput checks the output left by an earlier run before it is
+// served or reused. Output without a manifest predates verification and is
+// left alone.
+func (s *Service) verifyStaleOutput() {
+	if _, err := os.Stat(s.outputManifestPath()); err != nil {
+		return
+	}
+	check := s.checkOutput()
+	s.outputCheck.Store(check)
+	if check.OK() {
+		log.Printf("verify output: %d files match the manifest of %s", check.Files, shortCommit(check.Commit))
+		return
+	}
+	s.outputSuspect.Store(true)
+	log.Printf("verify output: %s, not serving or reusing it", describeVerification(check))
+}
+
+// outputReusable reports whether a build may carry parts of the active
+// output over, that is, whether its last check found nothing changed.
+func (s *Service) outputReusable() bool {
+	return !s.outputSuspect.Load()
+}
+
+// verifyBuiltOutput checks the output right after a build went live against
+// the manifest the build computed. The files were hashed moments before, so
+// only their presence and size are compared. Failures are reported, and the
+// next build starts from scratch.
+func (s *Service) verifyBuiltOutput(commit string, files map[string]outputManifestEntry) {
+	check := &OutputVerification{CheckedAt: time.Now().UTC(), Commit: commit}
+	s.compareOutput(check, files, func(name string, want outputManifestEntry) (bool, error) {
+		info, err := os.Stat(name)
+		if err != nil {
+			return false, err
+		}
+		return info.Mode().IsRegular() && info.Size() == want.Size, nil
+	})
+	s.outputCheck.Store(check)
+	if check.OK() {
+		s.outputSuspect.Store(false)
+		return
+	}
+	s.outputSuspect.Store(true)
+	log.Printf("verify output: %s right after the build", describeVerification(check))
+}
+
+// watchOutput checks the active output every outputVerifyInterval until ctx
+// ends, and rebuilds it in full when it no longer matches its manifest.
+func (s *Service) watchOutput(ctx context.Context) {
+	ticker := time.NewTicker(outputVerifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := os.Stat(s.outputManifestPath()); err != nil {
+			continue
+		}
+		previous := s.outputCheck.Load()
+		check := s.checkOutput()
+		// A build that went live meanwhile has checked its own output.
+		if !s.outputCheck.CompareAndSwap(previous, check) || check.OK() {
+			continue
+		}
+		s.outputSuspect.Store(true)
+		log.Printf("verify output: %s, rebuilding", describeVerification(check))
+		s.triggerRebuild()
+	}
+}
+
+func describeVerification(check *OutputVerification) string {
+	if check.Error != "" {
+		return check.Error
+	}
+	return fmt.Sprintf("%d of %d files missing and %d modified (%v)", check.Missing, check.Files, check.Modified, check.Paths)
+}
@@ -15,7 +15,18 @@ type page struct {
 	HTML       template.HTML
 	Sections   []templatex.TOCEntry
 	Summary    string
-	PlainText  string
-	LastHash   string
-	LastMod    time.Time
+	// Description is the meta description set in the front matter.
+	Description string
+	PlainText   string
+	LastHash    string
+	LastMod     time.Time
+	Tags        []string
+	Aliases     []string
+	Query       *pageQuery
+	// Draft pages are built but left out of search and page listings.
+	Draft bool
+	// Pinned is the commit a page pinned in its front matter is shown as of,
+	// and NewerThanPin tells the page changed since.
+	Pinned       string
+	NewerThanPin bool
 }
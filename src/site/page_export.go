@@ -0,0 +1,80 @@
+package site
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+// PageHeading is a table of contents entry of an exported page.
+type PageHeading struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Level int    `json:"level"`
+}
+
+// PageExport is the machine-readable form of a document, served to clients
+// that ask for Markdown or JSON instead of HTML.
+type PageExport struct {
+	Path         string        `json:"path"`
+	Route        string        `json:"route"`
+	Title        string        `json:"title"`
+	Summary      string        `json:"summary"`
+	HTML         string        `json:"html"`
+	Headings     []PageHeading `json:"headings"`
+	LastCommit   string        `json:"lastCommit,omitempty"`
+	LastModified *time.Time    `json:"lastModified,omitempty"`
+	Markdown     []byte        `json:"-"`
+}
+
+// ExportPage resolves a page request path to its Markdown document. Routes
+// without a Markdown source, such as the directory page, report
+// os.ErrNotExist.
+func (s *Service) ExportPage(ctx context.Context, requestPath string) (*PageExport, error) {
+	info, ok := s.analyzeRequestPath(requestPath)
+	if !ok {
+		return nil, ErrInvalidPath
+	}
+	if info.relative == directoryPageRoute || (info.relative == recentPageRoute && s.recentPageEnabled()) {
+		return nil, os.ErrNotExist
+	}
+	rel, route, _, err := info.documentTargets(s.homeDoc)
+	if err != nil {
+		return nil, err
+	}
+	if s.routeIsPrivate(route) {
+		return nil, ErrForbiddenRoute
+	}
+	if err := s.checkRouteACL(ctx, route, config.ACLRead); err != nil {
+		return nil, err
+	}
+	source, err := s.documents.Read(rel)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.documents.RenderDocument(ctx, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &PageExport{
+		Path:       rel,
+		Route:      doc.Route,
+		Title:      doc.Title,
+		Summary:    doc.Summary,
+		HTML:       string(doc.HTML),
+		Headings:   make([]PageHeading, 0, len(doc.Sections)),
+		LastCommit: doc.LastHash,
+		Markdown:   source,
+	}
+	for _, section := range doc.Sections {
+		export.Headings = append(export.Headings, PageHeading{ID: section.ID, Text: section.Text, Level: section.Level})
+	}
+	if !doc.LastMod.IsZero() {
+		modified := doc.LastMod.UTC()
+		export.LastModified = &modified
+	}
+	return export, nil
+}
@@ -0,0 +1,118 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+// ErrPreconditionFailed rejects a page write whose If-Match or If-None-Match
+// condition does not hold for the current content.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// PagePrecondition guards a page write against concurrent changes, following
+// the HTTP conditional request headers.
+type PagePrecondition struct {
+	// IfMatch lists the content hashes the page must currently have. "*"
+	// matches any existing page.
+	IfMatch []string
+	// IfNoneMatch only allows creating the page.
+	IfNoneMatch bool
+}
+
+// PageWrite reports the outcome of PutPage.
+type PageWrite struct {
+	Path  string `json:"path"`
+	Route string `json:"route"`
+	// Status is "created", "updated" or "unchanged".
+	Status string `json:"status"`
+	ETag   string `json:"etag"`
+}
+
+// ContentHash identifies a version of a page's source.
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// PageSource returns the source of a page along with its content hash.
+func (s *Service) PageSource(ctx context.Context, relPath string) ([]byte, string, error) {
+	content, err := s.LoadRaw(ctx, relPath)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, ContentHash(content), nil
+}
+
+// PutPage creates or replaces a page for API clients. Writing the content a
+// page already has is not committed, so clients may repeat a write safely.
+// An empty message is replaced by a default one.
+func (s *Service) PutPage(ctx context.Context, relPath string, content []byte, pre PagePrecondition, message, remoteAddr string) (*PageWrite, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.ensureRepositoryFresh(ctx); err != nil {
+		return nil, err
+	}
+
+	rel, err := normalizeRelPath(relPath, s.homeDoc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLWrite); err != nil {
+		return nil, err
+	}
+	current, err := s.documents.Read(rel)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	hash := ""
+	if exists {
+		hash = ContentHash(current)
+	}
+	if pre.IfNoneMatch && exists {
+		return nil, fmt.Errorf("%w: page exists", ErrPreconditionFailed)
+	}
+	if len(pre.IfMatch) > 0 && !(exists && (slices.Contains(pre.IfMatch, "*") || slices.Contains(pre.IfMatch, hash))) {
+		return nil, fmt.Errorf("%w: page has changed", ErrPreconditionFailed)
+	}
+
+	result := &PageWrite{Path: rel, Route: routeFromPath(rel, s.homeDoc), ETag: ContentHash(content)}
+	if exists && bytes.Equal(current, content) {
+		result.Status = "unchanged"
+		return result, nil
+	}
+	if !exists && isReservedPath(rel) {
+		return nil, fmt.Errorf("%w: %s", ErrReservedPath, rel)
+	}
+	if !exists {
+		if err := s.checkCaseCollision(ctx, rel, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Status = "updated"
+	if !exists {
+		result.Status = "created"
+	}
+	if strings.TrimSpace(message) == "" {
+		verb := "Update"
+		if !exists {
+			verb = "Create"
+		}
+		message = fmt.Sprintf("%s page: `%s`", verb, s.commitLabel(rel))
+	}
+	if err := s.commitPage(ctx, rel, content, message, remoteAddr); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
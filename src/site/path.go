@@ -2,8 +2,10 @@ package site
 
 import (
 	"errors"
+	"fmt"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -18,11 +20,21 @@ var reservedRouteNames = map[string]struct{}{
 	"readme":       {},
 	"search-index": {},
 	"directory":    {},
+	"recent":       {},
 	"gollum":       {},
 	"root":         {},
 	"default":      {},
 	"assets":       {},
 	"api":          {},
+	"healthz":      {},
+	"metrics":      {},
+	"debug":        {},
+}
+
+// reservedRouteTrees are reserved names whose whole subtree is served by the
+// server, so no page may be created below them either.
+var reservedRouteTrees = map[string]struct{}{
+	"debug": {},
 }
 
 var (
@@ -32,6 +44,9 @@ var (
 	ErrReservedPath = errors.New("reserved path")
 	// ErrForbiddenRoute indicates the requested route is configured as private.
 	ErrForbiddenRoute = errors.New("route is restricted")
+	// ErrArchivedRoute refuses changes to archived pages. It is an
+	// ErrForbiddenRoute.
+	ErrArchivedRoute = fmt.Errorf("%w: page is archived", ErrForbiddenRoute)
 )
 
 func normalizeRelPath(input, homeDoc string) (string, error) {
@@ -103,8 +118,9 @@ func isReservedPath(rel string) bool {
 	lowered := strings.ToLower(filepath.ToSlash(strings.TrimSpace(rel)))
 	lowered = strings.TrimPrefix(lowered, "/")
 	lowered = strings.TrimSuffix(lowered, ".md")
-	if strings.Contains(lowered, "/") {
-		return false
+	if first, _, nested := strings.Cut(lowered, "/"); nested {
+		_, ok := reservedRouteTrees[first]
+		return ok
 	}
 	_, ok := reservedRouteNames[lowered]
 	return ok
@@ -123,9 +139,14 @@ func isMarkdown(path string) bool {
 	return strings.EqualFold(filepath.Ext(path), ".md")
 }
 
+// layoutFragmentNames are the file names of layout fragments, which apply to
+// the pages of their directory and below rather than being pages themselves.
+// The HTML ones are injected verbatim, only from the root and only with
+// inject.repoFiles, and are never published.
+var layoutFragmentNames = []string{"_Header.md", "_Footer.md", "_Sidebar.md", "_Head.html", "_BodyEnd.html"}
+
 func isLayoutFragment(path string) bool {
-	base := filepath.Base(path)
-	return base == "_Header.md" || base == "_Footer.md" || base == "_Sidebar.md"
+	return slices.Contains(layoutFragmentNames, filepath.Base(path))
 }
 
 func isIgnorable(path string) bool {
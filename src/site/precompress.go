@@ -0,0 +1,163 @@
+package site
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/fsutil"
+)
+
+// Content encodings of precompressed outputs, in order of preference.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// precompressTimeout bounds a single run of the brotli command.
+const precompressTimeout = time.Minute
+
+var precompressSuffix = map[string]string{EncodingBrotli: ".br", EncodingGzip: ".gz"}
+
+// compressible reports whether an output file is text worth compressing.
+func compressible(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".json", ".css", ".js", ".mjs", ".map", ".svg", ".xml", ".txt", ".csv", ".md":
+		return true
+	}
+	return false
+}
+
+// precompressEncodings lists the encodings builds write siblings for.
+func (s *Service) precompressEncodings() []string {
+	if len(s.cfg.Precompress.BrotliCommand) > 0 {
+		return []string{EncodingBrotli, EncodingGzip}
+	}
+	return []string{EncodingGzip}
+}
+
+// precompressOutputs writes .br and .gz siblings next to the text files of
+// buildDir. Siblings of files unchanged since the active build are copied
+// from activeDir instead of being compressed again; with an empty activeDir
+// every file is compressed.
+func (s *Service) precompressOutputs(ctx context.Context, activeDir, buildDir string) error {
+	var files []string
+	err := filepath.WalkDir(buildDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !compressible(p) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() >= int64(s.cfg.Precompress.MinBytes) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encodings := s.precompressEncodings()
+	for _, src := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(buildDir, src)
+		if err != nil {
+			return err
+		}
+		active := filepath.Join(activeDir, rel)
+		unchanged := activeDir != "" && sameFile(active, src)
+		for _, encoding := range encodings {
+			dst := src + precompressSuffix[encoding]
+			if _, err := os.Stat(dst); err == nil {
+				// A tracked file of that name wins over the sibling.
+				continue
+			}
+			if unchanged {
+				if err := fsutil.CopyFile(active+precompressSuffix[encoding], dst); err == nil {
+					continue
+				}
+			}
+			if err := s.compressFile(ctx, encoding, src, dst); err != nil {
+				return fmt.Errorf("precompress %s: %w", filepath.ToSlash(rel), err)
+			}
+		}
+	}
+	return nil
+}
+
+// compressFile writes src compressed with encoding to dst, unless that does
+// not make it smaller.
+func (s *Service) compressFile(ctx context.Context, encoding, src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	switch encoding {
+	case EncodingGzip:
+		zw, err := gzip.NewWriterLevel(&out, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	case EncodingBrotli:
+		ctx, cancel := context.WithTimeout(ctx, precompressTimeout)
+		defer cancel()
+		command := s.cfg.Precompress.BrotliCommand
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = &out
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("brotli: %w (%s)", err, strings.TrimSpace(stderr.String()))
+		}
+	default:
+		return fmt.Errorf("unknown encoding %q", encoding)
+	}
+	if out.Len() == 0 || out.Len() >= len(data) {
+		return nil
+	}
+	return os.WriteFile(dst, out.Bytes(), 0o644)
+}
+
+// Precompressed returns the sibling of an output file stored with encoding,
+// when the build wrote one.
+func (s *Service) Precompressed(file OutputFile, encoding string) (OutputFile, bool) {
+	suffix, ok := precompressSuffix[encoding]
+	if !ok || !s.cfg.Precompress.Enabled || !compressible(file.Path) {
+		return OutputFile{}, false
+	}
+	return s.LookupOutput(file.Path + suffix)
+}
+
+// isPrecompressedSibling reports whether an output path is a .br or .gz
+// sibling written by the build rather than a file of its own. Such siblings
+// share the URL of the file they compress.
+func (s *Service) isPrecompressedSibling(rel string) bool {
+	if !s.cfg.Precompress.Enabled {
+		return false
+	}
+	for _, suffix := range precompressSuffix {
+		if base, ok := strings.CutSuffix(rel, suffix); ok && compressible(base) {
+			return true
+		}
+	}
+	return false
+}
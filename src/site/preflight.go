@@ -0,0 +1,63 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/iedon/dn42-wiki-go/fsutil"
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var (
+	buildPreflightFailures = metrics.NewCounter("wiki_build_preflight_failures_total", "Static builds refused because the output filesystem lacked free space.")
+	buildOutputBytes       = metrics.NewGauge("wiki_build_output_bytes", "Size of the active build output, used to estimate the space a rebuild needs.")
+)
+
+// ErrInsufficientSpace is returned when a build would not fit on the output
+// filesystem.
+var ErrInsufficientSpace = errors.New("insufficient disk space for build")
+
+// checkBuildSpace refuses to start a build when the filesystem holding parent
+// has less free space than the previous output needed plus 10% headroom.
+// Without a previous build or on platforms that cannot report free space the
+// check passes.
+func (s *Service) checkBuildSpace(parent string) error {
+	need := s.outputSize()
+	buildOutputBytes.Set(float64(need))
+	if need == 0 {
+		return nil
+	}
+	need += need / 10
+	free, err := fsutil.FreeSpace(parent)
+	if err != nil {
+		return nil
+	}
+	if free < uint64(need) {
+		buildPreflightFailures.Inc()
+		return fmt.Errorf("%w: %s needs about %d bytes, %d available", ErrInsufficientSpace, parent, need, free)
+	}
+	return nil
+}
+
+// outputSize sums the active output, from the manifest when available.
+func (s *Service) outputSize() int64 {
+	var total int64
+	if index := s.outputIndex.current.Load(); index != nil {
+		for _, file := range index.files {
+			total += file.Size
+		}
+		return total
+	}
+	_ = filepath.WalkDir(s.cfg.OutputDir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
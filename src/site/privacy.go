@@ -1,5 +1,11 @@
 package site
 
+import (
+	"context"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
 func (s *Service) routeIsPrivateFromRel(rel string) bool {
 	route := routeFromPath(rel, s.homeDoc)
 	return s.routeIsPrivate(route)
@@ -27,6 +33,9 @@ func (s *Service) routeFromRequestPath(requestPath string) (string, error) {
 	if info.relative == directoryPageRoute {
 		return directoryPageRoute, nil
 	}
+	if info.relative == recentPageRoute && s.recentPageEnabled() {
+		return recentPageRoute, nil
+	}
 	if info.relative == "/" {
 		return "/", nil
 	}
@@ -38,7 +47,7 @@ func (s *Service) routeFromRequestPath(requestPath string) (string, error) {
 }
 
 // EnsureRequestAccessible validates whether the provided HTTP route is accessible in live mode.
-func (s *Service) EnsureRequestAccessible(requestPath string) error {
+func (s *Service) EnsureRequestAccessible(ctx context.Context, requestPath string) error {
 	if !s.cfg.Live {
 		return nil
 	}
@@ -49,5 +58,15 @@ func (s *Service) EnsureRequestAccessible(requestPath string) error {
 	if s.routeIsPrivate(route) {
 		return ErrForbiddenRoute
 	}
-	return nil
+	return s.checkRouteACL(ctx, route, config.ACLRead)
+}
+
+// RobotsDirectives returns the X-Robots-Tag value configured for an HTTP
+// request path, or an empty string.
+func (s *Service) RobotsDirectives(requestPath string) string {
+	info, ok := s.analyzeRequestPath(requestPath)
+	if !ok {
+		return ""
+	}
+	return s.cfg.RobotsDirectives(info.relative)
 }
@@ -0,0 +1,222 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+// ErrPullRejected reports an upstream commit held back by pull validation.
+var ErrPullRejected = errors.New("upstream commit failed validation")
+
+// maxValidationProblems bounds the problems recorded for a rejected commit.
+const maxValidationProblems = 50
+
+var (
+	pullValidationFailures = metrics.NewCounter("wiki_pull_validation_failures_total", "Upstream commits rejected by pull validation.")
+	pullRejectedGauge      = metrics.NewGauge("wiki_pull_rejected", "1 while the latest upstream commit is held back by pull validation.")
+
+	hrefAttr = regexp.MustCompile(`href="([^"]*)"`)
+	idAttr   = regexp.MustCompile(`\sid="([^"]*)"`)
+)
+
+// PullRejection describes the upstream commit currently held back.
+type PullRejection struct {
+	Commit     string    `json:"commit"`
+	Serving    string    `json:"serving"`
+	Problems   []string  `json:"problems"`
+	RejectedAt time.Time `json:"rejectedAt"`
+}
+
+type pullRejectionHolder struct {
+	current atomic.Pointer[PullRejection]
+}
+
+// PullRejection returns the upstream commit rejected by the last validated
+// pull, or nil when the checkout matches upstream.
+func (s *Service) PullRejection() *PullRejection {
+	return s.rejection.current.Load()
+}
+
+// validatePull checks the freshly pulled checkout and rolls it back to prev
+// when it fails. A commit that was already rejected is rolled back without
+// being validated or reported again.
+func (s *Service) validatePull(ctx context.Context, prev string) error {
+	head, err := s.repo.Head(ctx)
+	if err != nil {
+		return err
+	}
+	if rejected := s.PullRejection(); rejected != nil && rejected.Commit == head {
+		return s.repo.ResetHard(ctx, prev)
+	}
+
+	problems, err := s.validateCheckout(ctx)
+	if err == nil && len(problems) == 0 {
+		s.rejection.current.Store(nil)
+		pullRejectedGauge.Set(0)
+		return nil
+	}
+	if prev == "" {
+		// Nothing to fall back to; publish what upstream has.
+		return err
+	}
+	if resetErr := s.repo.ResetHard(ctx, prev); resetErr != nil {
+		return errors.Join(err, resetErr)
+	}
+	if err != nil {
+		return fmt.Errorf("validate %s: %w", shortCommit(head), err)
+	}
+
+	s.rejection.current.Store(&PullRejection{
+		Commit:     head,
+		Serving:    prev,
+		Problems:   problems,
+		RejectedAt: time.Now().UTC(),
+	})
+	pullValidationFailures.Inc()
+	pullRejectedGauge.Set(1)
+	s.gitLog.Printf("pull: rejected %s, keeping %s: %s", shortCommit(head), shortCommit(prev), strings.Join(problems, "; "))
+	return fmt.Errorf("%w: %s: %s", ErrPullRejected, shortCommit(head), problems[0])
+}
+
+// validateCheckout returns the problems found in the working tree: files
+// above the size limit, documents that fail to render and, optionally,
+// absolute links to pages or files that do not exist.
+func (s *Service) validateCheckout(ctx context.Context) ([]string, error) {
+	opts := s.cfg.PullValidation
+	files, err := s.documents.ListTracked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	report := func(format string, args ...any) {
+		if len(problems) < maxValidationProblems {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	tracked := make(map[string]struct{}, len(files))
+	var docs []page
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tracked[file] = struct{}{}
+		if opts.MaxFileBytes > 0 {
+			if info, err := os.Stat(filepath.Join(s.documents.RepoDir(), filepath.FromSlash(file))); err == nil && info.Size() > opts.MaxFileBytes {
+				report("%s: %d bytes exceeds the %d byte limit", file, info.Size(), opts.MaxFileBytes)
+			}
+		}
+		if !s.documents.IsDocument(file) || isLayoutFragment(file) {
+			continue
+		}
+		doc, err := s.documents.RenderDocument(ctx, file)
+		if err != nil {
+			report("%s: render: %v", file, err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	if opts.CheckLinks || opts.CheckAnchors {
+		titles := make(map[string]string, len(docs))
+		anchors := make(map[string]map[string]struct{}, len(docs))
+		for _, doc := range docs {
+			titles[doc.Route] = doc.Title
+			if opts.CheckAnchors {
+				anchors[doc.Route] = pageAnchors(doc.HTML)
+			}
+		}
+		for _, doc := range docs {
+			for _, match := range hrefAttr.FindAllStringSubmatch(string(doc.HTML), -1) {
+				href := html.UnescapeString(match[1])
+				if opts.CheckLinks && !s.linkResolves(href, titles, tracked) {
+					report("%s: broken link %s", doc.Source, href)
+					continue
+				}
+				if opts.CheckAnchors && !s.anchorResolves(href, doc.Route, titles, anchors) {
+					report("%s: broken anchor %s", doc.Source, href)
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// pageAnchors collects the element IDs of a rendered document, such as the
+// generated heading IDs.
+func pageAnchors(content template.HTML) map[string]struct{} {
+	ids := map[string]struct{}{"top": {}}
+	for _, match := range idAttr.FindAllStringSubmatch(string(content), -1) {
+		ids[html.UnescapeString(match[1])] = struct{}{}
+	}
+	return ids
+}
+
+// anchorResolves reports whether the #fragment of a link to the same page or
+// to another page names an element of that page. Links without a fragment
+// and links to files or outside the wiki are not checked.
+func (s *Service) anchorResolves(href, route string, titles map[string]string, anchors map[string]map[string]struct{}) bool {
+	target, fragment, ok := strings.Cut(href, "#")
+	if !ok || fragment == "" {
+		return true
+	}
+	if target != "" {
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+			return true
+		}
+		if route, ok = s.linkedRoute(target, titles); !ok {
+			return true
+		}
+	}
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	_, ok = anchors[route][fragment]
+	return ok
+}
+
+// linkResolves reports whether an absolute in-site link points at a page,
+// a tracked file or a template asset. Relative and external links are not
+// checked.
+func (s *Service) linkResolves(href string, titles map[string]string, tracked map[string]struct{}) bool {
+	if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return true
+	}
+	href, _, _ = strings.Cut(href, "#")
+	href, _, _ = strings.Cut(href, "?")
+	if s.wikiLinkExists(href, titles) {
+		return true
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	rel, ok := s.trimBase(sanitizeRoute(href))
+	if !ok {
+		return false
+	}
+	rel = strings.TrimPrefix(rel, "/")
+	if _, ok := tracked[rel]; ok {
+		return true
+	}
+	return strings.HasPrefix(rel, "assets/")
+}
+
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
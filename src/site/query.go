@@ -0,0 +1,169 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// pageQuery is the query key of a page's front matter. Query pages get the
+// list of matching pages appended to their content at build time, eg.
+//
+//	query:
+//	  tags: [service]
+//	  prefix: /services
+//	  recent: 10
+type pageQuery struct {
+	// Tags a page must all carry.
+	Tags []string
+	// Prefix limits matches to the routes below it.
+	Prefix string
+	// Recent, when positive, lists that many pages by last change instead
+	// of all of them by title.
+	Recent int
+}
+
+// parsePageQuery reads the query of a query page from its front matter.
+func parsePageQuery(meta map[string]any) (*pageQuery, error) {
+	raw, ok := meta["query"]
+	if !ok {
+		return nil, nil
+	}
+	spec, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("query must be a mapping of tags, prefix and recent")
+	}
+	query := &pageQuery{Tags: metaTags(spec["tags"])}
+	for key, value := range spec {
+		switch key {
+		case "tags":
+		case "prefix":
+			prefix, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("query prefix must be a string")
+			}
+			prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+			if prefix != "" {
+				query.Prefix = "/" + prefix
+			}
+		case "recent":
+			count, ok := value.(int)
+			if !ok || count < 0 {
+				return nil, fmt.Errorf("query recent must be a non-negative number")
+			}
+			query.Recent = count
+		default:
+			return nil, fmt.Errorf("unknown query key %q", key)
+		}
+	}
+	return query, nil
+}
+
+// metaStrings reads a list of strings given either as a YAML sequence or as
+// a comma separated string. Blank items are dropped.
+func metaStrings(value any) []string {
+	var raw []string
+	switch v := value.(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			raw = append(raw, fmt.Sprint(item))
+		}
+	}
+	var items []string
+	for _, item := range raw {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// metaTags reads the tags of a page. Tags are matched case-insensitively.
+func metaTags(value any) []string {
+	var tags []string
+	for _, tag := range metaStrings(value) {
+		tag = strings.ToLower(tag)
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matches reports whether a page is selected by the query.
+func (q *pageQuery) matches(info PageInfo) bool {
+	if q.Prefix != "" {
+		route := strings.ToLower(info.Route)
+		prefix := strings.ToLower(q.Prefix)
+		if route != prefix && !strings.HasPrefix(route, prefix+"/") {
+			return false
+		}
+	}
+	for _, tag := range q.Tags {
+		if !slices.Contains(info.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryResults lists the public pages matched by the query of doc, leaving
+// out doc itself.
+func (s *Service) queryResults(doc page, nav *SiteSnapshot) []templatex.QueryResult {
+	var matched []PageInfo
+	for _, info := range nav.Pages {
+		if info.Route == doc.Route || info.Draft || s.routeIsUnlisted(info.Route) || !doc.Query.matches(info) {
+			continue
+		}
+		matched = append(matched, info)
+	}
+	if doc.Query.Recent > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].ModTime.After(matched[j].ModTime)
+		})
+		if len(matched) > doc.Query.Recent {
+			matched = matched[:doc.Query.Recent]
+		}
+	} else {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return strings.ToLower(matched[i].Title) < strings.ToLower(matched[j].Title)
+		})
+	}
+
+	results := make([]templatex.QueryResult, 0, len(matched))
+	for _, info := range matched {
+		result := templatex.QueryResult{
+			Title:   info.Title,
+			URL:     info.URL,
+			Summary: info.Summary,
+		}
+		if doc.Query.Recent > 0 && !info.ModTime.IsZero() {
+			result.DateISO = info.ModTime.UTC().Format(time.RFC3339)
+			result.Date = info.ModTime.UTC().Format("Jan 2, 2006")
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// expandQuery appends the pages matched by a query page to its content.
+// Other pages are returned unchanged.
+func (s *Service) expandQuery(doc page, nav *SiteSnapshot) (template.HTML, error) {
+	if doc.Query == nil || nav == nil {
+		return doc.HTML, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(string(doc.HTML))
+	if err := s.templates.RenderTemplate(&buf, templatex.QueryResultsTemplate, s.queryResults(doc, nav)); err != nil {
+		return "", fmt.Errorf("query page %s: %w", doc.Source, err)
+	}
+	return template.HTML(buf.String()), nil
+}
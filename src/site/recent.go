@@ -0,0 +1,124 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+const (
+	recentPageRoute  = "/recent"
+	recentPageOutput = "recent.html"
+	recentPageTitle  = "Recent Changes"
+)
+
+// isRecentRoute checks if the given relative path maps to the recent changes
+// page route.
+func isRecentRoute(rel string) bool {
+	lowered := strings.ToLower(filepath.ToSlash(strings.TrimSpace(rel)))
+	lowered = strings.TrimPrefix(lowered, "/")
+	lowered = strings.TrimSuffix(lowered, ".md")
+	lowered = strings.TrimSuffix(lowered, "/")
+	return lowered == strings.TrimPrefix(recentPageRoute, "/")
+}
+
+// recentPageEnabled reports whether builds publish the recent changes page.
+func (s *Service) recentPageEnabled() bool {
+	return s.cfg.RecentChanges.Limit > 0
+}
+
+// recentChanges lists the latest commits with the pages each touched.
+// Commits that only touched other files or private pages are skipped.
+func (s *Service) recentChanges(ctx context.Context, nav *SiteSnapshot) ([]templatex.ChangeEntry, error) {
+	changes, err := s.repo.RecentChanges(ctx, s.cfg.RecentChanges.Limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]templatex.ChangeEntry, 0, len(changes))
+	for _, change := range changes {
+		var pages []templatex.ChangedPage
+		for _, file := range change.Files {
+			if !s.documents.IsDocument(file.Path) || isLayoutFragment(file.Path) {
+				continue
+			}
+			route := routeFromPath(file.Path, s.homeDoc)
+			if s.routeIsUnlisted(route) {
+				continue
+			}
+			title, exists := nav.Titles[route]
+			if !exists {
+				title = deriveTitle(file.Path)
+			}
+			changed := templatex.ChangedPage{Title: title, Deleted: file.Status == "D" || !exists}
+			if !changed.Deleted {
+				changed.URL = resolveDirectoryURL(s.cfg.BaseURL, route)
+			}
+			pages = append(pages, changed)
+		}
+		if len(pages) == 0 {
+			continue
+		}
+		entries = append(entries, templatex.ChangeEntry{
+			Hash:      change.Hash,
+			ShortHash: shortCommit(change.Hash),
+			Author:    change.Author,
+			Message:   change.Message,
+			DateISO:   change.CommittedAt.UTC().Format(time.RFC3339),
+			Date:      change.CommittedAt.UTC().Format("Jan 2 15:04:05 MST 2006"),
+			Pages:     pages,
+		})
+	}
+	return entries, nil
+}
+
+func (s *Service) recentPageData(changes []templatex.ChangeEntry) *templatex.PageData {
+	snapshot := s.layout.Snapshot()
+	data := &templatex.PageData{
+		Title:            recentPageTitle,
+		PageTitle:        s.pageTitle(recentPageTitle),
+		HeaderHTML:       snapshot.Header,
+		FooterHTML:       snapshot.Footer,
+		ServerFooterHTML: snapshot.ServerFooter,
+		HeadHTML:         snapshot.Head,
+		BodyEndHTML:      snapshot.BodyEnd,
+		SidebarHTML:      snapshot.Sidebar,
+		ContentTemplate:  templatex.RecentContentTemplate,
+		ActivePath:       recentPageRoute,
+		RequestedPath:    recentPageRoute,
+		Editable:         false,
+		Buttons:          templatex.PageButtons{},
+		SearchIndexURL:   s.searchIndexPath(),
+		Live:             s.cfg.Live,
+		BaseURL:          s.cfg.BaseURL,
+		Breadcrumbs: []templatex.Breadcrumb{
+			{Title: recentPageTitle, Current: true},
+		},
+		Changes: changes,
+		Staging: s.cfg.IsStaging(),
+	}
+	data.Meta = s.buildMeta("The latest edits to the wiki.", recentPageTitle, "website")
+	data.Meta.Robots = s.cfg.RobotsDirectives(recentPageRoute)
+	return data
+}
+
+func (s *Service) writeRecentPage(ctx context.Context, baseDir string, nav *SiteSnapshot) error {
+	changes, err := s.recentChanges(ctx, nav)
+	if err != nil {
+		return fmt.Errorf("recent changes: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := s.templates.Render(&buf, s.recentPageData(changes)); err != nil {
+		return err
+	}
+	minified, err := s.renderer.MinifyHTML(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("minify recent changes page: %w", err)
+	}
+	return os.WriteFile(filepath.Join(baseDir, recentPageOutput), minified, 0o644)
+}
@@ -4,20 +4,25 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/iedon/dn42-wiki-go/config"
 	"github.com/iedon/dn42-wiki-go/fsutil"
+	"github.com/iedon/dn42-wiki-go/gitutil"
 	"github.com/iedon/dn42-wiki-go/templatex"
 )
 
 // RenderPage renders a single document for live mode.
 func (s *Service) RenderPage(ctx context.Context, relPath string) (*templatex.PageData, error) {
-	if err := s.buildLayout(ctx); err != nil {
+	if err := s.ensureLayout(ctx); err != nil {
 		return nil, err
 	}
 
@@ -25,23 +30,51 @@ func (s *Service) RenderPage(ctx context.Context, relPath string) (*templatex.Pa
 	if err != nil {
 		return nil, err
 	}
-	if err := s.ensureRouteAccessible(norm); err != nil {
+	if err := s.checkAccess(ctx, norm, config.ACLRead); err != nil {
 		return nil, err
 	}
 
 	if isDirectoryRoute(norm) {
-		return s.directoryPageData(ctx)
+		snapshot, err := s.Snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.directoryPageData(snapshot), nil
+	}
+	if isRecentRoute(norm) && s.recentPageEnabled() {
+		snapshot, err := s.Snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := s.recentChanges(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		return s.recentPageData(changes), nil
 	}
 
 	doc, err := s.documents.RenderDocument(ctx, norm)
 	if err != nil {
 		return nil, err
 	}
+	if snapshot := s.snapshot.Load(); snapshot != nil {
+		if doc.HTML, err = s.expandQuery(doc, snapshot); err != nil {
+			return nil, err
+		}
+		doc.HTML = s.markMissingLinks(doc.HTML, snapshot.Titles)
+	}
 	return s.pageData(doc), nil
 }
 
 // RenderFullPage renders and minifies a page ready to be written to the response.
+// Concurrent requests for the same page share a single render.
 func (s *Service) RenderFullPage(ctx context.Context, relPath string) ([]byte, error) {
+	return s.pageFlights.Do("page\x00"+relPath, func() ([]byte, error) {
+		return s.renderFullPage(ctx, relPath)
+	})
+}
+
+func (s *Service) renderFullPage(ctx context.Context, relPath string) ([]byte, error) {
 	data, err := s.RenderPage(ctx, relPath)
 	if err != nil {
 		return nil, err
@@ -75,6 +108,20 @@ func (s *Service) RenderForbiddenPage(ctx context.Context, requestedPath string)
 	return s.renderStatusPage(ctx, requestedPath, cfg)
 }
 
+// RenderErrorPage renders a themed 500 page naming reference, under which
+// the failure was logged. It is not coalesced like the other status pages,
+// as each one names its own failure.
+func (s *Service) RenderErrorPage(ctx context.Context, requestedPath, reference string) ([]byte, error) {
+	cfg := statusPageConfig{
+		title:       "500 - Internal error",
+		template:    templatex.ErrorContentTemplate,
+		metaType:    "website",
+		description: errorDescription,
+		reference:   reference,
+	}
+	return s.renderStatusPageOnce(ctx, requestedPath, cfg)
+}
+
 // sanitizeRequestedPath cleans up a raw requested path for display purposes.
 func sanitizeRequestedPath(raw string) string {
 	raw = strings.TrimSpace(raw)
@@ -112,11 +159,18 @@ type statusPageConfig struct {
 	template    string
 	metaType    string
 	description func(string) string
+	reference   string
 }
 
 // renderStatusPage centralizes 403/404 page generation to keep the templates in sync.
 func (s *Service) renderStatusPage(ctx context.Context, requestedPath string, cfg statusPageConfig) ([]byte, error) {
-	if err := s.buildLayout(ctx); err != nil {
+	return s.pageFlights.Do(cfg.template+"\x00"+requestedPath, func() ([]byte, error) {
+		return s.renderStatusPageOnce(ctx, requestedPath, cfg)
+	})
+}
+
+func (s *Service) renderStatusPageOnce(ctx context.Context, requestedPath string, cfg statusPageConfig) ([]byte, error) {
+	if err := s.ensureLayout(ctx); err != nil {
 		return nil, err
 	}
 
@@ -132,6 +186,7 @@ func (s *Service) renderStatusPage(ctx context.Context, requestedPath string, cf
 	data.ContentTemplate = cfg.template
 	data.ActivePath = ""
 	data.RequestedPath = sanitized
+	data.ErrorReference = cfg.reference
 
 	description := ""
 	if cfg.description != nil {
@@ -153,6 +208,10 @@ func notFoundDescription(path string) string {
 	return "The page you are looking for could not be found."
 }
 
+func errorDescription(string) string {
+	return "The server failed to answer this request."
+}
+
 func forbiddenDescription(path string) string {
 	if path != "" && path != "/" {
 		return fmt.Sprintf("Access to %s is restricted.", path)
@@ -160,18 +219,67 @@ func forbiddenDescription(path string) string {
 	return "Access to the requested resource is restricted."
 }
 
-func (s *Service) renderDocuments(ctx context.Context, files []string) ([]page, error) {
-	docs := make([]page, 0, len(files))
+// renderDocuments renders the documents among files on up to
+// render.concurrency workers. The first failure cancels the remaining work.
+func (s *Service) renderDocuments(ctx context.Context, files []string, plan *incrementalBuild, timings *buildTimings) ([]page, error) {
+	sources := make([]string, 0, len(files))
 	for _, file := range files {
-		if !isMarkdown(file) || isLayoutFragment(file) {
-			continue
+		if s.documents.IsDocument(file) && !isLayoutFragment(file) {
+			sources = append(sources, file)
 		}
-		doc, err := s.documents.RenderDocument(ctx, file)
+	}
+
+	// One history traversal beats a `git log` per page unless only a few
+	// pages need rendering.
+	var history map[string]gitutil.Commit
+	if pending := plan.pending(sources); pending > batchHistoryThreshold {
+		commits, err := s.repo.LastCommitPerPath(ctx)
 		if err != nil {
-			return nil, err
+			log.Printf("build static: batch history: %v", err)
+		} else {
+			history = commits
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	docs := make([]page, len(sources))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(s.cfg.Render.Concurrency, 1), len(sources)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if doc, ok := plan.reuse(sources[i]); ok {
+					docs[i] = doc
+					continue
+				}
+				start := time.Now()
+				doc, err := s.documents.renderDocument(ctx, sources[i], history)
+				if err != nil {
+					cancel(err)
+					continue
+				}
+				timings.rendered(doc, start)
+				docs[i] = doc
+			}
+		}()
+	}
+feed:
+	for i := range sources {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
 		}
-		docs = append(docs, doc)
 	}
+	close(next)
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+
 	sort.Slice(docs, func(i, j int) bool {
 		return docs[i].Route < docs[j].Route
 	})
@@ -195,45 +303,62 @@ func (s *Service) pageData(doc page) *templatex.PageData {
 		}
 	}
 
+	header, footer, sidebar := s.layoutFor(doc.Source, snapshot)
+	archived := s.cfg.IsPathArchived(doc.Route)
 	data := &templatex.PageData{
 		Title:            doc.Title,
 		PageTitle:        pageTitle,
-		HeaderHTML:       snapshot.Header,
-		FooterHTML:       snapshot.Footer,
+		HeaderHTML:       header,
+		FooterHTML:       footer,
 		ServerFooterHTML: snapshot.ServerFooter,
-		SidebarHTML:      snapshot.Sidebar,
+		HeadHTML:         snapshot.Head,
+		BodyEndHTML:      snapshot.BodyEnd,
+		SidebarHTML:      sidebar,
 		ContentHTML:      doc.HTML,
 		ContentTemplate:  templatex.DefaultContentTemplate,
-		Sections:         doc.Sections,
+		Sections:         nestSections(doc.Sections, string(doc.HTML)),
 		ActivePath:       doc.Route,
 		RequestedPath:    doc.Route,
 		Editable:         s.cfg.Editable,
 		Buttons: templatex.PageButtons{
 			EnableHistory: true,
-			EnableRename:  s.cfg.Editable,
-			EnableEdit:    s.cfg.Editable,
+			EnableRename:  s.cfg.Editable && !archived,
+			EnableEdit:    s.cfg.Editable && !archived,
 			EnableNew:     s.cfg.Editable,
-			EnableDelete:  s.cfg.Editable,
+			EnableDelete:  s.cfg.Editable && !archived,
+			EnableUpload:  s.cfg.Editable && s.cfg.Uploads.Enabled,
 		},
 		SearchIndexURL:  s.searchIndexPath(),
 		Live:            s.cfg.Live,
 		BaseURL:         s.cfg.BaseURL,
-		Breadcrumbs:     buildBreadcrumbs(doc.Route, doc.Title, s.cfg.BaseURL),
 		LastUpdatedISO:  lastUpdatedISO,
 		LastUpdated:     lastUpdated,
 		LastCommitHash:  doc.LastHash,
 		LastCommitShort: lastCommitShort,
+		Staging:         s.cfg.IsStaging(),
+		Draft:           doc.Draft,
+		Archived:        archived,
+		Pinned:          shortCommit(doc.Pinned),
+		NewerThanPin:    doc.NewerThanPin,
+	}
+	s.applyNavigation(data, doc, s.snapshot.Load())
+	if s.cfg.Live {
+		data.HistoryFeedURL = s.historyFeedURL(doc.Route)
+	}
+	description := doc.Summary
+	if doc.Description != "" {
+		description = doc.Description
+	}
+	data.Meta = s.buildMeta(description, doc.Title, "article")
+	data.Meta.Robots = s.cfg.RobotsDirectives(doc.Route)
+	if doc.Draft {
+		data.Meta.Robots = draftRobots(data.Meta.Robots)
 	}
-	data.Meta = s.buildMeta(doc.Summary, doc.Title, "article")
 	return data
 }
 
-func (s *Service) directoryPageData(ctx context.Context) (*templatex.PageData, error) {
+func (s *Service) directoryPageData(nav *SiteSnapshot) *templatex.PageData {
 	snapshot := s.layout.Snapshot()
-	entries, err := s.directoryEntries(ctx)
-	if err != nil {
-		return nil, err
-	}
 	title := directoryPageTitle
 
 	data := &templatex.PageData{
@@ -242,6 +367,8 @@ func (s *Service) directoryPageData(ctx context.Context) (*templatex.PageData, e
 		HeaderHTML:       snapshot.Header,
 		FooterHTML:       snapshot.Footer,
 		ServerFooterHTML: snapshot.ServerFooter,
+		HeadHTML:         snapshot.Head,
+		BodyEndHTML:      snapshot.BodyEnd,
 		SidebarHTML:      snapshot.Sidebar,
 		ContentTemplate:  templatex.DirectoryContentTemplate,
 		ActivePath:       directoryPageRoute,
@@ -254,15 +381,29 @@ func (s *Service) directoryPageData(ctx context.Context) (*templatex.PageData, e
 		Breadcrumbs: []templatex.Breadcrumb{
 			{Title: directoryPageTitle, Current: true},
 		},
-		Directory: entries,
+		Directory:         nav.Directory,
+		ArchivedDirectory: nav.ArchivedDirectory,
+		Staging:           s.cfg.IsStaging(),
 	}
 	data.Meta = s.buildMeta("Browse the complete documentation index.", directoryPageTitle, "website")
-	return data, nil
+	data.Meta.Robots = s.cfg.RobotsDirectives(directoryPageRoute)
+	return data
 }
 
-func (s *Service) writeDocuments(baseDir string, docs []page) error {
+func (s *Service) writeDocuments(ctx context.Context, baseDir string, docs []page, nav *SiteSnapshot, timings *buildTimings) error {
 	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		html, err := s.expandQuery(doc, nav)
+		if err != nil {
+			return err
+		}
+		doc.HTML = s.markMissingLinks(html, nav.Titles)
 		data := s.pageData(doc)
+		// Navigate by the pages of this build, not the last one.
+		s.applyNavigation(data, doc, nav)
 		var buf bytes.Buffer
 		if err := s.templates.Render(&buf, data); err != nil {
 			return err
@@ -286,15 +427,13 @@ func (s *Service) writeDocuments(baseDir string, docs []page) error {
 				return fmt.Errorf("set mod time %s: %w", doc.Route, err)
 			}
 		}
+		timings.written(doc, start)
 	}
 	return nil
 }
 
-func (s *Service) writeDirectoryPage(ctx context.Context, baseDir string) error {
-	data, err := s.directoryPageData(ctx)
-	if err != nil {
-		return err
-	}
+func (s *Service) writeDirectoryPage(baseDir string, nav *SiteSnapshot) error {
+	data := s.directoryPageData(nav)
 	var buf bytes.Buffer
 	if err := s.templates.Render(&buf, data); err != nil {
 		return err
@@ -318,6 +457,19 @@ func (s *Service) writeForbiddenPage(ctx context.Context, baseDir string) error
 	return s.writeStatusPage(ctx, baseDir, "403.html", s.RenderForbiddenPage)
 }
 
+// writeRobotsTxt disallows the blocked user agents for static hosts that
+// cannot enforce the block list. A robots.txt tracked in the repository wins.
+func (s *Service) writeRobotsTxt(baseDir string, files []string) error {
+	if len(s.cfg.Robots.BlockUserAgents) == 0 || slices.Contains(files, "robots.txt") {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, agent := range s.cfg.Robots.BlockUserAgents {
+		fmt.Fprintf(&buf, "User-agent: %s\nDisallow: /\n\n", agent)
+	}
+	return os.WriteFile(filepath.Join(baseDir, "robots.txt"), buf.Bytes(), 0o644)
+}
+
 func (s *Service) writeStatusPage(ctx context.Context, baseDir, filename string, render func(context.Context, string) ([]byte, error)) error {
 	pageBytes, err := render(ctx, "")
 	if err != nil {
@@ -365,6 +517,7 @@ func (s *Service) buildMeta(summary, fallback, ogType string) templatex.Meta {
 		Description:   description,
 		OpenGraphType: ogType,
 		OpenGraphSite: s.siteName(),
+		Robots:        s.cfg.RobotsDirectives("/"),
 	}
 }
 
@@ -383,11 +536,15 @@ func (s *Service) siteName() string {
 func (s *Service) pageTitle(raw string) string {
 	title := strings.TrimSpace(raw)
 	site := s.siteName()
-	if title == "" {
-		return site
+	full := fmt.Sprintf("%s - %s", title, site)
+	switch {
+	case title == "":
+		full = site
+	case site == "":
+		full = title
 	}
-	if site == "" {
-		return title
+	if s.cfg.IsStaging() {
+		return "[Staging] " + full
 	}
-	return fmt.Sprintf("%s - %s", title, site)
+	return full
 }
@@ -0,0 +1,111 @@
+package site
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+	"github.com/iedon/dn42-wiki-go/renderer"
+)
+
+var (
+	renderCacheEntries   = metrics.NewGauge("wiki_render_cache_entries", "Rendered documents held in memory.")
+	renderCacheHits      = metrics.NewCounter("wiki_render_cache_hits_total", "Document renders served from memory.")
+	renderCacheMisses    = metrics.NewCounter("wiki_render_cache_misses_total", "Document renders that ran the Markdown renderer.")
+	renderCacheEvictions = metrics.NewCounter("wiki_render_cache_evictions_total", "Rendered documents evicted to respect cache.maxRenderedPages.")
+)
+
+// renderCache keeps Markdown render results keyed by source content, evicting
+// the least recently used entries beyond its capacity. Unchanged documents are
+// therefore not re-rendered on every build. Misses fall back to the optional
+// on-disk cache before rendering.
+type renderCache struct {
+	mu       sync.Mutex
+	capacity int
+	disk     *diskRenderCache
+	order    *list.List
+	items    map[[sha256.Size]byte]*list.Element
+	inflight flightGroup[*renderer.RenderResult]
+}
+
+type renderCacheItem struct {
+	key    [sha256.Size]byte
+	result *renderer.RenderResult
+}
+
+// newRenderCache returns a cache holding up to capacity results; capacity <= 0
+// disables the in-memory layer. disk may be nil.
+func newRenderCache(capacity int, disk *diskRenderCache) *renderCache {
+	return &renderCache{
+		capacity: capacity,
+		disk:     disk,
+		order:    list.New(),
+		items:    make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// Render returns the cached result for the file source or renders and stores
+// it. The file extension is part of the key as it selects the renderer, and
+// so is the path of viewer files, as their pages link to the file itself.
+func (c *renderCache) Render(r *renderer.Renderer, name string, source []byte) (*renderer.RenderResult, error) {
+	if c == nil || (c.capacity <= 0 && c.disk == nil) {
+		return r.RenderFile(name, source)
+	}
+	h := sha256.New()
+	h.Write([]byte(strings.ToLower(filepath.Ext(name))))
+	h.Write([]byte{0})
+	if r.IsViewer(name) {
+		h.Write([]byte(filepath.ToSlash(name)))
+		h.Write([]byte{0})
+	}
+	h.Write(source)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		result := elem.Value.(*renderCacheItem).result
+		c.mu.Unlock()
+		renderCacheHits.Inc()
+		return result, nil
+	}
+	c.mu.Unlock()
+
+	result, err := c.inflight.Do(string(key[:]), func() (*renderer.RenderResult, error) {
+		if c.disk != nil {
+			if result, ok := c.disk.Load(key); ok {
+				return result, nil
+			}
+		}
+		renderCacheMisses.Inc()
+		result, err := r.RenderFile(name, source)
+		if err == nil && c.disk != nil {
+			c.disk.Store(key, result)
+		}
+		return result, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.capacity <= 0 {
+		return result, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; !ok {
+		c.items[key] = c.order.PushFront(&renderCacheItem{key: key, result: result})
+		for c.order.Len() > c.capacity {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*renderCacheItem).key)
+			renderCacheEvictions.Inc()
+		}
+	}
+	renderCacheEntries.Set(float64(c.order.Len()))
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/metrics"
+	"github.com/iedon/dn42-wiki-go/renderer"
+)
+
+var (
+	renderDiskHits  = metrics.NewCounter("wiki_render_disk_cache_hits_total", "Document renders loaded from the on-disk render cache.")
+	renderDiskBytes = metrics.NewGauge("wiki_render_disk_cache_bytes", "Bytes used by the on-disk render cache.")
+)
+
+// diskRenderCache persists render results across restarts, one JSON file per
+// source content. Entries are keyed together with a salt covering the binary
+// and render settings, so upgrades and configuration changes never serve
+// stale HTML. Once the directory grows past its cap the least recently used
+// files are removed.
+type diskRenderCache struct {
+	dir      string
+	maxBytes int64
+	salt     []byte
+
+	mu   sync.Mutex
+	size int64
+}
+
+// newDiskRenderCache opens dir, creating it when needed.
+func newDiskRenderCache(dir string, maxBytes int64, salt []byte) (*diskRenderCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create render cache dir: %w", err)
+	}
+	c := &diskRenderCache{dir: dir, maxBytes: maxBytes, salt: salt}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trimLocked()
+	return c, nil
+}
+
+// renderCacheSalt fingerprints everything besides the source that affects a
+// render result.
+func renderCacheSalt(cfg *config.Config) []byte {
+	h := sha256.New()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		h.Write([]byte(info.Main.Version))
+		for _, setting := range info.Settings {
+			if strings.HasPrefix(setting.Key, "vcs.") {
+				h.Write([]byte(setting.Key + "=" + setting.Value + "\n"))
+			}
+		}
+	}
+	// Development builds carry no VCS stamp; the executable itself changes
+	// with every rebuild.
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			fmt.Fprintf(h, "%d:%d\n", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	settings, _ := json.Marshal(cfg.Render)
+	h.Write(settings)
+	fmt.Fprintf(h, "\n%s\n%s\n", cfg.SiteName, cfg.BaseURL)
+	return h.Sum(nil)
+}
+
+func (c *diskRenderCache) path(key [sha256.Size]byte) string {
+	h := sha256.New()
+	h.Write(c.salt)
+	h.Write(key[:])
+	name := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+// Load returns the stored result for a content key.
+func (c *diskRenderCache) Load(key [sha256.Size]byte) (*renderer.RenderResult, bool) {
+	file := c.path(key)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var result renderer.RenderResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		_ = os.Remove(file)
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(file, now, now)
+	renderDiskHits.Inc()
+	return &result, true
+}
+
+// Store writes a result, replacing any previous entry atomically.
+func (c *diskRenderCache) Store(key [sha256.Size]byte, result *renderer.RenderResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	file := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		log.Printf("render cache: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		log.Printf("render cache: %v", err)
+		return
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	var previous int64
+	if info, err := os.Stat(file); err == nil {
+		previous = info.Size()
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += int64(len(data)) - previous
+	if c.size > c.maxBytes {
+		c.trimLocked()
+	}
+	renderDiskBytes.Set(float64(c.size))
+}
+
+// trimLocked rescans the directory and removes the least recently used
+// entries until it is below 90% of the cap, leaving room before the next
+// scan.
+func (c *diskRenderCache) trimLocked() {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+	_ = filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path: p, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total > c.maxBytes {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+		target := c.maxBytes / 10 * 9
+		for _, e := range entries {
+			if total <= target {
+				break
+			}
+			if os.Remove(e.path) == nil {
+				total -= e.size
+			}
+		}
+	}
+	c.size = total
+	renderDiskBytes.Set(float64(total))
+}
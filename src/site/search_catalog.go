@@ -3,26 +3,38 @@ package site
 import (
 	"encoding/json"
 	"sync"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var (
+	searchIndexBytes    = metrics.NewGauge("wiki_search_index_bytes", "Size of the last built search index.")
+	searchIndexInMemory = metrics.NewGauge("wiki_search_index_in_memory", "Whether the search index is held in memory (1) or served from disk (0).")
 )
 
-// SearchCatalog maintains the serialized search index in memory.
+// SearchCatalog maintains the serialized search index in memory. Indexes
+// larger than maxBytes are left on disk; a negative limit never keeps them.
 type SearchCatalog struct {
-	mu      sync.RWMutex
-	payload json.RawMessage
+	mu       sync.RWMutex
+	payload  json.RawMessage
+	maxBytes int
 }
 
-func newSearchCatalog() *SearchCatalog {
-	return &SearchCatalog{}
+func newSearchCatalog(maxBytes int) *SearchCatalog {
+	return &SearchCatalog{maxBytes: maxBytes}
 }
 
 func (c *SearchCatalog) Update(payload json.RawMessage) {
+	searchIndexBytes.Set(float64(len(payload)))
 	c.mu.Lock()
-	if len(payload) == 0 {
+	defer c.mu.Unlock()
+	if len(payload) == 0 || c.maxBytes < 0 || (c.maxBytes > 0 && len(payload) > c.maxBytes) {
 		c.payload = nil
+		searchIndexInMemory.Set(0)
 	} else {
+		searchIndexInMemory.Set(1)
 		c.payload = append(json.RawMessage(nil), payload...)
 	}
-	c.mu.Unlock()
 }
 
 func (c *SearchCatalog) Snapshot() json.RawMessage {
@@ -6,18 +6,22 @@ import (
 	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"golang.org/x/text/unicode/norm"
 )
 
 const (
-	searchIndexVersion = 3
+	searchIndexVersion = 4
 	maxPositionsPerDoc = 48
+	// maxOffsetsPerDoc bounds the highlight offsets kept per term and page.
+	maxOffsetsPerDoc = 3
 )
 
 var (
 	searchIndexFields    = []string{"title", "summary", "content"}
-	emptySearchIndexJSON = json.RawMessage(`{"v":3,"c":0,"f":["title","summary","content"],"a":[0,0,0],"d":[],"t":{}}`)
+	emptySearchIndexJSON = json.RawMessage(`{"v":4,"c":0,"f":["title","summary","content"],"a":[0,0,0],"d":[],"t":{}}`)
 )
 
 type termEntry struct {
@@ -26,9 +30,19 @@ type termEntry struct {
 	SummaryFreq int
 	ContentFreq int
 	Positions   []int
+	// Offsets locate the first occurrences of the term in the page excerpt,
+	// in UTF-16 code units as used by JavaScript strings.
+	Offsets []textSpan
 }
 
-func buildSearchIndex(pages []page) (json.RawMessage, error) {
+type textSpan struct {
+	Start, End int
+}
+
+// buildSearchIndex encodes pages for the client side search. With a positive
+// excerptChars, each page carries that much of its text, and postings record
+// where terms occur in it so results can show the matching passage.
+func buildSearchIndex(pages []page, excerptChars int) (json.RawMessage, error) {
 	if len(pages) == 0 {
 		return append(json.RawMessage(nil), emptySearchIndexJSON...), nil
 	}
@@ -40,7 +54,7 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 	for docID, pg := range pages {
 		docTerms := make(map[string]*termEntry, 64)
 
-		titleLen := processField(pg.Title, func(token string) {
+		titleLen := processField(pg.Title, func(token string, _ textSpan) {
 			entry := docTerms[token]
 			if entry == nil {
 				entry = &termEntry{DocID: docID}
@@ -49,7 +63,7 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 			entry.TitleFreq++
 		})
 
-		summaryLen := processField(pg.Summary, func(token string) {
+		summaryLen := processField(pg.Summary, func(token string, _ textSpan) {
 			entry := docTerms[token]
 			if entry == nil {
 				entry = &termEntry{DocID: docID}
@@ -58,8 +72,10 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 			entry.SummaryFreq++
 		})
 
+		excerpt := searchExcerpt(pg.PlainText, excerptChars)
+		excerptUnits := utf16Len(excerpt)
 		contentPos := 0
-		contentLen := processField(pg.PlainText, func(token string) {
+		contentLen := processField(pg.PlainText, func(token string, span textSpan) {
 			entry := docTerms[token]
 			if entry == nil {
 				entry = &termEntry{DocID: docID}
@@ -69,6 +85,9 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 			if len(entry.Positions) < maxPositionsPerDoc {
 				entry.Positions = append(entry.Positions, contentPos)
 			}
+			if span.End <= excerptUnits && len(entry.Offsets) < maxOffsetsPerDoc {
+				entry.Offsets = append(entry.Offsets, span)
+			}
 			contentPos++
 		})
 
@@ -77,7 +96,11 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 		sumLengths[2] += contentLen
 
 		meta := encodeLengths(titleLen, summaryLen, contentLen)
-		docs = append(docs, []string{pg.Route, pg.Title, pg.Summary, meta})
+		doc := []string{pg.Route, pg.Title, pg.Summary, meta}
+		if excerpt != "" {
+			doc = append(doc, excerpt)
+		}
+		docs = append(docs, doc)
 
 		for term, entry := range docTerms {
 			termMap[term] = append(termMap[term], entry)
@@ -130,41 +153,94 @@ func buildSearchIndex(pages []page) (json.RawMessage, error) {
 	return json.RawMessage(data), nil
 }
 
-func processField(text string, apply func(string)) int {
+// processField splits text into search tokens and reports each with its
+// span in text. Characters are decomposed one at a time, so spans map back
+// to the original text rather than to its normalized form.
+func processField(text string, apply func(string, textSpan)) int {
 	if text == "" {
 		return 0
 	}
-	normalized := norm.NFKD.String(text)
-	var builder strings.Builder
-	count := 0
-	for _, r := range normalized {
-		switch {
-		case unicode.Is(unicode.Mn, r):
-			continue
-		case unicode.IsLetter(r) || unicode.IsDigit(r):
-			builder.WriteRune(unicode.ToLower(r))
-		default:
-			if builder.Len() > 0 {
-				token := builder.String()
-				builder.Reset()
-				if shouldIndexToken(token) {
-					apply(token)
-					count++
-				}
-			}
+	var (
+		builder strings.Builder
+		span    textSpan
+		offset  int
+		count   int
+		decomp  []byte
+	)
+	flush := func() {
+		if builder.Len() == 0 {
+			return
 		}
-	}
-	if builder.Len() > 0 {
 		token := builder.String()
 		builder.Reset()
 		if shouldIndexToken(token) {
-			apply(token)
+			apply(token, span)
 			count++
 		}
 	}
+	for _, original := range text {
+		width := utf16.RuneLen(original)
+		if width < 0 {
+			width = 1
+		}
+		decomp = decomp[:0]
+		if original < utf8.RuneSelf {
+			decomp = append(decomp, byte(original))
+		} else {
+			decomp = norm.NFKD.AppendString(decomp, string(original))
+		}
+		for _, r := range string(decomp) {
+			switch {
+			case unicode.Is(unicode.Mn, r):
+				continue
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				if builder.Len() == 0 {
+					span.Start = offset
+				}
+				builder.WriteRune(unicode.ToLower(r))
+				span.End = offset + width
+			default:
+				flush()
+			}
+		}
+		offset += width
+	}
+	flush()
 	return count
 }
 
+// searchExcerpt returns up to limit characters of text, cut at a word
+// boundary when one is near.
+func searchExcerpt(text string, limit int) string {
+	if limit <= 0 || text == "" {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	cut := 0
+	for i := 0; i < limit; i++ {
+		_, size := utf8.DecodeRuneInString(text[cut:])
+		cut += size
+	}
+	if space := strings.LastIndexAny(text[:cut], " \t\n"); space > cut*3/4 {
+		cut = space
+	}
+	return strings.TrimSpace(text[:cut])
+}
+
+func utf16Len(text string) int {
+	n := 0
+	for _, r := range text {
+		if width := utf16.RuneLen(r); width > 0 {
+			n += width
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
 func shouldIndexToken(token string) bool {
 	if token == "" {
 		return false
@@ -198,6 +274,10 @@ func encodeTermEntries(entries []*termEntry) string {
 			builder.WriteByte(':')
 			builder.WriteString(encodePositions(entry.Positions))
 		}
+		if len(entry.Offsets) > 0 {
+			builder.WriteByte(':')
+			builder.WriteString(encodeOffsets(entry.Offsets))
+		}
 	}
 	return builder.String()
 }
@@ -239,3 +319,20 @@ func encodePositions(positions []int) string {
 	}
 	return builder.String()
 }
+
+// encodeOffsets writes spans as "start-length" pairs separated by '.', with
+// each start relative to the previous one.
+func encodeOffsets(spans []textSpan) string {
+	var builder strings.Builder
+	prev := 0
+	for i, span := range spans {
+		if i > 0 {
+			builder.WriteByte('.')
+		}
+		builder.WriteString(encodeInt(span.Start - prev))
+		builder.WriteByte('-')
+		builder.WriteString(encodeInt(span.End - span.Start))
+		prev = span.Start
+	}
+	return builder.String()
+}
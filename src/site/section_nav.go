@@ -0,0 +1,85 @@
+package site
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// applyNavigation fills the breadcrumbs and section navigation of a page
+// from nav, which is nil until the first build.
+func (s *Service) applyNavigation(data *templatex.PageData, doc page, nav *SiteSnapshot) {
+	var titles map[string]string
+	var sections map[string][]PageInfo
+	if nav != nil {
+		titles, sections = nav.Titles, nav.sections
+	}
+	data.Breadcrumbs = buildBreadcrumbs(doc.Route, doc.Title, s.cfg.BaseURL, titles)
+	data.Section = sectionNav(doc.Route, sections)
+}
+
+// groupSections lists the public, published pages by the route of their
+// directory, in directory page order.
+func (s *Service) groupSections(pages []PageInfo) map[string][]PageInfo {
+	sections := make(map[string][]PageInfo)
+	for _, info := range pages {
+		if info.Draft || s.routeIsUnlisted(info.Route) {
+			continue
+		}
+		if parent := parentRoute(info.Route); parent != "" {
+			sections[parent] = append(sections[parent], info)
+		}
+	}
+	for _, group := range sections {
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := strings.ToLower(group[i].Title), strings.ToLower(group[j].Title)
+			if a != b {
+				return a < b
+			}
+			return group[i].Route < group[j].Route
+		})
+	}
+	return sections
+}
+
+// sectionNav finds the previous and next pages of the directory of the page
+// at route and the pages of the directory named like it. The home page has
+// no section, and drafts and private pages have no neighbours.
+func sectionNav(route string, sections map[string][]PageInfo) templatex.SectionNav {
+	var section templatex.SectionNav
+	if strings.Trim(route, "/") == "" {
+		return section
+	}
+	siblings := sections[parentRoute(route)]
+	for i, info := range siblings {
+		if info.Route != route {
+			continue
+		}
+		if i > 0 {
+			section.Previous = &templatex.PageLink{Title: siblings[i-1].Title, URL: siblings[i-1].URL}
+		}
+		if i < len(siblings)-1 {
+			section.Next = &templatex.PageLink{Title: siblings[i+1].Title, URL: siblings[i+1].URL}
+		}
+		break
+	}
+	for _, info := range sections[route] {
+		section.Children = append(section.Children, templatex.PageLink{Title: info.Title, URL: info.URL})
+	}
+	return section
+}
+
+// parentRoute returns the route of the directory holding route: "/a/" for
+// "/a/b/", "/" for "/a/" and "" for the root itself.
+func parentRoute(route string) string {
+	trimmed := strings.Trim(route, "/")
+	if trimmed == "" {
+		return ""
+	}
+	idx := strings.LastIndex(trimmed, "/")
+	if idx < 0 {
+		return "/"
+	}
+	return "/" + trimmed[:idx] + "/"
+}
@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/iedon/dn42-wiki-go/cdn"
 	"github.com/iedon/dn42-wiki-go/config"
 	"github.com/iedon/dn42-wiki-go/fsutil"
 	"github.com/iedon/dn42-wiki-go/gitutil"
@@ -33,11 +39,26 @@ type Service struct {
 	documents *DocumentStore
 	layout    *LayoutCache
 	search    *SearchCatalog
-
-	writeMu     sync.Mutex
-	buildMu     sync.Mutex
-	rebuildOnce sync.Once
-	rebuildCh   chan struct{}
+	startup   *startupTracker
+	snapshot  snapshotHolder
+	reuse     buildReuse
+	rejection pullRejectionHolder
+	purger    *cdn.Purger
+	// gitLog receives messages about pulls and clones.
+	gitLog *log.Logger
+
+	outputIndex outputIndexHolder
+	pageFlights flightGroup[[]byte]
+
+	// outputSuspect is set while the active output failed verification, so
+	// builds do not carry any of it over.
+	outputSuspect atomic.Bool
+	outputCheck   atomic.Pointer[OutputVerification]
+
+	slowestPages atomic.Pointer[[]PageTiming]
+
+	writeMu sync.Mutex
+	builds  buildQueue
 }
 type requestAnalysis struct {
 	original      string
@@ -59,52 +80,115 @@ func (a requestAnalysis) documentTargets(homeDoc string) (string, string, string
 	return rel, route, html, nil
 }
 
-// buildLayout constructs the common layout fragments.
+// buildLayout refreshes the layout fragments of every directory. Fragments
+// whose git blob is unchanged keep their previous rendering.
 func (s *Service) buildLayout(ctx context.Context) error {
-	_ = ctx
-
-	var (
-		headerHTML, footerHTML, serverFooterHTML, sidebarHTML template.HTML
-		err                                                   error
-	)
+	blobs, err := s.repo.BlobHashes(ctx, layoutFragmentNames...)
+	if err != nil {
+		return err
+	}
 
-	if !s.cfg.IgnoreHeader {
-		headerHTML, err = s.optionalFragment("_Header.md")
-		if err != nil {
-			return err
+	dirs := make(map[string]map[string]layoutFragment)
+	for file, blob := range blobs {
+		dir, name := path.Split(file)
+		dir = path.Clean(dir)
+		if (name == "_Header.md" && s.cfg.IgnoreHeader) || (name == "_Footer.md" && s.cfg.IgnoreFooter) {
+			continue
 		}
+		raw := path.Ext(name) == ".html"
+		if raw && (dir != "." || !s.cfg.Inject.RepoFiles) {
+			continue
+		}
+		entry, ok := s.layout.fragment(dir, name)
+		if !ok || entry.blob != blob {
+			source, err := s.documents.ReadFragment(file)
+			if err != nil {
+				return err
+			}
+			html := template.HTML(source)
+			if !raw {
+				if html, err = s.renderInlineMarkdown(string(source)); err != nil {
+					return fmt.Errorf("render %s: %w", file, err)
+				}
+			}
+			entry = layoutFragment{blob: blob, html: html}
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]layoutFragment)
+		}
+		dirs[dir][name] = entry
 	}
 
-	if !s.cfg.IgnoreFooter {
-		footerHTML, err = s.optionalFragment("_Footer.md")
-		if err != nil {
+	snapshot := s.layout.Snapshot()
+	serverFooterHTML := snapshot.ServerFooter
+	if snapshot.LoadedAt.IsZero() {
+		if serverFooterHTML, err = s.renderInlineMarkdown(strings.TrimSpace(s.cfg.ServerFooter)); err != nil {
 			return err
 		}
 	}
 
-	sidebarHTML, err = s.optionalFragment("_Sidebar.md")
-	if err != nil {
-		return err
+	bodyEnd := template.HTML(s.cfg.Inject.BodyEnd)
+	if s.cfg.Analytics.Enabled {
+		bodyEnd += analyticsBeacon
 	}
+	s.layout.replace(dirs, LayoutSnapshot{
+		ServerFooter: serverFooterHTML,
+		Head:         template.HTML(s.cfg.Inject.Head),
+		BodyEnd:      bodyEnd,
+	})
+	return nil
+}
 
-	serverFooterHTML, err = s.renderInlineMarkdown(strings.TrimSpace(s.cfg.ServerFooter))
-	if err != nil {
-		return err
+// analyticsBeacon reports a page view to /api/beacon, unless the browser
+// asks not to be tracked.
+const analyticsBeacon template.HTML = `<script>if(navigator.sendBeacon&&navigator.doNotTrack!=="1"&&!navigator.globalPrivacyControl)navigator.sendBeacon("/api/beacon",location.pathname);</script>`
+
+// ensureLayout loads the layout fragments unless a build already did.
+// Builds refresh them whenever the repository changes.
+func (s *Service) ensureLayout(ctx context.Context) error {
+	if !s.layout.Snapshot().LoadedAt.IsZero() {
+		return nil
 	}
+	return s.buildLayout(ctx)
+}
 
-	s.layout.Update(headerHTML, footerHTML, serverFooterHTML, sidebarHTML)
-	return nil
+// sidebarFor returns the sidebar of the page at rel: the _Sidebar.md of the
+// nearest directory above it that has one, falling back to the root sidebar.
+// An empty nested _Sidebar.md hides the sidebar for its subtree.
+func (s *Service) sidebarFor(rel string, root template.HTML) template.HTML {
+	if nested := s.layout.Nested("_Sidebar.md", rel); len(nested) > 0 {
+		return nested[0]
+	}
+	return root
 }
 
-func (s *Service) optionalFragment(name string) (template.HTML, error) {
-	fragment, err := s.documents.RenderFragment(name)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
-		}
-		return "", err
+// cascadeFragment combines the root rendering of a header or footer with the
+// ones in directories above the page at rel, according to layoutCascade.
+// Stacked headers run from the root down, stacked footers from the page up.
+func (s *Service) cascadeFragment(name, rel string, root template.HTML, footer bool) template.HTML {
+	nested := s.layout.Nested(name, rel)
+	if len(nested) == 0 {
+		return root
+	}
+	if s.cfg.LayoutCascade == config.LayoutCascadeReplace {
+		return nested[0]
+	}
+	parts := append(nested, root)
+	if !footer {
+		slices.Reverse(parts)
 	}
-	return template.HTML(fragment.HTML), nil
+	var sb strings.Builder
+	for _, part := range parts {
+		sb.WriteString(string(part))
+	}
+	return template.HTML(sb.String())
+}
+
+// layoutFor returns the header, footer and sidebar of the page at rel.
+func (s *Service) layoutFor(rel string, snapshot LayoutSnapshot) (header, footer, sidebar template.HTML) {
+	header = s.cascadeFragment("_Header.md", rel, snapshot.Header, false)
+	footer = s.cascadeFragment("_Footer.md", rel, snapshot.Footer, true)
+	return header, footer, s.sidebarFor(rel, snapshot.Sidebar)
 }
 
 func (s *Service) renderInlineMarkdown(content string) (template.HTML, error) {
@@ -121,6 +205,50 @@ func (s *Service) renderInlineMarkdown(content string) (template.HTML, error) {
 // NewService constructs a Service instance.
 func NewService(cfg *config.Config, repo *gitutil.Repository, templates *templatex.Engine) *Service {
 	rend := renderer.New()
+	if transforms, err := renderer.BuildTransforms(cfg.Render.Transforms, renderer.TransformOptions{
+		SiteName:  cfg.SiteName,
+		BaseURL:   cfg.BaseURL,
+		Variables: cfg.Render.Variables,
+	}); err != nil {
+		log.Printf("render transforms: %v", err)
+	} else {
+		rend.Use(transforms...)
+	}
+	rend.UseWikiLinks(cfg.BaseURL)
+	rend.UseInterwiki(cfg.Render.Interwiki)
+	rend.UseViewers(cfg.Render.Viewers...)
+	if cfg.Render.Math {
+		rend.UseMath()
+	}
+	if cfg.Render.Minify {
+		rend.UseMinify()
+	}
+	// Explicit external renderers are registered last so they can override
+	// the command behind a built-in format.
+	for _, name := range cfg.Render.Formats {
+		if format, ok := renderer.Format(name); ok {
+			if _, err := exec.LookPath(format.Command[0]); err != nil {
+				log.Printf("render format %s: %v", name, err)
+			}
+			rend.UseExternal(format)
+		}
+	}
+	for _, ext := range cfg.Render.External {
+		rend.UseExternal(renderer.External{
+			Name:       ext.Name,
+			Command:    ext.Command,
+			Fences:     ext.Fences,
+			Extensions: ext.Extensions,
+			Timeout:    time.Duration(ext.TimeoutSec) * time.Second,
+		})
+	}
+	var disk *diskRenderCache
+	if cfg.Cache.RenderDir != "" {
+		var err error
+		if disk, err = newDiskRenderCache(cfg.Cache.RenderDir, cfg.Cache.MaxRenderDirBytes, renderCacheSalt(cfg)); err != nil {
+			log.Printf("render cache: %v", err)
+		}
+	}
 	homeDoc := ensureHomeDoc(cfg.HomeDoc)
 	trimmedBase := strings.Trim(strings.TrimSpace(cfg.BaseURL), "/")
 	basePrefix := ""
@@ -138,12 +266,20 @@ func NewService(cfg *config.Config, repo *gitutil.Repository, templates *templat
 		basePrefix:  basePrefix,
 		baseRoot:    baseRoot,
 		baseTrimmed: trimmedBase,
-		documents:   newDocumentStore(repo, rend, homeDoc),
+		documents:   newDocumentStore(repo, rend, newRenderCache(cfg.Cache.MaxRenderedPages, disk), homeDoc, cfg.Summary, cfg.Render.TitleFromHeading),
 		layout:      newLayoutCache(),
-		search:      newSearchCatalog(),
+		search:      newSearchCatalog(cfg.Cache.MaxSearchIndexBytes),
+		startup:     newStartupTracker(),
+		gitLog:      log.Default(),
 	}
 }
 
+// UseGitLogger sends messages about pulls and clones to logger instead of
+// the standard logger.
+func (s *Service) UseGitLogger(logger *slog.Logger) {
+	s.gitLog = slog.NewLogLogger(logger.Handler(), slog.LevelInfo)
+}
+
 func (s *Service) searchIndexPath() string {
 	return path.Join("/", s.cfg.BaseURL, "search-index.json")
 }
@@ -220,6 +356,10 @@ func (s *Service) CanonicalRedirect(requestPath string) (string, bool, bool, err
 		canonical := s.pathWithBase(directoryPageRoute)
 		return canonical, false, info.original != canonical, nil
 	}
+	if info.relative == recentPageRoute && s.recentPageEnabled() {
+		canonical := s.pathWithBase(recentPageRoute)
+		return canonical, false, info.original != canonical, nil
+	}
 
 	if strings.EqualFold(info.relative, "/index") {
 		canonical := s.pathWithBase("/")
@@ -239,6 +379,15 @@ func (s *Service) CanonicalRedirect(requestPath string) (string, bool, bool, err
 	if err != nil {
 		return "", false, false, err
 	}
+	if target, ok := s.aliasTarget(route); ok {
+		exists, err := s.documents.Exists(rel)
+		if err != nil {
+			return "", false, false, fmt.Errorf("check document existence: %w", err)
+		}
+		if !exists {
+			return s.pathWithBase(target), true, true, nil
+		}
+	}
 	canonical := s.pathWithBase(route)
 	alias := route == "/" && info.candidate != ""
 	redirect := info.original != canonical
@@ -254,14 +403,29 @@ func (s *Service) CanonicalRedirect(requestPath string) (string, bool, bool, err
 	return canonical, alias, redirect, nil
 }
 
-// BuildStatic renders the entire repository into static HTML assets.
+// BuildStatic renders the entire repository into static HTML assets. Builds
+// are queued so only one runs at a time, and a newer request aborts a build
+// still in progress. Cancelling ctx stops waiting; the build itself stops
+// once no caller is waiting for it anymore.
 func (s *Service) BuildStatic(ctx context.Context) error {
+	select {
+	case err := <-s.builds.submit(ctx, s.buildStatic):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) buildStatic(ctx context.Context) error {
 	finalDir := s.cfg.OutputDir
 	parent := filepath.Dir(finalDir)
 	if parent == "" {
 		parent = "."
 	}
 
+	if err := s.checkBuildSpace(parent); err != nil {
+		return err
+	}
 	tempDir, err := os.MkdirTemp(parent, ".__build-")
 	if err != nil {
 		return fmt.Errorf("create temp output dir: %w", err)
@@ -277,6 +441,10 @@ func (s *Service) BuildStatic(ctx context.Context) error {
 		return err
 	}
 
+	head, err := s.repo.Head(ctx)
+	if err != nil {
+		return err
+	}
 	files, err := s.documents.ListTracked(ctx)
 	if err != nil {
 		return err
@@ -285,13 +453,28 @@ func (s *Service) BuildStatic(ctx context.Context) error {
 		return fmt.Errorf("repository has no tracked files")
 	}
 
-	docs, err := s.renderDocuments(ctx, files)
+	// Output that failed verification is not carried over into the new build.
+	trusted := s.outputReusable()
+	var plan *incrementalBuild
+	if trusted {
+		plan = s.planIncremental(ctx, head, files)
+	}
+	timings := newBuildTimings(s.cfg.Render.SlowestPages > 0)
+	docs, err := s.renderDocuments(ctx, files, plan, timings)
 	if err != nil {
 		return err
 	}
 
+	withheld := 0
 	for _, file := range files {
-		if isMarkdown(file) || isIgnorable(file) || isLayoutFragment(file) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if (s.documents.IsDocument(file) && !s.renderer.IsViewer(file)) || isIgnorable(file) || isLayoutFragment(file) {
+			continue
+		}
+		if !s.cfg.Assets.Allows(file) {
+			withheld++
 			continue
 		}
 		src := filepath.Join(s.repo.Dir, filepath.FromSlash(file))
@@ -300,28 +483,73 @@ func (s *Service) BuildStatic(ctx context.Context) error {
 			return fmt.Errorf("copy asset %s: %w", file, err)
 		}
 	}
+	if withheld > 0 {
+		log.Printf("build static: %d files not published, their types are not in assets", withheld)
+	}
 
-	if err := s.writeDocuments(tempDir, docs); err != nil {
-		return err
+	snapshot := s.newSiteSnapshot(files, docs)
+	for _, collision := range snapshot.Collisions {
+		log.Printf("build static: %s collision: %s", collision.Kind, strings.Join(collision.Paths, ", "))
+	}
+	changed := docs
+	if plan != nil {
+		active := s.snapshot.Load()
+		changed = make([]page, 0, len(plan.dirty))
+		for _, doc := range docs {
+			// Query pages list other pages, so they are never carried over.
+			if plan.dirty[doc.Source] || doc.Query != nil || s.navigationChanged(doc, active, snapshot) || !reusePage(finalDir, tempDir, doc) {
+				changed = append(changed, doc)
+			}
+		}
+		log.Printf("build static: incremental, %d of %d pages rewritten", len(changed), len(docs))
 	}
-	if err := s.writeDirectoryPage(ctx, tempDir); err != nil {
+	if err := s.writeDocuments(ctx, tempDir, changed, snapshot, timings); err != nil {
 		return err
 	}
+	// Edits that keep the set of documents and their indexed text unchanged
+	// carry the directory page and search index over from the active build.
+	prevDirectorySum, prevSearchSum := s.reuse.sums()
+	directorySum := s.directoryFingerprint(files)
+	if !trusted || directorySum != prevDirectorySum || !reuseOutput(finalDir, tempDir, directoryPageOutput) {
+		if err := s.writeDirectoryPage(tempDir, snapshot); err != nil {
+			return err
+		}
+	}
+	if s.recentPageEnabled() {
+		if err := s.writeRecentPage(ctx, tempDir, snapshot); err != nil {
+			return err
+		}
+	}
 	if err := s.writeNotFoundPage(ctx, tempDir); err != nil {
 		return err
 	}
 	if err := s.writeForbiddenPage(ctx, tempDir); err != nil {
 		return err
 	}
-
-	indexJSON, err := buildSearchIndex(docs)
-	if err != nil {
+	if err := s.writeRobotsTxt(tempDir, files); err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(tempDir, "search-index.json"), indexJSON, 0o644); err != nil {
-		return fmt.Errorf("write search index: %w", err)
+	if err := s.writeBadges(tempDir, files, snapshot); err != nil {
+		return err
+	}
+
+	searchable := make([]page, 0, len(docs))
+	for _, doc := range docs {
+		if !doc.Draft && !s.routeIsUnlisted(doc.Route) {
+			searchable = append(searchable, doc)
+		}
+	}
+	searchSum := searchFingerprint(searchable)
+	if !trusted || searchSum != prevSearchSum || !reuseOutput(finalDir, tempDir, "search-index.json") {
+		indexJSON, err := buildSearchIndex(searchable, s.cfg.Search.SnippetChars)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, "search-index.json"), indexJSON, 0o644); err != nil {
+			return fmt.Errorf("write search index: %w", err)
+		}
+		s.search.Update(indexJSON)
 	}
-	s.search.Update(indexJSON)
 
 	if s.templates.StaticDir != "" {
 		dst := filepath.Join(tempDir, "assets")
@@ -333,7 +561,27 @@ func (s *Service) BuildStatic(ctx context.Context) error {
 	if err := s.writeHomeAliases(tempDir, docs); err != nil {
 		return err
 	}
+	if err := s.writeAliasPages(tempDir, snapshot); err != nil {
+		return err
+	}
+	if s.cfg.Precompress.Enabled {
+		activeDir := finalDir
+		if !trusted {
+			activeDir = ""
+		}
+		if err := s.precompressOutputs(ctx, activeDir, tempDir); err != nil {
+			return err
+		}
+	}
+	manifest, err := hashOutput(tempDir)
+	if err != nil {
+		return fmt.Errorf("hash output: %w", err)
+	}
 
+	// Last chance to abort before the output is swapped.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if err := os.Chmod(tempDir, 0o755); err != nil {
 		return fmt.Errorf("set temp output permissions: %w", err)
 	}
@@ -361,9 +609,26 @@ func (s *Service) BuildStatic(ctx context.Context) error {
 		return fmt.Errorf("set final output permissions: %w", err)
 	}
 
+	s.snapshot.Store(snapshot)
+	s.recordSlowestPages(timings)
+	s.reuse.store(directorySum, searchSum)
+	s.reuse.storePages(head, docs)
+	if err := s.refreshOutputIndex(head); err != nil {
+		log.Printf("index output: %v", err)
+	}
+	if err := s.writeOutputManifest(head, manifest); err != nil {
+		log.Printf("write output manifest: %v", err)
+	}
+	// The first build has nothing to compare against and nothing cached yet.
+	if s.purger != nil {
+		if _, err := os.Stat(backupDir); err == nil {
+			s.purgeChanged(context.WithoutCancel(ctx), backupDir, finalDir)
+		}
+	}
 	_ = os.RemoveAll(backupDir)
 	cleanTemp = false
 	tempDir = ""
+	s.verifyBuiltOutput(head, manifest)
 	return nil
 }
 
@@ -372,6 +637,12 @@ func (s *Service) RenderPreview(content []byte) (*renderer.RenderResult, error)
 	return s.renderer.Render(content)
 }
 
+// FormatMarkdown normalizes the layout of Markdown source, failing with
+// renderer.ErrFormatChangesOutput when that would change how it renders.
+func (s *Service) FormatMarkdown(content []byte) ([]byte, error) {
+	return s.renderer.Format(content)
+}
+
 // SearchIndex returns a snapshot of the current search dataset.
 func (s *Service) SearchIndex() json.RawMessage {
 	payload := s.search.Snapshot()
@@ -386,41 +657,60 @@ func (s *Service) SearchIndex() json.RawMessage {
 }
 
 func (s *Service) triggerRebuild() {
-	s.rebuildOnce.Do(func() {
-		s.rebuildCh = make(chan struct{}, 1)
-		go s.rebuildWorker()
-	})
-	select {
-	case s.rebuildCh <- struct{}{}:
-	default:
-	}
-}
-
-func (s *Service) rebuildWorker() {
-	for range s.rebuildCh {
-		s.buildMu.Lock()
-		if err := s.BuildStatic(context.Background()); err != nil {
+	done := s.builds.submit(context.Background(), s.buildStatic)
+	go func() {
+		if err := <-done; err != nil {
 			log.Printf("build static: %v", err)
 		}
-		s.buildMu.Unlock()
-	}
+	}()
 }
 
 // Pull synchronizes the repository and refreshes caches.
 func (s *Service) Pull(ctx context.Context) error {
+	if !s.Ready() {
+		return ErrNotReady
+	}
+	var prev string
+	if s.cfg.PullValidation.Enabled {
+		head, err := s.repo.Head(ctx)
+		if err != nil {
+			return err
+		}
+		prev = head
+	}
 	changed, err := s.repo.Pull(ctx)
 	if err != nil {
 		return err
 	}
+	if source := s.repo.LastPullSource(); source != s.cfg.Git.Remote {
+		s.gitLog.Printf("pull: primary remote unavailable, served by mirror %s", gitutil.RedactURL(source))
+	}
 	if !changed {
 		return nil
 	}
-	if err := s.BuildStatic(ctx); err != nil {
+	if s.cfg.PullValidation.Enabled {
+		if err := s.validatePull(context.WithoutCancel(ctx), prev); err != nil {
+			return err
+		}
+	}
+	// The checkout already moved, so finish the build even if the caller
+	// goes away.
+	if err := s.BuildStatic(context.WithoutCancel(ctx)); err != nil {
 		return fmt.Errorf("build static: %w", err)
 	}
 	return nil
 }
 
+// HeadCommit reports the commit currently checked out in the wiki repository.
+func (s *Service) HeadCommit(ctx context.Context) (string, error) {
+	return s.repo.Head(ctx)
+}
+
+// Branch returns the branch the wiki is served from.
+func (s *Service) Branch(ctx context.Context) (string, error) {
+	return s.repo.Branch(ctx)
+}
+
 // Push synchronizes local commits to the configured remote.
 func (s *Service) Push(ctx context.Context) error {
 	return s.repo.Push(ctx)
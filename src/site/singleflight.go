@@ -0,0 +1,49 @@
+package site
+
+import (
+	"sync"
+
+	"github.com/iedon/dn42-wiki-go/metrics"
+)
+
+var renderCoalesced = metrics.NewCounter("wiki_render_coalesced_total", "Renders answered by joining an identical render already in flight.")
+
+// flightGroup coalesces concurrent calls with the same key so only one of
+// them does the work, as after a rebuild when many requests miss together.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// Do runs fn once per key among concurrent callers and shares its result.
+func (g *flightGroup[T]) Do(key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[T])
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		renderCoalesced.Inc()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+	call := &flightCall[T]{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.val, call.err = fn()
+	return call.val, call.err
+}
@@ -0,0 +1,159 @@
+package site
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// maxRecentChanges bounds the recently changed documents kept per snapshot.
+const maxRecentChanges = 50
+
+// SiteSnapshot is the immutable site-wide navigation data computed once per
+// build and shared by every page render of that build.
+type SiteSnapshot struct {
+	BuiltAt   time.Time
+	Directory []*templatex.DirectoryEntry
+	// ArchivedDirectory holds the pages under archivedPagesPrefix, which
+	// Directory leaves out.
+	ArchivedDirectory []*templatex.DirectoryEntry
+	// Recent lists documents by last commit, newest first.
+	Recent []RecentChange
+	// Titles maps document routes to their display titles.
+	Titles map[string]string
+	// Pages lists the metadata of every document, sorted by route.
+	Pages []PageInfo
+	// Aliases maps the alias routes from page front matter to the routes
+	// of their pages.
+	Aliases map[string]string
+	// Collisions lists pages whose routes differ only in case or that
+	// share a title.
+	Collisions []Collision
+	// Orphans lists the routes of pages not reachable from the home page
+	// or a sidebar.
+	Orphans []string
+	// sections groups the listed pages by the route of their directory.
+	sections map[string][]PageInfo
+}
+
+// PageInfo is the metadata of a document that query pages select from.
+type PageInfo struct {
+	Title   string
+	Route   string
+	URL     string
+	Summary string
+	Tags    []string
+	ModTime time.Time
+	Draft   bool
+}
+
+// RecentChange describes the latest commit touching a document.
+type RecentChange struct {
+	Title   string
+	Route   string
+	URL     string
+	Hash    string
+	ModTime time.Time
+}
+
+type snapshotHolder struct {
+	current atomic.Pointer[SiteSnapshot]
+}
+
+func (h *snapshotHolder) Load() *SiteSnapshot {
+	return h.current.Load()
+}
+
+func (h *snapshotHolder) Store(snapshot *SiteSnapshot) {
+	h.current.Store(snapshot)
+}
+
+// newSiteSnapshot derives navigation data from the tracked files and the
+// documents rendered for a build.
+func (s *Service) newSiteSnapshot(files []string, docs []page) *SiteSnapshot {
+	titles := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		titles[doc.Route] = doc.Title
+	}
+	tree := newDirectoryTree(s.cfg.BaseURL, s.homeDoc)
+	archived := newDirectoryTree(s.cfg.BaseURL, s.homeDoc)
+	// Both lists share the directory page, so their anchors must not clash.
+	archived.anchors = tree.anchors
+	for _, file := range files {
+		if !s.documents.IsDocument(file) || isLayoutFragment(file) {
+			continue
+		}
+		route := routeFromPath(file, s.homeDoc)
+		if s.cfg.IsPathArchived(route) {
+			archived.add(file, titles[route])
+			continue
+		}
+		tree.add(file, titles[route])
+	}
+
+	recent := make([]RecentChange, 0, len(docs))
+	pages := make([]PageInfo, 0, len(docs))
+	for _, doc := range docs {
+		pages = append(pages, PageInfo{
+			Title:   doc.Title,
+			Route:   doc.Route,
+			URL:     resolveDirectoryURL(s.cfg.BaseURL, doc.Route),
+			Summary: doc.Summary,
+			Tags:    doc.Tags,
+			ModTime: doc.LastMod,
+			Draft:   doc.Draft,
+		})
+		if doc.LastMod.IsZero() {
+			continue
+		}
+		recent = append(recent, RecentChange{
+			Title:   doc.Title,
+			Route:   doc.Route,
+			URL:     resolveDirectoryURL(s.cfg.BaseURL, doc.Route),
+			Hash:    doc.LastHash,
+			ModTime: doc.LastMod,
+		})
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].ModTime.After(recent[j].ModTime)
+	})
+	if len(recent) > maxRecentChanges {
+		recent = recent[:maxRecentChanges]
+	}
+
+	var orphans []string
+	if len(docs) > 0 {
+		for _, doc := range s.findOrphans(docs, s.layout.Fragments("_Sidebar.md")) {
+			orphans = append(orphans, doc.Route)
+		}
+	}
+
+	return &SiteSnapshot{
+		BuiltAt:           time.Now().UTC(),
+		Directory:         tree.entries(),
+		ArchivedDirectory: archived.entries(),
+		Recent:            recent,
+		Titles:            titles,
+		Pages:             pages,
+		Aliases:           s.pageAliasTargets(docs),
+		Collisions:        findCollisions(docs),
+		Orphans:           orphans,
+		sections:          s.groupSections(pages),
+	}
+}
+
+// Snapshot returns the navigation data of the last build, computing a
+// directory-only snapshot when no build has completed yet.
+func (s *Service) Snapshot(ctx context.Context) (*SiteSnapshot, error) {
+	if snapshot := s.snapshot.Load(); snapshot != nil {
+		return snapshot, nil
+	}
+	files, err := s.documents.ListTracked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.newSiteSnapshot(files, nil), nil
+}
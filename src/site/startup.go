@@ -0,0 +1,152 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// Startup phases reported while the repository is prepared in live mode.
+const (
+	StartupPending  = "pending"
+	StartupCloning  = "cloning"
+	StartupBuilding = "building"
+	StartupReady    = "ready"
+)
+
+// ErrNotReady is returned by operations that need the repository before the
+// initial clone has completed.
+var ErrNotReady = errors.New("wiki is still initializing")
+
+// StartupStatus describes the progress of the initial clone and build.
+type StartupStatus struct {
+	Phase     string    `json:"phase"`
+	Since     time.Time `json:"since"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type startupTracker struct {
+	mu      sync.RWMutex
+	status  StartupStatus
+	readyCh chan struct{}
+}
+
+func newStartupTracker() *startupTracker {
+	return &startupTracker{
+		status:  StartupStatus{Phase: StartupPending, Since: time.Now().UTC()},
+		readyCh: make(chan struct{}),
+	}
+}
+
+func (t *startupTracker) setPhase(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.Phase == StartupReady {
+		return
+	}
+	t.status.Phase = phase
+	t.status.Since = time.Now().UTC()
+	if phase == StartupReady {
+		close(t.readyCh)
+	}
+}
+
+func (t *startupTracker) attempt() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Attempts++
+	return t.status.Attempts
+}
+
+func (t *startupTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = err.Error()
+}
+
+// Initialize clones the repository and performs the first build, retrying
+// clone failures with backoff until it succeeds or ctx is cancelled. Build
+// failures are logged and do not hold the service back, matching the
+// behaviour of later rebuilds.
+func (s *Service) Initialize(ctx context.Context) error {
+	s.verifyStaleOutput()
+	delay := 5 * time.Second
+	for {
+		attempt := s.startup.attempt()
+		s.startup.setPhase(StartupCloning)
+		err := s.repo.EnsureClone()
+		if err == nil {
+			break
+		}
+		s.startup.fail(err)
+		s.gitLog.Printf("initialize: clone attempt %d failed, retrying in %s: %v", attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 5*time.Minute)
+	}
+
+	s.startup.setPhase(StartupBuilding)
+	if err := s.BuildStatic(ctx); err != nil {
+		s.startup.fail(err)
+		log.Printf("initialize: static build: %v", err)
+	}
+	s.startup.setPhase(StartupReady)
+	go s.watchOutput(ctx)
+	return nil
+}
+
+// Ready reports whether the initial clone and build have finished.
+func (s *Service) Ready() bool {
+	select {
+	case <-s.startup.readyCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitReady blocks until Initialize has finished or ctx is cancelled.
+func (s *Service) WaitReady(ctx context.Context) error {
+	select {
+	case <-s.startup.readyCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartupStatus returns a copy of the current initialization progress.
+func (s *Service) StartupStatus() StartupStatus {
+	s.startup.mu.RLock()
+	defer s.startup.mu.RUnlock()
+	return s.startup.status
+}
+
+// RenderInitializingPage renders the themed placeholder shown until the wiki
+// is ready. Repository fragments are not available yet, so the layout only
+// carries server-provided content.
+func (s *Service) RenderInitializingPage() ([]byte, error) {
+	doc := page{Title: "Starting up"}
+	data := s.pageData(doc)
+	data.Editable = false
+	data.Buttons = templatex.PageButtons{}
+	data.ContentTemplate = templatex.InitializingContentTemplate
+	data.ActivePath = ""
+	data.RequestedPath = "/"
+	data.Meta = s.buildMeta("The wiki is starting up.", doc.Title, "website")
+
+	var buf bytes.Buffer
+	if err := s.templates.Render(&buf, data); err != nil {
+		return nil, err
+	}
+	return s.renderer.MinifyHTML(buf.Bytes())
+}
@@ -17,6 +17,10 @@ func (s *Service) StaticDocumentPath(requestPath string) (string, error) {
 		return filepath.Join(s.cfg.OutputDir, "index.html"), nil
 	case directoryPageRoute:
 		return filepath.Join(s.cfg.OutputDir, directoryPageOutput), nil
+	case recentPageRoute:
+		if s.recentPageEnabled() {
+			return filepath.Join(s.cfg.OutputDir, recentPageOutput), nil
+		}
 	}
 
 	_, _, htmlPath, err := info.documentTargets(s.homeDoc)
@@ -26,6 +30,20 @@ func (s *Service) StaticDocumentPath(requestPath string) (string, error) {
 	return filepath.Join(s.cfg.OutputDir, filepath.FromSlash(htmlPath)), nil
 }
 
+// PublishedAsset reports whether a file of the output, other than a page,
+// may be served: generated files and template assets always, repository
+// files when the assets configuration allows their type.
+func (s *Service) PublishedAsset(rel string) bool {
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	switch {
+	case rel == "robots.txt", rel == "search-index.json", strings.HasPrefix(rel, badgeDir+"/"):
+		return true
+	case s.templates.StaticDir != "" && strings.HasPrefix(rel, "assets/"):
+		return true
+	}
+	return s.cfg.Assets.Allows(rel)
+}
+
 // NotFoundDocumentPath returns the static 404 page path.
 func (s *Service) NotFoundDocumentPath() string {
 	return filepath.Join(s.cfg.OutputDir, "404.html")
@@ -3,6 +3,9 @@ package site
 import (
 	"path/filepath"
 	"strings"
+
+	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/renderer"
 )
 
 func deriveTitle(relPath string) string {
@@ -16,61 +19,48 @@ func deriveTitle(relPath string) string {
 	return name
 }
 
-func summarize(plain string) string {
-	plain = strings.TrimSpace(plain)
-	if plain == "" {
-		return ""
+// firstHeading returns the text of the first heading of the given level.
+func firstHeading(headings []renderer.Heading, level int) string {
+	for _, heading := range headings {
+		if heading.Level == level {
+			return strings.Join(strings.Fields(heading.Text), " ")
+		}
+	}
+	return ""
+}
+
+// summarize takes the summary of a page from the first configured source it
+// has, falling back to the start of its text.
+func summarize(cfg config.SummaryConfig, description string, rendered *renderer.RenderResult) string {
+	text := ""
+	for _, source := range cfg.Sources {
+		switch source {
+		case config.SummaryDescription:
+			text = description
+		case config.SummaryMore:
+			text = rendered.Excerpt
+		case config.SummaryParagraph:
+			text = rendered.Lead
+		case config.SummaryText:
+			text = rendered.PlainText
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			break
+		}
 	}
-	if len(plain) <= 200 {
-		return plain
+	if text == "" {
+		text = rendered.PlainText
 	}
-	return plain[:200] + "..."
+	return renderer.Summarize(text, cfg.MaxChars)
 }
 
+// metaDescription shortens the summary, or the fallback without one, for
+// the description meta tag.
 func metaDescription(summary, fallback string) string {
 	const limit = 160
 	text := strings.TrimSpace(summary)
 	if text == "" {
-		text = strings.TrimSpace(fallback)
-	}
-	if text == "" {
-		return ""
-	}
-	text = strings.Join(strings.Fields(text), " ")
-	text = fixPunctuationSpacing(text)
-	runes := []rune(text)
-	if len(runes) <= limit {
-		return text
-	}
-	cutoff := min(limit, len(runes))
-	trimmed := strings.TrimSpace(string(runes[:cutoff]))
-	if idx := strings.LastIndex(trimmed, " "); idx > -1 {
-		trimmed = trimmed[:idx]
+		text = fallback
 	}
-	trimmed = strings.TrimSpace(trimmed)
-	if trimmed == "" {
-		return ""
-	}
-	return trimmed + "..."
-}
-
-func fixPunctuationSpacing(s string) string {
-	replacer := strings.NewReplacer(
-		" ,", ",",
-		" .", ".",
-		" ;", ";",
-		" :", ":",
-		" !", "!",
-		" ?", "?",
-		" %", "%",
-		" )", ")",
-		" ]", "]",
-		" }", "}",
-		" '", "'",
-		" \"", "\"",
-		"( ", "(",
-		"[ ", "[",
-		"{ ", "{",
-	)
-	return replacer.Replace(s)
+	return renderer.Summarize(text, limit)
 }
@@ -0,0 +1,52 @@
+package site
+
+import (
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/templatex"
+)
+
+// nestSections turns the flat headings of a page into the table of contents
+// tree, each section located in the page HTML content. Headings not found
+// in content, eg. when a transform dropped them, start where the previous
+// one does.
+func nestSections(flat []templatex.TOCEntry, content string) []templatex.TOCEntry {
+	if len(flat) == 0 {
+		return nil
+	}
+	located := make([]templatex.TOCEntry, len(flat))
+	cursor := 0
+	for i, entry := range flat {
+		entry.Start = cursor
+		if at := strings.Index(content[cursor:], ` id="`+entry.ID+`"`); at >= 0 {
+			if open := strings.LastIndexByte(content[:cursor+at], '<'); open >= cursor {
+				entry.Start = open
+			}
+			cursor += at
+		}
+		entry.End = len(content)
+		located[i] = entry
+	}
+	for i := range located {
+		for _, next := range located[i+1:] {
+			if next.Level <= located[i].Level {
+				located[i].End = next.Start
+				break
+			}
+		}
+	}
+	entries, _ := nestEntries(located, 0, 0)
+	return entries
+}
+
+// nestEntries collects the entries from i on that are deeper than level,
+// and returns where it stopped.
+func nestEntries(located []templatex.TOCEntry, i, level int) ([]templatex.TOCEntry, int) {
+	var entries []templatex.TOCEntry
+	for i < len(located) && located[i].Level > level {
+		entry := located[i]
+		entry.Children, i = nestEntries(located, i+1, entry.Level)
+		entries = append(entries, entry)
+	}
+	return entries, i
+}
@@ -0,0 +1,149 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/iedon/dn42-wiki-go/config"
+)
+
+var (
+	// ErrUploadType rejects files whose content or extension is not allowed.
+	ErrUploadType = errors.New("file type not allowed")
+	// ErrUploadTooLarge rejects files above uploads.maxBytes.
+	ErrUploadTooLarge = errors.New("file too large")
+)
+
+// maxUploadNameAttempts bounds the numbered names tried when an upload's
+// name is taken.
+const maxUploadNameAttempts = 100
+
+// Upload describes a committed attachment.
+type Upload struct {
+	Path     string `json:"path"`
+	URL      string `json:"url"`
+	Markdown string `json:"markdown"`
+}
+
+// SaveUpload validates an attachment, writes it below the uploads directory
+// and commits it. Existing files are never overwritten; a numbered name is
+// picked instead.
+func (s *Service) SaveUpload(ctx context.Context, name string, data []byte, message, remoteAddr string) (*Upload, error) {
+	if !s.cfg.Editable || !s.cfg.Uploads.Enabled {
+		return nil, fmt.Errorf("uploads disabled")
+	}
+	if int64(len(data)) > s.cfg.Uploads.MaxBytes {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrUploadTooLarge, s.cfg.Uploads.MaxBytes)
+	}
+	base, ext := uploadName(name)
+	if base == "" {
+		return nil, fmt.Errorf("%w: file name required", ErrInvalidPath)
+	}
+	if err := s.checkUploadType(ext, data); err != nil {
+		return nil, err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.ensureRepositoryFresh(ctx); err != nil {
+		return nil, err
+	}
+
+	rel := ""
+	for attempt := 0; attempt < maxUploadNameAttempts && rel == ""; attempt++ {
+		candidate := base + ext
+		if attempt > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", base, attempt, ext)
+		}
+		candidate = path.Join(s.cfg.Uploads.Dir, candidate)
+		exists, err := s.documents.Exists(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			rel = candidate
+		}
+	}
+	if rel == "" {
+		return nil, fmt.Errorf("no free name for %s%s in %s", base, ext, s.cfg.Uploads.Dir)
+	}
+	if err := s.checkAccess(ctx, rel, config.ACLWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.documents.Write(rel, data); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(message) == "" {
+		message = fmt.Sprintf("Upload file: `%s`", rel)
+	}
+	finalMessage, err := s.composeCommitMessage(message, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.documents.Commit(ctx, []string{rel}, finalMessage, s.composeCommitAuthor(ctx)); err != nil {
+		return nil, err
+	}
+	if err := s.finalizeCommit(ctx); err != nil {
+		return nil, err
+	}
+	s.triggerRebuild()
+
+	upload := &Upload{Path: rel, URL: s.pathWithBase("/" + rel)}
+	label := path.Base(rel)
+	if strings.HasPrefix(mime.TypeByExtension(ext), "image/") {
+		upload.Markdown = fmt.Sprintf("![%s](%s)", label, upload.URL)
+	} else {
+		upload.Markdown = fmt.Sprintf("[%s](%s)", label, upload.URL)
+	}
+	return upload, nil
+}
+
+// checkUploadType accepts a file when its sniffed media type is allowed and
+// its extension names the same type.
+func (s *Service) checkUploadType(ext string, data []byte) error {
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil || !slices.Contains(s.cfg.Uploads.Types, sniffed) {
+		return fmt.Errorf("%w: %s", ErrUploadType, sniffed)
+	}
+	declared, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil || declared != sniffed {
+		return fmt.Errorf("%w: extension %q does not match %s content", ErrUploadType, ext, sniffed)
+	}
+	if s.documents.IsDocument("upload" + ext) {
+		return fmt.Errorf("%w: %s files are pages", ErrUploadType, ext)
+	}
+	return nil
+}
+
+// uploadName splits a client supplied file name into a safe base name and
+// its lowercased extension. Directories are dropped, and runs of characters
+// other than letters, digits and '_' become a single '-'.
+func uploadName(name string) (string, string) {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	ext := strings.ToLower(filepath.Ext(name))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+	var sb strings.Builder
+	dash := false
+	for _, r := range stem {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			sb.WriteRune(r)
+			dash = false
+		case !dash && sb.Len() > 0:
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(sb.String(), "-"), ext
+}
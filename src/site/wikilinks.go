@@ -0,0 +1,65 @@
+package site
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/iedon/dn42-wiki-go/renderer"
+)
+
+var wikiLinkTag = regexp.MustCompile(`<a class="` + renderer.WikiLinkClass + `" href="([^"]*)">`)
+
+// markMissingLinks flags [[Page]] links whose target is not a known document
+// so editors can spot them. Rendering is cached by content alone, so this
+// runs per build against the current set of routes.
+func (s *Service) markMissingLinks(content template.HTML, titles map[string]string) template.HTML {
+	if titles == nil || !strings.Contains(string(content), renderer.WikiLinkClass) {
+		return content
+	}
+	marked := wikiLinkTag.ReplaceAllStringFunc(string(content), func(tag string) string {
+		href := html.UnescapeString(wikiLinkTag.FindStringSubmatch(tag)[1])
+		if s.wikiLinkExists(href, titles) {
+			return tag
+		}
+		return strings.Replace(tag, `class="`+renderer.WikiLinkClass+`"`, `class="`+renderer.WikiLinkClass+` `+renderer.WikiLinkMissingClass+`"`, 1)
+	})
+	return template.HTML(marked)
+}
+
+func (s *Service) wikiLinkExists(href string, titles map[string]string) bool {
+	if path, _, _ := strings.Cut(href, "#"); path == "" {
+		return true
+	}
+	_, ok := s.linkedRoute(href, titles)
+	return ok
+}
+
+// linkedRoute resolves an in-site link to the route of a known document,
+// ignoring any #fragment.
+func (s *Service) linkedRoute(href string, titles map[string]string) (string, bool) {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	rel, ok := s.trimBase(sanitizeRoute(href))
+	if !ok {
+		return "", false
+	}
+	if rel == "/" {
+		return "/", true
+	}
+	if _, ok := titles[rel+"/"]; ok {
+		return rel + "/", true
+	}
+	// Links may name the home document explicitly, eg. [[Home]].
+	norm, err := normalizeRelPath(rel, s.homeDoc)
+	if err != nil {
+		return "", false
+	}
+	route := routeFromPath(norm, s.homeDoc)
+	_, ok = titles[route]
+	return route, ok
+}
@@ -0,0 +1,357 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	formatVersion = 1
+	manifestName  = "manifest.json"
+	configName    = "config.json"
+	repoPrefix    = "repo"
+	storesPrefix  = "stores"
+)
+
+// Manifest describes the contents of a snapshot archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Server    string    `json:"server,omitempty"`
+	Stores    []string  `json:"stores,omitempty"`
+}
+
+// Options controls snapshot creation.
+type Options struct {
+	// RepoDir is the working copy of the wiki repository, including .git.
+	RepoDir string
+	// Config holds the redacted configuration document to embed.
+	Config []byte
+	// Stores maps a logical store name to a local directory or file to
+	// include.
+	Stores map[string]string
+	// Server identifies the producing binary in the manifest.
+	Server string
+}
+
+// RestoreOptions controls how a snapshot is unpacked.
+type RestoreOptions struct {
+	// RepoDir receives the repository contents.
+	RepoDir string
+	// ConfigPath optionally receives the embedded (redacted) configuration.
+	ConfigPath string
+	// Stores maps a logical store name to its destination directory or
+	// file.
+	Stores map[string]string
+	// Force allows restoring into non-empty destinations.
+	Force bool
+}
+
+// Create writes a gzip-compressed tar archive holding the repository, the
+// redacted configuration, and any additional local stores.
+func Create(w io.Writer, opts Options) error {
+	if strings.TrimSpace(opts.RepoDir) == "" {
+		return errors.New("repository directory required")
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(opts.Stores))
+	for name := range opts.Stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest := Manifest{
+		Version:   formatVersion,
+		CreatedAt: time.Now().UTC(),
+		Server:    opts.Server,
+		Stores:    names,
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := writeBytes(tw, manifestName, manifestJSON); err != nil {
+		return err
+	}
+	if len(opts.Config) > 0 {
+		if err := writeBytes(tw, configName, opts.Config); err != nil {
+			return err
+		}
+	}
+	if err := addTree(tw, opts.RepoDir, repoPrefix); err != nil {
+		return fmt.Errorf("archive repository: %w", err)
+	}
+	for _, name := range names {
+		dir := opts.Stores[name]
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := addTree(tw, dir, path.Join(storesPrefix, name)); err != nil {
+			return fmt.Errorf("archive store %s: %w", name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore unpacks an archive produced by Create.
+func Restore(r io.Reader, opts RestoreOptions) (*Manifest, error) {
+	if strings.TrimSpace(opts.RepoDir) == "" {
+		return nil, errors.New("repository directory required")
+	}
+	if !opts.Force {
+		if err := ensureEmpty(opts.RepoDir); err != nil {
+			return nil, err
+		}
+		for _, dir := range opts.Stores {
+			if err := ensureEmpty(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		switch {
+		case name == manifestName:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("parse manifest: %w", err)
+			}
+			if manifest.Version > formatVersion {
+				return nil, fmt.Errorf("unsupported snapshot version %d", manifest.Version)
+			}
+		case name == configName:
+			if opts.ConfigPath == "" {
+				continue
+			}
+			if err := extractEntry(tr, hdr, opts.ConfigPath); err != nil {
+				return nil, err
+			}
+		case name == repoPrefix || strings.HasPrefix(name, repoPrefix+"/"):
+			if err := extractUnder(tr, hdr, opts.RepoDir, strings.TrimPrefix(name, repoPrefix)); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, storesPrefix+"/"):
+			rest := strings.TrimPrefix(name, storesPrefix+"/")
+			store, rel, _ := strings.Cut(rest, "/")
+			dir, ok := opts.Stores[store]
+			if !ok || dir == "" {
+				continue
+			}
+			if err := extractUnder(tr, hdr, dir, rel); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("archive is missing a manifest")
+	}
+	return manifest, nil
+}
+
+func addTree(tw *tar.Writer, root, prefix string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+func writeBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func extractUnder(tr *tar.Reader, hdr *tar.Header, root, rel string) error {
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if !within(root, target) {
+		return fmt.Errorf("archive entry %q escapes destination", hdr.Name)
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		link := filepath.FromSlash(hdr.Linkname)
+		if filepath.IsAbs(link) || !within(root, filepath.Join(filepath.Dir(target), link)) {
+			return fmt.Errorf("archive entry %q links outside destination", hdr.Name)
+		}
+	}
+	// Links restored earlier, or already present under -force, must not
+	// redirect later entries outside the destination.
+	if rel != "" && !resolvesWithin(root, filepath.Dir(target)) {
+		return fmt.Errorf("archive entry %q would be written through a link", hdr.Name)
+	}
+	return extractEntry(tr, hdr, target)
+}
+
+// resolvesWithin reports whether dir, after following any symlinks in the
+// part of it that already exists, still lies within root.
+func resolvesWithin(root, dir string) bool {
+	base, err := filepath.EvalSymlinks(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return within(base, filepath.Join(resolved, rest))
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+func extractEntry(tr *tar.Reader, hdr *tar.Header, target string) error {
+	mode := fs.FileMode(hdr.Mode).Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0o755)
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		_ = os.Remove(target)
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0o200)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, tr); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	default:
+		return nil
+	}
+}
+
+func ensureEmpty(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("destination %s already exists", dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("destination %s is not empty", dir)
+	}
+	return nil
+}
+
+func within(base, target string) bool {
+	rel, err := filepath.Rel(filepath.Clean(base), filepath.Clean(target))
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
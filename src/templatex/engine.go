@@ -14,8 +14,15 @@ const (
 	DefaultContentTemplate   = "content-default"
 	NotFoundContentTemplate  = "content-404"
 	ForbiddenContentTemplate = "content-403"
+	// ErrorContentTemplate is shown when a request fails unexpectedly.
+	ErrorContentTemplate     = "content-500"
 	DirectoryContentTemplate = "content-directory"
-	LayoutTemplate           = "layout"
+	RecentContentTemplate    = "content-recent"
+	// QueryResultsTemplate lists the pages matched by a query page.
+	QueryResultsTemplate = "query-results"
+	// InitializingContentTemplate is shown until the first build completes.
+	InitializingContentTemplate = "content-initializing"
+	LayoutTemplate              = "layout"
 )
 
 // Engine is a thin wrapper around Go templates with a fallback default layout.
@@ -31,24 +38,44 @@ type PageData struct {
 	HeaderHTML       template.HTML
 	FooterHTML       template.HTML
 	ServerFooterHTML template.HTML
-	SidebarHTML      template.HTML
-	ContentHTML      template.HTML
-	ContentTemplate  string
-	Sections         []TOCEntry
-	ActivePath       string
-	RequestedPath    string
-	Editable         bool
-	Buttons          PageButtons
-	SearchIndexURL   string
-	Live             bool
-	BaseURL          string
-	Breadcrumbs      []Breadcrumb
-	LastUpdatedISO   string
-	LastUpdated      string
-	LastCommitHash   string
-	LastCommitShort  string
-	Directory        []*DirectoryEntry
-	Meta             Meta
+	// HeadHTML and BodyEndHTML are operator snippets, such as analytics or
+	// custom CSS, placed at the end of <head> and <body>.
+	HeadHTML        template.HTML
+	BodyEndHTML     template.HTML
+	SidebarHTML     template.HTML
+	ContentHTML     template.HTML
+	ContentTemplate string
+	Sections        []TOCEntry
+	ActivePath      string
+	RequestedPath   string
+	// ErrorReference identifies a failed request in the logs, on error
+	// pages.
+	ErrorReference  string
+	Editable        bool
+	Buttons         PageButtons
+	SearchIndexURL  string
+	Live            bool
+	BaseURL         string
+	Breadcrumbs     []Breadcrumb
+	LastUpdatedISO  string
+	LastUpdated     string
+	LastCommitHash  string
+	LastCommitShort string
+	HistoryFeedURL  string
+	Directory       []*DirectoryEntry
+	// ArchivedDirectory lists the archived pages apart from Directory.
+	ArchivedDirectory []*DirectoryEntry
+	Changes           []ChangeEntry
+	Meta              Meta
+	Staging           bool
+	Draft             bool
+	// Archived pages are kept for the record and cannot be edited.
+	Archived bool
+	// Pinned is the short hash of the commit a pinned page is shown as of.
+	Pinned       string
+	NewerThanPin bool
+	// Section lists the pages around this one in the directory tree.
+	Section SectionNav
 }
 
 // Meta holds SEO-oriented metadata for the rendered page.
@@ -56,13 +83,21 @@ type Meta struct {
 	Description   string
 	OpenGraphType string
 	OpenGraphSite string
+	Robots        string
 }
 
-// TOCEntry models a single heading for sidebar navigation.
+// TOCEntry models a single heading for sidebar navigation. In PageData the
+// entries are nested: Children holds the headings of a higher level up to
+// the next heading of the same or a lower one.
 type TOCEntry struct {
 	ID    string
 	Text  string
 	Level int
+	// Start and End are the byte offsets in ContentHTML of the section, from
+	// its heading up to the next heading of the same or a lower level.
+	Start    int
+	End      int
+	Children []TOCEntry
 }
 
 // PageButtons controls the visibility of editing actions.
@@ -72,6 +107,7 @@ type PageButtons struct {
 	EnableEdit    bool
 	EnableNew     bool
 	EnableDelete  bool
+	EnableUpload  bool
 }
 
 // Breadcrumb models a single breadcrumb entry for navigation.
@@ -81,6 +117,21 @@ type Breadcrumb struct {
 	Current bool
 }
 
+// PageLink links another page by its title.
+type PageLink struct {
+	Title string
+	URL   string
+}
+
+// SectionNav holds the neighbours of a page in the directory tree: the
+// previous and next pages of its directory, in directory page order, and
+// the pages in the directory named like the page.
+type SectionNav struct {
+	Previous *PageLink
+	Next     *PageLink
+	Children []PageLink
+}
+
 // DirectoryEntry represents a node in the directory listing hierarchy.
 type DirectoryEntry struct {
 	Title    string
@@ -94,6 +145,34 @@ type DirectoryEntry struct {
 	Aliases  []string
 }
 
+// ChangeEntry is a commit listed on the recent changes page.
+type ChangeEntry struct {
+	Hash      string
+	ShortHash string
+	Author    string
+	Message   string
+	DateISO   string
+	Date      string
+	Pages     []ChangedPage
+}
+
+// ChangedPage is a page touched by a listed commit. Deleted pages have no URL.
+type ChangedPage struct {
+	Title   string
+	URL     string
+	Deleted bool
+}
+
+// QueryResult is a page matched by the query of a query page. Date is only
+// set when the query lists recently changed pages.
+type QueryResult struct {
+	Title   string
+	URL     string
+	Summary string
+	DateISO string
+	Date    string
+}
+
 // Load instantiates an engine using files from templateDir.
 func Load(templateDir string) (*Engine, error) {
 	if templateDir == "" {
@@ -181,3 +260,15 @@ func (e *Engine) Render(w io.Writer, data *PageData) error {
 	}
 	return e.templates.ExecuteTemplate(w, LayoutTemplate, data)
 }
+
+// RenderTemplate executes a single named template, such as a fragment
+// embedded into page content, with data.
+func (e *Engine) RenderTemplate(w io.Writer, name string, data any) error {
+	if e.templates == nil {
+		return fmt.Errorf("template engine not initialized")
+	}
+	if e.templates.Lookup(name) == nil {
+		return fmt.Errorf("template %q is not defined", name)
+	}
+	return e.templates.ExecuteTemplate(w, name, data)
+}
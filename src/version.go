@@ -10,6 +10,9 @@ const (
 // Set at link stage via `-ldflags "-X main.GIT_COMMIT=$(git rev-parse --short HEAD)"`
 var GIT_COMMIT string
 
+// Set at link stage via `-ldflags "-X main.BUILD_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)"`
+var BUILD_TIME string
+
 // Server header string
 var SERVER_SIGNATURE = fmt.Sprintf("%s (%s)", SERVER_NAME+"/"+SERVER_VERSION, func() string {
 	if GIT_COMMIT != "" {
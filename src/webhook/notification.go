@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxNotificationBytes bounds the size of inbound notification bodies.
+const MaxNotificationBytes = 1 << 20
+
+// Notification is the delta payload sent by dn42notifyd protocol v2 and
+// returned from v2 poll registrations.
+type Notification struct {
+	Version int          `json:"version"`
+	Repos   []RepoUpdate `json:"repos"`
+}
+
+// RepoUpdate describes the latest state of a single repository.
+type RepoUpdate struct {
+	Name   string   `json:"name"`
+	Commit string   `json:"commit"`
+	Paths  []string `json:"paths,omitempty"`
+}
+
+// ParseNotification decodes a v2 notification body. It returns nil without
+// error for empty or legacy bodies that carry no repository list.
+func ParseNotification(data []byte) (*Notification, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || !strings.HasPrefix(trimmed, "{") {
+		return nil, nil
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(trimmed), &n); err != nil {
+		return nil, fmt.Errorf("parse notification: %w", err)
+	}
+	if n.Version < 2 || len(n.Repos) == 0 {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+// Lookup returns the update entry for the given owner/name repository path.
+func (n *Notification) Lookup(repo string) (RepoUpdate, bool) {
+	if n == nil {
+		return RepoUpdate{}, false
+	}
+	for _, update := range n.Repos {
+		if strings.EqualFold(strings.Trim(update.Name, "/"), strings.Trim(repo, "/")) {
+			return update, true
+		}
+	}
+	return RepoUpdate{}, false
+}
+
+// UpToDate reports whether the update refers to the given local commit.
+func (u RepoUpdate) UpToDate(head string) bool {
+	commit := strings.ToLower(strings.TrimSpace(u.Commit))
+	head = strings.ToLower(strings.TrimSpace(head))
+	if len(commit) < 7 || head == "" {
+		return false
+	}
+	return strings.HasPrefix(head, commit) || strings.HasPrefix(commit, head)
+}
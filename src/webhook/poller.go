@@ -3,16 +3,19 @@ package webhook
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/iedon/dn42-wiki-go/config"
+	"github.com/iedon/dn42-wiki-go/metrics"
+	"github.com/iedon/dn42-wiki-go/netutil"
 	"github.com/iedon/dn42-wiki-go/site"
 )
 
@@ -25,8 +28,33 @@ type Poller struct {
 	client    *http.Client
 	pollURL   string
 	userAgent string
+
+	mu    sync.RWMutex
+	state RegistrationState
+}
+
+// RegistrationState summarizes the poller's relationship with the notify service.
+type RegistrationState struct {
+	Registered          bool      `json:"registered"`
+	LastAttempt         time.Time `json:"lastAttempt,omitzero"`
+	LastSuccess         time.Time `json:"lastSuccess,omitzero"`
+	NextAttempt         time.Time `json:"nextAttempt,omitzero"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError,omitempty"`
 }
 
+const (
+	minRetryDelay = 15 * time.Second
+	retryJitter   = 0.2
+)
+
+var (
+	pollerRegistered  = metrics.NewGauge("wiki_poller_registered", "Whether the last poll registration succeeded (1) or failed (0).")
+	pollerFailures    = metrics.NewGauge("wiki_poller_consecutive_failures", "Consecutive failed poll registrations.")
+	pollerLastSuccess = metrics.NewGauge("wiki_poller_last_success_timestamp_seconds", "Unix time of the last successful poll registration.")
+	pollerAttempts    = metrics.NewCounterVec("wiki_poller_attempts_total", "Poll registration attempts by result.", "result")
+)
+
 // NewPoller constructs a polling manager when webhook polling is enabled.
 func NewPoller(cfg *config.Config, svc *site.Service, logger *slog.Logger, userAgent string) (*Poller, error) {
 	if cfg == nil || svc == nil {
@@ -41,11 +69,9 @@ func NewPoller(cfg *config.Config, svc *site.Service, logger *slog.Logger, userA
 		return nil, fmt.Errorf("invalid polling interval")
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	if cfg.Webhook.Polling.SkipRemoteCert {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	client, err := netutil.NewHTTPClient(cfg.Outbound.ClientOptions(30*time.Second, cfg.Webhook.Polling.SkipRemoteCert))
+	if err != nil {
+		return nil, fmt.Errorf("http client: %w", err)
 	}
 
 	return &Poller{
@@ -59,28 +85,88 @@ func NewPoller(cfg *config.Config, svc *site.Service, logger *slog.Logger, userA
 }
 
 // Run starts the background refresh loop until the context is cancelled.
+// Failed registrations are retried with jittered exponential backoff so a
+// network partition does not leave the instance unregistered for a whole
+// polling interval.
 func (p *Poller) Run(ctx context.Context) {
-	interval := p.cfg.Webhook.Polling.Interval()
-	p.execute(ctx)
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			p.execute(ctx)
+		case <-timer.C:
+			timer.Reset(p.execute(ctx))
 		}
 	}
 }
 
-func (p *Poller) execute(ctx context.Context) {
-	if err := p.refreshRegistration(ctx); err != nil {
-		p.logger.Warn("webhook poll", "error", err)
-		return
+// State returns a copy of the current registration state.
+func (p *Poller) State() RegistrationState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// Health adapts State for health reporting.
+func (p *Poller) Health() (bool, any) {
+	state := p.State()
+	return state.Registered, state
+}
+
+func (p *Poller) execute(ctx context.Context) time.Duration {
+	interval := p.cfg.Webhook.Polling.Interval()
+	started := time.Now()
+	err := p.refreshRegistration(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.LastAttempt = started
+	if err != nil {
+		p.state.Registered = false
+		p.state.ConsecutiveFailures++
+		p.state.LastError = err.Error()
+		pollerAttempts.Inc("failure")
+	} else {
+		p.state.Registered = true
+		p.state.ConsecutiveFailures = 0
+		p.state.LastError = ""
+		p.state.LastSuccess = started
+		pollerAttempts.Inc("success")
+		pollerLastSuccess.Set(float64(started.Unix()))
+	}
+
+	delay := interval
+	if err != nil {
+		delay = retryDelay(p.state.ConsecutiveFailures, interval)
+		p.logger.Warn("webhook poll", "error", err, "failures", p.state.ConsecutiveFailures, "retryIn", delay.Round(time.Second))
+	}
+	p.state.NextAttempt = time.Now().Add(delay)
+
+	if p.state.Registered {
+		pollerRegistered.Set(1)
+	} else {
+		pollerRegistered.Set(0)
+	}
+	pollerFailures.Set(float64(p.state.ConsecutiveFailures))
+	return delay
+}
+
+// retryDelay doubles from minRetryDelay per consecutive failure, caps at the
+// regular interval, and spreads retries by ±20% to avoid thundering herds
+// when many mirrors lose connectivity together.
+func retryDelay(failures int, interval time.Duration) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	if delay > interval {
+		delay = interval
 	}
+	jitter := 1 + retryJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * jitter)
 }
 
 func (p *Poller) refreshRegistration(ctx context.Context) error {
@@ -93,6 +179,10 @@ func (p *Poller) refreshRegistration(ctx context.Context) error {
 		Repos:   []string{repo},
 		Ping:    true,
 	}
+	if p.cfg.Webhook.Polling.ProtocolVersion >= 2 {
+		body.Version = p.cfg.Webhook.Polling.ProtocolVersion
+		body.Deltas = true
+	}
 	payload, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("marshal poll body: %w", err)
@@ -117,8 +207,38 @@ func (p *Poller) refreshRegistration(ctx context.Context) error {
 		return fmt.Errorf("poll request failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))
 	}
 
-	// Drain the body to allow connection reuse. The payload is informational only.
+	if body.Version < 2 {
+		// Drain the body to allow connection reuse. The payload is informational only.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	// v2 registrations answer with the latest known commit per repository,
+	// which lets us catch up on notifications missed while unreachable.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxNotificationBytes))
+	if err != nil {
+		return fmt.Errorf("read poll response: %w", err)
+	}
 	_, _ = io.Copy(io.Discard, resp.Body)
+	notification, err := ParseNotification(data)
+	if err != nil {
+		return err
+	}
+	update, ok := notification.Lookup(repo)
+	if !ok {
+		return nil
+	}
+	head, err := p.svc.HeadCommit(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve head: %w", err)
+	}
+	if update.UpToDate(head) {
+		return nil
+	}
+	p.logger.Info("webhook poll", "repo", repo, "remoteCommit", update.Commit, "localCommit", head)
+	if err := p.svc.Pull(ctx); err != nil {
+		return fmt.Errorf("pull after poll: %w", err)
+	}
 	return nil
 }
 
@@ -126,4 +246,6 @@ type pollRequest struct {
 	Webhook string   `json:"webhook"`
 	Repos   []string `json:"repos"`
 	Ping    bool     `json:"ping,omitempty"`
+	Version int      `json:"version,omitempty"`
+	Deltas  bool     `json:"deltas,omitempty"`
 }
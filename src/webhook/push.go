@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxPushBytes bounds the size of forge push event bodies, which list every
+// pushed commit and grow far beyond notifications. GitHub caps deliveries at
+// 25 MB.
+const MaxPushBytes = 25 << 20
+
+// forgeEventHeaders carry the event type of repository webhooks, as sent by
+// GitHub, Gitea, Gogs and GitLab.
+var forgeEventHeaders = []string{"X-GitHub-Event", "X-Gitea-Event", "X-Gogs-Event", "X-Gitlab-Event"}
+
+// ForgeEvent returns the event type of a repository webhook delivery, or ""
+// when the request does not come from a forge.
+func ForgeEvent(header http.Header) string {
+	for _, name := range forgeEventHeaders {
+		if event := strings.TrimSpace(header.Get(name)); event != "" {
+			return event
+		}
+	}
+	return ""
+}
+
+// IsPushEvent reports whether a forge event type is a push, of branches or
+// of tags.
+func IsPushEvent(event string) bool {
+	switch strings.ToLower(event) {
+	case "push", "push hook", "tag push hook":
+		return true
+	}
+	return false
+}
+
+// Push is what the wiki needs of a forge push event.
+type Push struct {
+	// Repo is the path of the pushed repository, eg. owner/name, or
+	// group/subgroup/name on GitLab.
+	Repo string
+	// Ref is the full name of the pushed ref, eg. refs/heads/master.
+	Ref string
+	// After is the commit the ref points to after the push.
+	After string
+}
+
+// ParsePush decodes the push event payload of GitHub, Gitea, Gogs or GitLab.
+func ParsePush(data []byte) (*Push, error) {
+	var body struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("parse push event: %w", err)
+	}
+	push := &Push{
+		Repo:  strings.Trim(body.Repository.FullName, "/"),
+		Ref:   strings.TrimSpace(body.Ref),
+		After: strings.TrimSpace(body.After),
+	}
+	if push.Repo == "" {
+		push.Repo = strings.Trim(body.Project.PathWithNamespace, "/")
+	}
+	if push.Repo == "" || push.Ref == "" {
+		return nil, fmt.Errorf("parse push event: repository or ref missing")
+	}
+	return push, nil
+}
+
+// Branch returns the pushed branch; tag pushes have none.
+func (p *Push) Branch() (string, bool) {
+	return strings.CutPrefix(p.Ref, "refs/heads/")
+}
+
+// Deleted reports whether the push deleted the ref.
+func (p *Push) Deleted() bool {
+	return p.After != "" && strings.Trim(p.After, "0") == ""
+}
+
+// IsRepo reports whether the push is to the owner/name repository, as
+// derived from the configured remote. Only the last two segments of the
+// pushed path are compared, as the remote's are.
+func (p *Push) IsRepo(repo string) bool {
+	segments := strings.Split(p.Repo, "/")
+	if len(segments) < 2 {
+		return false
+	}
+	tail := strings.Join(segments[len(segments)-2:], "/")
+	return strings.EqualFold(tail, strings.Trim(repo, "/"))
+}
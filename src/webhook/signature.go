@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of a
+	// delivery, as GitHub and Gitea repository webhooks send it.
+	SignatureHeader = "X-Hub-Signature-256"
+	// TimestampHeader carries the unix time a delivery was sent at.
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+// Sign returns the SignatureHeader value for a delivery. A timestamp, when
+// given, is signed along with the body as "<timestamp>.<body>", so it can
+// neither be changed nor dropped on replay. Forges sign the body alone.
+func Sign(secret, timestamp string, body []byte) string {
+	return "sha256=" + hex.EncodeToString(signatureOf(secret, timestamp, body))
+}
+
+// ValidSignature reports whether signature is the SignatureHeader value of
+// the delivery.
+func ValidSignature(secret, timestamp string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, signatureOf(secret, timestamp, body))
+}
+
+func signatureOf(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	if timestamp != "" {
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,50 @@
+// Sign in and out with the wiki's identity provider, when the server
+// requires a login for edits.
+export function createAccountModule({ config: runtime, dom, api }) {
+  let account = null;
+
+  function render(button) {
+    if (account?.authenticated) {
+      button.textContent = "Sign out";
+      button.title = `Signed in as ${account.name}`;
+    } else {
+      button.textContent = "Sign in";
+      button.title = "";
+    }
+    button.closest(".toolbar-group")?.removeAttribute("hidden");
+  }
+
+  async function toggle() {
+    if (!account?.authenticated) {
+      api.login();
+      return;
+    }
+    try {
+      await api.fetchJSON(api.endpoint("logout"), { method: "POST" });
+    } catch (error) {
+      console.warn("Failed to sign out", error);
+    }
+    window.location.reload();
+  }
+
+  async function init() {
+    const button = dom.qs("[data-account]");
+    if (!button || !runtime.features?.login || !api.endpoint("me")) {
+      return;
+    }
+    try {
+      account = await api.fetchJSON(api.endpoint("me"));
+    } catch (error) {
+      console.warn("Failed to load account", error);
+      return;
+    }
+    runtime.account = account;
+    render(button);
+    button.addEventListener("click", (event) => {
+      event.preventDefault();
+      toggle();
+    });
+  }
+
+  return { init };
+}
@@ -1,13 +1,76 @@
 const API_CONTENT_TYPE = "application/json";
+const EDIT_TOKEN_HEADER = "X-Edit-Token";
+const EDIT_TOKEN_STORAGE_KEY = "dn42-wiki-edit-token";
+const CHALLENGE_RESPONSE_HEADER = "X-Challenge-Response";
+
+function storedEditToken() {
+  try {
+    return window.localStorage.getItem(EDIT_TOKEN_STORAGE_KEY) ?? "";
+  } catch (_error) {
+    return "";
+  }
+}
+
+function storeEditToken(token) {
+  try {
+    if (token) {
+      window.localStorage.setItem(EDIT_TOKEN_STORAGE_KEY, token);
+    } else {
+      window.localStorage.removeItem(EDIT_TOKEN_STORAGE_KEY);
+    }
+  } catch (_error) {
+    // storage unavailable; the token is asked for again next time
+  }
+}
+
+// The server asks for an edit token with this challenge when writes are
+// restricted to holders of operator-issued tokens.
+function wantsEditToken(response) {
+  return response.status === 401 && (response.headers.get("WWW-Authenticate") ?? "").startsWith("EditToken");
+}
+
+// The server asks for a login with this challenge when edits require
+// signing in with the wiki's identity provider.
+function wantsLogin(response) {
+  return response.status === 401 && (response.headers.get("WWW-Authenticate") ?? "").startsWith("Login");
+}
+
+// The server asks anonymous editors to solve an anti-abuse challenge with
+// this challenge before accepting their writes.
+function wantsChallenge(response) {
+  return response.status === 401 && (response.headers.get("WWW-Authenticate") ?? "").startsWith("Challenge");
+}
 
 export function createApi(runtime) {
   const { basePath } = runtime;
+  let challengeSolver = null;
+
+  // setChallengeSolver installs the function that solves a challenge the
+  // server asks for, resolving to the response to send, or "" when the
+  // user gave up.
+  function setChallengeSolver(solver) {
+    challengeSolver = solver;
+  }
 
   function apiPath(path) {
     const clean = path.startsWith("/") ? path : `/${path}`;
     return basePath ? `${basePath}${clean}` : clean;
   }
 
+  // endpoint returns the path of a named API endpoint, or an empty string
+  // when the server does not offer it.
+  function endpoint(name) {
+    return runtime.endpoints?.[name] ?? "";
+  }
+
+  // login leaves for the identity provider, which sends the user back to
+  // the current page. Editor drafts survive the round trip.
+  function login() {
+    const target = endpoint("login") || "/auth/login";
+    const back = `${window.location.pathname}${window.location.search}${window.location.hash}`;
+    window.location.assign(`${apiPath(target)}?return=${encodeURIComponent(back)}`);
+  }
+
   function toRoute(input) {
     if (!input) {
       return "/";
@@ -42,25 +105,52 @@ export function createApi(runtime) {
     const { method = "GET", body, headers = {} } = options;
     const url = /^https?:/i.test(path) ? path : apiPath(path);
     const requestHeaders = new Headers(headers);
-    if (!requestHeaders.has("Content-Type") && body) {
+    if (!requestHeaders.has("Content-Type") && body && !(body instanceof FormData)) {
       requestHeaders.set("Content-Type", API_CONTENT_TYPE);
     }
+    const editToken = storedEditToken();
+    if (method !== "GET" && editToken && !requestHeaders.has(EDIT_TOKEN_HEADER)) {
+      requestHeaders.set(EDIT_TOKEN_HEADER, editToken);
+    }
     const response = await fetch(url, {
       method,
       body,
       headers: requestHeaders,
     });
+    if (wantsEditToken(response) && !options.editTokenRetried) {
+      storeEditToken("");
+      const token = window.prompt("Editing this wiki requires an edit token. Paste the token you were given:");
+      if (token && token.trim()) {
+        storeEditToken(token.trim());
+        return fetchJSON(path, { ...options, editTokenRetried: true });
+      }
+    }
+    if (wantsChallenge(response) && challengeSolver && !options.challengeRetried) {
+      const solution = await challengeSolver();
+      if (solution) {
+        const retryHeaders = new Headers(headers);
+        retryHeaders.set(CHALLENGE_RESPONSE_HEADER, solution);
+        return fetchJSON(path, { ...options, headers: retryHeaders, challengeRetried: true });
+      }
+    }
+    if (wantsLogin(response) && window.confirm("Editing this wiki requires signing in. Your changes are kept as a draft. Sign in now?")) {
+      login();
+    }
     if (!response.ok) {
       let message = `${response.status} ${response.statusText}`;
+      let data = null;
       try {
-        const data = await response.clone().json();
+        data = await response.clone().json();
         if (data && typeof data.error === "string") {
           message = data.error;
         }
       } catch (_error) {
         // ignore JSON parse failure
       }
-      throw new Error(message);
+      const error = new Error(message);
+      error.status = response.status;
+      error.data = data;
+      throw error;
     }
     const contentType = response.headers.get("content-type") ?? "";
     if (contentType.includes(API_CONTENT_TYPE)) {
@@ -77,5 +167,5 @@ export function createApi(runtime) {
     }
   }
 
-  return { apiPath, fetchJSON, pageUrl, toRoute, absoluteUrl };
+  return { apiPath, endpoint, fetchJSON, login, pageUrl, toRoute, absoluteUrl, setChallengeSolver };
 }
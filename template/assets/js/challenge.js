@@ -0,0 +1,194 @@
+// Solve the anti-abuse challenge the server asks anonymous editors for:
+// a proof of work computed in the browser, or a CAPTCHA widget.
+
+const CAPTCHA_SCRIPTS = {
+  hcaptcha: { src: "https://js.hcaptcha.com/1/api.js?render=explicit", global: "hcaptcha" },
+  turnstile: { src: "https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit", global: "turnstile" },
+};
+
+// Hashes tried before yielding to the browser while solving a proof of work.
+const POW_BATCH = 20000;
+
+const K = new Uint32Array([
+  0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+  0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+  0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+  0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+  0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+  0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+  0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+  0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+]);
+
+// sha256 hashes an ASCII string into eight 32-bit words. It is synchronous
+// and works without WebCrypto, which plain-HTTP pages do not get.
+function sha256(text) {
+  const length = text.length;
+  const blocks = ((length + 8) >> 6) + 1;
+  const words = new Uint32Array(blocks * 16);
+  for (let i = 0; i < length; i += 1) {
+    words[i >> 2] |= (text.charCodeAt(i) & 0xff) << (24 - (i % 4) * 8);
+  }
+  words[length >> 2] |= 0x80 << (24 - (length % 4) * 8);
+  words[blocks * 16 - 1] = length * 8;
+
+  const h = new Uint32Array([0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19]);
+  const w = new Uint32Array(64);
+  for (let offset = 0; offset < words.length; offset += 16) {
+    for (let t = 0; t < 16; t += 1) {
+      w[t] = words[offset + t];
+    }
+    for (let t = 16; t < 64; t += 1) {
+      const a = w[t - 15];
+      const b = w[t - 2];
+      const s0 = ((a >>> 7) | (a << 25)) ^ ((a >>> 18) | (a << 14)) ^ (a >>> 3);
+      const s1 = ((b >>> 17) | (b << 15)) ^ ((b >>> 19) | (b << 13)) ^ (b >>> 10);
+      w[t] = w[t - 16] + s0 + w[t - 7] + s1;
+    }
+    let [a, b, c, d, e, f, g, hh] = h;
+    for (let t = 0; t < 64; t += 1) {
+      const S1 = ((e >>> 6) | (e << 26)) ^ ((e >>> 11) | (e << 21)) ^ ((e >>> 25) | (e << 7));
+      const ch = (e & f) ^ (~e & g);
+      const t1 = (hh + S1 + ch + K[t] + w[t]) | 0;
+      const S0 = ((a >>> 2) | (a << 30)) ^ ((a >>> 13) | (a << 19)) ^ ((a >>> 22) | (a << 10));
+      const maj = (a & b) ^ (a & c) ^ (b & c);
+      const t2 = (S0 + maj) | 0;
+      hh = g;
+      g = f;
+      f = e;
+      e = (d + t1) | 0;
+      d = c;
+      c = b;
+      b = a;
+      a = (t1 + t2) | 0;
+    }
+    h[0] += a;
+    h[1] += b;
+    h[2] += c;
+    h[3] += d;
+    h[4] += e;
+    h[5] += f;
+    h[6] += g;
+    h[7] += hh;
+  }
+  return h;
+}
+
+function leadingZeroBits(hash) {
+  let bits = 0;
+  for (const word of hash) {
+    if (word !== 0) {
+      return bits + Math.clz32(word);
+    }
+    bits += 32;
+  }
+  return bits;
+}
+
+function loadScript(src) {
+  return new Promise((resolve, reject) => {
+    const script = document.createElement("script");
+    script.src = src;
+    script.async = true;
+    script.addEventListener("load", () => resolve());
+    script.addEventListener("error", () => reject(new Error(`Failed to load ${src}`)));
+    document.head.append(script);
+  });
+}
+
+export function createChallengeModule({ dom, api, modal }) {
+  const dialog = dom.qs("#challenge-modal");
+  const widget = dom.qs("[data-challenge-widget]", dialog ?? document);
+  const status = dom.qs("[data-challenge-status]", dialog ?? document);
+  let cancelled = false;
+  let settle = null;
+
+  function setStatus(message) {
+    if (status) {
+      status.textContent = message;
+    }
+  }
+
+  // solvePow looks for a counter in batches, so the page stays responsive.
+  function solvePow({ challenge, difficulty }) {
+    return new Promise((resolve) => {
+      let counter = 0;
+      const step = () => {
+        if (cancelled) {
+          resolve("");
+          return;
+        }
+        for (const end = counter + POW_BATCH; counter < end; counter += 1) {
+          const candidate = `${challenge}:${counter}`;
+          if (leadingZeroBits(sha256(candidate)) >= difficulty) {
+            resolve(candidate);
+            return;
+          }
+        }
+        window.setTimeout(step, 0);
+      };
+      step();
+    });
+  }
+
+  async function solveCaptcha({ provider, siteKey }) {
+    const script = CAPTCHA_SCRIPTS[provider];
+    if (!script || !widget) {
+      throw new Error(`Unsupported challenge provider ${provider}`);
+    }
+    if (!window[script.global]) {
+      await loadScript(script.src);
+    }
+    setStatus("Complete the check to save your edit.");
+    return new Promise((resolve) => {
+      settle = resolve;
+      window[script.global].render(widget, {
+        sitekey: siteKey,
+        callback: (token) => resolve(token),
+      });
+    });
+  }
+
+  // solve fetches a challenge and resolves to its solution, or to "" when
+  // the dialog was closed first.
+  async function solve() {
+    cancelled = false;
+    settle = null;
+    if (widget) {
+      widget.replaceChildren();
+    }
+    setStatus("");
+    if (dialog) {
+      modal.open(dialog, { stack: true });
+    }
+    try {
+      const info = await api.fetchJSON(api.endpoint("challenge") || "/api/challenge");
+      if (info.provider === "pow") {
+        setStatus("Checking that you are not a robot. This takes a few seconds…");
+        return await solvePow(info);
+      }
+      return await solveCaptcha(info);
+    } catch (error) {
+      console.warn("Failed to solve challenge", error);
+      return "";
+    } finally {
+      settle = null;
+      if (dialog && !cancelled) {
+        modal.close(dialog);
+      }
+    }
+  }
+
+  function init() {
+    if (!dialog) {
+      return;
+    }
+    dialog.addEventListener("modal:close", () => {
+      cancelled = true;
+      settle?.("");
+    });
+    api.setChallengeSolver(solve);
+  }
+
+  return { init };
+}
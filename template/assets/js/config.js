@@ -1,16 +1,73 @@
+// Used until, or when, /api/ui-config cannot be loaded.
+const DEFAULT_ENDPOINTS = {
+  preview: "/api/preview",
+  format: "/api/format",
+  document: "/api/document",
+  history: "/api/history",
+  diff: "/api/diff",
+  blame: "/api/blame",
+  save: "/api/save",
+  previewSave: "/api/save/preview-diff",
+  rename: "/api/rename",
+  restore: "/api/restore",
+  delete: "/api/delete",
+  upload: "/api/upload",
+};
+
+const DEFAULT_SHORTCUTS = {
+  search: "/",
+  edit: "e",
+  new: "n",
+  history: "h",
+};
+
 export function createConfig(root) {
   const dataset = root?.dataset ?? {};
   const basePath = normalizeBase(dataset.base ?? "");
   return {
     basePath,
+    live: dataset.live === "true",
     editable: dataset.editable === "true",
     pagePath: dataset.path ?? "",
     repoUrl: dataset.repo ?? "",
     searchIndexPath: (dataset.searchIndex ?? "").trim(),
     legacySearchPath: (dataset.search ?? "").trim(),
+    features: {},
+    endpoints: { ...DEFAULT_ENDPOINTS },
+    shortcuts: { ...DEFAULT_SHORTCUTS },
   };
 }
 
+// loadUIConfig merges the server's /api/ui-config into runtime. Static
+// builds have no server to ask and keep the defaults, as does a failed
+// request.
+export async function loadUIConfig(runtime, apiClient) {
+  if (!runtime.live) {
+    return runtime;
+  }
+  try {
+    const data = await apiClient.fetchJSON("/api/ui-config");
+    runtime.editable = data.editable === true;
+    runtime.features = data.features ?? {};
+    if (data.endpoints) {
+      runtime.endpoints = { ...data.endpoints };
+    }
+    if (data.shortcuts) {
+      runtime.shortcuts = { ...data.shortcuts };
+    }
+    if (!runtime.searchIndexPath && data.search?.indexUrl) {
+      runtime.searchIndexPath = data.search.indexUrl;
+    }
+    if (data.uploads) {
+      runtime.uploads = data.uploads;
+    }
+    runtime.attribution = data.attribution ?? "";
+  } catch (error) {
+    console.warn("Failed to load UI config", error);
+  }
+  return runtime;
+}
+
 function normalizeBase(raw) {
   if (!raw) {
     return "";
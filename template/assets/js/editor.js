@@ -9,6 +9,7 @@ const RESERVED_PATHS = new Set([
   "readme",
   "search-index",
   "directory",
+  "recent",
   "gollum",
   "root",
   "default",
@@ -16,6 +17,11 @@ const RESERVED_PATHS = new Set([
   "api",
 ]);
 
+const DRAFT_STORAGE_PREFIX = "dn42-wiki-draft:";
+const DRAFT_NEW_PAGE_KEY = "new";
+const DRAFT_AUTOSAVE_DELAY = 1000;
+const ATTRIBUTION_STORAGE_KEY = "dn42-wiki-author";
+
 export function createEditorModule({ config: runtime, dom, api: apiClient, helpers: util, modal }) {
   if (!runtime.editable) {
     return {
@@ -36,12 +42,16 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
   const editorPreview = dom.qs("#editor-preview");
   const editorTabs = dom.qsa("[data-tab]");
   const editorToolbar = dom.qs("#editor-toolbar");
+  const editorUpload = dom.qs("#editor-upload");
   const editorWorkspace = dom.qs("#editor-workspace");
   const editorPane = dom.qs("#editor-pane");
   const editorPath = dom.qs("#editor-path");
   const editorPathHint = dom.qs("#editor-path-hint");
   const editorPathGroup = dom.qs("#editor-path-group");
   const editorMessage = dom.qs("#editor-message");
+  const editorAttribution = dom.qs("#editor-attribution");
+  const editorAuthor = dom.qs("#editor-author");
+  const editorEmail = dom.qs("#editor-email");
   const editorSave = dom.qs("#editor-save");
   const editorStatus = dom.qs("#editor-status");
 
@@ -53,6 +63,9 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
 
   let editorInitialContent = "";
   let editorSaving = false;
+  // The version of the page the editor started from, kept with drafts so
+  // they can be checked against the server later.
+  let editorBase = { hash: "", revision: "" };
 
   function notifyQueued() {
     window.alert(ASYNC_NOTICE);
@@ -62,6 +75,222 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
     return typeof value === "string" ? value.replace(/\r\n/g, "\n") : "";
   }
 
+  function editorOpen() {
+    return Boolean(editorModal) && !editorModal.classList.contains("hidden");
+  }
+
+  function draftKey() {
+    const mode = editorModal?.dataset?.mode ?? "edit";
+    const path = editorModal?.dataset?.path ?? "";
+    return DRAFT_STORAGE_PREFIX + (mode === "edit" ? path : DRAFT_NEW_PAGE_KEY);
+  }
+
+  function readDraft(key) {
+    try {
+      const raw = window.localStorage.getItem(key);
+      const draft = raw ? JSON.parse(raw) : null;
+      return draft && typeof draft.content === "string" ? draft : null;
+    } catch (_error) {
+      return null;
+    }
+  }
+
+  function removeDraft(key = draftKey()) {
+    try {
+      window.localStorage.removeItem(key);
+    } catch (_error) {
+      // storage unavailable; nothing was kept
+    }
+  }
+
+  // Editors who are not signed in may name themselves as the author of
+  // their edits, when the wiki allows it. The name is remembered for the
+  // next edit and for renames.
+  function attributionEnabled() {
+    const mode = runtime.attribution;
+    return (mode === "optional" || mode === "required") && !runtime.account?.authenticated;
+  }
+
+  function storedAttribution() {
+    try {
+      const stored = JSON.parse(window.localStorage.getItem(ATTRIBUTION_STORAGE_KEY) ?? "null");
+      return {
+        displayName: typeof stored?.displayName === "string" ? stored.displayName : "",
+        email: typeof stored?.email === "string" ? stored.email : "",
+      };
+    } catch (_error) {
+      return { displayName: "", email: "" };
+    }
+  }
+
+  function showAttribution() {
+    if (!editorAttribution) {
+      return;
+    }
+    const enabled = attributionEnabled();
+    editorAttribution.hidden = !enabled;
+    if (!enabled) {
+      return;
+    }
+    const stored = storedAttribution();
+    if (editorAuthor) {
+      editorAuthor.value = stored.displayName;
+      editorAuthor.required = runtime.attribution === "required";
+    }
+    if (editorEmail) {
+      editorEmail.value = stored.email;
+    }
+  }
+
+  // attributionFields returns the author fields to send with a write,
+  // taking them from the editor form when it is shown.
+  function attributionFields(fromForm) {
+    if (!attributionEnabled()) {
+      return {};
+    }
+    if (!fromForm) {
+      return storedAttribution();
+    }
+    const attribution = {
+      displayName: editorAuthor?.value.trim() ?? "",
+      email: editorEmail?.value.trim() ?? "",
+    };
+    try {
+      window.localStorage.setItem(ATTRIBUTION_STORAGE_KEY, JSON.stringify(attribution));
+    } catch (_error) {
+      // storage unavailable; the name is asked for again next time
+    }
+    return attribution;
+  }
+
+  function storeDraft() {
+    if (!editorOpen() || !editorInput) {
+      return;
+    }
+    const content = normalizeContent(editorInput.value);
+    if (content === editorInitialContent) {
+      removeDraft();
+      return;
+    }
+    try {
+      window.localStorage.setItem(
+        draftKey(),
+        JSON.stringify({
+          path: editorPath?.value.trim() ?? "",
+          content,
+          message: editorMessage?.value ?? "",
+          baseHash: editorBase.hash,
+          baseRevision: editorBase.revision,
+          savedAt: new Date().toISOString(),
+        })
+      );
+    } catch (_error) {
+      // storage full or unavailable; autosave is best effort
+    }
+  }
+
+  const scheduleDraft = util.debounce(storeDraft, DRAFT_AUTOSAVE_DELAY);
+
+  async function checkDraft(path, base) {
+    const params = new URLSearchParams({ path, hash: base.hash ?? "", revision: base.revision ?? "" });
+    return apiClient.fetchJSON(`${apiClient.endpoint("draftCheck")}?${params.toString()}`);
+  }
+
+  function describeConflict(conflict) {
+    if (!conflict) {
+      return "has changed";
+    }
+    if (conflict.deleted) {
+      return "has been deleted";
+    }
+    if (conflict.created) {
+      return "has been created by someone else";
+    }
+    const commits = conflict.commits ?? [];
+    if (!commits.length) {
+      return "has changed";
+    }
+    const count = conflict.truncated ? `${commits.length}+` : String(commits.length);
+    const latest = commits[0];
+    return `has been changed ${count} time(s) since, last by ${latest.author} (${util.formatDate(latest.committedAt)}: ${latest.message})`;
+  }
+
+  function applyDraft(draft, notice) {
+    editorInput.value = draft.content;
+    if (editorMessage && draft.message) {
+      editorMessage.value = draft.message;
+    }
+    if (editorPath && !editorPath.disabled && draft.path) {
+      editorPath.value = draft.path;
+    }
+    editorBase = { hash: draft.baseHash ?? "", revision: draft.baseRevision ?? "" };
+    updateHighlight();
+    updateSaveState();
+    util.setHint(editorStatus, notice);
+  }
+
+  // restoreDraft offers a draft autosaved for the page being opened, first
+  // asking the server whether the page changed since the draft's base.
+  async function restoreDraft() {
+    const key = draftKey();
+    const draft = readDraft(key);
+    if (!draft) {
+      return;
+    }
+    if (normalizeContent(draft.content) === editorInitialContent) {
+      removeDraft(key);
+      return;
+    }
+    const savedAt = util.formatDate(draft.savedAt);
+    const path = draft.path || editorModal.dataset.path || "";
+    if (!path) {
+      applyDraft(draft, `Restored your unsaved draft from ${savedAt}`);
+      return;
+    }
+    const base = { hash: draft.baseHash, revision: draft.baseRevision };
+    let check = null;
+    try {
+      check = await checkDraft(path, base);
+    } catch (_error) {
+      applyDraft(draft, `Restored your unsaved draft from ${savedAt}; it could not be checked against the server`);
+      return;
+    }
+    if (key !== draftKey()) {
+      return;
+    }
+    if (!check.changed) {
+      applyDraft(draft, `Restored your unsaved draft from ${savedAt}`);
+      return;
+    }
+    const keep = window.confirm(
+      `You have an unsaved draft of this page from ${savedAt}, but the page ${describeConflict(check.conflict)}.\n\n` +
+        "OK restores your draft, Cancel discards it and keeps the current version."
+    );
+    if (keep) {
+      applyDraft(draft, "Restored your draft; the page changed since you started it, so review it before saving");
+    } else {
+      removeDraft(key);
+    }
+  }
+
+  // recheckDraft warns when the page changed while the browser was offline.
+  async function recheckDraft() {
+    if (!editorOpen() || (editorModal.dataset.mode ?? "edit") !== "edit") {
+      return;
+    }
+    if (normalizeContent(editorInput.value) === editorInitialContent) {
+      return;
+    }
+    try {
+      const check = await checkDraft(editorModal.dataset.path ?? "", editorBase);
+      if (check.changed) {
+        util.setHint(editorStatus, `While you were offline, the page ${describeConflict(check.conflict)}`, true);
+      }
+    } catch (_error) {
+      // still unreachable; the next reconnect tries again
+    }
+  }
+
   function isReservedPath(path) {
     return RESERVED_PATHS.has((path ?? "").toLowerCase());
   }
@@ -143,7 +372,8 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
   }
 
   function setEditorMode(mode) {
-    const showPreview = mode === "preview";
+    // The changes tab shows its diff in the preview pane.
+    const showPreview = mode !== "edit";
     editorTabs.forEach((button) => {
       const tab = button.getAttribute("data-tab");
       const active = tab === mode;
@@ -181,7 +411,7 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
     }
     editorPreview.innerHTML = "<p>Rendering preview...</p>";
     try {
-      const data = await apiClient.fetchJSON("/api/preview", {
+      const data = await apiClient.fetchJSON(apiClient.endpoint("preview"), {
         method: "POST",
         body: JSON.stringify({ content: editorInput.value }),
       });
@@ -194,6 +424,33 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
     }
   }
 
+  async function refreshChanges() {
+    if (!editorPreview || !editorInput || !editorPath) {
+      return;
+    }
+    editorPreview.innerHTML = "<p>Comparing with the saved page...</p>";
+    try {
+      const data = await apiClient.fetchJSON(apiClient.endpoint("previewSave"), {
+        method: "POST",
+        body: JSON.stringify({
+          path: editorPath.value.trim() || runtime.pagePath,
+          content: editorInput.value,
+          base: editorBase.revision,
+          format: "html",
+        }),
+      });
+      const note = data.merged
+        ? '<p class="form-hint">The page changed since you started editing; this includes merging your changes with the newer version.</p>'
+        : "";
+      editorPreview.innerHTML = data.html ? note + data.html : "<p>Saving would not change the page.</p>";
+    } catch (error) {
+      const message = error.data?.conflict
+        ? "Your changes conflict with newer changes to the page; saving will show where."
+        : error.message;
+      editorPreview.innerHTML = `<p class="form-hint error">${escapeHTML(message)}</p>`;
+    }
+  }
+
   function updateSaveState() {
     if (!editorSave || !editorInput || !editorMessage) {
       return;
@@ -251,31 +508,70 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
     editorSaving = true;
     updateSaveState();
     try {
-      await apiClient.fetchJSON("/api/save", {
+      const result = await apiClient.fetchJSON(apiClient.endpoint("save"), {
         method: "POST",
         body: JSON.stringify({
           path: pathValue,
           content: editorInput.value,
           message,
+          base: editorBase.revision,
+          ...attributionFields(true),
         }),
       });
       util.setHint(editorStatus, "Saved successfully");
       editorInitialContent = currentContent;
+      removeDraft();
       modal.close(editorModal);
-      notifyQueued();
+      if (result.status === "unchanged") {
+        window.alert("The page already had your changes, so nothing was saved.");
+      } else {
+        if (result.merged) {
+          window.alert("The page changed while you were editing. Your changes were merged with the newer version.");
+        }
+        notifyQueued();
+      }
     } catch (error) {
-      util.setHint(editorStatus, error.message, true);
+      if (error.data?.conflict) {
+        showConflict(error.data.conflict);
+      } else {
+        util.setHint(editorStatus, error.message, true);
+      }
     } finally {
       editorSaving = false;
       updateSaveState();
     }
   }
 
-  function populateEditor({ path = runtime.pagePath, content = "", trigger = null, isEditing = true }) {
+  // showConflict offers to load a failed merge, conflict markers and all,
+  // into the editor, on top of the page as it is now.
+  function showConflict(conflict) {
+    const hunks = conflict.hunks ?? [];
+    if (conflict.deleted || !conflict.merged) {
+      util.setHint(editorStatus, "The page was deleted while you were editing. Save it as a new page to keep your changes.", true);
+      return;
+    }
+    const lines = hunks.map((hunk) => hunk.line).join(", ");
+    const resolve = window.confirm(
+      `The page changed while you were editing, and ${hunks.length} of the changes conflict with yours (near line ${lines}).\n\n` +
+        "OK loads both versions, between <<<<<<< and >>>>>>> markers, into the editor to resolve by hand. Cancel keeps your text as it is."
+    );
+    util.setHint(editorStatus, `Conflicts near line ${lines}; resolve them and save again`, true);
+    if (!resolve) {
+      return;
+    }
+    editorInput.value = conflict.merged;
+    editorBase = { hash: "", revision: conflict.revision ?? "" };
+    updateHighlight();
+    updateSaveState();
+    scheduleDraft();
+  }
+
+  function populateEditor({ path = runtime.pagePath, content = "", hash = "", revision = "", trigger = null, isEditing = true }) {
     if (!editorModal || !editorInput || !editorPath) {
       return;
     }
     editorInitialContent = normalizeContent(content);
+    editorBase = { hash, revision };
     if (editorTitle) {
       editorTitle.textContent = isEditing ? "Edit Page" : "New Page";
     }
@@ -298,11 +594,13 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
       editorPathHint.classList.remove("error");
     }
     editorMessage.value = "";
+    showAttribution();
     util.setHint(editorStatus, "");
     editorSaving = false;
     updateSaveState();
     setEditorMode("edit");
     modal.open(editorModal, { trigger });
+    restoreDraft();
   }
 
   async function openEditor(options = {}) {
@@ -312,10 +610,12 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
   async function handleEdit(trigger) {
     try {
       const params = new URLSearchParams({ path: runtime.pagePath });
-      const data = await apiClient.fetchJSON(`/api/document?${params.toString()}`);
+      const data = await apiClient.fetchJSON(`${apiClient.endpoint("document")}?${params.toString()}`);
       openEditor({
         path: data.path,
         content: data.content || "",
+        hash: data.hash ?? "",
+        revision: data.revision ?? "",
         trigger,
         isEditing: true,
       });
@@ -374,11 +674,12 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
       pathSubmit.setAttribute("aria-disabled", "true");
     }
     try {
-      await apiClient.fetchJSON("/api/rename", {
+      await apiClient.fetchJSON(apiClient.endpoint("rename"), {
         method: "POST",
         body: JSON.stringify({
           oldPath: runtime.pagePath,
           newPath,
+          ...attributionFields(false),
         }),
       });
       modal.close(pathModal);
@@ -412,7 +713,7 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
       return;
     }
     try {
-      await apiClient.fetchJSON("/api/delete", {
+      await apiClient.fetchJSON(apiClient.endpoint("delete"), {
         method: "POST",
         body: JSON.stringify({ path: currentPath }),
       });
@@ -501,9 +802,66 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
     }
   }
 
+  function insertText(text) {
+    const start = editorInput.selectionStart;
+    const end = editorInput.selectionEnd;
+    const value = editorInput.value;
+    editorInput.value = value.slice(0, start) + text + value.slice(end);
+    editorInput.selectionStart = editorInput.selectionEnd = start + text.length;
+    editorInput.focus();
+    updateSaveState();
+    updateHighlight();
+    scheduleDraft();
+  }
+
+  async function formatContent() {
+    if (!editorInput) {
+      return;
+    }
+    util.setHint(editorStatus, "Formatting...");
+    try {
+      const result = await apiClient.fetchJSON(apiClient.endpoint("format"), {
+        method: "POST",
+        body: JSON.stringify({ content: editorInput.value }),
+      });
+      if (!result.changed) {
+        util.setHint(editorStatus, "Already formatted");
+        return;
+      }
+      editorInput.value = result.content;
+      updateHighlight();
+      updateSaveState();
+      scheduleDraft();
+      util.setHint(editorStatus, "Formatted");
+    } catch (error) {
+      util.setHint(editorStatus, error.message, true);
+    }
+  }
+
+  async function uploadFile(file) {
+    if (!file) {
+      return;
+    }
+    if (!apiClient.endpoint("upload")) {
+      util.setHint(editorStatus, "Uploads are disabled on this wiki", true);
+      return;
+    }
+    const form = new FormData();
+    form.append("file", file, file.name);
+    util.setHint(editorStatus, `Uploading ${file.name}...`);
+    try {
+      const result = await apiClient.fetchJSON(apiClient.endpoint("upload"), { method: "POST", body: form });
+      insertText(result.markdown ?? "");
+      util.setHint(editorStatus, `Uploaded ${result.path}`);
+    } catch (error) {
+      util.setHint(editorStatus, error.message, true);
+    }
+  }
+
   function handleBeforeUnload(event) {
     const currentContent = normalizeContent(editorInput.value);
     if (currentContent !== editorInitialContent) {
+      storeDraft();
       event.preventDefault();
     }
   }
@@ -526,6 +884,8 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
       if (currentContent !== editorInitialContent) {
         if (!window.confirm("You have unsaved changes. Are you sure you want to close?")) {
           event.preventDefault();
+        } else {
+          removeDraft();
         }
       }
     });
@@ -536,27 +896,50 @@ export function createEditorModule({ config: runtime, dom, api: apiClient, helpe
           const tab = button.getAttribute("data-tab");
           if (tab === "preview") {
             refreshPreview();
+          } else if (tab === "changes") {
+            refreshChanges();
           }
           setEditorMode(tab);
         });
       });
     }
     editorToolbar?.addEventListener("click", (event) => {
+      if (event.target?.closest("button[data-upload]")) {
+        event.preventDefault();
+        editorUpload?.click();
+        return;
+      }
+      if (event.target?.closest("button[data-format]")) {
+        event.preventDefault();
+        formatContent();
+        return;
+      }
       const target = event.target?.closest("button[data-md]");
       if (!target) {
         return;
       }
       event.preventDefault();
       applyFormatting(target.getAttribute("data-md"));
+      scheduleDraft();
+    });
+    editorUpload?.addEventListener("change", () => {
+      const [file] = editorUpload.files ?? [];
+      editorUpload.value = "";
+      uploadFile(file);
     });
     if (editorInput) {
       editorInput.addEventListener("input", () => {
         updateSaveState();
         updateHighlight();
+        scheduleDraft();
       });
       editorInput.addEventListener("scroll", syncHighlightScroll);
     }
-    editorMessage?.addEventListener("input", updateSaveState);
+    editorMessage?.addEventListener("input", () => {
+      updateSaveState();
+      scheduleDraft();
+    });
+    window.addEventListener("online", recheckDraft);
     editorSave?.addEventListener("click", (event) => {
       event.preventDefault();
       savePage();
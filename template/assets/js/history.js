@@ -6,6 +6,7 @@ export function createHistoryModule({ config: runtime, dom, api: apiClient, help
   const historyDiffModal = dom.qs("#history-diff-modal");
   const historyDiff = dom.qs("#history-diff");
   const historyDiffCode = dom.qs("#history-diff-code");
+  const historyDiffSide = dom.qs("#history-diff-side");
   const historyDiffTitle = dom.qs("#history-diff-title");
 
   const state = {
@@ -36,6 +37,7 @@ export function createHistoryModule({ config: runtime, dom, api: apiClient, help
     if (historyDiff && historyDiffCode) {
       historyDiffCode.textContent = "";
     }
+    showDiffView(false);
     if (forceClose && historyDiffModal) {
       modal.close(historyDiffModal);
     }
@@ -47,10 +49,25 @@ export function createHistoryModule({ config: runtime, dom, api: apiClient, help
     }
   }
 
+  // showDiffView switches between the unified text view, also used for
+  // status messages, and the side-by-side table.
+  function showDiffView(sideBySide) {
+    if (historyDiff) {
+      historyDiff.hidden = sideBySide;
+    }
+    if (historyDiffSide) {
+      historyDiffSide.hidden = !sideBySide;
+      if (!sideBySide) {
+        historyDiffSide.innerHTML = "";
+      }
+    }
+  }
+
   function showDiffStatus(message, toneClass = "") {
     if (!historyDiffCode) {
       return;
     }
+    showDiffView(false);
     historyDiffCode.textContent = message;
     historyDiffCode.className = toneClass || "";
   }
@@ -161,7 +178,7 @@ export function createHistoryModule({ config: runtime, dom, api: apiClient, help
       pageSize: "25",
     });
     try {
-      const data = await apiClient.fetchJSON(`/api/history?${params.toString()}`);
+      const data = await apiClient.fetchJSON(`${apiClient.endpoint("history")}?${params.toString()}`);
       const items = data.items ?? [];
       if (reset) {
         resetHistoryDiff(true);
@@ -200,7 +217,20 @@ export function createHistoryModule({ config: runtime, dom, api: apiClient, help
         from: from.hash,
         to: to.hash,
       });
-      const data = await apiClient.fetchJSON(`/api/diff?${params.toString()}`);
+      if (historyDiffSide) {
+        params.set("format", "html");
+      }
+      const data = await apiClient.fetchJSON(`${apiClient.endpoint("diff")}?${params.toString()}`);
+      if (data && typeof data.html === "string") {
+        if (!data.html.includes("<td")) {
+          showDiffStatus("No diff available", "z-go");
+        } else {
+          // The server escapes the diffed text.
+          historyDiffSide.innerHTML = data.html;
+          showDiffView(true);
+        }
+        return;
+      }
       const diff = (data && data.diff) || "";
       if (!diff.trim()) {
         showDiffStatus("No diff available", "z-go");
@@ -48,6 +48,21 @@ export function createLayoutModule({ dom }) {
     return { element };
   }
 
+  // sectionParents returns the links of the sections enclosing the one of
+  // link, so a collapsed branch still shows where the reader is.
+  function sectionParents(link) {
+    const parents = [];
+    let branch = link.closest("li")?.parentElement?.closest(".summary-branch");
+    while (branch) {
+      const parent = branch.querySelector(":scope > summary > a[data-section]");
+      if (parent) {
+        parents.push(parent);
+      }
+      branch = branch.parentElement?.closest(".summary-branch");
+    }
+    return parents;
+  }
+
   function observeSections() {
     if (!contentContainer) {
       return;
@@ -89,7 +104,11 @@ export function createLayoutModule({ dom }) {
       }
       const link = map.get(candidate[0]);
       if (link) {
-        links.forEach((item) => item.classList.toggle("active", item === link));
+        const parents = sectionParents(link);
+        links.forEach((item) => {
+          item.classList.toggle("active", item === link);
+          item.classList.toggle("active-parent", parents.includes(item));
+        });
       }
     };
     sectionObserver = new IntersectionObserver(
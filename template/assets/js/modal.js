@@ -114,6 +114,10 @@ export function createModalManager(domUtils) {
     }
   }
 
+  function isOpen() {
+    return stack.length > 0;
+  }
+
   function open(modal, { trigger = null, stack: stacked = false } = {}) {
     if (!modal) {
       return;
@@ -148,5 +152,5 @@ export function createModalManager(domUtils) {
     });
   }
 
-  return { init, open, close, closeTop, closeAll };
+  return { init, open, close, closeTop, closeAll, isOpen };
 }
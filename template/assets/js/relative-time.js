@@ -0,0 +1,43 @@
+const UNITS = [
+  ["year", 365 * 24 * 60 * 60],
+  ["month", 30 * 24 * 60 * 60],
+  ["week", 7 * 24 * 60 * 60],
+  ["day", 24 * 60 * 60],
+  ["hour", 60 * 60],
+  ["minute", 60],
+];
+
+export function createRelativeTimeModule(dom) {
+  const formatter =
+    typeof Intl !== "undefined" && Intl.RelativeTimeFormat
+      ? new Intl.RelativeTimeFormat(undefined, { numeric: "auto" })
+      : null;
+
+  function describe(date) {
+    const seconds = Math.round((date.getTime() - Date.now()) / 1000);
+    for (const [unit, size] of UNITS) {
+      if (Math.abs(seconds) >= size) {
+        return formatter.format(Math.round(seconds / size), unit);
+      }
+    }
+    return formatter.format(0, "minute");
+  }
+
+  function init() {
+    if (!formatter) {
+      return;
+    }
+    dom.qsa("time[data-relative-time]").forEach((element) => {
+      const date = new Date(element.getAttribute("datetime") || "");
+      if (Number.isNaN(date.getTime())) {
+        return;
+      }
+      if (!element.title) {
+        element.title = element.textContent.trim();
+      }
+      element.textContent = describe(date);
+    });
+  }
+
+  return { init };
+}
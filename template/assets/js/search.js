@@ -195,15 +195,36 @@ export function createSearchModule({
     return positions;
   }
 
+  function decodeOffsets(encoded) {
+    if (!encoded) {
+      return [];
+    }
+    const offsets = [];
+    let start = 0;
+    encoded.split(".").forEach((part) => {
+      const [delta, length] = part.split("-");
+      start += decodeInt(delta);
+      offsets.push({ start, end: start + decodeInt(length) });
+    });
+    return offsets;
+  }
+
   function decodePosting(entry) {
-    const [docId, titleFreq, summaryFreq, contentFreq, encodedPositions] =
-      entry.split(":");
+    const [
+      docId,
+      titleFreq,
+      summaryFreq,
+      contentFreq,
+      encodedPositions,
+      encodedOffsets,
+    ] = entry.split(":");
     return {
       docId: decodeInt(docId),
       titleFreq: decodeInt(titleFreq),
       summaryFreq: decodeInt(summaryFreq),
       contentFreq: decodeInt(contentFreq),
       positions: decodePositions(encodedPositions || ""),
+      offsets: decodeOffsets(encodedOffsets || ""),
     };
   }
 
@@ -218,10 +239,9 @@ export function createSearchModule({
     if (!encoded) {
       return [];
     }
-    const parts = encoded.split(";");
-    const [header, ...rest] = parts;
-    const expected = decodeInt(header.split(":")[0]);
-    const postings = rest.map(decodePosting);
+    const [header, body = ""] = encoded.split("|");
+    const expected = decodeInt(header);
+    const postings = body ? body.split(";").map(decodePosting) : [];
     if (expected && postings.length !== expected) {
       return postings.slice(0, expected);
     }
@@ -275,10 +295,11 @@ export function createSearchModule({
     if (!rawDocs) {
       return null;
     }
-    const docs = rawDocs.map(([route, title, summary, meta]) => ({
+    const docs = rawDocs.map(([route, title, summary, meta, text]) => ({
       route,
       title,
       summary,
+      text: text ?? "",
       lengths: decodeLengths(meta),
     }));
     const termSource = payload.terms ?? payload.t ?? {};
@@ -353,7 +374,51 @@ export function createSearchModule({
     );
   }
 
-  function buildSnippet(doc, tokens) {
+  function escapeHTML(text) {
+    return text
+      .replace(/&/g, "&amp;")
+      .replace(/</g, "&lt;")
+      .replace(/>/g, "&gt;")
+      .replace(/"/g, "&quot;");
+  }
+
+  // highlightExcerpt cuts a window of text around the first match and wraps
+  // the matches inside it in <mark>. Offsets index the text in UTF-16 code
+  // units, as produced by the index builder.
+  function highlightExcerpt(text, offsets) {
+    const sorted = offsets
+      .filter((span) => span.end <= text.length)
+      .sort((a, b) => a.start - b.start);
+    if (!sorted.length) {
+      return "";
+    }
+    let start = Math.max(sorted[0].start - 40, 0);
+    if (start > 0) {
+      const space = text.lastIndexOf(" ", start);
+      start = space >= 0 && sorted[0].start - space < 60 ? space + 1 : start;
+    }
+    const end = Math.min(start + 160, text.length);
+    let html = start > 0 ? "..." : "";
+    let cursor = start;
+    sorted.forEach((span) => {
+      if (span.start < cursor || span.end > end) {
+        return;
+      }
+      html += escapeHTML(text.slice(cursor, span.start));
+      html += `<mark>${escapeHTML(text.slice(span.start, span.end))}</mark>`;
+      cursor = span.end;
+    });
+    html += escapeHTML(text.slice(cursor, end));
+    return end < text.length ? `${html}...` : html;
+  }
+
+  function buildSnippet(doc, tokens, offsets) {
+    if (doc.text && offsets.length) {
+      const excerpt = highlightExcerpt(doc.text, offsets);
+      if (excerpt) {
+        return excerpt;
+      }
+    }
     const summary = doc.summary ?? "";
     if (!summary) {
       return "";
@@ -364,11 +429,13 @@ export function createSearchModule({
       .filter((pos) => pos >= 0)
       .sort((a, b) => a - b);
     if (!positions.length) {
-      return summary.slice(0, 140);
+      return escapeHTML(summary.slice(0, 140));
     }
     const start = Math.max(positions[0] - 40, 0);
     const end = Math.min(start + 160, summary.length);
-    return `${summary.slice(start, end)}${end < summary.length ? "..." : ""}`;
+    return `${escapeHTML(summary.slice(start, end))}${
+      end < summary.length ? "..." : ""
+    }`;
   }
 
   function expandTokenByPrefix(token, index) {
@@ -399,11 +466,13 @@ export function createSearchModule({
           summary: 0,
           content: 0,
           positions: [],
+          offsets: [],
         };
         bucket.title += posting.titleFreq;
         bucket.summary += posting.summaryFreq;
         bucket.content += posting.contentFreq;
         bucket.positions.push(...posting.positions);
+        bucket.offsets.push(...posting.offsets);
         combined.set(posting.docId, bucket);
       });
     });
@@ -431,7 +500,11 @@ export function createSearchModule({
           return;
         }
         const key = entry.docId;
-        const prev = docScores.get(key) || { score: 0, matches: [] };
+        const prev = docScores.get(key) || {
+          score: 0,
+          matches: [],
+          offsets: [],
+        };
         const idf = computeIDF(entries.length, index.docCount);
         const [titleLen, summaryLen, contentLen] = doc.lengths;
         const score =
@@ -441,7 +514,12 @@ export function createSearchModule({
               bm25(entry.summary, summaryLen, index.avgFieldLengths[1]) +
               bm25(entry.content, contentLen, index.avgFieldLengths[2]));
         prev.matches.push(...entry.positions);
-        docScores.set(key, { score, matches: prev.matches });
+        prev.offsets.push(...entry.offsets);
+        docScores.set(key, {
+          score,
+          matches: prev.matches,
+          offsets: prev.offsets,
+        });
       });
     });
     const scores = Array.from(docScores.entries()).map(([docId, info]) => {
@@ -452,7 +530,7 @@ export function createSearchModule({
       return {
         docId,
         score: info.score + titleBonus * 1.5 + pathBonus + phraseBonus,
-        snippet: buildSnippet(doc, tokens),
+        snippet: buildSnippet(doc, tokens, info.offsets),
       };
     });
     scores.sort((a, b) => b.score - a.score);
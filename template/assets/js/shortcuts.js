@@ -0,0 +1,50 @@
+// Single key shortcuts, bound by runtime.shortcuts (action to key) and
+// ignored while typing or while a modal is open.
+export function createShortcutsModule({ config: runtime, dom, modal }) {
+  function isTyping(target) {
+    if (!target || !(target instanceof Element)) {
+      return false;
+    }
+    return target.isContentEditable || Boolean(target.closest("input, textarea, select"));
+  }
+
+  function actionFor(key) {
+    const bindings = runtime.shortcuts ?? {};
+    return Object.keys(bindings).find((action) => bindings[action] && bindings[action] === key) ?? "";
+  }
+
+  function run(action) {
+    if (action === "search") {
+      const input = dom.qs("#search-box");
+      if (!input) {
+        return false;
+      }
+      input.focus();
+      input.select();
+      return true;
+    }
+    const button = dom.qs(`[data-action="${action}"]`);
+    if (!button || button.disabled || button.hidden) {
+      return false;
+    }
+    button.click();
+    return true;
+  }
+
+  function init() {
+    document.addEventListener("keydown", (event) => {
+      if (event.defaultPrevented || event.ctrlKey || event.metaKey || event.altKey) {
+        return;
+      }
+      if (isTyping(event.target) || modal.isOpen()) {
+        return;
+      }
+      const action = actionFor(event.key);
+      if (action && run(action)) {
+        event.preventDefault();
+      }
+    });
+  }
+
+  return { init };
+}
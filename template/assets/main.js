@@ -1,4 +1,4 @@
-import { createConfig } from "./js/config.js";
+import { createConfig, loadUIConfig } from "./js/config.js";
 import { createDomUtils } from "./js/dom.js";
 import { createHelpers } from "./js/helpers.js";
 import { createApi } from "./js/api.js";
@@ -12,6 +12,10 @@ import { createHistoryModule } from "./js/history.js";
 import { createEditorModule } from "./js/editor.js";
 import { createToolbarModule } from "./js/toolbar.js";
 import { createSidebarModule } from "./js/sidebar.js";
+import { createRelativeTimeModule } from "./js/relative-time.js";
+import { createShortcutsModule } from "./js/shortcuts.js";
+import { createAccountModule } from "./js/account.js";
+import { createChallengeModule } from "./js/challenge.js";
 
 const body = document.body;
 if (!body) {
@@ -33,6 +37,10 @@ const history = createHistoryModule({ config, dom, api, helpers, modal });
 const editor = createEditorModule({ config, dom, api, helpers, modal });
 const toolbar = createToolbarModule({ dom, config, editor, history });
 const sidebarOverlay = createSidebarModule({ dom, modal });
+const relativeTime = createRelativeTimeModule(dom);
+const shortcuts = createShortcutsModule({ config, dom, modal });
+const account = createAccountModule({ config, dom, api });
+const challenge = createChallengeModule({ dom, api, modal });
 
 modal.init();
 externalLinks.init();
@@ -44,3 +52,9 @@ history.init();
 editor.init();
 toolbar.init();
 sidebarOverlay.init();
+relativeTime.init();
+challenge.init();
+loadUIConfig(config, api).then(() => {
+  shortcuts.init();
+  account.init();
+});